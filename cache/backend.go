@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	_ Backend = (*Redis)(nil)
+	_ Backend = (*Memory)(nil)
+)
+
+// Backend is the set storage used to cache effective permissions of users
+type Backend interface {
+	SAddContext(ctx context.Context, key string, members ...string) error
+	SRemContext(ctx context.Context, key string, members ...string) error
+	SMembersContext(ctx context.Context, key string) ([]string, error)
+	SIsMembersContext(ctx context.Context, key, value string) (bool, error)
+	ExistsContext(ctx context.Context, key string) (bool, error)
+	DelContext(ctx context.Context, keys ...string) (bool, error)
+	// ExpireAtContext remove key at specified time, a key created again afterwards doesn't expire
+	ExpireAtContext(ctx context.Context, key string, at time.Time) error
+	FlushDBContext(ctx context.Context) error
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/nzqpeace/rbac/db"
+)
+
+// DelegatedRoles list roles delegated to uid which are in effect now, i.e. within period of their delegation
+// and still held by their delegator. roles may be listed more than once
+func (dao *PermissionDao) DelegatedRoles(system, uid string) ([]string, error) {
+	return dao.DelegatedRolesContext(context.Background(), system, uid)
+}
+
+// DelegatedRolesContext is DelegatedRoles with context
+func (dao *PermissionDao) DelegatedRolesContext(ctx context.Context, system, uid string) (roles []string, err error) {
+	roles, _, err = dao.receivedContext(ctx, system, uid, time.Now(), false, set.NewSet())
+	return
+}
+
+// DelegableRoles list roles uid may delegate now, i.e. roles assigned to it directly and roles delegated to it
+// transitively. roles of its groups can't be delegated
+func (dao *PermissionDao) DelegableRoles(system, uid string) ([]string, error) {
+	return dao.DelegableRolesContext(context.Background(), system, uid)
+}
+
+// DelegableRolesContext is DelegableRoles with context
+func (dao *PermissionDao) DelegableRolesContext(ctx context.Context, system, uid string) (roles []string, err error) {
+	roles, _, err = dao.delegableContext(ctx, system, uid, time.Now(), set.NewSet())
+	return
+}
+
+// delegableContext return roles uid may delegate at now, next is the earliest time after now they may change.
+// path holds delegators already on the chain, so cycles of delegations end there
+func (dao *PermissionDao) delegableContext(ctx context.Context, system, uid string, now time.Time, path set.Set) (roles []string, next *time.Time, err error) {
+	u, err := dao.user.GetUserPermModelContext(ctx, system, uid)
+	if err == nil {
+		next = u.NextChange(now)
+		roles = append(roles, u.EffectiveAt(now).Roles...)
+	} else if err != db.ErrNotFound {
+		return nil, nil, err
+	}
+
+	received, n, err := dao.receivedContext(ctx, system, uid, now, true, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(roles, received...), earliest(next, n), nil
+}
+
+// receivedContext return roles delegated to uid at now which their delegators may delegate, only those of
+// transitive delegations if transitive. next is the earliest time after now they may change
+func (dao *PermissionDao) receivedContext(ctx context.Context, system, uid string, now time.Time, transitive bool, path set.Set) (roles []string, next *time.Time, err error) {
+	ds, err := dao.delegation.GetDelegationsToContext(ctx, system, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path.Add(uid)
+	defer path.Remove(uid)
+	for _, d := range ds {
+		if (transitive && !d.Transitive) || path.Contains(d.Delegator) {
+			continue
+		}
+		next = earliest(next, d.NextChange(now))
+		if !d.ActiveAt(now) {
+			continue
+		}
+
+		held, n, err := dao.delegableContext(ctx, system, d.Delegator, now, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		next = earliest(next, n)
+		for _, role := range d.Roles {
+			if contains(held, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return
+}
+
+// earliest return the earlier one of a and b, nil means never
+func earliest(a, b *time.Time) *time.Time {
+	if a == nil || b != nil && b.Before(*a) {
+		return b
+	}
+	return a
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
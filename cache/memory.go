@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process Backend, it behaves like redis sets: a set is removed
+// as soon as its last member is removed or its deadline has passed
+type Memory struct {
+	mu        sync.RWMutex
+	sets      map[string]map[string]struct{}
+	deadlines map[string]time.Time
+}
+
+// NewMemory create an empty memory backend
+func NewMemory() *Memory {
+	return &Memory{
+		sets:      make(map[string]map[string]struct{}),
+		deadlines: make(map[string]time.Time),
+	}
+}
+
+// set return set of key, nil if it doesn't exist or has expired, the caller must hold the lock
+func (m *Memory) set(key string) map[string]struct{} {
+	if d, ok := m.deadlines[key]; ok && !time.Now().Before(d) {
+		return nil
+	}
+	return m.sets[key]
+}
+
+// purge remove key if it has expired, the caller must hold the write lock
+func (m *Memory) purge(key string) {
+	if m.set(key) == nil {
+		delete(m.sets, key)
+		delete(m.deadlines, key)
+	}
+}
+
+// SAddContext add members into set
+func (m *Memory) SAddContext(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purge(key)
+	set, ok := m.sets[key]
+	if !ok {
+		set = make(map[string]struct{})
+		m.sets[key] = set
+	}
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+	return nil
+}
+
+// SRemContext remove members from set
+func (m *Memory) SRemContext(ctx context.Context, key string, members ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purge(key)
+	set, ok := m.sets[key]
+	if !ok {
+		return nil
+	}
+	for _, member := range members {
+		delete(set, member)
+	}
+	if len(set) == 0 {
+		delete(m.sets, key)
+		delete(m.deadlines, key)
+	}
+	return nil
+}
+
+// SMembersContext list all members at specified set
+func (m *Memory) SMembersContext(ctx context.Context, key string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := []string{}
+	for member := range m.set(key) {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// SIsMembersContext check whether a member of specified set
+func (m *Memory) SIsMembersContext(ctx context.Context, key, value string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.set(key)[value]
+	return ok, nil
+}
+
+// ExistsContext check whether specified set exist
+func (m *Memory) ExistsContext(ctx context.Context, key string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.set(key) != nil, nil
+}
+
+// DelContext delete specified keys, return true if any of them existed
+func (m *Memory) DelContext(ctx context.Context, keys ...string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := false
+	for _, key := range keys {
+		if m.set(key) != nil {
+			deleted = true
+		}
+		delete(m.sets, key)
+		delete(m.deadlines, key)
+	}
+	return deleted, nil
+}
+
+// FlushDBContext remove all keys
+func (m *Memory) FlushDBContext(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sets = make(map[string]map[string]struct{})
+	m.deadlines = make(map[string]time.Time)
+	return nil
+}
+
+// ExpireAtContext remove set at specified time, it's ignored if set doesn't exist
+func (m *Memory) ExpireAtContext(ctx context.Context, key string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purge(key)
+	if _, ok := m.sets[key]; ok {
+		m.deadlines[key] = at
+	}
+	return nil
+}
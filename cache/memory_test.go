@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySet(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	key := "Project"
+	assert.Nil(t, m.SAddContext(ctx, key, "Cowshed0", "Cowshed1"))
+
+	exist, err := m.SIsMembersContext(ctx, key, "Cowshed0")
+	assert.Nil(t, err)
+	assert.True(t, exist)
+
+	// check members
+	members, err := m.SMembersContext(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(members))
+
+	exist, err = m.SIsMembersContext(ctx, key, "NotExist")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	// set is removed with its last member
+	assert.Nil(t, m.SRemContext(ctx, key, "Cowshed0", "Cowshed1"))
+	exist, err = m.ExistsContext(ctx, key)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	// delete
+	assert.Nil(t, m.SAddContext(ctx, key, "Cowshed0"))
+	deleted, err := m.DelContext(ctx, key, "NotExist")
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = m.DelContext(ctx, key)
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+}
+
+func TestMemoryExpire(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	key := "Project"
+	assert.Nil(t, m.SAddContext(ctx, key, "Cowshed0"))
+	assert.Nil(t, m.ExpireAtContext(ctx, key, time.Now().Add(time.Hour)))
+	exist, err := m.ExistsContext(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, exist)
+
+	// expired set behaves like a missing one
+	assert.Nil(t, m.ExpireAtContext(ctx, key, time.Now()))
+	exist, err = m.SIsMembersContext(ctx, key, "Cowshed0")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	members, err := m.SMembersContext(ctx, key)
+	assert.Nil(t, err)
+	assert.Empty(t, members)
+
+	// set created again doesn't expire
+	assert.Nil(t, m.SAddContext(ctx, key, "Cowshed1"))
+	members, err = m.SMembersContext(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Cowshed1"}, members)
+
+	// missing sets are ignored
+	assert.Nil(t, m.ExpireAtContext(ctx, "NotExist", time.Now()))
+	exist, err = m.ExistsContext(ctx, "NotExist")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
@@ -1,92 +1,678 @@
 package cache
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	set "github.com/deckarep/golang-set"
 	"github.com/nzqpeace/rbac/db"
 	"github.com/nzqpeace/rbac/model"
 )
 
-const redisKeyFormatPermissions = "%s_%s_permissions" // {system}_{uid}_permissions
+const (
+	redisKeyFormatPermissions        = "%s_%s_permissions" // {system}_{uid}_permissions
+	redisKeyFormatWildcards          = "%s_%s_wildcards"   // {system}_{uid}_wildcards
+	redisKeyFormatResources          = "%s_%s_resources"   // {system}_{uid}_resources
+	redisKeyFormatConditions         = "%s_%s_conditions"  // {system}_{uid}_conditions
+	redisKeyFormatDomains            = "%s_%s_domains"     // {system}_{uid}_domains
+	redisKeyFormatUnknown            = "%s_%s_unknown"     // {system}_{uid}_unknown
+	redisKeyFormatSessions           = "%s_%s_sessions"    // {system}_{uid}_sessions
+	redisKeyFormatSessionPermissions = "%s_%s_session_%s"  // {system}_{uid}_session_{id}
 
-// PermissionDao is permission dao
+	// domainSeparator separate key of user from domain its permissions are cached for
+	domainSeparator = "@"
+
+	// denyPrefix mark entries of blacklist at wildcards and resources set
+	denyPrefix = "!"
+
+	// DefaultNegativeTTL is how long users found to be unknown are remembered by default
+	DefaultNegativeTTL = time.Minute
+)
+
+// PermissionDao is permission dao, effective permissions of each user are cached at a set, wildcards
+// granted to user are also cached at another set together with denied ones, i.e. blacklist and permissions
+// denied by roles, which is only consulted when a permission isn't found at the first one. grants on
+// resources are cached at a third set as `permission@type/id` together with denied ones too. conditional
+// permissions of roles are cached at a fourth set as json with denied ones, they're only consulted when
+// attributes of a request are given. permissions within a domain are cached at the same sets suffixed by
+// `@{domain}`, domains cached for user are tracked at another set so they're removed together. the permissions
+// set always holds the empty member once loaded, so users without permissions are cached too.
+// users which are neither registered nor members of any group get default roles of their system, if it has
+// none they're remembered as unknown at another set for NegativeTTL, so checking them doesn't hit the store.
+// roles delegated to user count as its own while in effect. permissions of sessions are cached at a set per
+// session together with denied ones, sessions cached for user are tracked like domains
 type PermissionDao struct {
-	*Redis
-	role *db.RoleDao
-	user *db.UserDao
+	Backend
+	permission db.PermissionStore
+	role       db.RoleStore
+	user       db.UserStore
+	group      db.GroupStore
+	system     db.SystemStore
+	delegation db.DelegationStore
+
+	// NegativeTTL is how long unknown users are remembered, they aren't if it's not positive
+	NegativeTTL time.Duration
+	// Register store user registered automatically with default roles of its system unless it exists already,
+	// e.g. after checking constraints of roles. user is inserted into store directly if it's nil
+	Register func(ctx context.Context, u *model.UserPermModel) error
+	// Authorized return roles user may activate within a session, active roles it may not activate don't count.
+	// all active roles count if it's nil
+	Authorized func(ctx context.Context, system, uid string) ([]string, error)
 }
 
-// NewPermissionDao create a new permission dao
-func NewPermissionDao(r *Redis, mgo *db.DataBase) *PermissionDao {
+// NewPermissionDao create a new permission dao which cache permissions at backend,
+// roles, users, groups, systems and delegations are loaded from specified store
+func NewPermissionDao(backend Backend, store db.Store) *PermissionDao {
 	return &PermissionDao{
-		r,
-		db.NewRoleDao(mgo),
-		db.NewUserDao(mgo),
+		Backend:     backend,
+		permission:  store.Permissions(),
+		role:        store.Roles(),
+		user:        store.Users(),
+		group:       store.Groups(),
+		system:      store.Systems(),
+		delegation:  store.Delegations(),
+		NegativeTTL: DefaultNegativeTTL,
 	}
 }
 
 // Permissions list all permissions of specified system
-func (dao *PermissionDao) Permissions(system, uid string) (ps []string, err error) {
+func (dao *PermissionDao) Permissions(system, uid string) ([]string, error) {
+	return dao.PermissionsContext(context.Background(), system, uid)
+}
+
+// PermissionsContext is Permissions with context
+func (dao *PermissionDao) PermissionsContext(ctx context.Context, system, uid string) (ps []string, err error) {
 	key := fmt.Sprintf(redisKeyFormatPermissions, system, uid)
-	return dao.SMembers(key)
+	members, err := dao.SMembersContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	ps = []string{}
+	for _, m := range members {
+		if m != "" {
+			ps = append(ps, m)
+		}
+	}
+	return ps, nil
 }
 
 // IsPermit check if have specified permission
-func (dao *PermissionDao) IsPermit(system, uid string, permission string) (permit bool, err error) {
-	key := fmt.Sprintf(redisKeyFormatPermissions, system, uid)
-	permit, err = dao.SIsMembers(key, permission)
+func (dao *PermissionDao) IsPermit(system, uid string, permission string) (bool, error) {
+	return dao.IsPermitContext(context.Background(), system, uid, permission)
+}
+
+// IsPermitContext is IsPermit with context
+func (dao *PermissionDao) IsPermitContext(ctx context.Context, system, uid string, permission string) (permit bool, err error) {
+	return dao.isPermitContext(ctx, system, uid, "", permission)
+}
+
+// IsPermitInDomain check if have specified permission within domain, roles, whitelist and blacklist of
+// user within domain apply together with its global ones. an empty domain is the same as IsPermit
+func (dao *PermissionDao) IsPermitInDomain(system, uid, domain string, permission string) (bool, error) {
+	return dao.IsPermitInDomainContext(context.Background(), system, uid, domain, permission)
+}
+
+// IsPermitInDomainContext is IsPermitInDomain with context
+func (dao *PermissionDao) IsPermitInDomainContext(ctx context.Context, system, uid, domain string, permission string) (bool, error) {
+	return dao.isPermitContext(ctx, system, uid, domain, permission)
+}
+
+// domainKey format key of user for permissions within domain
+func domainKey(format, system, uid, domain string) string {
+	key := fmt.Sprintf(format, system, uid)
+	if domain != "" {
+		key += domainSeparator + domain
+	}
+	return key
+}
+
+// knownDomainContext report whether user holds any entry within domain, domains of user are cached whenever its
+// permissions are reloaded
+func (dao *PermissionDao) knownDomainContext(ctx context.Context, system, uid, domain string) (bool, error) {
+	dkey := fmt.Sprintf(redisKeyFormatDomains, system, uid)
+	domains, err := dao.SMembersContext(ctx, dkey)
+	if err != nil {
+		return false, err
+	}
+
+	if len(domains) == 0 { // not loaded yet, unknown users have no domains
+		ukey := fmt.Sprintf(redisKeyFormatUnknown, system, uid)
+		if unknown, err := dao.ExistsContext(ctx, ukey); err != nil || unknown {
+			return false, err
+		}
+		if err = dao.reloadContext(ctx, system, uid, ""); err == db.ErrNotFound {
+			return false, dao.markUnknownContext(ctx, ukey, uid)
+		} else if err != nil {
+			return false, err
+		}
+		if domains, err = dao.SMembersContext(ctx, dkey); err != nil {
+			return false, err
+		}
+	}
+	return contains(domains, domain), nil
+}
+
+// isPermitContext check if have specified permission within domain. a domain in which user holds no entry is
+// checked like the global one, so checks of arbitrary domains don't add keys to cache
+func (dao *PermissionDao) isPermitContext(ctx context.Context, system, uid, domain string, permission string) (permit bool, err error) {
+	if domain != "" {
+		known, err := dao.knownDomainContext(ctx, system, uid, domain)
+		if err != nil {
+			return false, err
+		}
+		if !known {
+			domain = ""
+		}
+	}
+
+	// the empty member only marks permissions as loaded
+	if permission == "" {
+		return false, nil
+	}
+	key := domainKey(redisKeyFormatPermissions, system, uid, domain)
+	permit, err = dao.SIsMembersContext(ctx, key, permission)
 	if err != nil {
 		return
 	}
 	// check whether specified key exist when `exist` is false
 	if !permit {
-		exist, err := dao.Exists(key)
+		exist, err := dao.ExistsContext(ctx, key)
 		if err != nil {
 			return permit, err
 		}
 
-		if !exist { // reload from mongo when specified key is not in cache
-			err = dao.ReloadPermissions(system, uid)
-			return dao.SIsMembers(key, permission)
+		if !exist { // reload from store when specified key is not in cache, unknown users have no permission
+			ukey := fmt.Sprintf(redisKeyFormatUnknown, system, uid)
+			if unknown, err := dao.ExistsContext(ctx, ukey); err != nil || unknown {
+				return false, err
+			}
+			if err = dao.reloadContext(ctx, system, uid, domain); err == db.ErrNotFound {
+				return false, dao.markUnknownContext(ctx, ukey, uid)
+			} else if err != nil {
+				return false, err
+			}
+			if permit, err = dao.SIsMembersContext(ctx, key, permission); err != nil || permit {
+				return permit, err
+			}
 		}
+		return dao.matchWildcardsContext(ctx, domainKey(redisKeyFormatWildcards, system, uid, domain), permission)
 	}
 	return
 }
 
+// matchWildcardsContext check permission against wildcards cached at key, blacklist always wins
+func (dao *PermissionDao) matchWildcardsContext(ctx context.Context, key string, permission string) (bool, error) {
+	members, err := dao.SMembersContext(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return matchMembers(members, permission), nil
+}
+
+// matchMembers check permission against members of a set holding permissions together with denied ones,
+// the latter always win. the empty member only marks a set as loaded
+func matchMembers(members []string, permission string) bool {
+	permit := false
+	for _, m := range members {
+		if strings.HasPrefix(m, denyPrefix) {
+			if model.MatchPermission(strings.TrimPrefix(m, denyPrefix), permission) {
+				return false
+			}
+		} else if m != "" && model.MatchPermission(m, permission) {
+			permit = true
+		}
+	}
+	return permit
+}
+
+// IsPermitOn check if have specified permission on resource, which is permitted by either
+// an unscoped permission or a grant covering resource
+func (dao *PermissionDao) IsPermitOn(system, uid string, permission string, resource model.Resource) (bool, error) {
+	return dao.IsPermitOnContext(context.Background(), system, uid, permission, resource)
+}
+
+// IsPermitOnContext is IsPermitOn with context
+func (dao *PermissionDao) IsPermitOnContext(ctx context.Context, system, uid string, permission string, resource model.Resource) (permit bool, err error) {
+	// reload from store if necessary
+	if permit, err = dao.IsPermitContext(ctx, system, uid, permission); err != nil || permit {
+		return
+	}
+
+	key := fmt.Sprintf(redisKeyFormatResources, system, uid)
+	if permit, err = dao.SIsMembersContext(ctx, key, scopedMember(model.Grant{Permission: permission, Resource: resource})); err != nil || permit {
+		return
+	}
+
+	// fall back to grants with wildcards or id patterns
+	members, err := dao.SMembersContext(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range members {
+		if strings.HasPrefix(m, denyPrefix) {
+			if model.MatchPermission(strings.TrimPrefix(m, denyPrefix), permission) {
+				return false, nil
+			}
+		} else if g, ok := parseScopedMember(m); ok && g.Covers(permission, resource) {
+			permit = true
+		}
+	}
+	return permit, nil
+}
+
+// IsPermitWithAttrs check if have specified permission, either unconditionally or through a condition
+// satisfied by attrs. conditions which can't be evaluated against attrs don't permit
+func (dao *PermissionDao) IsPermitWithAttrs(system, uid string, permission string, attrs map[string]interface{}) (bool, error) {
+	return dao.IsPermitWithAttrsContext(context.Background(), system, uid, permission, attrs)
+}
+
+// IsPermitWithAttrsContext is IsPermitWithAttrs with context
+func (dao *PermissionDao) IsPermitWithAttrsContext(ctx context.Context, system, uid string, permission string, attrs map[string]interface{}) (permit bool, err error) {
+	// unconditional permissions are checked first, it reloads from store if necessary
+	if permit, err = dao.IsPermitContext(ctx, system, uid, permission); err != nil || permit {
+		return
+	}
+
+	key := fmt.Sprintf(redisKeyFormatConditions, system, uid)
+	members, err := dao.SMembersContext(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	var conditions []model.Condition
+	for _, m := range members {
+		if strings.HasPrefix(m, denyPrefix) {
+			if model.MatchPermission(strings.TrimPrefix(m, denyPrefix), permission) {
+				return false, nil
+			}
+			continue
+		}
+
+		var c model.Condition
+		if json.Unmarshal([]byte(m), &c) == nil && c.Covers(permission) {
+			conditions = append(conditions, c)
+		}
+	}
+	for _, c := range conditions {
+		if ok, err := c.Eval(attrs); err == nil && ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsPermitWithRoles check if have specified permission through whitelist of user and roles only, roles
+// aren't checked against those assigned to user. blacklist of user and permissions denied by roles still
+// win. it's computed from store on each call instead of being cached
+func (dao *PermissionDao) IsPermitWithRoles(system, uid string, permission string, roles []string) (bool, error) {
+	return dao.IsPermitWithRolesContext(context.Background(), system, uid, permission, roles)
+}
+
+// IsPermitWithRolesContext is IsPermitWithRoles with context
+func (dao *PermissionDao) IsPermitWithRolesContext(ctx context.Context, system, uid string, permission string, roles []string) (bool, error) {
+	u, err := dao.user.GetUserPermModelContext(ctx, system, uid)
+	if err == db.ErrNotFound {
+		u, err = *model.NewUserPermModel(system, uid), nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	u = u.EffectiveAt(time.Now())
+	permissions, _, denied, err := dao.resolveContext(ctx, &u, roles)
+	if err != nil || matchAny(denied, permission) {
+		return false, err
+	}
+	return matchAny(permissions, permission), nil
+}
+
+// IsPermitInSession check if user of session has specified permission through roles active within session,
+// whitelist and blacklist of user still apply. permissions are cached for session until it expires or they change
+func (dao *PermissionDao) IsPermitInSession(session model.Session, permission string) (bool, error) {
+	return dao.IsPermitInSessionContext(context.Background(), session, permission)
+}
+
+// IsPermitInSessionContext is IsPermitInSession with context
+func (dao *PermissionDao) IsPermitInSessionContext(ctx context.Context, session model.Session, permission string) (bool, error) {
+	key := fmt.Sprintf(redisKeyFormatSessionPermissions, session.System, session.UID, session.ID)
+	members, err := dao.SMembersContext(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if len(members) == 0 {
+		if members, err = dao.reloadSessionContext(ctx, session); err != nil {
+			return false, err
+		}
+	}
+	return matchMembers(members, permission), nil
+}
+
+// reloadSessionContext resolve permissions of user of session through roles active within session and cache them
+// together with denied ones, the empty member marks them as loaded. they expire with session or when effective
+// entries or delegations of user change
+func (dao *PermissionDao) reloadSessionContext(ctx context.Context, session model.Session) ([]string, error) {
+	u, err := dao.user.GetUserPermModelContext(ctx, session.System, session.UID)
+	if err == db.ErrNotFound {
+		u, err = *model.NewUserPermModel(session.System, session.UID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	active := session.Roles
+	if dao.Authorized != nil {
+		authorized, err := dao.Authorized(ctx, session.System, session.UID)
+		if err != nil {
+			return nil, err
+		}
+		active = []string{}
+		for _, role := range session.Roles {
+			if contains(authorized, role) {
+				active = append(active, role)
+			}
+		}
+	}
+
+	now := time.Now()
+	next := earliest(u.NextChange(now), &session.ExpiresAt)
+	u = u.EffectiveAt(now)
+	_, n, err := dao.rolesContext(ctx, &u, now)
+	if err != nil {
+		return nil, err
+	}
+	next = earliest(next, n)
+	permissions, _, denied, err := dao.resolveContext(ctx, &u, active)
+	if err != nil {
+		return nil, err
+	}
+
+	members := append([]string{""}, permissions...)
+	for _, p := range denied {
+		members = append(members, denyPrefix+p)
+	}
+
+	// session is tracked first, so its key is removed together with those of user
+	if err = dao.SAddContext(ctx, fmt.Sprintf(redisKeyFormatSessions, session.System, session.UID), session.ID); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf(redisKeyFormatSessionPermissions, session.System, session.UID, session.ID)
+	if err = dao.SAddContext(ctx, key, members...); err != nil {
+		return nil, err
+	}
+	return members, dao.ExpireAtContext(ctx, key, *next)
+}
+
+// RemoveSession drop permissions cached for session, e.g. when its active roles change
+func (dao *PermissionDao) RemoveSession(session model.Session) (bool, error) {
+	return dao.RemoveSessionContext(context.Background(), session)
+}
+
+// RemoveSessionContext is RemoveSession with context
+func (dao *PermissionDao) RemoveSessionContext(ctx context.Context, session model.Session) (bool, error) {
+	return dao.DelContext(ctx, fmt.Sprintf(redisKeyFormatSessionPermissions, session.System, session.UID, session.ID))
+}
+
+// scopedMember format grant as member of resources set
+func scopedMember(g model.Grant) string {
+	return g.Permission + "@" + g.Resource.String()
+}
+
+// parseScopedMember parse member of resources set formatted by scopedMember
+func parseScopedMember(m string) (model.Grant, bool) {
+	i := strings.Index(m, "@")
+	if i < 0 {
+		return model.Grant{}, false
+	}
+	r, err := model.ParseResource(m[i+1:])
+	return model.Grant{Permission: m[:i], Resource: r}, err == nil
+}
+
 // RemovePermissions remove specified permissions
 func (dao *PermissionDao) RemovePermissions(system, uid string, names ...string) error {
+	return dao.RemovePermissionsContext(context.Background(), system, uid, names...)
+}
+
+// RemovePermissionsContext is RemovePermissions with context
+func (dao *PermissionDao) RemovePermissionsContext(ctx context.Context, system, uid string, names ...string) error {
 	key := fmt.Sprintf(redisKeyFormatPermissions, system, uid)
-	return dao.SRem(key, names...)
+	return dao.SRemContext(ctx, key, names...)
 }
 
 // AddPermissions add specified permissions
 func (dao *PermissionDao) AddPermissions(system, uid string, names ...string) error {
+	return dao.AddPermissionsContext(context.Background(), system, uid, names...)
+}
+
+// AddPermissionsContext is AddPermissions with context
+func (dao *PermissionDao) AddPermissionsContext(ctx context.Context, system, uid string, names ...string) error {
 	key := fmt.Sprintf(redisKeyFormatPermissions, system, uid)
-	return dao.SAdd(key, names...)
+	return dao.SAddContext(ctx, key, names...)
 }
 
-// ReloadPermissions reload permissions from mongo
+// ReloadPermissions reload permissions from store
 func (dao *PermissionDao) ReloadPermissions(system, uid string) error {
-	key := fmt.Sprintf(redisKeyFormatPermissions, system, uid)
-	_, err := dao.Del(key)
+	return dao.ReloadPermissionsContext(context.Background(), system, uid)
+}
+
+// ReloadPermissionsContext is ReloadPermissions with context
+func (dao *PermissionDao) ReloadPermissionsContext(ctx context.Context, system, uid string) error {
+	return dao.reloadContext(ctx, system, uid, "")
+}
+
+// reloadContext reload permissions within domain from store
+func (dao *PermissionDao) reloadContext(ctx context.Context, system, uid, domain string) error {
+	key := domainKey(redisKeyFormatPermissions, system, uid, domain)
+	wkey := domainKey(redisKeyFormatWildcards, system, uid, domain)
+	rkey := domainKey(redisKeyFormatResources, system, uid, domain)
+	ckey := domainKey(redisKeyFormatConditions, system, uid, domain)
+	_, err := dao.DelContext(ctx, key, wkey, rkey, ckey)
+	if err != nil {
+		return err
+	}
+
+	// reload from store, members of groups needn't be registered as users
+	userPermModel, err := dao.user.GetUserPermModelContext(ctx, system, uid)
+	if err == db.ErrNotFound {
+		userPermModel, err = dao.unregisteredContext(ctx, system, uid)
+	}
 	if err != nil {
 		return err
 	}
+	domains := userPermModel.Domains()
 
-	// reload from mongo
-	userPermModel, err := dao.user.GetUserPermModel(system, uid)
+	// entries outside their windows are left out, cached sets expire when the effective entries or delegations change
+	now := time.Now()
+	next := userPermModel.NextChange(now)
+	userPermModel = userPermModel.EffectiveAt(now).InDomain(domain)
+	roles, n, err := dao.rolesContext(ctx, &userPermModel, now)
+	if err != nil {
+		return err
+	}
+	next = earliest(next, n)
+	permissions, conditions, denied, err := dao.resolveContext(ctx, &userPermModel, roles)
 	if err != nil {
 		return err
 	}
 
-	permissions := dao.GetPermissions(&userPermModel)
+	// domains are tracked first, so their keys are removed together with those of user. the empty one marks them
+	// as loaded
+	if err = dao.SAddContext(ctx, fmt.Sprintf(redisKeyFormatDomains, system, uid), append([]string{"", domain}, domains...)...); err != nil {
+		return err
+	}
+
+	// wildcards, grants and conditions are stored first, so they're complete once permissions exist
+	var conditional []string
+	for _, c := range conditions {
+		if matchAny(denied, c.Permission) {
+			continue
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		conditional = append(conditional, string(b))
+	}
+	if len(conditional) > 0 {
+		for _, p := range denied {
+			conditional = append(conditional, denyPrefix+p)
+		}
+		if err = dao.SAddContext(ctx, ckey, conditional...); err != nil {
+			return err
+		}
+	}
+
+	var scoped []string
+	for _, g := range userPermModel.Grants {
+		if !matchAny(denied, g.Permission) {
+			scoped = append(scoped, scopedMember(g))
+		}
+	}
+	if len(scoped) > 0 {
+		for _, p := range denied {
+			scoped = append(scoped, denyPrefix+p)
+		}
+		if err = dao.SAddContext(ctx, rkey, scoped...); err != nil {
+			return err
+		}
+	}
 
-	// store permissions into redis
-	return dao.SAdd(key, permissions...)
+	var wildcards []string
+	for _, p := range permissions {
+		if model.IsWildcard(p) {
+			wildcards = append(wildcards, p)
+		}
+	}
+	if len(wildcards) > 0 {
+		for _, p := range denied {
+			wildcards = append(wildcards, denyPrefix+p)
+		}
+		if err = dao.SAddContext(ctx, wkey, wildcards...); err != nil {
+			return err
+		}
+	}
+
+	// store permissions into redis, the empty member marks them as loaded even if user has none
+	if err = dao.SAddContext(ctx, key, append([]string{""}, permissions...)...); err != nil || next == nil {
+		return err
+	}
+	for _, k := range []string{ckey, rkey, wkey, key} {
+		if err = dao.ExpireAtContext(ctx, k, *next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unregisteredContext build user which isn't registered with default roles of its system, it's registered with them
+// if system auto register users. db.ErrNotFound is returned if user gets neither default roles, roles of groups
+// nor delegated roles
+func (dao *PermissionDao) unregisteredContext(ctx context.Context, system, uid string) (model.UserPermModel, error) {
+	s, err := dao.system.GetSystemContext(ctx, system)
+	if err != nil && err != db.ErrNotFound {
+		return model.UserPermModel{}, err
+	}
+
+	u := model.NewUserPermModel(system, uid, s.DefaultRoles...)
+	if s.AutoRegister {
+		p := model.Provenance{GrantedAt: time.Now(), Reason: "default roles of system"}
+		if err = u.SetProvenance(model.ListRoles, p, s.DefaultRoles...); err != nil {
+			return model.UserPermModel{}, err
+		}
+		if dao.Register != nil {
+			err = dao.Register(ctx, u)
+		} else {
+			err = dao.user.InsertUserPermModelContext(ctx, u)
+		}
+		if err == db.ErrAlreadyExists { // registered meanwhile, its roles are kept
+			return dao.user.GetUserPermModelContext(ctx, system, uid)
+		}
+		return *u, err
+	}
+	if len(s.DefaultRoles) > 0 {
+		return *u, nil
+	}
+
+	groups, err := dao.group.GetGroupsOfUserContext(ctx, system, uid)
+	if err != nil {
+		return model.UserPermModel{}, err
+	}
+	if len(groups) > 0 {
+		return *u, nil
+	}
+
+	ds, err := dao.delegation.GetDelegationsToContext(ctx, system, uid)
+	if err != nil {
+		return model.UserPermModel{}, err
+	}
+	if len(ds) == 0 {
+		return model.UserPermModel{}, db.ErrNotFound
+	}
+	return *u, nil
+}
+
+// markUnknownContext remember uid as unknown at key for NegativeTTL
+func (dao *PermissionDao) markUnknownContext(ctx context.Context, key, uid string) error {
+	if dao.NegativeTTL <= 0 {
+		return nil
+	}
+	if err := dao.SAddContext(ctx, key, uid); err != nil {
+		return err
+	}
+	return dao.ExpireAtContext(ctx, key, time.Now().Add(dao.NegativeTTL))
 }
 
-func (dao *PermissionDao) GetPermissions(u *model.UserPermModel) (permissions []string) {
+func (dao *PermissionDao) GetPermissions(u *model.UserPermModel) []string {
+	permissions, _ := dao.GetPermissionsContext(context.Background(), u)
+	return permissions
+}
+
+// GetPermissionsContext compute effective permissions of user, entries of user outside their windows are ignored.
+// roles are those of user, all groups it belongs to and delegated to it, permissions of roles are inherited from all their ancestors, roles which don't exist are ignored. wildcards are kept and expanded to all
+// registered permissions they match. deny beats allow: permissions matched by blacklist of user or denied by any of
+// the roles are removed, whichever role or whitelist grants them. conditional permissions aren't included
+func (dao *PermissionDao) GetPermissionsContext(ctx context.Context, u *model.UserPermModel) (permissions []string, err error) {
+	permissions, _, _, err = dao.effectiveContext(ctx, u)
+	return
+}
+
+// effectiveContext compute effective permissions of user as GetPermissionsContext, together with conditions of all
+// its roles and the denied patterns, which are blacklist of user followed by permissions denied by roles
+func (dao *PermissionDao) effectiveContext(ctx context.Context, u *model.UserPermModel) (permissions []string, conditions []model.Condition, denied []string, err error) {
+	now := time.Now()
+	effective := u.EffectiveAt(now)
+	u = &effective
+
+	roles, _, err := dao.rolesContext(ctx, u, now)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return dao.resolveContext(ctx, u, roles)
+}
+
+// rolesContext return roles of effective user u, its groups and delegated to it at now, next is the earliest time
+// after now delegated roles may change
+func (dao *PermissionDao) rolesContext(ctx context.Context, u *model.UserPermModel, now time.Time) (roles []string, next *time.Time, err error) {
+	groups, err := dao.group.GetGroupsOfUserContext(ctx, u.System, u.UID)
+	if err != nil {
+		return nil, nil, err
+	}
+	roles = append([]string{}, u.Roles...)
+	for _, g := range groups {
+		roles = append(roles, g.Roles...)
+	}
+
+	delegated, next, err := dao.receivedContext(ctx, u.System, u.UID, now, false, set.NewSet())
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(roles, delegated...), next, nil
+}
+
+// resolveContext compute effective permissions of user as effectiveContext, but through specified roles
+// instead of those assigned to user and its groups
+func (dao *PermissionDao) resolveContext(ctx context.Context, u *model.UserPermModel, roles []string) (permissions []string, conditions []model.Condition, denied []string, err error) {
 	pset := set.NewSet()
 	// generate permission list
 	// 1. add permissions at whitelist
@@ -94,35 +680,134 @@ func (dao *PermissionDao) GetPermissions(u *model.UserPermModel) (permissions []
 		pset.Add(p)
 	}
 
-	// 2. add permissions permited throught role
-	for _, role := range u.Roles {
+	// 2. add permissions permited throught roles and their ancestors,
+	// each role is visited once so that cycles can't trap the walk
+	visited, dset := set.NewSet(), set.NewSet()
+	queue := append([]string{}, roles...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if !visited.Add(name) {
+			continue
+		}
+
 		// fetch each role's permissions
-		ps, err := dao.role.GetPermissions(u.System, role)
-		if err != nil {
+		role, err := dao.role.GetRoleContext(ctx, u.System, name)
+		if err == db.ErrNotFound {
 			continue
+		} else if err != nil {
+			return nil, nil, nil, err
 		}
 
-		for _, p := range ps {
+		for _, p := range role.Permissions {
 			pset.Add(p)
 		}
+		conditions = append(conditions, role.Conditions...)
+		for _, p := range role.Denied {
+			dset.Add(p)
+		}
+		queue = append(queue, role.Parents...)
 	}
 
-	// 3. remove permissions at blacklist
-	for _, p := range u.BlackList {
-		pset.Remove(p)
+	var granted []string
+	for _, v := range pset.ToSlice() {
+		granted = append(granted, v.(string))
 	}
 
-	for _, v := range pset.ToSlice() {
-		permissions = append(permissions, v.(string))
+	// 3. expand wildcards to registered permissions
+	if granted, err = dao.expandContext(ctx, u.System, granted); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 4. remove permissions at blacklist or denied by roles
+	denied = append([]string{}, u.BlackList...)
+	for _, v := range dset.ToSlice() {
+		denied = append(denied, v.(string))
+	}
+	for _, p := range granted {
+		if !matchAny(denied, p) {
+			permissions = append(permissions, p)
+		}
 	}
 	return
 }
 
+// expandContext add registered permissions matched by wildcards at names
+func (dao *PermissionDao) expandContext(ctx context.Context, system string, names []string) ([]string, error) {
+	var wildcards []string
+	for _, n := range names {
+		if model.IsWildcard(n) {
+			wildcards = append(wildcards, n)
+		}
+	}
+	if len(wildcards) == 0 {
+		return names, nil
+	}
+
+	ps, err := dao.permission.GetAllPermissionsContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+
+	pset := set.NewSet()
+	for _, n := range names {
+		pset.Add(n)
+	}
+	for _, p := range ps {
+		if matchAny(wildcards, p.Name) {
+			pset.Add(p.Name)
+		}
+	}
+
+	res := []string{}
+	for _, v := range pset.ToSlice() {
+		res = append(res, v.(string))
+	}
+	return res, nil
+}
+
+// matchAny report whether name is matched by any of patterns
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if model.MatchPermission(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (dao *PermissionDao) RemoveUser(system, uid string) (bool, error) {
-	key := fmt.Sprintf(redisKeyFormatPermissions, system, uid)
-	return dao.Del(key)
+	return dao.RemoveUserContext(context.Background(), system, uid)
+}
+
+func (dao *PermissionDao) RemoveUserContext(ctx context.Context, system, uid string) (bool, error) {
+	dkey := fmt.Sprintf(redisKeyFormatDomains, system, uid)
+	domains, err := dao.SMembersContext(ctx, dkey)
+	if err != nil {
+		return false, err
+	}
+
+	skey := fmt.Sprintf(redisKeyFormatSessions, system, uid)
+	sessions, err := dao.SMembersContext(ctx, skey)
+	if err != nil {
+		return false, err
+	}
+
+	keys := []string{dkey, skey, fmt.Sprintf(redisKeyFormatUnknown, system, uid)}
+	for _, domain := range append([]string{""}, domains...) {
+		keys = append(keys, domainKey(redisKeyFormatPermissions, system, uid, domain), domainKey(redisKeyFormatWildcards, system, uid, domain),
+			domainKey(redisKeyFormatResources, system, uid, domain), domainKey(redisKeyFormatConditions, system, uid, domain))
+	}
+	for _, id := range sessions {
+		keys = append(keys, fmt.Sprintf(redisKeyFormatSessionPermissions, system, uid, id))
+	}
+	return dao.DelContext(ctx, keys...)
 }
 
 func (dao *PermissionDao) ClearAllKeys() {
-	dao.FlushDB()
+	dao.ClearAllKeysContext(context.Background())
+}
+
+func (dao *PermissionDao) ClearAllKeysContext(ctx context.Context) error {
+	return dao.FlushDBContext(ctx)
 }
@@ -1,16 +1,20 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/db/kvstore"
 	"github.com/nzqpeace/rbac/model"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
 	pdao *PermissionDao
+	ctx  = context.Background()
 )
 
 const system = "Cowshed"
@@ -33,12 +37,12 @@ func init() {
 		Url: "localhost/test",
 	}
 
-	db, err := db.Init(conf)
+	d, err := db.Init(conf)
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	pdao = NewPermissionDao(r, db)
+	pdao = NewPermissionDao(r, db.NewMgoStore(d))
 }
 
 func fillDataIntoMongo(t *testing.T) {
@@ -48,21 +52,21 @@ func fillDataIntoMongo(t *testing.T) {
 	admin := model.NewRole(system, "admin", "", "read", "write", "manage")
 
 	// create role
-	assert.Nil(t, pdao.role.CreateRole(guest))
-	assert.Nil(t, pdao.role.CreateRole(common))
-	assert.Nil(t, pdao.role.CreateRole(admin))
+	assert.Nil(t, pdao.role.CreateRoleContext(ctx, guest))
+	assert.Nil(t, pdao.role.CreateRoleContext(ctx, common))
+	assert.Nil(t, pdao.role.CreateRoleContext(ctx, admin))
 
 	commonUser := model.NewUserPermModel(system, uid, "common")
 	commonAdmin := model.NewUserPermModel(system, "uid_admin", "admin")
 
 	// create user permission model
-	assert.Nil(t, pdao.user.CreateUserPermModel(commonUser))
-	assert.Nil(t, pdao.user.CreateUserPermModel(commonAdmin))
+	assert.Nil(t, pdao.user.CreateUserPermModelContext(ctx, commonUser))
+	assert.Nil(t, pdao.user.CreateUserPermModelContext(ctx, commonAdmin))
 }
 
 func clearDataAtMongo(t *testing.T) {
-	assert.Nil(t, pdao.user.RemoveUserPermModel(system, uid))
-	assert.Nil(t, pdao.role.RemoveAllRoles(system))
+	assert.Nil(t, pdao.user.RemoveUserPermModelContext(ctx, system, uid))
+	assert.Nil(t, pdao.role.RemoveAllRolesContext(ctx, system))
 }
 
 func TestPermission(t *testing.T) {
@@ -124,9 +128,527 @@ func TestPermission(t *testing.T) {
 	assert.Nil(t, pdao.RemovePermissions(system, uid, "write", "read"))
 }
 
+func TestPermissionWildcards(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	for _, name := range []string{"article:read", "article:delete", "article:comment:create", "billing.invoice.create"} {
+		assert.Nil(t, store.Permissions().CreatePermissionContext(ctx, &model.Permission{System: system, Name: name}))
+	}
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "editor", "", "article:*")))
+	user := model.NewUserPermModel(system, uid, "editor")
+	user.WhiteList = []string{"billing.*"}
+	user.BlackList = []string{"article:delete", "article:comment:*"}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, user))
+
+	// wildcards are expanded to registered permissions, blacklist wins
+	ps, err := dao.GetPermissionsContext(ctx, user)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"article:*", "article:read", "billing.*", "billing.invoice.create"}, ps)
+
+	for name, expected := range map[string]bool{
+		"article:read":           true,
+		"article:publish":        true, // not registered, matched by wildcard
+		"article:delete":         false,
+		"article:comment:create": false,
+		"article:comment:update": false,
+		"article":                false,
+		"billing.refund.create":  true,
+		"billing:invoice":        false,
+	} {
+		permit, err := dao.IsPermitContext(ctx, system, uid, name)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, permit, name)
+	}
+
+	// wildcards are dropped together with user
+	_, err = dao.RemoveUserContext(ctx, system, uid)
+	assert.Nil(t, err)
+	ws, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatWildcards, system, uid))
+	assert.Nil(t, err)
+	assert.Empty(t, ws)
+}
+
+func TestPermissionResources(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "reader", "", "read")))
+	user := model.NewUserPermModel(system, uid, "reader")
+	user.BlackList = []string{"share"}
+	user.Grants = []model.Grant{
+		{Permission: "write", Resource: model.Resource{Type: "document", ID: "42"}},
+		{Permission: "comment", Resource: model.Resource{Type: "document", ID: "draft-*"}},
+		{Permission: "share", Resource: model.Resource{Type: "document", ID: "42"}},
+	}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, user))
+
+	for _, c := range []struct {
+		permission string
+		resource   model.Resource
+		expected   bool
+	}{
+		{"read", model.Resource{Type: "folder", ID: "1"}, true},
+		{"write", model.Resource{Type: "document", ID: "42"}, true},
+		{"write", model.Resource{Type: "document", ID: "43"}, false},
+		{"write", model.Resource{Type: "folder", ID: "42"}, false},
+		{"comment", model.Resource{Type: "document", ID: "draft-1"}, true},
+		{"comment", model.Resource{Type: "document", ID: "final-1"}, false},
+		{"share", model.Resource{Type: "document", ID: "42"}, false},
+	} {
+		permit, err := dao.IsPermitOnContext(ctx, system, uid, c.permission, c.resource)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, permit, c.permission+" on "+c.resource.String())
+	}
+
+	// grants don't permit unscoped checks
+	permit, err := dao.IsPermitContext(ctx, system, uid, "write")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	_, err = dao.RemoveUserContext(ctx, system, uid)
+	assert.Nil(t, err)
+	rs, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatResources, system, uid))
+	assert.Nil(t, err)
+	assert.Empty(t, rs)
+}
+
+func TestPermissionConditions(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	clerk := model.NewRole(system, "clerk", "", "read")
+	clerk.Conditions = []model.Condition{
+		{Permission: "refund", Expr: `amount < 1000 && region == user.region`},
+		{Permission: "report:*", Expr: `in(region, "eu", "us")`},
+		{Permission: "share", Expr: `true`},
+	}
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, clerk))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "senior", "", "refund")))
+	user := model.NewUserPermModel(system, uid, "clerk")
+	user.BlackList = []string{"share"}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, user))
+
+	eu := map[string]interface{}{"region": "eu", "user": map[string]interface{}{"region": "eu"}}
+	for _, c := range []struct {
+		permission string
+		amount     interface{}
+		expected   bool
+	}{
+		{"read", nil, true},
+		{"refund", 999, true},
+		{"refund", 1000, false},
+		{"refund", nil, false}, // can't be evaluated
+		{"report:daily", nil, true},
+		{"share", nil, false},
+	} {
+		attrs := map[string]interface{}{"amount": c.amount}
+		for k, v := range eu {
+			attrs[k] = v
+		}
+		permit, err := dao.IsPermitWithAttrsContext(ctx, system, uid, c.permission, attrs)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, permit, c.permission)
+	}
+
+	// conditions don't permit checks without attributes
+	permit, err := dao.IsPermitContext(ctx, system, uid, "refund")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// unconditional permissions don't need attributes
+	assert.Nil(t, store.Users().AddRolesContext(ctx, system, uid, "senior"))
+	_, err = dao.RemoveUserContext(ctx, system, uid)
+	assert.Nil(t, err)
+	permit, err = dao.IsPermitWithAttrsContext(ctx, system, uid, "refund", nil)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	cs, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatConditions, system, uid))
+	assert.Nil(t, err)
+	assert.Len(t, cs, 3) // condition of blacklisted share is replaced by its deny entry
+}
+
+func TestPermissionDenied(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "analyst", "", "read", "export_data", "report:*")))
+	contractor := model.NewRole(system, "contractor", "")
+	contractor.Denied = []string{"export_data", "report:finance"}
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, contractor))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "vendor", "", "write")))
+	assert.Nil(t, store.Roles().AddParentsContext(ctx, system, "vendor", "contractor"))
+	user := model.NewUserPermModel(system, uid, "analyst", "vendor")
+	user.WhiteList = []string{"export_data", "manage"}
+	user.Grants = []model.Grant{{Permission: "export_data", Resource: model.Resource{Type: "report", ID: "1"}}}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, user))
+
+	// denials of inherited roles beat permissions of other roles and whitelist
+	ps, err := dao.GetPermissionsContext(ctx, user)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"read", "report:*", "write", "manage"}, ps)
+	for permission, expected := range map[string]bool{
+		"read":           true,
+		"export_data":    false,
+		"report:daily":   true,
+		"report:finance": false,
+	} {
+		permit, err := dao.IsPermitContext(ctx, system, uid, permission)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, permit, permission)
+	}
+	permit, err := dao.IsPermitOnContext(ctx, system, uid, "export_data", model.Resource{Type: "report", ID: "1"})
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// denials apply to members of groups too
+	team := model.NewGroup(system, "team", "", "analyst", "contractor")
+	team.Members = []string{"uid_member"}
+	assert.Nil(t, store.Groups().CreateGroupContext(ctx, team))
+	permit, err = dao.IsPermitContext(ctx, system, "uid_member", "export_data")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+}
+
+func TestPermissionWithRoles(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "reader", "", "read", "report:*")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "writer", "", "write")))
+	assert.Nil(t, store.Roles().AddParentsContext(ctx, system, "writer", "reader"))
+	auditor := model.NewRole(system, "auditor", "", "audit")
+	auditor.Denied = []string{"write"}
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, auditor))
+	user := model.NewUserPermModel(system, uid, "writer", "auditor")
+	user.WhiteList = []string{"manage"}
+	user.BlackList = []string{"report:finance"}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, user))
+
+	// only specified roles and their ancestors count, whitelist and blacklist still apply
+	for _, c := range []struct {
+		roles      []string
+		permission string
+		expected   bool
+	}{
+		{[]string{"writer"}, "write", true},
+		{[]string{"writer"}, "report:daily", true},
+		{[]string{"writer"}, "report:finance", false},
+		{[]string{"writer"}, "audit", false},
+		{[]string{"writer", "auditor"}, "write", false},
+		{[]string{"auditor"}, "audit", true},
+		{nil, "manage", true},
+		{nil, "read", false},
+	} {
+		permit, err := dao.IsPermitWithRolesContext(ctx, system, uid, c.permission, c.roles)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, permit, "%v %s", c.roles, c.permission)
+	}
+
+	// unknown users have permissions of roles only
+	permit, err := dao.IsPermitWithRolesContext(ctx, system, "uid_unknown", "read", []string{"reader"})
+	assert.Nil(t, err)
+	assert.True(t, permit)
+}
+
+func TestPermissionSession(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+	dao.Authorized = func(ctx context.Context, system, uid string) ([]string, error) {
+		return []string{"reader", "writer"}, nil
+	}
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "reader", "", "read", "report:*")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "writer", "", "write")))
+	user := model.NewUserPermModel(system, uid, "reader", "writer")
+	user.BlackList = []string{"report:finance"}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, user))
+
+	// roles which may not be activated don't count, blacklist still applies
+	session := *model.NewSession(system, uid, time.Now().Add(time.Hour), "reader", "admin")
+	session.ID = "id"
+	for permission, expected := range map[string]bool{"read": true, "report:daily": true, "report:finance": false, "write": false, "": false} {
+		permit, err := dao.IsPermitInSessionContext(ctx, session, permission)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, permit, permission)
+	}
+
+	// permissions are cached until they're dropped together with those of user
+	assert.Nil(t, store.Users().AddToBlackListContext(ctx, system, uid, "read"))
+	permit, err := dao.IsPermitInSessionContext(ctx, session, "read")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	_, err = dao.RemoveUserContext(ctx, system, uid)
+	assert.Nil(t, err)
+	permit, err = dao.IsPermitInSessionContext(ctx, session, "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// or dropped for session alone, e.g. when its active roles change
+	session.Roles = []string{"writer"}
+	permit, err = dao.IsPermitInSessionContext(ctx, session, "write")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	_, err = dao.RemoveSessionContext(ctx, session)
+	assert.Nil(t, err)
+	permit, err = dao.IsPermitInSessionContext(ctx, session, "write")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// session without permissions is cached too
+	empty := *model.NewSession(system, uid, time.Now().Add(time.Hour))
+	empty.ID = "empty"
+	permit, err = dao.IsPermitInSessionContext(ctx, empty, "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	exist, err := dao.ExistsContext(ctx, fmt.Sprintf(redisKeyFormatSessionPermissions, system, uid, empty.ID))
+	assert.Nil(t, err)
+	assert.True(t, exist)
+}
+
+func TestPermissionGroups(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "reader", "", "read")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "writer", "", "write")))
+	user := model.NewUserPermModel(system, uid, "reader")
+	user.BlackList = []string{"manage"}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, user))
+	team := model.NewGroup(system, "team", "", "writer")
+	team.Members = []string{uid, "uid_member"}
+	assert.Nil(t, store.Groups().CreateGroupContext(ctx, team))
+	assert.Nil(t, store.Groups().CreateGroupContext(ctx, model.NewGroup(system, "admins", "", "admin")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "admin", "", "manage")))
+	assert.Nil(t, store.Groups().AddMembersContext(ctx, system, "admins", uid))
+
+	// roles of groups are added to those of user, blacklist still wins
+	ps, err := dao.GetPermissionsContext(ctx, user)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"read", "write"}, ps)
+
+	// members of groups needn't be registered
+	permit, err := dao.IsPermitContext(ctx, system, "uid_member", "write")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = dao.IsPermitContext(ctx, system, "uid_member", "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	permit, err = dao.IsPermitContext(ctx, system, "uid_stranger", "write")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+}
+
+func TestPermissionWindows(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "reader", "", "read")))
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, uid)))
+	boundary := time.Now().Add(300 * time.Millisecond)
+	assert.Nil(t, store.Users().AddWithinContext(ctx, system, uid, model.ListWhiteList, model.Period{ExpiresAt: &boundary}, "write"))
+	assert.Nil(t, store.Users().AddWithinContext(ctx, system, uid, model.ListRoles, model.Period{ValidFrom: &boundary}, "reader"))
+
+	permit, err := dao.IsPermitContext(ctx, system, uid, "write")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = dao.IsPermitContext(ctx, system, uid, "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// cached permissions expire at the boundary and are reloaded
+	time.Sleep(time.Until(boundary))
+	permit, err = dao.IsPermitContext(ctx, system, uid, "write")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	permit, err = dao.IsPermitContext(ctx, system, uid, "read")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+}
+
+func TestPermissionDomains(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "reader", "", "read")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "admin", "", "read", "write", "manage")))
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, uid, "reader")))
+	assert.Nil(t, store.Users().AddInDomainContext(ctx, system, uid, "org_a", model.ListRoles, "admin"))
+	assert.Nil(t, store.Users().AddInDomainContext(ctx, system, uid, "org_a", model.ListBlackList, "manage"))
+	assert.Nil(t, store.Users().AddInDomainContext(ctx, system, uid, "org_b", model.ListWhiteList, "audit"))
+
+	for _, c := range []struct {
+		domain     string
+		permission string
+		expected   bool
+	}{
+		{"", "read", true},
+		{"", "write", false},
+		{"org_a", "read", true},
+		{"org_a", "write", true},
+		{"org_a", "manage", false},
+		{"org_a", "audit", false},
+		{"org_b", "write", false},
+		{"org_b", "audit", true},
+		{"org_c", "read", true},
+		{"org_c", "write", false},
+	} {
+		permit, err := dao.IsPermitInDomainContext(ctx, system, uid, c.domain, c.permission)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, permit, "%s %s", c.domain, c.permission)
+	}
+
+	// each domain is cached on its own and removed together with user
+	ps, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatPermissions, system, uid)+"@org_a")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"", "read", "write"}, ps)
+
+	// domains without entries of user are checked like the global one and not cached
+	exist, err := dao.ExistsContext(ctx, fmt.Sprintf(redisKeyFormatPermissions, system, uid)+"@org_c")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	domains, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatDomains, system, uid))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"", "org_a", "org_b"}, domains)
+	permit, err := dao.IsPermitInDomainContext(ctx, system, "uid_stranger", "org_c", "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	exist, err = dao.ExistsContext(ctx, fmt.Sprintf(redisKeyFormatDomains, system, "uid_stranger"))
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	assert.Nil(t, store.Users().RemoveInDomainContext(ctx, system, uid, "org_a", model.ListRoles, "admin"))
+	_, err = dao.RemoveUserContext(ctx, system, uid)
+	assert.Nil(t, err)
+	permit, err = dao.IsPermitInDomainContext(ctx, system, uid, "org_a", "write")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+}
+
+func TestPermissionDelegations(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "approver", "", "approve")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "reader", "", "read")))
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, "uid_manager", "approver", "reader")))
+	assert.Nil(t, store.Delegations().CreateDelegationContext(ctx, model.NewDelegation(system, "uid_manager", "uid_deputy", "approver")))
+	assert.Nil(t, store.Delegations().CreateDelegationContext(ctx, model.NewDelegation(system, "uid_deputy", "uid_intern", "approver")))
+
+	// non transitive delegations can't be delegated further
+	permit, err := dao.IsPermitContext(ctx, system, "uid_deputy", "approve")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = dao.IsPermitContext(ctx, system, "uid_intern", "approve")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	roles, err := dao.DelegableRolesContext(ctx, system, "uid_deputy")
+	assert.Nil(t, err)
+	assert.Empty(t, roles)
+
+	// a cycle of transitive delegations doesn't keep roles delegator lost
+	d := model.NewDelegation(system, "uid_manager", "uid_deputy", "approver")
+	d.Transitive = true
+	assert.Nil(t, store.Delegations().CreateDelegationContext(ctx, d))
+	d = model.NewDelegation(system, "uid_deputy", "uid_manager", "approver")
+	d.Transitive = true
+	assert.Nil(t, store.Delegations().CreateDelegationContext(ctx, d))
+	roles, err = dao.DelegatedRolesContext(ctx, system, "uid_intern")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"approver"}, roles)
+	assert.Nil(t, store.Users().RemoveRolesContext(ctx, system, "uid_manager", "approver"))
+	for _, uid := range []string{"uid_manager", "uid_deputy", "uid_intern"} {
+		roles, err = dao.DelegatedRolesContext(ctx, system, uid)
+		assert.Nil(t, err)
+		assert.Empty(t, roles, uid)
+	}
+}
+
 func BenchmarkIsPermit(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// pdao.SIsMembers("cowshed_uid_admin_permissions", "read")
 		pdao.IsPermit("cowshed", "uid_admin", "read")
 	}
 }
+
+func TestPermissionUnknownUsers(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	dao := NewPermissionDao(NewMemory(), store)
+
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "anonymous", "", "read")))
+	permit, err := dao.IsPermitContext(ctx, system, "visitor", "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// unknown users are remembered until their keys are removed
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, "visitor", "anonymous")))
+	permit, err = dao.IsPermitContext(ctx, system, "visitor", "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	_, err = dao.RemoveUserContext(ctx, system, "visitor")
+	assert.Nil(t, err)
+	permit, err = dao.IsPermitContext(ctx, system, "visitor", "read")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// registered users without permissions are cached too, so checking them doesn't reload
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, "idle")))
+	for _, permission := range []string{"read", ""} {
+		permit, err = dao.IsPermitContext(ctx, system, "idle", permission)
+		assert.Nil(t, err)
+		assert.False(t, permit)
+	}
+	assert.Nil(t, store.Users().AddRolesContext(ctx, system, "idle", "anonymous"))
+	permit, err = dao.IsPermitContext(ctx, system, "idle", "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	ps, err := dao.PermissionsContext(ctx, system, "idle")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, ps)
+
+	// unregistered users get default roles of system
+	s := model.NewSystem(system, "")
+	s.DefaultRoles = []string{"anonymous"}
+	assert.Nil(t, store.Systems().CreateSystemContext(ctx, s))
+	for _, domain := range []string{"", "org_a"} {
+		permit, err = dao.IsPermitInDomainContext(ctx, system, "stranger", domain, "read")
+		assert.Nil(t, err)
+		assert.True(t, permit, domain)
+	}
+	_, err = store.Users().GetUserPermModelContext(ctx, system, "stranger")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// and are registered with them on first check if system auto register users
+	s.AutoRegister = true
+	assert.Nil(t, store.Systems().UpdateSystemContext(ctx, s))
+	permit, err = dao.IsPermitContext(ctx, system, "newcomer", "read")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	u, err := store.Users().GetUserPermModelContext(ctx, system, "newcomer")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"anonymous"}, u.Roles)
+
+	// users registered meanwhile keep their roles
+	dao.Register = func(ctx context.Context, u *model.UserPermModel) error {
+		assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, u.UID)))
+		return store.Users().InsertUserPermModelContext(ctx, u)
+	}
+	permit, err = dao.IsPermitContext(ctx, system, "latecomer", "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	u, err = store.Users().GetUserPermModelContext(ctx, system, "latecomer")
+	assert.Nil(t, err)
+	assert.Empty(t, u.Roles)
+	dao.Register = nil
+
+	// unknown users aren't remembered without negative ttl
+	dao.NegativeTTL = 0
+	permit, err = dao.IsPermitContext(ctx, system+"_other", "visitor", "read")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system+"_other", "anonymous", "", "read")))
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system+"_other", "visitor", "anonymous")))
+	permit, err = dao.IsPermitContext(ctx, system+"_other", "visitor", "read")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+}
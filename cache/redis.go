@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"time"
@@ -22,8 +23,21 @@ func NewRedis(config *RedisConfig) *Redis {
 
 // Do wrapper of redis.Do
 func (r *Redis) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	return r.DoContext(context.Background(), commandName, args...)
+}
+
+// DoContext is Do with context, the command is bounded by deadline of ctx
+func (r *Redis) DoContext(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	conn := r.pool.Get()
 	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		return redis.DoWithTimeout(conn, time.Until(deadline), commandName, args...)
+	}
 	return conn.Do(commandName, args...)
 }
 
@@ -104,7 +118,12 @@ func NewRedisPool(config *RedisConfig) *redis.Pool {
 }
 
 // SAdd add members into redis set
-func (r *Redis) SAdd(key string, members ...string) (err error) {
+func (r *Redis) SAdd(key string, members ...string) error {
+	return r.SAddContext(context.Background(), key, members...)
+}
+
+// SAddContext is SAdd with context
+func (r *Redis) SAddContext(ctx context.Context, key string, members ...string) (err error) {
 	if len(members) == 0 {
 		return
 	}
@@ -115,12 +134,17 @@ func (r *Redis) SAdd(key string, members ...string) (err error) {
 		params = append(params, m)
 	}
 
-	_, err = r.Do("sadd", params...)
+	_, err = r.DoContext(ctx, "sadd", params...)
 	return
 }
 
 // SRem remove members from redis set
-func (r *Redis) SRem(key string, members ...string) (err error) {
+func (r *Redis) SRem(key string, members ...string) error {
+	return r.SRemContext(context.Background(), key, members...)
+}
+
+// SRemContext is SRem with context
+func (r *Redis) SRemContext(ctx context.Context, key string, members ...string) (err error) {
 	if len(members) == 0 {
 		return
 	}
@@ -130,30 +154,55 @@ func (r *Redis) SRem(key string, members ...string) (err error) {
 	for _, m := range members {
 		params = append(params, m)
 	}
-	_, err = r.Do("srem", params...)
+	_, err = r.DoContext(ctx, "srem", params...)
 	return
 }
 
 // SMembers list all members at specified redis set
 func (r *Redis) SMembers(key string) ([]string, error) {
-	return redis.Strings(r.Do("smembers", key))
+	return r.SMembersContext(context.Background(), key)
+}
+
+// SMembersContext is SMembers with context
+func (r *Redis) SMembersContext(ctx context.Context, key string) ([]string, error) {
+	return redis.Strings(r.DoContext(ctx, "smembers", key))
 }
 
 // SIsMembers check whether a member of specified set
 func (r *Redis) SIsMembers(key, value string) (bool, error) {
-	return redis.Bool(r.Do("sismember", key, value))
+	return r.SIsMembersContext(context.Background(), key, value)
+}
+
+// SIsMembersContext is SIsMembers with context
+func (r *Redis) SIsMembersContext(ctx context.Context, key, value string) (bool, error) {
+	return redis.Bool(r.DoContext(ctx, "sismember", key, value))
 }
 
 func (r *Redis) Exists(key string) (bool, error) {
-	return redis.Bool(r.Do("exists", key))
+	return r.ExistsContext(context.Background(), key)
+}
+
+func (r *Redis) ExistsContext(ctx context.Context, key string) (bool, error) {
+	return redis.Bool(r.DoContext(ctx, "exists", key))
 }
 
 func (r *Redis) FlushDB() {
-	r.Do("flushdb")
+	r.FlushDBContext(context.Background())
+}
+
+// FlushDBContext remove all keys of current redis db
+func (r *Redis) FlushDBContext(ctx context.Context) error {
+	_, err := r.DoContext(ctx, "flushdb")
+	return err
 }
 
 // Del delete specified key from redis
 func (r *Redis) Del(keys ...string) (bool, error) {
+	return r.DelContext(context.Background(), keys...)
+}
+
+// DelContext is Del with context
+func (r *Redis) DelContext(ctx context.Context, keys ...string) (bool, error) {
 	if len(keys) == 0 {
 		return true, nil
 	}
@@ -162,5 +211,16 @@ func (r *Redis) Del(keys ...string) (bool, error) {
 	for _, k := range keys {
 		params = append(params, k)
 	}
-	return redis.Bool(r.Do("del", params...))
+	return redis.Bool(r.DoContext(ctx, "del", params...))
+}
+
+// ExpireAt set the time specified key expires
+func (r *Redis) ExpireAt(key string, at time.Time) error {
+	return r.ExpireAtContext(context.Background(), key, at)
+}
+
+// ExpireAtContext is ExpireAt with context
+func (r *Redis) ExpireAtContext(ctx context.Context, key string, at time.Time) error {
+	_, err := r.DoContext(ctx, "pexpireat", key, at.UnixNano()/int64(time.Millisecond))
+	return err
 }
@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nzqpeace/rbac/model"
+)
+
+const (
+	redisKeyFormatSession        = "session_%s"  // session_{id}
+	redisKeyFormatSystemSessions = "sessions_%s" // sessions_{system}
+
+	// members of session set are its owner prefixed by sessionOwnerPrefix and its active roles prefixed by sessionRolePrefix,
+	// the owner keeps the set alive while no role is active
+	sessionOwnerPrefix = "owner:"
+	sessionRolePrefix  = "role:"
+)
+
+// ErrSessionNotFound is returned when session doesn't exist or has expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// sessionOwner is the owner member of session set
+type sessionOwner struct {
+	System    string    `json:"system"`
+	UID       string    `json:"uid"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionDao is session dao, each session is cached at a set which expires together with the session.
+// sessions of a system are tracked at another set as their deadline and id, e.g. "1700000000000000000:id".
+// sessions must be kept at a backend of their own, since cached permissions are invalidated by flushing theirs
+type SessionDao struct {
+	Backend
+}
+
+// NewSessionDao create a new session dao which keep sessions at backend
+func NewSessionDao(backend Backend) *SessionDao {
+	return &SessionDao{backend}
+}
+
+// CreateSession store session with a new random id, which is set at session
+func (dao *SessionDao) CreateSession(session *model.Session) error {
+	return dao.CreateSessionContext(context.Background(), session)
+}
+
+// CreateSessionContext is CreateSession with context
+func (dao *SessionDao) CreateSessionContext(ctx context.Context, session *model.Session) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	owner, err := json.Marshal(sessionOwner{System: session.System, UID: session.UID, ExpiresAt: session.ExpiresAt})
+	if err != nil {
+		return err
+	}
+
+	id := hex.EncodeToString(b)
+	key := fmt.Sprintf(redisKeyFormatSession, id)
+	members := []string{sessionOwnerPrefix + string(owner)}
+	for _, role := range session.Roles {
+		members = append(members, sessionRolePrefix+role)
+	}
+	if err = dao.SAddContext(ctx, key, members...); err != nil {
+		return err
+	}
+	if err = dao.ExpireAtContext(ctx, key, session.ExpiresAt); err != nil {
+		return err
+	}
+	if err = dao.trackContext(ctx, session.System, id, session.ExpiresAt); err != nil {
+		return err
+	}
+	session.ID = id
+	return nil
+}
+
+// trackContext add session to sessions of system, which expire together with the last of them. expired sessions
+// are dropped from them meanwhile
+func (dao *SessionDao) trackContext(ctx context.Context, system, id string, expiresAt time.Time) error {
+	key := fmt.Sprintf(redisKeyFormatSystemSessions, system)
+	members, err := dao.SMembersContext(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now, last := time.Now(), expiresAt
+	expired := []string{}
+	for _, m := range members {
+		at, _ := parseTracked(m)
+		if !now.Before(at) {
+			expired = append(expired, m)
+		} else if at.After(last) {
+			last = at
+		}
+	}
+	if len(expired) > 0 {
+		if err = dao.SRemContext(ctx, key, expired...); err != nil {
+			return err
+		}
+	}
+	if err = dao.SAddContext(ctx, key, fmt.Sprintf("%d:%s", expiresAt.UnixNano(), id)); err != nil {
+		return err
+	}
+	return dao.ExpireAtContext(ctx, key, last)
+}
+
+// parseTracked return deadline and id of session tracked by member, a malformed member has expired
+func parseTracked(member string) (time.Time, string) {
+	parts := strings.SplitN(member, ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, ""
+	}
+	nsec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, ""
+	}
+	return time.Unix(0, nsec), parts[1]
+}
+
+// GetSession get specified session, active roles are in ascending order
+func (dao *SessionDao) GetSession(id string) (model.Session, error) {
+	return dao.GetSessionContext(context.Background(), id)
+}
+
+// GetSessionContext is GetSession with context
+func (dao *SessionDao) GetSessionContext(ctx context.Context, id string) (model.Session, error) {
+	members, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatSession, id))
+	if err != nil {
+		return model.Session{}, err
+	}
+
+	session := model.Session{ID: id, Roles: []string{}}
+	found := false
+	for _, m := range members {
+		if strings.HasPrefix(m, sessionRolePrefix) {
+			session.Roles = append(session.Roles, strings.TrimPrefix(m, sessionRolePrefix))
+			continue
+		}
+
+		var owner sessionOwner
+		if strings.HasPrefix(m, sessionOwnerPrefix) && json.Unmarshal([]byte(strings.TrimPrefix(m, sessionOwnerPrefix)), &owner) == nil {
+			session.System, session.UID, session.ExpiresAt = owner.System, owner.UID, owner.ExpiresAt
+			found = true
+		}
+	}
+	if !found || !time.Now().Before(session.ExpiresAt) {
+		return model.Session{}, ErrSessionNotFound
+	}
+	sort.Strings(session.Roles)
+	return session, nil
+}
+
+// ActivateRoles add roles into active roles of session
+func (dao *SessionDao) ActivateRoles(id string, roles ...string) error {
+	return dao.ActivateRolesContext(context.Background(), id, roles...)
+}
+
+// ActivateRolesContext is ActivateRoles with context
+func (dao *SessionDao) ActivateRolesContext(ctx context.Context, id string, roles ...string) error {
+	session, err := dao.GetSessionContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf(redisKeyFormatSession, id)
+	members := []string{}
+	for _, role := range roles {
+		members = append(members, sessionRolePrefix+role)
+	}
+	if err = dao.SAddContext(ctx, key, members...); err != nil {
+		return err
+	}
+	// the set is created again without deadline if session expired in the meantime
+	return dao.ExpireAtContext(ctx, key, session.ExpiresAt)
+}
+
+// DropRoles remove roles from active roles of session
+func (dao *SessionDao) DropRoles(id string, roles ...string) error {
+	return dao.DropRolesContext(context.Background(), id, roles...)
+}
+
+// DropRolesContext is DropRoles with context
+func (dao *SessionDao) DropRolesContext(ctx context.Context, id string, roles ...string) error {
+	if _, err := dao.GetSessionContext(ctx, id); err != nil {
+		return err
+	}
+
+	members := []string{}
+	for _, role := range roles {
+		members = append(members, sessionRolePrefix+role)
+	}
+	return dao.SRemContext(ctx, fmt.Sprintf(redisKeyFormatSession, id), members...)
+}
+
+// RemoveSession remove specified session, return false if it doesn't exist
+func (dao *SessionDao) RemoveSession(id string) (bool, error) {
+	return dao.RemoveSessionContext(context.Background(), id)
+}
+
+// RemoveSessionContext is RemoveSession with context
+func (dao *SessionDao) RemoveSessionContext(ctx context.Context, id string) (bool, error) {
+	return dao.DelContext(ctx, fmt.Sprintf(redisKeyFormatSession, id))
+}
+
+// RemoveSessionsOfSystem remove all sessions of specified system
+func (dao *SessionDao) RemoveSessionsOfSystem(system string) error {
+	return dao.RemoveSessionsOfSystemContext(context.Background(), system)
+}
+
+// RemoveSessionsOfSystemContext is RemoveSessionsOfSystem with context
+func (dao *SessionDao) RemoveSessionsOfSystemContext(ctx context.Context, system string) error {
+	key := fmt.Sprintf(redisKeyFormatSystemSessions, system)
+	members, err := dao.SMembersContext(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for _, m := range members {
+		if _, id := parseTracked(m); id != "" {
+			keys = append(keys, fmt.Sprintf(redisKeyFormatSession, id))
+		}
+	}
+	_, err = dao.DelContext(ctx, keys...)
+	return err
+}
+
+// RemoveRoleFromSessions deactivate role within all sessions of system, e.g. when it's unregistered
+func (dao *SessionDao) RemoveRoleFromSessions(system, role string) error {
+	return dao.RemoveRoleFromSessionsContext(context.Background(), system, role)
+}
+
+// RemoveRoleFromSessionsContext is RemoveRoleFromSessions with context
+func (dao *SessionDao) RemoveRoleFromSessionsContext(ctx context.Context, system, role string) error {
+	return dao.renameRoleContext(ctx, system, role, "")
+}
+
+// RenameRoleInSessions rename role active within sessions of system
+func (dao *SessionDao) RenameRoleInSessions(system, oldname, newname string) error {
+	return dao.RenameRoleInSessionsContext(context.Background(), system, oldname, newname)
+}
+
+// RenameRoleInSessionsContext is RenameRoleInSessions with context
+func (dao *SessionDao) RenameRoleInSessionsContext(ctx context.Context, system, oldname, newname string) error {
+	return dao.renameRoleContext(ctx, system, oldname, newname)
+}
+
+// renameRoleContext replace active role oldname with newname within all sessions of system which haven't expired,
+// oldname is only deactivated if newname is empty
+func (dao *SessionDao) renameRoleContext(ctx context.Context, system, oldname, newname string) error {
+	members, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatSystemSessions, system))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, m := range members {
+		at, id := parseTracked(m)
+		if id == "" || !now.Before(at) {
+			continue
+		}
+		key := fmt.Sprintf(redisKeyFormatSession, id)
+		active, err := dao.SIsMembersContext(ctx, key, sessionRolePrefix+oldname)
+		if err != nil {
+			return err
+		}
+		if !active {
+			continue
+		}
+		if newname != "" {
+			if err = dao.SAddContext(ctx, key, sessionRolePrefix+newname); err != nil {
+				return err
+			}
+			// the set is created again without deadline if session expired in the meantime
+			if err = dao.ExpireAtContext(ctx, key, at); err != nil {
+				return err
+			}
+		}
+		if err = dao.SRemContext(ctx, key, sessionRolePrefix+oldname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
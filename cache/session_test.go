@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	dao := NewSessionDao(NewMemory())
+
+	session := model.NewSession(system, uid, time.Now().Add(time.Hour), "writer")
+	assert.Nil(t, dao.CreateSessionContext(ctx, session))
+	assert.NotEmpty(t, session.ID)
+
+	// activate and drop roles
+	assert.Nil(t, dao.ActivateRolesContext(ctx, session.ID, "reader", "auditor"))
+	assert.Nil(t, dao.DropRolesContext(ctx, session.ID, "writer", "not_active"))
+	s, err := dao.GetSessionContext(ctx, session.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, system, s.System)
+	assert.Equal(t, uid, s.UID)
+	assert.Equal(t, []string{"auditor", "reader"}, s.Roles)
+	assert.True(t, session.ExpiresAt.Equal(s.ExpiresAt))
+
+	// session without active roles is kept
+	assert.Nil(t, dao.DropRolesContext(ctx, session.ID, "reader", "auditor"))
+	s, err = dao.GetSessionContext(ctx, session.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, s.Roles)
+
+	// remove session
+	removed, err := dao.RemoveSessionContext(ctx, session.ID)
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	_, err = dao.GetSessionContext(ctx, session.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+	assert.Equal(t, ErrSessionNotFound, dao.ActivateRolesContext(ctx, session.ID, "reader"))
+	_, err = dao.GetSessionContext(ctx, "not_exist")
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	// expired sessions are gone
+	expiring := model.NewSession(system, uid, time.Now().Add(50*time.Millisecond))
+	assert.Nil(t, dao.CreateSessionContext(ctx, expiring))
+	assert.NotEqual(t, session.ID, expiring.ID)
+	time.Sleep(100 * time.Millisecond)
+	_, err = dao.GetSessionContext(ctx, expiring.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+	assert.Equal(t, ErrSessionNotFound, dao.DropRolesContext(ctx, expiring.ID, "reader"))
+
+	// sessions of a system are removed together, expired ones are no longer tracked while removed ones are until
+	// they expire
+	other := model.NewSession(system+"_other", uid, time.Now().Add(time.Hour))
+	assert.Nil(t, dao.CreateSessionContext(ctx, other))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, dao.CreateSessionContext(ctx, model.NewSession(system, uid, time.Now().Add(time.Hour))))
+	}
+	tracked, err := dao.SMembersContext(ctx, fmt.Sprintf(redisKeyFormatSystemSessions, system))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(tracked))
+	assert.Nil(t, dao.RemoveSessionsOfSystemContext(ctx, system))
+	for _, m := range tracked {
+		_, id := parseTracked(m)
+		_, err = dao.GetSessionContext(ctx, id)
+		assert.Equal(t, ErrSessionNotFound, err)
+	}
+	_, err = dao.GetSessionContext(ctx, other.ID)
+	assert.Nil(t, err)
+}
@@ -1,11 +1,43 @@
 package rbac
 
 import (
+	"time"
+
 	"github.com/nzqpeace/rbac/cache"
 	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/db/kvstore"
+	"github.com/nzqpeace/rbac/db/sqlstore"
+)
+
+// storage backends supported by RBACConfig.Backend
+const (
+	BackendMongo  = "mongo"
+	BackendMemory = "memory"
+	BackendSQL    = "sql"
+	BackendBolt   = "bolt"
 )
 
 type RBACConfig struct {
+	// Backend select storage backend, default is mongo
+	Backend string
+
+	// Redis is used to cache permissions, permissions are cached in process memory when it's nil
 	Redis *cache.RedisConfig
 	Mgo   *db.MgoConf
+	SQL   *sqlstore.Config
+	Bolt  *kvstore.BoltConfig
+
+	// SessionRedis keep sessions, it must not share a database with Redis, which is flushed to invalidate
+	// cached permissions. it's required along with Redis, sessions are kept in process memory if both are nil
+	SessionRedis *cache.RedisConfig
+
+	// Store is used instead of Backend when it's not nil
+	Store db.Store
+
+	// Strict reject writes which refer to permissions or roles not registered, see ReferenceError
+	Strict bool
+
+	// NegativeTTL is how long users which are unknown to store are remembered, so checking them doesn't hit
+	// the store again. it's cache.DefaultNegativeTTL when 0, they aren't remembered when it's negative
+	NegativeTTL time.Duration
 }
@@ -0,0 +1,350 @@
+package rbac
+
+import (
+	"context"
+	"sort"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// MaxMembersViolation is a role assigned to more users than it allows
+type MaxMembersViolation struct {
+	Role       string   `json:"role"`
+	MaxMembers int      `json:"max_members"`
+	UIDs       []string `json:"uids"` // all users holding role, within domains, through groups or by delegation included
+}
+
+// PrerequisiteViolation is a user holding a role without the roles it requires
+type PrerequisiteViolation struct {
+	UID     string   `json:"uid"`
+	Role    string   `json:"role"`
+	Missing []string `json:"missing"`
+}
+
+// ConstraintReport lists existing violations of all constraints of a system
+type ConstraintReport struct {
+	SoD           []SoDViolation          `json:"sod"`
+	MaxMembers    []MaxMembersViolation   `json:"max_members"`
+	Prerequisites []PrerequisiteViolation `json:"prerequisites"`
+}
+
+// missing return roles of required which aren't contained in held
+func missing(required, held []string) []string {
+	res := []string{}
+	for _, role := range required {
+		if !contains(held, role) {
+			res = append(res, role)
+		}
+	}
+	return res
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// heldRoles return roles assigned to user directly, nil if user isn't registered
+func (r *RBAC) heldRoles(ctx context.Context, system, uid string) ([]string, error) {
+	roles, err := r.User.GetAllRolesContext(ctx, system, uid)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	return roles, err
+}
+
+// heldUser return user as stored, an empty one if user isn't registered
+func (r *RBAC) heldUser(ctx context.Context, system, uid string) (model.UserPermModel, error) {
+	u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+	if err == db.ErrNotFound {
+		return model.UserPermModel{}, nil
+	}
+	return u, err
+}
+
+// indirectRoles return roles user holds through its groups or by delegation, whatever periods of delegations are
+func (r *RBAC) indirectRoles(ctx context.Context, system, uid string) ([]string, error) {
+	groups, err := r.Group.GetGroupsOfUserContext(ctx, system, uid)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := r.Delegation.GetDelegationsToContext(ctx, system, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []string{}
+	for _, g := range groups {
+		roles = append(roles, g.Roles...)
+	}
+	for _, d := range ds {
+		roles = append(roles, d.Roles...)
+	}
+	return roles, nil
+}
+
+// allIndirectRoles map users of system to roles they hold through groups or by delegation
+func (r *RBAC) allIndirectRoles(ctx context.Context, system string) (map[string][]string, error) {
+	groups, err := r.Group.GetAllGroupsContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := r.Delegation.GetAllDelegationsContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string)
+	for _, g := range groups {
+		for _, uid := range g.Members {
+			roles[uid] = append(roles[uid], g.Roles...)
+		}
+	}
+	for _, d := range ds {
+		roles[d.Delegate] = append(roles[d.Delegate], d.Roles...)
+	}
+	return roles, nil
+}
+
+// holdersOf return users holding role directly, within any domain, through groups or by delegation
+func (r *RBAC) holdersOf(ctx context.Context, system, role string) ([]string, error) {
+	users, err := r.User.GetUsersWithRolesContext(ctx, system, role)
+	if err != nil {
+		return nil, err
+	}
+	within, err := r.User.GetUsersWithDomainRolesContext(ctx, system, role)
+	if err != nil {
+		return nil, err
+	}
+	indirect, err := r.allIndirectRoles(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+
+	uids := []string{}
+	for _, u := range append(users, within...) {
+		if !contains(uids, u.UID) {
+			uids = append(uids, u.UID)
+		}
+	}
+	for uid, roles := range indirect {
+		if contains(roles, role) && !contains(uids, uid) {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Strings(uids)
+	return uids, nil
+}
+
+// checkConstraints return the first violation of separation-of-duty rules, prerequisites or max members introduced
+// by changing roles of user from held to roles. *SoDError, *PrerequisiteError or *MaxMembersError is returned,
+// violations which already exist are tolerated. roles inherited from assigned ones, roles of groups of user and
+// roles delegated to it count as held. dynamic separation-of-duty rules are checked when roles are activated within
+// sessions instead
+func (r *RBAC) checkConstraints(ctx context.Context, system, uid string, held, roles []string) error {
+	indirect, err := r.indirectRoles(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	before := append(append([]string{}, held...), indirect...)
+	after := append(append([]string{}, roles...), indirect...)
+
+	rs, err := r.checkHeld(ctx, system, uid, before, after, roles)
+	if err != nil {
+		return err
+	}
+	for _, role := range rs {
+		if !contains(roles, role.Name) || contains(before, role.Name) {
+			continue
+		}
+		if err = r.checkMaxMembers(ctx, system, role, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMembers return the first violation of constraints introduced by uids gaining roles, e.g. as members of a group
+func (r *RBAC) checkMembers(ctx context.Context, system string, uids, roles []string) error {
+	if len(uids) == 0 || len(roles) == 0 {
+		return nil
+	}
+
+	var rs []model.Role
+	for _, uid := range uids {
+		held, err := r.heldRoles(ctx, system, uid)
+		if err != nil {
+			return err
+		}
+		indirect, err := r.indirectRoles(ctx, system, uid)
+		if err != nil {
+			return err
+		}
+		before := append(held, indirect...)
+		after := append(append([]string{}, before...), roles...)
+		if rs, err = r.checkHeld(ctx, system, uid, before, after, roles); err != nil {
+			return err
+		}
+	}
+
+	for _, role := range rs {
+		if !contains(roles, role.Name) {
+			continue
+		}
+		if err := r.checkMaxMembers(ctx, system, role, uids...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkHeld return the first violation of separation-of-duty rules or prerequisites of assigned introduced by
+// changing roles held by user from before to after, all roles of system are returned for further checks
+func (r *RBAC) checkHeld(ctx context.Context, system, uid string, before, after, assigned []string) ([]model.Role, error) {
+	rules, err := r.Constraint.GetAllSoDRulesContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := r.Role.GetAllRolesContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHierarchy(rs)
+	expandedBefore, expandedAfter := h.expand(before), h.expand(after)
+	for _, rule := range rules {
+		if rule.Dynamic {
+			continue
+		}
+		if v := rule.Violated(expandedAfter); v != nil && rule.Violated(expandedBefore) == nil {
+			return nil, &SoDError{System: system, UID: uid, Rule: rule.Name, Roles: v, Cardinality: rule.Cardinality}
+		}
+	}
+
+	for _, role := range rs {
+		if !contains(assigned, role.Name) {
+			continue
+		}
+		added := !contains(before, role.Name)
+		if m := missing(role.Prerequisites, expandedAfter); len(m) > 0 && (added || len(missing(role.Prerequisites, expandedBefore)) == 0) {
+			return nil, &PrerequisiteError{System: system, UID: uid, Role: role.Name, Missing: m}
+		}
+	}
+	return rs, nil
+}
+
+// checkMaxMembers return *MaxMembersError if role would be held by more users than it allows once uids hold it too
+func (r *RBAC) checkMaxMembers(ctx context.Context, system string, role model.Role, uids ...string) error {
+	if role.MaxMembers == 0 {
+		return nil
+	}
+	holders, err := r.holdersOf(ctx, system, role.Name)
+	if err != nil {
+		return err
+	}
+
+	n := len(holders)
+	for _, uid := range uids {
+		if !contains(holders, uid) {
+			holders = append(holders, uid)
+		}
+	}
+	if len(holders) > n && len(holders) > role.MaxMembers {
+		return &MaxMembersError{System: system, Role: role.Name, MaxMembers: role.MaxMembers}
+	}
+	return nil
+}
+
+// SetRoleConstraints replace max members and prerequisites of role. a role with max members may be held by that
+// many users at most, directly, within domains, through groups or by delegation, 0 means unlimited. a user must hold all
+// prerequisites of a role, by any of these means or by inheritance, before gaining the role. users already
+// violating them aren't changed
+func (r *RBAC) SetRoleConstraints(system, name string, maxMembers int, prerequisites ...string) error {
+	return r.SetRoleConstraintsContext(context.Background(), system, name, maxMembers, prerequisites...)
+}
+
+// SetRoleConstraintsContext is SetRoleConstraints with context
+func (r *RBAC) SetRoleConstraintsContext(ctx context.Context, system, name string, maxMembers int, prerequisites ...string) error {
+	if maxMembers < 0 {
+		return model.ErrInvalidMaxMembers
+	}
+	if err := r.checkRoles(ctx, system, prerequisites); err != nil {
+		return err
+	}
+	return r.Role.UpdateConstraintsContext(ctx, system, name, maxMembers, prerequisites...)
+}
+
+// ValidateConstraints list existing users and roles violating separation-of-duty rules, max members or
+// prerequisites of system, e.g. after constraints were added to populated roles
+func (r *RBAC) ValidateConstraints(system string) (ConstraintReport, error) {
+	return r.ValidateConstraintsContext(context.Background(), system)
+}
+
+// ValidateConstraintsContext is ValidateConstraints with context
+func (r *RBAC) ValidateConstraintsContext(ctx context.Context, system string) (report ConstraintReport, err error) {
+	report = ConstraintReport{
+		SoD:           []SoDViolation{},
+		MaxMembers:    []MaxMembersViolation{},
+		Prerequisites: []PrerequisiteViolation{},
+	}
+
+	rules, err := r.Constraint.GetAllSoDRulesContext(ctx, system)
+	if err != nil {
+		return
+	}
+	for _, rule := range rules {
+		violations, err := r.AuditSoDRuleContext(ctx, system, rule.Name)
+		if err != nil {
+			return report, err
+		}
+		report.SoD = append(report.SoD, violations...)
+	}
+
+	rs, err := r.Role.GetAllRolesContext(ctx, system)
+	if err != nil {
+		return
+	}
+	h := newHierarchy(rs)
+	required := make(map[string][]string)
+	var names []string
+	for _, role := range rs {
+		if len(role.Prerequisites) > 0 {
+			required[role.Name] = role.Prerequisites
+			names = append(names, role.Name)
+		}
+		if role.MaxMembers == 0 {
+			continue
+		}
+
+		holders, err := r.holdersOf(ctx, system, role.Name)
+		if err != nil {
+			return report, err
+		}
+		if len(holders) > role.MaxMembers {
+			report.MaxMembers = append(report.MaxMembers, MaxMembersViolation{Role: role.Name, MaxMembers: role.MaxMembers, UIDs: holders})
+		}
+	}
+
+	indirect, err := r.allIndirectRoles(ctx, system)
+	if err != nil {
+		return
+	}
+	users, err := r.User.GetUsersWithRolesContext(ctx, system, names...)
+	if err != nil {
+		return
+	}
+	for _, u := range users {
+		held := h.expand(append(append([]string{}, u.Roles...), indirect[u.UID]...))
+		for _, name := range u.Roles {
+			if m := missing(required[name], held); len(m) > 0 {
+				report.Prerequisites = append(report.Prerequisites, PrerequisiteViolation{UID: u.UID, Role: name, Missing: m})
+			}
+		}
+	}
+	return
+}
@@ -1,9 +1,12 @@
 package db
 
 import (
-	"gopkg.in/mgo.v2"
+	"context"
+	"strings"
 
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type (
@@ -20,84 +23,223 @@ func NewBase(db *DataBase, collection string) *Base {
 	}
 }
 
-func (m *Base) Invoke(fn func(col *mgo.Collection) error) error {
+// Invoke run fn with the collection, ctx given to fn is bounded by timeout of database.
+// Violation of unique indexes is reported as ErrAlreadyExists
+func (m *Base) Invoke(fn func(ctx context.Context, col *mongo.Collection) error) error {
+	return m.InvokeContext(context.Background(), fn)
+}
+
+// InvokeContext is Invoke with context
+func (m *Base) InvokeContext(ctx context.Context, fn func(ctx context.Context, col *mongo.Collection) error) error {
+	if m.db.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.db.timeout)
+		defer cancel()
+	}
 
-	s := m.db.Copy()
-	defer s.Close()
-	err := fn(s.C(m.collection))
+	err := fn(ctx, m.db.C(m.collection))
+	if err == mongo.ErrNoDocuments {
+		err = ErrNotFound
+	} else if mongo.IsDuplicateKeyError(err) {
+		err = ErrAlreadyExists
+	}
 	return err
 }
 
+// isUpdate check whether change is made of update operators like `$set`, otherwise it's a replacement
+func isUpdate(change interface{}) bool {
+	m, ok := change.(bson.M)
+	if !ok {
+		return false
+	}
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// updateOne update or replace the first document matched by query
+func updateOne(ctx context.Context, col *mongo.Collection, query, change interface{}, upsert bool) (res *mongo.UpdateResult, err error) {
+	if isUpdate(change) {
+		return col.UpdateOne(ctx, query, change, options.Update().SetUpsert(upsert))
+	}
+	return col.ReplaceOne(ctx, query, change, options.Replace().SetUpsert(upsert))
+}
+
 func (m *Base) Insert(model interface{}) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		return col.Insert(model)
+	return m.InsertContext(context.Background(), model)
+}
+
+// InsertContext is Insert with context
+func (m *Base) InsertContext(ctx context.Context, model interface{}) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		_, err := col.InsertOne(ctx, model)
+		return err
 	})
 }
 
 func (m *Base) Upsert(query, change interface{}) error {
-	return m.Invoke(func(col *mgo.Collection) (err error) {
-		_, err = col.Upsert(query, change)
+	return m.UpsertContext(context.Background(), query, change)
+}
+
+// UpsertContext is Upsert with context
+func (m *Base) UpsertContext(ctx context.Context, query, change interface{}) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) (err error) {
+		_, err = updateOne(ctx, col, query, change, true)
 		return
 	})
 }
 
 func (m *Base) Update(query, change interface{}) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		return col.Update(query, change)
+	return m.UpdateContext(context.Background(), query, change)
+}
+
+// UpdateContext is Update with context
+func (m *Base) UpdateContext(ctx context.Context, query, change interface{}) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		res, err := updateOne(ctx, col, query, change, false)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		return nil
 	})
 }
 
 func (m *Base) UpdateAll(query, change interface{}) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		_, err := col.UpdateAll(query, change)
+	return m.UpdateAllContext(context.Background(), query, change)
+}
+
+// UpdateAllContext is UpdateAll with context
+func (m *Base) UpdateAllContext(ctx context.Context, query, change interface{}) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		_, err := col.UpdateMany(ctx, query, change)
 		return err
 	})
 }
 
 func (m *Base) Find(query bson.M, model interface{}) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		return col.Find(query).One(model)
+	return m.FindContext(context.Background(), query, model)
+}
+
+// FindContext is Find with context
+func (m *Base) FindContext(ctx context.Context, query bson.M, model interface{}) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		return col.FindOne(ctx, query).Decode(model)
 	})
 }
 
+// FindAll decode all documents matched by query into models, sorts are field names, prefixed by '-' for descending order
 func (m *Base) FindAll(query bson.M, models interface{}, skip, limit int, sorts ...string) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		return col.Find(query).Skip(skip).Limit(limit).Sort(sorts...).All(models)
+	return m.FindAllContext(context.Background(), query, models, skip, limit, sorts...)
+}
+
+// FindAllContext is FindAll with context
+func (m *Base) FindAllContext(ctx context.Context, query bson.M, models interface{}, skip, limit int, sorts ...string) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		opts := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit))
+		if len(sorts) > 0 {
+			sort := bson.D{}
+			for _, s := range sorts {
+				if strings.HasPrefix(s, "-") {
+					sort = append(sort, bson.E{Key: s[1:], Value: -1})
+				} else {
+					sort = append(sort, bson.E{Key: strings.TrimPrefix(s, "+"), Value: 1})
+				}
+			}
+			opts.SetSort(sort)
+		}
+
+		cursor, err := col.Find(ctx, query, opts)
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, models)
 	})
 }
 
 func (m *Base) Distinct(query bson.M, models interface{}, key string) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		return col.Find(query).Distinct(key, models)
+	return m.DistinctContext(context.Background(), query, models, key)
+}
+
+// DistinctContext is Distinct with context
+func (m *Base) DistinctContext(ctx context.Context, query bson.M, models interface{}, key string) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		values, err := col.Distinct(ctx, key, query)
+		if err != nil {
+			return err
+		}
+
+		// round trip through bson to decode values into models
+		data, err := bson.Marshal(bson.M{"values": values})
+		if err != nil {
+			return err
+		}
+		var wrapper struct {
+			Values bson.RawValue `bson:"values"`
+		}
+		if err = bson.Unmarshal(data, &wrapper); err != nil {
+			return err
+		}
+		return wrapper.Values.Unmarshal(models)
 	})
 }
 
 // atomic update object and return old object
 func (m *Base) FindAndModify(query, change bson.M, model interface{}) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		_, err := col.Find(query).Apply(mgo.Change{
-			Update: change,
-		}, model)
-		return err
+	return m.FindAndModifyContext(context.Background(), query, change, model)
+}
+
+// FindAndModifyContext is FindAndModify with context
+func (m *Base) FindAndModifyContext(ctx context.Context, query, change bson.M, model interface{}) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		return col.FindOneAndUpdate(ctx, query, change).Decode(model)
 	})
 }
 
 func (m *Base) Remove(query bson.M) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		return col.Remove(query)
+	return m.RemoveContext(context.Background(), query)
+}
+
+// RemoveContext is Remove with context
+func (m *Base) RemoveContext(ctx context.Context, query bson.M) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		res, err := col.DeleteOne(ctx, query)
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		return nil
 	})
 }
 
 func (m *Base) RemoveAll(query bson.M) error {
-	return m.Invoke(func(col *mgo.Collection) error {
-		_, err := col.RemoveAll(query)
+	return m.RemoveAllContext(context.Background(), query)
+}
+
+// RemoveAllContext is RemoveAll with context
+func (m *Base) RemoveAllContext(ctx context.Context, query bson.M) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		_, err := col.DeleteMany(ctx, query)
 		return err
 	})
 }
 
-func (m *Base) Count(query bson.M) (n int, err error) {
-	err = m.Invoke(func(col *mgo.Collection) error {
-		n, err = col.Find(query).Count()
+func (m *Base) Count(query bson.M) (int, error) {
+	return m.CountContext(context.Background(), query)
+}
+
+// CountContext is Count with context
+func (m *Base) CountContext(ctx context.Context, query bson.M) (n int, err error) {
+	err = m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		count, err := col.CountDocuments(ctx, query)
+		n = int(count)
 		return err
 	})
 
@@ -0,0 +1,358 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// supportTransactions check whether deployment is a replica set or sharded cluster,
+// multi-document transactions are not available on standalone servers
+func supportTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+	return hello.SetName != "" || hello.Msg == "isdbgrid", err
+}
+
+// transaction run fn within a multi-document transaction if deployment support it. Cascades need a
+// replica set or sharded cluster for that, on a standalone server fn is run directly and changes made
+// before a failure are kept, Init warns about it
+func (m *DataBase) transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !m.transactions {
+		return fn(ctx)
+	}
+
+	sess, err := m.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// cascade run fn within a transaction, the timeout of database and error mapping of Invoke apply
+func (m *Base) cascade(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		return m.db.transaction(ctx, fn)
+	})
+}
+
+// splitField split field referring to a field of documents at an array, e.g. `grants.permission`,
+// into the array and the sub field, sub is empty for arrays of plain values
+func splitField(field string) (array, sub string) {
+	if i := strings.Index(field, "."); i >= 0 {
+		return field[:i], field[i+1:]
+	}
+	return field, ""
+}
+
+// refFilter match documents of system whose fields contain value
+func refFilter(system, value string, fields []string) bson.M {
+	or := bson.A{}
+	for _, f := range fields {
+		or = append(or, bson.M{f: value})
+	}
+	return bson.M{"system": system, "$or": or}
+}
+
+// referrers list key of documents matched by filter in ascending order
+func referrers(ctx context.Context, col *mongo.Collection, key string, filter bson.M) ([]string, error) {
+	values, err := col.Distinct(ctx, key, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, v := range values {
+		names = append(names, fmt.Sprint(v))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// pullRefs remove value from fields of all documents of system, return key of changed documents.
+// a field like `grants.permission` remove documents of array `grants` whose `permission` is value
+func pullRefs(ctx context.Context, col *mongo.Collection, key, system, value string, fields ...string) ([]string, error) {
+	filter := refFilter(system, value, fields)
+	names, err := referrers(ctx, col, key, filter)
+	if err != nil || len(names) == 0 {
+		return names, err
+	}
+
+	pull := bson.M{}
+	for _, f := range fields {
+		if array, sub := splitField(f); sub != "" {
+			pull[array] = bson.M{sub: value}
+		} else {
+			pull[f] = value
+		}
+	}
+	_, err = col.UpdateMany(ctx, filter, bson.M{"$pull": pull, "$inc": incRevision})
+	return names, err
+}
+
+// refKeys list sub fields which identify documents of an array together with the referring field,
+// e.g. a grant is identified by its permission and resource
+var refKeys = map[string][]string{
+	"grants.permission":     {"resource"},
+	"domain_roles.name":     {"domain"},
+	"domain_whitelist.name": {"domain"},
+	"domain_blacklist.name": {"domain"},
+}
+
+// refKey identify entry doc of an array by the sub fields which identify it together with field
+func refKey(doc bson.Raw, field string) string {
+	key := ""
+	for _, k := range refKeys[field] {
+		key += doc.Lookup(k).String() + "\x00"
+	}
+	return key
+}
+
+// hasName report whether v is a document whose sub field is name
+func hasName(v bson.RawValue, sub, name string) bool {
+	doc, ok := v.DocumentOK()
+	if !ok {
+		return false
+	}
+	s, ok := doc.Lookup(sub).StringValueOK()
+	return ok && s == name
+}
+
+// giveWay remove oldvalue from field of documents of system which also hold newvalue there,
+// so renaming doesn't duplicate entries. At arrays of documents, only an entry identified the same
+// way as an existing one of newvalue gives way
+func giveWay(ctx context.Context, col *mongo.Collection, system, oldvalue, newvalue, field string) error {
+	array, sub := splitField(field)
+	filter := bson.M{"system": system, field: bson.M{"$all": bson.A{oldvalue, newvalue}}}
+	if _, ok := refKeys[field]; !ok {
+		pull := bson.M{field: oldvalue}
+		if sub != "" {
+			pull = bson.M{array: bson.M{sub: oldvalue}}
+		}
+		_, err := col.UpdateMany(ctx, filter, bson.M{"$pull": pull})
+		return err
+	}
+
+	cursor, err := col.Find(ctx, filter, options.Find().SetProjection(bson.M{array: 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		values, err := cursor.Current.Lookup(array).Array().Values()
+		if err != nil {
+			return err
+		}
+		present := map[string]bool{}
+		for _, v := range values {
+			if hasName(v, sub, newvalue) {
+				present[refKey(v.Document(), field)] = true
+			}
+		}
+
+		kept := bson.A{}
+		for _, v := range values {
+			if !hasName(v, sub, oldvalue) || !present[refKey(v.Document(), field)] {
+				kept = append(kept, v)
+			}
+		}
+		_, err = col.UpdateOne(ctx, bson.M{"_id": cursor.Current.Lookup("_id")}, bson.M{"$set": bson.M{array: kept}})
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// renameRefs replace oldvalue with newvalue in fields of all documents of system, oldvalue gives way to
+// an existing newvalue, return key of changed documents
+func renameRefs(ctx context.Context, col *mongo.Collection, key, system, oldvalue, newvalue string, fields ...string) ([]string, error) {
+	filter := refFilter(system, oldvalue, fields)
+	names, err := referrers(ctx, col, key, filter)
+	if err != nil || len(names) == 0 {
+		return names, err
+	}
+
+	if _, err = col.UpdateMany(ctx, filter, bson.M{"$inc": incRevision}); err != nil {
+		return nil, err
+	}
+	// array updates fail on documents lacking the array, so each field only updates documents holding oldvalue at it
+	for _, f := range fields {
+		if err = giveWay(ctx, col, system, oldvalue, newvalue, f); err != nil {
+			return nil, err
+		}
+
+		var set string
+		var arrayFilter bson.M
+		if array, sub := splitField(f); sub != "" {
+			set, arrayFilter = array+".$[e]."+sub, bson.M{"e." + sub: oldvalue}
+		} else {
+			set, arrayFilter = f+".$[e]", bson.M{"e": oldvalue}
+		}
+		opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{arrayFilter}})
+		_, err = col.UpdateMany(ctx, bson.M{"system": system, f: oldvalue}, bson.M{"$set": bson.M{set: newvalue}}, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// rename change key of document identified by (system, oldname), fail if newname is taken.
+// inc is applied too if it's not nil
+func rename(ctx context.Context, col *mongo.Collection, key, system, oldname, newname string, inc bson.M) error {
+	change := bson.M{"$set": bson.M{key: newname}}
+	if inc != nil {
+		change["$inc"] = inc
+	}
+	res, err := col.UpdateOne(ctx, bson.M{"system": system, key: oldname}, change)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// remove delete document identified by (system, name)
+func remove(ctx context.Context, col *mongo.Collection, key, system, name string) error {
+	res, err := col.DeleteOne(ctx, bson.M{"system": system, key: name})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RemovePermissionCascade remove permission together with its references in roles, including their denied permissions and conditions, and users
+func (dao *PermissionDao) RemovePermissionCascade(system, name string) (Affected, error) {
+	return dao.RemovePermissionCascadeContext(context.Background(), system, name)
+}
+
+// RemovePermissionCascadeContext is RemovePermissionCascade with context
+func (dao *PermissionDao) RemovePermissionCascadeContext(ctx context.Context, system, name string) (affected Affected, err error) {
+	affected = Affected{Roles: []string{}, Users: []string{}}
+	err = dao.cascade(ctx, func(ctx context.Context) (err error) {
+		if err = remove(ctx, dao.db.C(PermissionsList), "name", system, name); err != nil {
+			return
+		}
+		if affected.Roles, err = pullRefs(ctx, dao.db.C(RoleList), "name", system, name, "permissions", "denied", "conditions.permission"); err != nil {
+			return
+		}
+		affected.Users, err = pullRefs(ctx, dao.db.C(UserList), "uid", system, name, "whitelist", "blacklist", "grants.permission",
+			"whitelist_windows.name", "blacklist_windows.name", "domain_whitelist.name", "domain_blacklist.name",
+			"whitelist_provenance.name", "blacklist_provenance.name")
+		return
+	})
+	return
+}
+
+// UpdatePermissionCascade rename permission together with its references in roles, including their denied permissions and conditions, and users
+func (dao *PermissionDao) UpdatePermissionCascade(system, oldname, newname string) (Affected, error) {
+	return dao.UpdatePermissionCascadeContext(context.Background(), system, oldname, newname)
+}
+
+// UpdatePermissionCascadeContext is UpdatePermissionCascade with context
+func (dao *PermissionDao) UpdatePermissionCascadeContext(ctx context.Context, system, oldname, newname string) (affected Affected, err error) {
+	affected = Affected{Roles: []string{}, Users: []string{}}
+	err = dao.cascade(ctx, func(ctx context.Context) (err error) {
+		if err = rename(ctx, dao.db.C(PermissionsList), "name", system, oldname, newname, nil); err != nil || oldname == newname {
+			return
+		}
+		if affected.Roles, err = renameRefs(ctx, dao.db.C(RoleList), "name", system, oldname, newname, "permissions", "denied", "conditions.permission"); err != nil {
+			return
+		}
+		affected.Users, err = renameRefs(ctx, dao.db.C(UserList), "uid", system, oldname, newname, "whitelist", "blacklist", "grants.permission",
+			"whitelist_windows.name", "blacklist_windows.name", "domain_whitelist.name", "domain_blacklist.name",
+			"whitelist_provenance.name", "blacklist_provenance.name")
+		return
+	})
+	return
+}
+
+// RemoveRoleCascade remove role and revoke it from users, groups, children and delegations, it's dropped from
+// separation-of-duty rules and default roles of system too
+func (dao *RoleDao) RemoveRoleCascade(system, name string) (Affected, error) {
+	return dao.RemoveRoleCascadeContext(context.Background(), system, name)
+}
+
+// RemoveRoleCascadeContext is RemoveRoleCascade with context
+func (dao *RoleDao) RemoveRoleCascadeContext(ctx context.Context, system, name string) (affected Affected, err error) {
+	affected = Affected{Roles: []string{}, Users: []string{}, Groups: []string{}, Delegates: []string{}}
+	err = dao.cascade(ctx, func(ctx context.Context) (err error) {
+		if err = remove(ctx, dao.db.C(RoleList), "name", system, name); err != nil {
+			return
+		}
+		if affected.Roles, err = pullRefs(ctx, dao.db.C(RoleList), "name", system, name, "parents", "prerequisites"); err != nil {
+			return
+		}
+		if affected.Groups, err = pullRefs(ctx, dao.db.C(GroupList), "name", system, name, "roles"); err != nil {
+			return
+		}
+		if _, err = pullRefs(ctx, dao.db.C(SoDRuleList), "name", system, name, "roles"); err != nil {
+			return
+		}
+		if err = pullDefaultRole(ctx, dao.db.C(SystemList), system, name); err != nil {
+			return
+		}
+		if affected.Delegates, err = pullRefs(ctx, dao.db.C(DelegationList), "delegate", system, name, "roles"); err != nil {
+			return
+		}
+		affected.Users, err = pullRefs(ctx, dao.db.C(UserList), "uid", system, name, "roles", "role_windows.name", "domain_roles.name",
+			"role_provenance.name")
+		return
+	})
+	return
+}
+
+// UpdateRoleNameCascade rename role together with its references in users, groups, children, delegations,
+// separation-of-duty rules and default roles of system
+func (dao *RoleDao) UpdateRoleNameCascade(system, oldname, newname string) (Affected, error) {
+	return dao.UpdateRoleNameCascadeContext(context.Background(), system, oldname, newname)
+}
+
+// UpdateRoleNameCascadeContext is UpdateRoleNameCascade with context
+func (dao *RoleDao) UpdateRoleNameCascadeContext(ctx context.Context, system, oldname, newname string) (affected Affected, err error) {
+	affected = Affected{Roles: []string{}, Users: []string{}, Groups: []string{}, Delegates: []string{}}
+	err = dao.cascade(ctx, func(ctx context.Context) (err error) {
+		if err = rename(ctx, dao.db.C(RoleList), "name", system, oldname, newname, incRevision); err != nil || oldname == newname {
+			return
+		}
+		if affected.Roles, err = renameRefs(ctx, dao.db.C(RoleList), "name", system, oldname, newname, "parents", "prerequisites"); err != nil {
+			return
+		}
+		if affected.Groups, err = renameRefs(ctx, dao.db.C(GroupList), "name", system, oldname, newname, "roles"); err != nil {
+			return
+		}
+		if _, err = renameRefs(ctx, dao.db.C(SoDRuleList), "name", system, oldname, newname, "roles"); err != nil {
+			return
+		}
+		if err = renameDefaultRole(ctx, dao.db.C(SystemList), system, oldname, newname); err != nil {
+			return
+		}
+		if affected.Delegates, err = renameRefs(ctx, dao.db.C(DelegationList), "delegate", system, oldname, newname, "roles"); err != nil {
+			return
+		}
+		affected.Users, err = renameRefs(ctx, dao.db.C(UserList), "uid", system, oldname, newname, "roles", "role_windows.name", "domain_roles.name",
+			"role_provenance.name")
+		return
+	})
+	return
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"math"
+
+	"github.com/nzqpeace/rbac/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SoDRuleList is name of collection
+const SoDRuleList = "sod_rules"
+
+// ConstraintDao define dao of separation-of-duty rules
+type ConstraintDao struct {
+	*Base
+}
+
+// NewConstraintDao create a new instance of ConstraintDao
+func NewConstraintDao(db *DataBase) *ConstraintDao {
+	return &ConstraintDao{
+		NewBase(db, SoDRuleList),
+	}
+}
+
+// GetSoDRule get specified rule
+func (dao *ConstraintDao) GetSoDRule(system, name string) (model.SoDRule, error) {
+	return dao.GetSoDRuleContext(context.Background(), system, name)
+}
+
+// GetSoDRuleContext is GetSoDRule with context
+func (dao *ConstraintDao) GetSoDRuleContext(ctx context.Context, system, name string) (rule model.SoDRule, err error) {
+	err = dao.FindContext(ctx, bson.M{"system": system, "name": name}, &rule)
+	return
+}
+
+// GetAllSoDRules get all rules of specified system
+func (dao *ConstraintDao) GetAllSoDRules(system string) ([]model.SoDRule, error) {
+	return dao.GetAllSoDRulesContext(context.Background(), system)
+}
+
+// GetAllSoDRulesContext is GetAllSoDRules with context
+func (dao *ConstraintDao) GetAllSoDRulesContext(ctx context.Context, system string) (rules []model.SoDRule, err error) {
+	rules = []model.SoDRule{}
+	err = dao.FindAllContext(ctx, bson.M{"system": system}, &rules, 0, math.MaxInt32, "name")
+	return
+}
+
+// CreateSoDRule create rule, replace it if already exist
+func (dao *ConstraintDao) CreateSoDRule(rule *model.SoDRule) error {
+	return dao.CreateSoDRuleContext(context.Background(), rule)
+}
+
+// CreateSoDRuleContext is CreateSoDRule with context
+func (dao *ConstraintDao) CreateSoDRuleContext(ctx context.Context, rule *model.SoDRule) error {
+	return dao.UpsertContext(ctx, bson.M{"system": rule.System, "name": rule.Name}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"desc":        rule.Desc,
+			"roles":       rule.Roles,
+			"cardinality": rule.Cardinality,
+			"dynamic":     rule.Dynamic,
+		},
+	})
+}
+
+// RemoveSoDRule remove specified rule
+func (dao *ConstraintDao) RemoveSoDRule(system, name string) error {
+	return dao.RemoveSoDRuleContext(context.Background(), system, name)
+}
+
+// RemoveSoDRuleContext is RemoveSoDRule with context
+func (dao *ConstraintDao) RemoveSoDRuleContext(ctx context.Context, system, name string) error {
+	return dao.RemoveContext(ctx, bson.M{"system": system, "name": name})
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"math"
+
+	"github.com/nzqpeace/rbac/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DelegationList is name of collection
+const DelegationList = "delegations"
+
+// DelegationDao define dao of delegations
+type DelegationDao struct {
+	*Base
+}
+
+// NewDelegationDao create a new instance of DelegationDao
+func NewDelegationDao(db *DataBase) *DelegationDao {
+	return &DelegationDao{
+		NewBase(db, DelegationList),
+	}
+}
+
+// GetDelegation get delegation from delegator to delegate
+func (dao *DelegationDao) GetDelegation(system, delegator, delegate string) (model.Delegation, error) {
+	return dao.GetDelegationContext(context.Background(), system, delegator, delegate)
+}
+
+// GetDelegationContext is GetDelegation with context
+func (dao *DelegationDao) GetDelegationContext(ctx context.Context, system, delegator, delegate string) (d model.Delegation, err error) {
+	err = dao.FindContext(ctx, bson.M{"system": system, "delegator": delegator, "delegate": delegate}, &d)
+	return
+}
+
+// GetAllDelegations get all delegations of specified system
+func (dao *DelegationDao) GetAllDelegations(system string) ([]model.Delegation, error) {
+	return dao.GetAllDelegationsContext(context.Background(), system)
+}
+
+// GetAllDelegationsContext is GetAllDelegations with context
+func (dao *DelegationDao) GetAllDelegationsContext(ctx context.Context, system string) (ds []model.Delegation, err error) {
+	ds = []model.Delegation{}
+	err = dao.FindAllContext(ctx, bson.M{"system": system}, &ds, 0, math.MaxInt32, "delegator", "delegate")
+	return
+}
+
+// GetDelegationsFrom list delegations made by uid
+func (dao *DelegationDao) GetDelegationsFrom(system, uid string) ([]model.Delegation, error) {
+	return dao.GetDelegationsFromContext(context.Background(), system, uid)
+}
+
+// GetDelegationsFromContext is GetDelegationsFrom with context
+func (dao *DelegationDao) GetDelegationsFromContext(ctx context.Context, system, uid string) (ds []model.Delegation, err error) {
+	ds = []model.Delegation{}
+	err = dao.FindAllContext(ctx, bson.M{"system": system, "delegator": uid}, &ds, 0, math.MaxInt32, "delegate")
+	return
+}
+
+// GetDelegationsTo list delegations received by uid
+func (dao *DelegationDao) GetDelegationsTo(system, uid string) ([]model.Delegation, error) {
+	return dao.GetDelegationsToContext(context.Background(), system, uid)
+}
+
+// GetDelegationsToContext is GetDelegationsTo with context
+func (dao *DelegationDao) GetDelegationsToContext(ctx context.Context, system, uid string) (ds []model.Delegation, err error) {
+	ds = []model.Delegation{}
+	err = dao.FindAllContext(ctx, bson.M{"system": system, "delegate": uid}, &ds, 0, math.MaxInt32, "delegator")
+	return
+}
+
+// CreateDelegation create delegation, replace it if already exist
+func (dao *DelegationDao) CreateDelegation(d *model.Delegation) error {
+	return dao.CreateDelegationContext(context.Background(), d)
+}
+
+// CreateDelegationContext is CreateDelegation with context
+func (dao *DelegationDao) CreateDelegationContext(ctx context.Context, d *model.Delegation) error {
+	return dao.UpsertContext(ctx, bson.M{"system": d.System, "delegator": d.Delegator, "delegate": d.Delegate}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"roles":      d.Roles,
+			"valid_from": d.ValidFrom,
+			"expires_at": d.ExpiresAt,
+			"transitive": d.Transitive,
+		},
+	})
+}
+
+// RemoveDelegation remove delegation from delegator to delegate
+func (dao *DelegationDao) RemoveDelegation(system, delegator, delegate string) error {
+	return dao.RemoveDelegationContext(context.Background(), system, delegator, delegate)
+}
+
+// RemoveDelegationContext is RemoveDelegation with context
+func (dao *DelegationDao) RemoveDelegationContext(ctx context.Context, system, delegator, delegate string) error {
+	return dao.RemoveContext(ctx, bson.M{"system": system, "delegator": delegator, "delegate": delegate})
+}
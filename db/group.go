@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"math"
+
+	"github.com/nzqpeace/rbac/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GroupList is name of collection
+const GroupList = "groups"
+
+// GroupDao define dao of group
+type GroupDao struct {
+	*Base
+}
+
+// NewGroupDao create a new instance of GroupDao
+func NewGroupDao(db *DataBase) *GroupDao {
+	return &GroupDao{
+		NewBase(db, GroupList),
+	}
+}
+
+// GetGroup get specified group
+func (dao *GroupDao) GetGroup(system, name string) (model.Group, error) {
+	return dao.GetGroupContext(context.Background(), system, name)
+}
+
+// GetGroupContext is GetGroup with context
+func (dao *GroupDao) GetGroupContext(ctx context.Context, system, name string) (group model.Group, err error) {
+	err = dao.FindContext(ctx, bson.M{"system": system, "name": name}, &group)
+	return
+}
+
+// GetAllGroups get all groups of specified system
+func (dao *GroupDao) GetAllGroups(system string) ([]model.Group, error) {
+	return dao.GetAllGroupsContext(context.Background(), system)
+}
+
+// GetAllGroupsContext is GetAllGroups with context
+func (dao *GroupDao) GetAllGroupsContext(ctx context.Context, system string) (groups []model.Group, err error) {
+	err = dao.FindAllContext(ctx, bson.M{"system": system}, &groups, 0, math.MaxInt32, "name")
+	return
+}
+
+// GetGroupsOfUser list groups which have uid as member
+func (dao *GroupDao) GetGroupsOfUser(system, uid string) ([]model.Group, error) {
+	return dao.GetGroupsOfUserContext(context.Background(), system, uid)
+}
+
+// GetGroupsOfUserContext is GetGroupsOfUser with context
+func (dao *GroupDao) GetGroupsOfUserContext(ctx context.Context, system, uid string) (groups []model.Group, err error) {
+	err = dao.FindAllContext(ctx, bson.M{"system": system, "members": uid}, &groups, 0, math.MaxInt32, "name")
+	return
+}
+
+// CreateGroup create group, replace it if already exist
+func (dao *GroupDao) CreateGroup(group *model.Group) error {
+	return dao.CreateGroupContext(context.Background(), group)
+}
+
+// CreateGroupContext is CreateGroup with context
+func (dao *GroupDao) CreateGroupContext(ctx context.Context, group *model.Group) error {
+	return dao.UpsertContext(ctx, bson.M{"system": group.System, "name": group.Name}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"desc":    group.Desc,
+			"roles":   group.Roles,
+			"members": group.Members,
+		},
+	})
+}
+
+// RemoveGroup remove specified group
+func (dao *GroupDao) RemoveGroup(system, name string) error {
+	return dao.RemoveGroupContext(context.Background(), system, name)
+}
+
+// RemoveGroupContext is RemoveGroup with context
+func (dao *GroupDao) RemoveGroupContext(ctx context.Context, system, name string) error {
+	return dao.RemoveContext(ctx, bson.M{"system": system, "name": name})
+}
+
+// addToSet add values into array field of specified group, values already present are ignored
+func (dao *GroupDao) addToSet(ctx context.Context, system, name, field string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$addToSet": bson.M{
+			field: bson.M{
+				"$each": values,
+			},
+		},
+	})
+}
+
+// pull remove value from array field of specified group
+func (dao *GroupDao) pull(ctx context.Context, system, name, field, value string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$pull": bson.M{
+			field: value,
+		},
+	})
+}
+
+// AddMembers add users to group
+func (dao *GroupDao) AddMembers(system, name string, uids ...string) error {
+	return dao.AddMembersContext(context.Background(), system, name, uids...)
+}
+
+// AddMembersContext is AddMembers with context
+func (dao *GroupDao) AddMembersContext(ctx context.Context, system, name string, uids ...string) error {
+	return dao.addToSet(ctx, system, name, "members", uids)
+}
+
+// RemoveMember remove user from group
+func (dao *GroupDao) RemoveMember(system, name string, uid string) error {
+	return dao.RemoveMemberContext(context.Background(), system, name, uid)
+}
+
+// RemoveMemberContext is RemoveMember with context
+func (dao *GroupDao) RemoveMemberContext(ctx context.Context, system, name string, uid string) error {
+	return dao.pull(ctx, system, name, "members", uid)
+}
+
+// RemoveMemberFromAll remove user from all groups of system
+func (dao *GroupDao) RemoveMemberFromAll(system, uid string) ([]string, error) {
+	return dao.RemoveMemberFromAllContext(context.Background(), system, uid)
+}
+
+// RemoveMemberFromAllContext is RemoveMemberFromAll with context
+func (dao *GroupDao) RemoveMemberFromAllContext(ctx context.Context, system, uid string) (names []string, err error) {
+	err = dao.cascade(ctx, func(ctx context.Context) (err error) {
+		names, err = pullRefs(ctx, dao.db.C(GroupList), "name", system, uid, "members")
+		return
+	})
+	return
+}
+
+// AddRoles add roles to group
+func (dao *GroupDao) AddRoles(system, name string, roles ...string) error {
+	return dao.AddRolesContext(context.Background(), system, name, roles...)
+}
+
+// AddRolesContext is AddRoles with context
+func (dao *GroupDao) AddRolesContext(ctx context.Context, system, name string, roles ...string) error {
+	return dao.addToSet(ctx, system, name, "roles", roles)
+}
+
+// RemoveRole remove role from group
+func (dao *GroupDao) RemoveRole(system, name string, role string) error {
+	return dao.RemoveRoleContext(context.Background(), system, name, role)
+}
+
+// RemoveRoleContext is RemoveRole with context
+func (dao *GroupDao) RemoveRoleContext(ctx context.Context, system, name string, role string) error {
+	return dao.pull(ctx, system, name, "roles", role)
+}
@@ -0,0 +1,112 @@
+package kvstore
+
+import (
+	"context"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltConfig is configuration of bolt storage
+type BoltConfig struct {
+	// Path of database file, it's created if not exist
+	Path string `json:"path"`
+}
+
+// BoltEngine is an Engine which persist data into a single bolt database file,
+// buckets are created on first write
+type BoltEngine struct {
+	db *bolt.DB
+}
+
+// OpenBoltEngine open database file at path, it fails if the file is locked by another process for one second
+func OpenBoltEngine(path string) (*BoltEngine, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltEngine{db}, nil
+}
+
+// OpenBoltStore create a store persisted at specified bolt database file
+func OpenBoltStore(config *BoltConfig) (*Store, error) {
+	engine, err := OpenBoltEngine(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(engine), nil
+}
+
+// View run fn within a read-only transaction
+func (e *BoltEngine) View(ctx context.Context, fn func(tx Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+// Update run fn within a read-write transaction
+func (e *BoltEngine) Update(ctx context.Context, fn func(tx Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+// Close close database file
+func (e *BoltEngine) Close() error {
+	return e.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// Get copy value out, memory returned by bolt is only valid within the transaction
+func (t *boltTx) Get(bucket, key string) []byte {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	v := b.Get([]byte(key))
+	if v == nil {
+		return nil
+	}
+	return append([]byte{}, v...)
+}
+
+func (t *boltTx) Put(bucket, key string, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), value)
+}
+
+func (t *boltTx) Delete(bucket, key string) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(key))
+}
+
+func (t *boltTx) ForEach(bucket, prefix string, fn func(key string, value []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	c := b.Cursor()
+	for k, v := c.Seek([]byte(prefix)); k != nil && hasPrefix(string(k), prefix); k, v = c.Next() {
+		if err := fn(string(k), append([]byte{}, v...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package kvstore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoltEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rbac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	e, err := OpenBoltEngine(filepath.Join(dir, "engine.db"))
+	assert.Nil(t, err)
+	defer e.Close()
+
+	assert.Nil(t, e.Update(ctx, func(tx Tx) error {
+		assert.Nil(t, tx.Put("bucket", "b", []byte("2")))
+		return tx.Put("bucket", "a", []byte("1"))
+	}))
+
+	// failed transaction leave no trace
+	failed := errors.New("failed")
+	assert.Equal(t, failed, e.Update(ctx, func(tx Tx) error {
+		assert.Nil(t, tx.Delete("bucket", "a"))
+		assert.Nil(t, tx.Put("bucket", "c", []byte("3")))
+		return failed
+	}))
+
+	assert.Nil(t, e.View(ctx, func(tx Tx) error {
+		assert.Equal(t, []byte("1"), tx.Get("bucket", "a"))
+		assert.Nil(t, tx.Get("bucket", "c"))
+		assert.Nil(t, tx.Get("not_exist", "a"))
+		assert.NotNil(t, tx.Put("bucket", "c", []byte("3")))
+
+		ks, err := keys(tx, "bucket", "")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "b"}, ks)
+		return nil
+	}))
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rbac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &BoltConfig{Path: filepath.Join(dir, "rbac.db")}
+	s, err := OpenBoltStore(config)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.Roles().CreateRoleContext(ctx, model.NewRole(system, "common", "", "read", "write")))
+	assert.Nil(t, s.Roles().CreateRoleContext(ctx, model.NewRole(system+"_other", "common", "", "read")))
+	assert.Nil(t, s.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, "uid_common", "common")))
+	assert.Nil(t, s.Close())
+
+	// data survive reopen
+	s, err = OpenBoltStore(config)
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rs, err := s.Roles().GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rs))
+	assert.Equal(t, 2, len(rs[0].Permissions))
+
+	roles, err := s.Users().GetAllRolesContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"common"}, roles)
+}
@@ -0,0 +1,535 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// pullRef remove all occurrences of value from list, report whether list is changed
+func pullRef(list *[]string, value string) bool {
+	res := pull(*list, value)
+	if len(res) == len(*list) {
+		return false
+	}
+	*list = res
+	return true
+}
+
+// renameRef replace all occurrences of oldvalue in list with newvalue, they give way to an existing
+// newvalue, report whether list is changed
+func renameRef(list *[]string, oldvalue, newvalue string) (changed bool) {
+	if contains(*list, newvalue) {
+		return pullRef(list, oldvalue)
+	}
+	for i, v := range *list {
+		if v == oldvalue {
+			(*list)[i] = newvalue
+			changed = true
+		}
+	}
+	return
+}
+
+// containsGrant report whether grants contains grant
+func containsGrant(grants []model.Grant, grant model.Grant) bool {
+	for _, g := range grants {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// pullGrants remove grants matched by fn, report whether grants is changed
+func pullGrants(grants *[]model.Grant, fn func(g model.Grant) bool) bool {
+	res := []model.Grant{}
+	for _, g := range *grants {
+		if !fn(g) {
+			res = append(res, g)
+		}
+	}
+	if len(res) == len(*grants) {
+		return false
+	}
+	*grants = res
+	return true
+}
+
+// pullConditions remove conditions of permission, report whether conditions is changed
+func pullConditions(conditions *[]model.Condition, permission string) bool {
+	res := []model.Condition{}
+	for _, c := range *conditions {
+		if c.Permission != permission {
+			res = append(res, c)
+		}
+	}
+	if len(res) == len(*conditions) {
+		return false
+	}
+	*conditions = res
+	return true
+}
+
+// pullWindows remove windows of name, report whether windows is changed
+func pullWindows(windows *[]model.Window, name string) bool {
+	res := []model.Window{}
+	for _, w := range *windows {
+		if w.Name != name {
+			res = append(res, w)
+		}
+	}
+	if len(res) == len(*windows) {
+		return false
+	}
+	*windows = res
+	return true
+}
+
+// renameWindows rename windows of oldname to newname, they give way to an existing one of newname,
+// report whether windows is changed
+func renameWindows(windows *[]model.Window, oldname, newname string) (changed bool) {
+	for _, w := range *windows {
+		if w.Name == newname {
+			return pullWindows(windows, oldname)
+		}
+	}
+	for i := range *windows {
+		if (*windows)[i].Name == oldname {
+			(*windows)[i].Name = newname
+			changed = true
+		}
+	}
+	return
+}
+
+// pullProvenance remove provenance of name, report whether provenance is changed
+func pullProvenance(provenance *[]model.Provenance, name string) bool {
+	res := []model.Provenance{}
+	for _, p := range *provenance {
+		if p.Name != name {
+			res = append(res, p)
+		}
+	}
+	if len(res) == len(*provenance) {
+		return false
+	}
+	*provenance = res
+	return true
+}
+
+// renameProvenance rename provenance of oldname to newname, it gives way to an existing one of newname,
+// report whether provenance is changed
+func renameProvenance(provenance *[]model.Provenance, oldname, newname string) (changed bool) {
+	for _, p := range *provenance {
+		if p.Name == newname {
+			return pullProvenance(provenance, oldname)
+		}
+	}
+	for i := range *provenance {
+		if (*provenance)[i].Name == oldname {
+			(*provenance)[i].Name = newname
+			changed = true
+		}
+	}
+	return
+}
+
+// pullDomainEntries remove entries of name within all domains, report whether entries is changed
+func pullDomainEntries(entries *[]model.DomainEntry, name string) bool {
+	res := []model.DomainEntry{}
+	for _, e := range *entries {
+		if e.Name != name {
+			res = append(res, e)
+		}
+	}
+	if len(res) == len(*entries) {
+		return false
+	}
+	*entries = res
+	return true
+}
+
+// renameDomainEntries rename entries of oldname to newname within all domains, an entry gives way to
+// an existing one of newname, report whether entries is changed
+func renameDomainEntries(entries *[]model.DomainEntry, oldname, newname string) bool {
+	res := []model.DomainEntry{}
+	changed := false
+	for _, e := range *entries {
+		if e.Name != oldname {
+			res = append(res, e)
+			continue
+		}
+		changed = true
+		renamed := e
+		renamed.Name = newname
+		if !containsDomainEntry(*entries, renamed) {
+			res = append(res, renamed)
+		}
+	}
+	*entries = res
+	return changed
+}
+
+// containsDomainEntry report whether entries contains e, whatever their provenance
+func containsDomainEntry(entries []model.DomainEntry, e model.DomainEntry) bool {
+	for _, v := range entries {
+		if v.Domain == e.Domain && v.Name == e.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// cascadeRoles apply fn to all roles of system, roles changed by fn are stored back and their names returned
+func cascadeRoles(tx Tx, system string, fn func(role *model.Role) bool) ([]string, error) {
+	var roles []model.Role
+	err := tx.ForEach(db.RoleList, systemPrefix(system), func(key string, value []byte) error {
+		var role model.Role
+		if err := json.Unmarshal(value, &role); err != nil {
+			return err
+		}
+		roles = append(roles, role)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// bucket can't be modified while iterating
+	names := []string{}
+	for i := range roles {
+		if !fn(&roles[i]) {
+			continue
+		}
+		roles[i].Revision++
+		if err := put(tx, db.RoleList, docKey(system, roles[i].Name), &roles[i]); err != nil {
+			return nil, err
+		}
+		names = append(names, roles[i].Name)
+	}
+	return names, nil
+}
+
+// cascadeUsers apply fn to all users of system, users changed by fn are stored back and their uids returned
+func cascadeUsers(tx Tx, system string, fn func(user *model.UserPermModel) bool) ([]string, error) {
+	var users []model.UserPermModel
+	err := tx.ForEach(db.UserList, systemPrefix(system), func(key string, value []byte) error {
+		var user model.UserPermModel
+		if err := json.Unmarshal(value, &user); err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uids := []string{}
+	for i := range users {
+		if !fn(&users[i]) {
+			continue
+		}
+		users[i].Revision++
+		if err := put(tx, db.UserList, docKey(system, users[i].UID), &users[i]); err != nil {
+			return nil, err
+		}
+		uids = append(uids, users[i].UID)
+	}
+	return uids, nil
+}
+
+// cascadeGroups apply fn to all groups of system, groups changed by fn are stored back and their names returned
+func cascadeGroups(tx Tx, system string, fn func(group *model.Group) bool) ([]string, error) {
+	var groups []model.Group
+	err := tx.ForEach(db.GroupList, systemPrefix(system), func(key string, value []byte) error {
+		var group model.Group
+		if err := json.Unmarshal(value, &group); err != nil {
+			return err
+		}
+		groups = append(groups, group)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for i := range groups {
+		if !fn(&groups[i]) {
+			continue
+		}
+		groups[i].Revision++
+		if err := put(tx, db.GroupList, docKey(system, groups[i].Name), &groups[i]); err != nil {
+			return nil, err
+		}
+		names = append(names, groups[i].Name)
+	}
+	return names, nil
+}
+
+// cascadeSoDRules apply fn to all separation-of-duty rules of system, rules changed by fn are stored back
+func cascadeSoDRules(tx Tx, system string, fn func(rule *model.SoDRule) bool) error {
+	var rules []model.SoDRule
+	err := tx.ForEach(db.SoDRuleList, systemPrefix(system), func(key string, value []byte) error {
+		var rule model.SoDRule
+		if err := json.Unmarshal(value, &rule); err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range rules {
+		if !fn(&rules[i]) {
+			continue
+		}
+		rules[i].Revision++
+		if err := put(tx, db.SoDRuleList, docKey(system, rules[i].Name), &rules[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cascadeDelegations apply fn to all delegations of system, delegations changed by fn are stored back,
+// return uids of their delegates in ascending order
+func cascadeDelegations(tx Tx, system string, fn func(d *model.Delegation) bool) ([]string, error) {
+	ds, err := delegations(tx, systemPrefix(system), fn)
+	if err != nil {
+		return nil, err
+	}
+
+	delegates, seen := []string{}, map[string]bool{}
+	for i := range ds {
+		ds[i].Revision++
+		if err := put(tx, db.DelegationList, delegationKey(system, ds[i].Delegator, ds[i].Delegate), &ds[i]); err != nil {
+			return nil, err
+		}
+		if !seen[ds[i].Delegate] {
+			seen[ds[i].Delegate] = true
+			delegates = append(delegates, ds[i].Delegate)
+		}
+	}
+	sort.Strings(delegates)
+	return delegates, nil
+}
+
+// cascadeSystem apply fn to system if it's registered, it's stored back if changed by fn
+func cascadeSystem(tx Tx, system string, fn func(s *model.System) bool) error {
+	var s model.System
+	if err := get(tx, db.SystemList, system, &s); err == db.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !fn(&s) {
+		return nil
+	}
+	s.Revision++
+	return put(tx, db.SystemList, system, &s)
+}
+
+// RemovePermissionCascadeContext remove permission together with its references in roles, including their denied permissions and conditions, and users
+func (dao *PermissionDao) RemovePermissionCascadeContext(ctx context.Context, system, name string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}}
+	err = dao.engine.Update(ctx, func(tx Tx) (err error) {
+		if err = remove(tx, db.PermissionsList, docKey(system, name)); err != nil {
+			return
+		}
+
+		affected.Roles, err = cascadeRoles(tx, system, func(role *model.Role) bool {
+			ps, ds, cs := pullRef(&role.Permissions, name), pullRef(&role.Denied, name), pullConditions(&role.Conditions, name)
+			return ps || ds || cs
+		})
+		if err != nil {
+			return
+		}
+		affected.Users, err = cascadeUsers(tx, system, func(user *model.UserPermModel) bool {
+			wl, bl := pullRef(&user.WhiteList, name), pullRef(&user.BlackList, name)
+			gs := pullGrants(&user.Grants, func(g model.Grant) bool {
+				return g.Permission == name
+			})
+			ws := pullWindows(&user.WhiteListWindows, name)
+			ws = pullWindows(&user.BlackListWindows, name) || ws
+			ds := pullDomainEntries(&user.DomainWhiteList, name)
+			ds = pullDomainEntries(&user.DomainBlackList, name) || ds
+			ps := pullProvenance(&user.WhiteListProvenance, name)
+			ps = pullProvenance(&user.BlackListProvenance, name) || ps
+			return wl || bl || gs || ws || ds || ps
+		})
+		return
+	})
+	return
+}
+
+// UpdatePermissionCascadeContext rename permission together with its references in roles, including their denied permissions and conditions, and users
+func (dao *PermissionDao) UpdatePermissionCascadeContext(ctx context.Context, system, oldname, newname string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}}
+	err = dao.engine.Update(ctx, func(tx Tx) (err error) {
+		var p model.Permission
+		err = rename(tx, db.PermissionsList, docKey(system, oldname), docKey(system, newname), &p, func() {
+			p.Name = newname
+		})
+		if err != nil || oldname == newname {
+			return
+		}
+
+		affected.Roles, err = cascadeRoles(tx, system, func(role *model.Role) bool {
+			ps, ds, cs := renameRef(&role.Permissions, oldname, newname), renameRef(&role.Denied, oldname, newname), false
+			// each permission has one condition at most, the renamed one gives way to an existing one
+			for _, c := range role.Conditions {
+				if c.Permission == newname {
+					cs = pullConditions(&role.Conditions, oldname)
+					break
+				}
+			}
+			for i := range role.Conditions {
+				if role.Conditions[i].Permission == oldname {
+					role.Conditions[i].Permission = newname
+					cs = true
+				}
+			}
+			return ps || ds || cs
+		})
+		if err != nil {
+			return
+		}
+		affected.Users, err = cascadeUsers(tx, system, func(user *model.UserPermModel) bool {
+			wl, bl := renameRef(&user.WhiteList, oldname, newname), renameRef(&user.BlackList, oldname, newname)
+			// a grant gives way to an existing one of newname on the same resource
+			gs := pullGrants(&user.Grants, func(g model.Grant) bool {
+				return g.Permission == oldname && containsGrant(user.Grants, model.Grant{Permission: newname, Resource: g.Resource})
+			})
+			for i := range user.Grants {
+				if user.Grants[i].Permission == oldname {
+					user.Grants[i].Permission = newname
+					gs = true
+				}
+			}
+			ws := renameWindows(&user.WhiteListWindows, oldname, newname)
+			ws = renameWindows(&user.BlackListWindows, oldname, newname) || ws
+			ds := renameDomainEntries(&user.DomainWhiteList, oldname, newname)
+			ds = renameDomainEntries(&user.DomainBlackList, oldname, newname) || ds
+			ps := renameProvenance(&user.WhiteListProvenance, oldname, newname)
+			ps = renameProvenance(&user.BlackListProvenance, oldname, newname) || ps
+			return wl || bl || gs || ws || ds || ps
+		})
+		return
+	})
+	return
+}
+
+// RemoveRoleCascadeContext remove role and revoke it from users, groups, children and delegations, it's dropped from
+// separation-of-duty rules and default roles of system too
+func (dao *RoleDao) RemoveRoleCascadeContext(ctx context.Context, system, name string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}, Groups: []string{}, Delegates: []string{}}
+	err = dao.engine.Update(ctx, func(tx Tx) (err error) {
+		if err = remove(tx, db.RoleList, docKey(system, name)); err != nil {
+			return
+		}
+
+		affected.Roles, err = cascadeRoles(tx, system, func(role *model.Role) bool {
+			ps, rs := pullRef(&role.Parents, name), pullRef(&role.Prerequisites, name)
+			return ps || rs
+		})
+		if err != nil {
+			return
+		}
+		affected.Groups, err = cascadeGroups(tx, system, func(group *model.Group) bool {
+			return pullRef(&group.Roles, name)
+		})
+		if err != nil {
+			return
+		}
+		err = cascadeSoDRules(tx, system, func(rule *model.SoDRule) bool {
+			return pullRef(&rule.Roles, name)
+		})
+		if err != nil {
+			return
+		}
+		err = cascadeSystem(tx, system, func(s *model.System) bool {
+			return pullRef(&s.DefaultRoles, name)
+		})
+		if err != nil {
+			return
+		}
+		affected.Delegates, err = cascadeDelegations(tx, system, func(d *model.Delegation) bool {
+			return pullRef(&d.Roles, name)
+		})
+		if err != nil {
+			return
+		}
+		affected.Users, err = cascadeUsers(tx, system, func(user *model.UserPermModel) bool {
+			rs, ws, ds := pullRef(&user.Roles, name), pullWindows(&user.RoleWindows, name), pullDomainEntries(&user.DomainRoles, name)
+			ps := pullProvenance(&user.RoleProvenance, name)
+			return rs || ws || ds || ps
+		})
+		return
+	})
+	return
+}
+
+// UpdateRoleNameCascadeContext rename role together with its references in users, groups, children, delegations,
+// separation-of-duty rules and default roles of system
+func (dao *RoleDao) UpdateRoleNameCascadeContext(ctx context.Context, system, oldname, newname string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}, Groups: []string{}, Delegates: []string{}}
+	err = dao.engine.Update(ctx, func(tx Tx) (err error) {
+		var role model.Role
+		err = rename(tx, db.RoleList, docKey(system, oldname), docKey(system, newname), &role, func() {
+			role.Name = newname
+			role.Revision++
+		})
+		if err != nil || oldname == newname {
+			return
+		}
+
+		affected.Roles, err = cascadeRoles(tx, system, func(role *model.Role) bool {
+			ps, rs := renameRef(&role.Parents, oldname, newname), renameRef(&role.Prerequisites, oldname, newname)
+			return ps || rs
+		})
+		if err != nil {
+			return
+		}
+		affected.Groups, err = cascadeGroups(tx, system, func(group *model.Group) bool {
+			return renameRef(&group.Roles, oldname, newname)
+		})
+		if err != nil {
+			return
+		}
+		err = cascadeSoDRules(tx, system, func(rule *model.SoDRule) bool {
+			return renameRef(&rule.Roles, oldname, newname)
+		})
+		if err != nil {
+			return
+		}
+		err = cascadeSystem(tx, system, func(s *model.System) bool {
+			return renameRef(&s.DefaultRoles, oldname, newname)
+		})
+		if err != nil {
+			return
+		}
+		affected.Delegates, err = cascadeDelegations(tx, system, func(d *model.Delegation) bool {
+			return renameRef(&d.Roles, oldname, newname)
+		})
+		if err != nil {
+			return
+		}
+		affected.Users, err = cascadeUsers(tx, system, func(user *model.UserPermModel) bool {
+			rs, ws := renameRef(&user.Roles, oldname, newname), renameWindows(&user.RoleWindows, oldname, newname)
+			ds := renameDomainEntries(&user.DomainRoles, oldname, newname)
+			ps := renameProvenance(&user.RoleProvenance, oldname, newname)
+			return rs || ws || ds || ps
+		})
+		return
+	})
+	return
+}
@@ -0,0 +1,60 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// ConstraintDao is the key/value implementation of db.ConstraintStore
+type ConstraintDao struct {
+	engine Engine
+}
+
+// GetSoDRuleContext get specified rule
+func (dao *ConstraintDao) GetSoDRuleContext(ctx context.Context, system, name string) (rule model.SoDRule, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return get(tx, db.SoDRuleList, docKey(system, name), &rule)
+	})
+	return
+}
+
+// GetAllSoDRulesContext get all rules of specified system
+func (dao *ConstraintDao) GetAllSoDRulesContext(ctx context.Context, system string) (rules []model.SoDRule, err error) {
+	rules = []model.SoDRule{}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.SoDRuleList, systemPrefix(system), func(key string, value []byte) error {
+			var rule model.SoDRule
+			if err := json.Unmarshal(value, &rule); err != nil {
+				return err
+			}
+			rules = append(rules, rule)
+			return nil
+		})
+	})
+	return
+}
+
+// CreateSoDRuleContext create rule, replace it if already exist
+func (dao *ConstraintDao) CreateSoDRuleContext(ctx context.Context, rule *model.SoDRule) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.SoDRule
+		key := docKey(rule.System, rule.Name)
+		if err := get(tx, db.SoDRuleList, key, &old); err != nil && err != db.ErrNotFound {
+			return err
+		}
+
+		r := *rule
+		r.Revision = old.Revision + 1
+		return put(tx, db.SoDRuleList, key, &r)
+	})
+}
+
+// RemoveSoDRuleContext remove specified rule
+func (dao *ConstraintDao) RemoveSoDRuleContext(ctx context.Context, system, name string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return remove(tx, db.SoDRuleList, docKey(system, name))
+	})
+}
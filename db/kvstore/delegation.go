@@ -0,0 +1,98 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// DelegationDao is the key/value implementation of db.DelegationStore, delegations are stored under
+// "{system}\x00{delegator}\x00{delegate}" keys
+type DelegationDao struct {
+	engine Engine
+}
+
+func delegationKey(system, delegator, delegate string) string {
+	return docKey(system, delegator+keySep+delegate)
+}
+
+// delegations list delegations of system under prefix which fn accepts
+func delegations(tx Tx, prefix string, fn func(d *model.Delegation) bool) ([]model.Delegation, error) {
+	ds := []model.Delegation{}
+	err := tx.ForEach(db.DelegationList, prefix, func(key string, value []byte) error {
+		var d model.Delegation
+		if err := json.Unmarshal(value, &d); err != nil {
+			return err
+		}
+		if fn(&d) {
+			ds = append(ds, d)
+		}
+		return nil
+	})
+	return ds, err
+}
+
+// GetDelegationContext get delegation from delegator to delegate
+func (dao *DelegationDao) GetDelegationContext(ctx context.Context, system, delegator, delegate string) (d model.Delegation, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return get(tx, db.DelegationList, delegationKey(system, delegator, delegate), &d)
+	})
+	return
+}
+
+// GetAllDelegationsContext get all delegations of specified system
+func (dao *DelegationDao) GetAllDelegationsContext(ctx context.Context, system string) (ds []model.Delegation, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) (err error) {
+		ds, err = delegations(tx, systemPrefix(system), func(d *model.Delegation) bool {
+			return true
+		})
+		return
+	})
+	return
+}
+
+// GetDelegationsFromContext list delegations made by uid
+func (dao *DelegationDao) GetDelegationsFromContext(ctx context.Context, system, uid string) (ds []model.Delegation, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) (err error) {
+		ds, err = delegations(tx, docKey(system, uid)+keySep, func(d *model.Delegation) bool {
+			return true
+		})
+		return
+	})
+	return
+}
+
+// GetDelegationsToContext list delegations received by uid
+func (dao *DelegationDao) GetDelegationsToContext(ctx context.Context, system, uid string) (ds []model.Delegation, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) (err error) {
+		ds, err = delegations(tx, systemPrefix(system), func(d *model.Delegation) bool {
+			return d.Delegate == uid
+		})
+		return
+	})
+	return
+}
+
+// CreateDelegationContext create delegation, replace it if already exist
+func (dao *DelegationDao) CreateDelegationContext(ctx context.Context, d *model.Delegation) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.Delegation
+		key := delegationKey(d.System, d.Delegator, d.Delegate)
+		if err := get(tx, db.DelegationList, key, &old); err != nil && err != db.ErrNotFound {
+			return err
+		}
+
+		v := *d
+		v.Revision = old.Revision + 1
+		return put(tx, db.DelegationList, key, &v)
+	})
+}
+
+// RemoveDelegationContext remove delegation from delegator to delegate
+func (dao *DelegationDao) RemoveDelegationContext(ctx context.Context, system, delegator, delegate string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return remove(tx, db.DelegationList, delegationKey(system, delegator, delegate))
+	})
+}
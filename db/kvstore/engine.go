@@ -0,0 +1,119 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/nzqpeace/rbac/db"
+)
+
+// keySep separates system from name/uid inside a key, it sorts before any printable character
+// so that all documents of a system are stored next to each other
+const keySep = "\x00"
+
+var errReadOnly = errors.New("write within read-only transaction")
+
+// Engine is a transactional key/value storage, documents are grouped by bucket
+type Engine interface {
+	// View run fn within a read-only transaction, fn is not called if ctx is already done
+	View(ctx context.Context, fn func(tx Tx) error) error
+	// Update run fn within a read-write transaction, changes are discarded if fn return error
+	Update(ctx context.Context, fn func(tx Tx) error) error
+	Close() error
+}
+
+// Tx is a transaction of engine
+type Tx interface {
+	// Get return value of key, nil if not exist
+	Get(bucket, key string) []byte
+	Put(bucket, key string, value []byte) error
+	Delete(bucket, key string) error
+	// ForEach iterate all keys with specified prefix in ascending order
+	ForEach(bucket, prefix string, fn func(key string, value []byte) error) error
+}
+
+func docKey(system, name string) string {
+	return system + keySep + name
+}
+
+func systemPrefix(system string) string {
+	return system + keySep
+}
+
+// get decode document stored at key into v
+func get(tx Tx, bucket, key string, v interface{}) error {
+	data := tx.Get(bucket, key)
+	if data == nil {
+		return db.ErrNotFound
+	}
+	return json.Unmarshal(data, v)
+}
+
+// put encode v and store it at key
+func put(tx Tx, bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Put(bucket, key, data)
+}
+
+// remove delete key, return db.ErrNotFound if key is not exist
+func remove(tx Tx, bucket, key string) error {
+	if tx.Get(bucket, key) == nil {
+		return db.ErrNotFound
+	}
+	return tx.Delete(bucket, key)
+}
+
+// rename move document from oldkey to newkey after fn modified it
+func rename(tx Tx, bucket, oldkey, newkey string, v interface{}, fn func()) error {
+	if err := get(tx, bucket, oldkey, v); err != nil {
+		return err
+	}
+	if oldkey != newkey && tx.Get(bucket, newkey) != nil {
+		return db.ErrAlreadyExists
+	}
+
+	fn()
+	if err := tx.Delete(bucket, oldkey); err != nil {
+		return err
+	}
+	return put(tx, bucket, newkey, v)
+}
+
+// pull remove all occurrences of value from slice
+func pull(slice []string, value string) []string {
+	res := []string{}
+	for _, s := range slice {
+		if s != value {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// contains report whether slice contains value
+func contains(slice []string, value string) bool {
+	for _, s := range slice {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// keys collect all keys with specified prefix
+func keys(tx Tx, bucket, prefix string) (ks []string, err error) {
+	err = tx.ForEach(bucket, prefix, func(key string, value []byte) error {
+		ks = append(ks, key)
+		return nil
+	})
+	return
+}
+
+func hasPrefix(key, prefix string) bool {
+	return strings.HasPrefix(key, prefix)
+}
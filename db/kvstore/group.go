@@ -0,0 +1,145 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// GroupDao is the key/value implementation of db.GroupStore
+type GroupDao struct {
+	engine Engine
+}
+
+// modify load group, apply fn and store it back within one transaction
+func (dao *GroupDao) modify(ctx context.Context, system, name string, fn func(group *model.Group)) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var group model.Group
+		key := docKey(system, name)
+		if err := get(tx, db.GroupList, key, &group); err != nil {
+			return err
+		}
+		fn(&group)
+		group.Revision++
+		return put(tx, db.GroupList, key, &group)
+	})
+}
+
+// GetGroupContext get specified group
+func (dao *GroupDao) GetGroupContext(ctx context.Context, system, name string) (group model.Group, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return get(tx, db.GroupList, docKey(system, name), &group)
+	})
+	return
+}
+
+// GetAllGroupsContext get all groups of specified system
+func (dao *GroupDao) GetAllGroupsContext(ctx context.Context, system string) ([]model.Group, error) {
+	return dao.find(ctx, system, func(group *model.Group) bool {
+		return true
+	})
+}
+
+// GetGroupsOfUserContext list groups which have uid as member
+func (dao *GroupDao) GetGroupsOfUserContext(ctx context.Context, system, uid string) ([]model.Group, error) {
+	return dao.find(ctx, system, func(group *model.Group) bool {
+		return contains(group.Members, uid)
+	})
+}
+
+// find list groups of system matched by fn
+func (dao *GroupDao) find(ctx context.Context, system string, fn func(group *model.Group) bool) (groups []model.Group, err error) {
+	groups = []model.Group{}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.GroupList, systemPrefix(system), func(key string, value []byte) error {
+			var group model.Group
+			if err := json.Unmarshal(value, &group); err != nil {
+				return err
+			}
+			if fn(&group) {
+				groups = append(groups, group)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// CreateGroupContext create group, replace it if already exist
+func (dao *GroupDao) CreateGroupContext(ctx context.Context, group *model.Group) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.Group
+		key := docKey(group.System, group.Name)
+		if err := get(tx, db.GroupList, key, &old); err != nil && err != db.ErrNotFound {
+			return err
+		}
+
+		g := *group
+		g.Revision = old.Revision + 1
+		return put(tx, db.GroupList, key, &g)
+	})
+}
+
+// RemoveGroupContext remove specified group
+func (dao *GroupDao) RemoveGroupContext(ctx context.Context, system, name string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return remove(tx, db.GroupList, docKey(system, name))
+	})
+}
+
+// AddMembersContext add users to group, members already present are ignored
+func (dao *GroupDao) AddMembersContext(ctx context.Context, system, name string, uids ...string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, name, func(group *model.Group) {
+		for _, uid := range uids {
+			if !contains(group.Members, uid) {
+				group.Members = append(group.Members, uid)
+			}
+		}
+	})
+}
+
+// RemoveMemberContext remove user from group
+func (dao *GroupDao) RemoveMemberContext(ctx context.Context, system, name string, uid string) error {
+	return dao.modify(ctx, system, name, func(group *model.Group) {
+		group.Members = pull(group.Members, uid)
+	})
+}
+
+// RemoveMemberFromAllContext remove user from all groups of system, return names of changed groups
+func (dao *GroupDao) RemoveMemberFromAllContext(ctx context.Context, system, uid string) (names []string, err error) {
+	err = dao.engine.Update(ctx, func(tx Tx) (err error) {
+		names, err = cascadeGroups(tx, system, func(group *model.Group) bool {
+			return pullRef(&group.Members, uid)
+		})
+		return
+	})
+	return
+}
+
+// AddRolesContext add roles to group, roles already present are ignored
+func (dao *GroupDao) AddRolesContext(ctx context.Context, system, name string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, name, func(group *model.Group) {
+		for _, r := range roles {
+			if !contains(group.Roles, r) {
+				group.Roles = append(group.Roles, r)
+			}
+		}
+	})
+}
+
+// RemoveRoleContext remove role from group
+func (dao *GroupDao) RemoveRoleContext(ctx context.Context, system, name string, role string) error {
+	return dao.modify(ctx, system, name, func(group *model.Group) {
+		group.Roles = pull(group.Roles, role)
+	})
+}
@@ -0,0 +1,134 @@
+package kvstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryEngine is an Engine which keep all data in process memory, it's safe for concurrent use
+type MemoryEngine struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryEngine create an empty memory engine
+func NewMemoryEngine() *MemoryEngine {
+	return &MemoryEngine{
+		buckets: make(map[string]map[string][]byte),
+	}
+}
+
+// View run fn within a read-only transaction
+func (e *MemoryEngine) View(ctx context.Context, fn func(tx Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return fn(&memoryTx{engine: e})
+}
+
+// Update run fn within a read-write transaction, writers are serialized and changes are only
+// published when fn succeed
+func (e *MemoryEngine) Update(ctx context.Context, fn func(tx Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	tx := &memoryTx{
+		engine:   e,
+		writable: true,
+		dirty:    make(map[string]map[string][]byte),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for name, bucket := range tx.dirty {
+		e.buckets[name] = bucket
+	}
+	return nil
+}
+
+// Close release all data
+func (e *MemoryEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.buckets = make(map[string]map[string][]byte)
+	return nil
+}
+
+type memoryTx struct {
+	engine   *MemoryEngine
+	writable bool
+	dirty    map[string]map[string][]byte // copy of buckets modified by this transaction
+}
+
+func (tx *memoryTx) bucket(name string) map[string][]byte {
+	if b, ok := tx.dirty[name]; ok {
+		return b
+	}
+	return tx.engine.buckets[name]
+}
+
+// writableBucket copy bucket on first write, so that a failed transaction leave no trace
+func (tx *memoryTx) writableBucket(name string) map[string][]byte {
+	if b, ok := tx.dirty[name]; ok {
+		return b
+	}
+
+	b := make(map[string][]byte)
+	for k, v := range tx.engine.buckets[name] {
+		b[k] = v
+	}
+	tx.dirty[name] = b
+	return b
+}
+
+func (tx *memoryTx) Get(bucket, key string) []byte {
+	v, ok := tx.bucket(bucket)[key]
+	if !ok {
+		return nil
+	}
+	return append([]byte{}, v...)
+}
+
+func (tx *memoryTx) Put(bucket, key string, value []byte) error {
+	if !tx.writable {
+		return errReadOnly
+	}
+	tx.writableBucket(bucket)[key] = append([]byte{}, value...)
+	return nil
+}
+
+func (tx *memoryTx) Delete(bucket, key string) error {
+	if !tx.writable {
+		return errReadOnly
+	}
+	delete(tx.writableBucket(bucket), key)
+	return nil
+}
+
+func (tx *memoryTx) ForEach(bucket, prefix string, fn func(key string, value []byte) error) error {
+	b := tx.bucket(bucket)
+
+	var ks []string
+	for k := range b {
+		if hasPrefix(k, prefix) {
+			ks = append(ks, k)
+		}
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+		if err := fn(k, append([]byte{}, b[k]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
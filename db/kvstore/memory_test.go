@@ -0,0 +1,38 @@
+package kvstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryEngine(t *testing.T) {
+	e := NewMemoryEngine()
+
+	assert.Nil(t, e.Update(ctx, func(tx Tx) error {
+		assert.Nil(t, tx.Put("bucket", "b", []byte("2")))
+		return tx.Put("bucket", "a", []byte("1"))
+	}))
+
+	// failed transaction leave no trace
+	failed := errors.New("failed")
+	assert.Equal(t, failed, e.Update(ctx, func(tx Tx) error {
+		assert.Nil(t, tx.Delete("bucket", "a"))
+		assert.Nil(t, tx.Put("bucket", "c", []byte("3")))
+		assert.Nil(t, tx.Get("bucket", "a"))
+		return failed
+	}))
+
+	assert.Nil(t, e.View(ctx, func(tx Tx) error {
+		assert.Equal(t, []byte("1"), tx.Get("bucket", "a"))
+		assert.Nil(t, tx.Get("bucket", "c"))
+		assert.Equal(t, errReadOnly, tx.Put("bucket", "c", []byte("3")))
+
+		// keys are iterated in ascending order
+		ks, err := keys(tx, "bucket", "")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "b"}, ks)
+		return nil
+	}))
+}
@@ -0,0 +1,54 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// PermissionDao is the key/value implementation of db.PermissionStore
+type PermissionDao struct {
+	engine Engine
+}
+
+// GetAllPermissionsContext get all permissions of specified system
+func (dao *PermissionDao) GetAllPermissionsContext(ctx context.Context, system string) (ps []model.Permission, err error) {
+	ps = []model.Permission{}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.PermissionsList, systemPrefix(system), func(key string, value []byte) error {
+			var p model.Permission
+			if err := json.Unmarshal(value, &p); err != nil {
+				return err
+			}
+			ps = append(ps, p)
+			return nil
+		})
+	})
+	return
+}
+
+// CreatePermissionContext create permission, replace it if already exist
+func (dao *PermissionDao) CreatePermissionContext(ctx context.Context, p *model.Permission) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return put(tx, db.PermissionsList, docKey(p.System, p.Name), p)
+	})
+}
+
+// RemovePermissionContext remove specified permission
+func (dao *PermissionDao) RemovePermissionContext(ctx context.Context, system, name string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return remove(tx, db.PermissionsList, docKey(system, name))
+	})
+}
+
+// UpdatePermissionContext rename specified permission
+func (dao *PermissionDao) UpdatePermissionContext(ctx context.Context, system, oldname, newname string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var p model.Permission
+		return rename(tx, db.PermissionsList, docKey(system, oldname), docKey(system, newname), &p, func() {
+			p.Name = newname
+		})
+	})
+}
@@ -0,0 +1,215 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// RoleDao is the key/value implementation of db.RoleStore
+type RoleDao struct {
+	engine Engine
+}
+
+// modify load role, apply fn and store it back within one transaction
+func (dao *RoleDao) modify(ctx context.Context, system, name string, fn func(role *model.Role)) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var role model.Role
+		key := docKey(system, name)
+		if err := get(tx, db.RoleList, key, &role); err != nil {
+			return err
+		}
+		fn(&role)
+		role.Revision++
+		return put(tx, db.RoleList, key, &role)
+	})
+}
+
+// GetRoleContext get specified role
+func (dao *RoleDao) GetRoleContext(ctx context.Context, system, name string) (role model.Role, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return get(tx, db.RoleList, docKey(system, name), &role)
+	})
+	return
+}
+
+// GetAllRolesContext get all roles of specified system
+func (dao *RoleDao) GetAllRolesContext(ctx context.Context, system string) (roles []model.Role, err error) {
+	roles = []model.Role{}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.RoleList, systemPrefix(system), func(key string, value []byte) error {
+			var role model.Role
+			if err := json.Unmarshal(value, &role); err != nil {
+				return err
+			}
+			roles = append(roles, role)
+			return nil
+		})
+	})
+	return
+}
+
+// CreateRoleContext create role, replace it if already exist
+func (dao *RoleDao) CreateRoleContext(ctx context.Context, role *model.Role) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.Role
+		key := docKey(role.System, role.Name)
+		if err := get(tx, db.RoleList, key, &old); err != nil && err != db.ErrNotFound {
+			return err
+		}
+
+		r := *role
+		r.Revision = old.Revision + 1
+		return put(tx, db.RoleList, key, &r)
+	})
+}
+
+// RemoveRoleContext remove specified role
+func (dao *RoleDao) RemoveRoleContext(ctx context.Context, system, name string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return remove(tx, db.RoleList, docKey(system, name))
+	})
+}
+
+// RemoveAllRolesContext remove all roles of specified system
+func (dao *RoleDao) RemoveAllRolesContext(ctx context.Context, system string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		ks, err := keys(tx, db.RoleList, systemPrefix(system))
+		if err != nil {
+			return err
+		}
+		for _, k := range ks {
+			if err := tx.Delete(db.RoleList, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateRoleNameContext rename specified role
+func (dao *RoleDao) UpdateRoleNameContext(ctx context.Context, system, oldname, newname string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var role model.Role
+		return rename(tx, db.RoleList, docKey(system, oldname), docKey(system, newname), &role, func() {
+			role.Name = newname
+			role.Revision++
+		})
+	})
+}
+
+// GetPermissionsContext get all permissions of specified role
+func (dao *RoleDao) GetPermissionsContext(ctx context.Context, system, name string) ([]string, error) {
+	role, err := dao.GetRoleContext(ctx, system, name)
+	return role.Permissions, err
+}
+
+// GrantPermissionsContext append permissions to specified role
+func (dao *RoleDao) GrantPermissionsContext(ctx context.Context, system, name string, permissions ...string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		role.Permissions = append(role.Permissions, permissions...)
+	})
+}
+
+// AddParentsContext add parents to specified role, parents already present are ignored
+func (dao *RoleDao) AddParentsContext(ctx context.Context, system, name string, parents ...string) error {
+	if len(parents) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		for _, p := range parents {
+			if !contains(role.Parents, p) {
+				role.Parents = append(role.Parents, p)
+			}
+		}
+	})
+}
+
+// RemoveParentContext remove parent from specified role
+func (dao *RoleDao) RemoveParentContext(ctx context.Context, system, name string, parent string) error {
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		role.Parents = pull(role.Parents, parent)
+	})
+}
+
+// DenyPermissionsContext add permissions denied by specified role, permissions already denied are ignored
+func (dao *RoleDao) DenyPermissionsContext(ctx context.Context, system, name string, permissions ...string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		for _, p := range permissions {
+			if !contains(role.Denied, p) {
+				role.Denied = append(role.Denied, p)
+			}
+		}
+	})
+}
+
+// RemoveDeniedContext remove permission from those denied by specified role
+func (dao *RoleDao) RemoveDeniedContext(ctx context.Context, system, name string, permission string) error {
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		role.Denied = pull(role.Denied, permission)
+	})
+}
+
+// SetConditionContext grant permission to role under condition, replacing the condition of the same permission
+func (dao *RoleDao) SetConditionContext(ctx context.Context, system, name string, condition model.Condition) error {
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		pullConditions(&role.Conditions, condition.Permission)
+		role.Conditions = append(role.Conditions, condition)
+	})
+}
+
+// RemoveConditionContext remove condition of permission from specified role
+func (dao *RoleDao) RemoveConditionContext(ctx context.Context, system, name string, permission string) error {
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		pullConditions(&role.Conditions, permission)
+	})
+}
+
+// UpdateConstraintsContext replace max members and prerequisites of specified role
+func (dao *RoleDao) UpdateConstraintsContext(ctx context.Context, system, name string, maxMembers int, prerequisites ...string) error {
+	if prerequisites == nil {
+		prerequisites = []string{}
+	}
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		role.MaxMembers, role.Prerequisites = maxMembers, prerequisites
+	})
+}
+
+// UpdateRoleIfMatchContext replace description and permissions of role if its revision equals revision
+func (dao *RoleDao) UpdateRoleIfMatchContext(ctx context.Context, role *model.Role, revision int64) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.Role
+		key := docKey(role.System, role.Name)
+		if err := get(tx, db.RoleList, key, &old); err != nil {
+			return err
+		}
+		if old.Revision != revision {
+			return db.ErrConflict
+		}
+
+		old.Desc, old.Permissions, old.Revision = role.Desc, role.Permissions, revision+1
+		if err := put(tx, db.RoleList, key, &old); err != nil {
+			return err
+		}
+		role.Revision = old.Revision
+		return nil
+	})
+}
+
+// RemovePermissionContext remove permission from specified role
+func (dao *RoleDao) RemovePermissionContext(ctx context.Context, system, name string, permission string) error {
+	return dao.modify(ctx, system, name, func(role *model.Role) {
+		role.Permissions = pull(role.Permissions, permission)
+	})
+}
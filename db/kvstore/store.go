@@ -0,0 +1,80 @@
+// Package kvstore implements db.Store on top of a transactional key/value engine,
+// documents are stored as json under "{system}\x00{name}" keys.
+package kvstore
+
+import (
+	"github.com/nzqpeace/rbac/db"
+)
+
+var _ db.Store = (*Store)(nil)
+
+// Store is the key/value implementation of db.Store
+type Store struct {
+	engine     Engine
+	permission *PermissionDao
+	role       *RoleDao
+	user       *UserDao
+	group      *GroupDao
+	constraint *ConstraintDao
+	system     *SystemDao
+	delegation *DelegationDao
+}
+
+// NewStore create a store on top of specified engine
+func NewStore(engine Engine) *Store {
+	return &Store{
+		engine:     engine,
+		permission: &PermissionDao{engine},
+		role:       &RoleDao{engine},
+		user:       &UserDao{engine},
+		group:      &GroupDao{engine},
+		constraint: &ConstraintDao{engine},
+		system:     &SystemDao{engine},
+		delegation: &DelegationDao{engine},
+	}
+}
+
+// NewMemoryStore create a store which keep everything in memory, it's intended for embedded use and tests
+func NewMemoryStore() *Store {
+	return NewStore(NewMemoryEngine())
+}
+
+// Permissions return permission dao
+func (s *Store) Permissions() db.PermissionStore {
+	return s.permission
+}
+
+// Roles return role dao
+func (s *Store) Roles() db.RoleStore {
+	return s.role
+}
+
+// Users return user dao
+func (s *Store) Users() db.UserStore {
+	return s.user
+}
+
+// Groups return group dao
+func (s *Store) Groups() db.GroupStore {
+	return s.group
+}
+
+// Constraints return constraint dao
+func (s *Store) Constraints() db.ConstraintStore {
+	return s.constraint
+}
+
+// Systems return system dao
+func (s *Store) Systems() db.SystemStore {
+	return s.system
+}
+
+// Delegations return delegation dao
+func (s *Store) Delegations() db.DelegationStore {
+	return s.delegation
+}
+
+// Close close underlying engine
+func (s *Store) Close() error {
+	return s.engine.Close()
+}
@@ -0,0 +1,33 @@
+package kvstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nzqpeace/rbac/db/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+const system = "Cowshed"
+
+func TestStore(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		storetest.Run(t, NewMemoryStore())
+	})
+
+	t.Run("Bolt", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "rbac")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		s, err := OpenBoltStore(&BoltConfig{Path: filepath.Join(dir, "rbac.db")})
+		assert.Nil(t, err)
+		defer s.Close()
+		storetest.Run(t, s)
+	})
+}
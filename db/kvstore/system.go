@@ -0,0 +1,139 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// SystemDao is the key/value implementation of db.SystemStore, systems are stored under their names
+type SystemDao struct {
+	engine Engine
+}
+
+// GetSystemContext get specified system
+func (dao *SystemDao) GetSystemContext(ctx context.Context, name string) (system model.System, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return get(tx, db.SystemList, name, &system)
+	})
+	return
+}
+
+// GetAllSystemsContext get all registered systems
+func (dao *SystemDao) GetAllSystemsContext(ctx context.Context) (systems []model.System, err error) {
+	systems = []model.System{}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.SystemList, "", func(key string, value []byte) error {
+			var system model.System
+			if err := json.Unmarshal(value, &system); err != nil {
+				return err
+			}
+			systems = append(systems, system)
+			return nil
+		})
+	})
+	return
+}
+
+// CreateSystemContext register system, db.ErrAlreadyExists is returned if it's registered already
+func (dao *SystemDao) CreateSystemContext(ctx context.Context, system *model.System) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		if tx.Get(db.SystemList, system.Name) != nil {
+			return db.ErrAlreadyExists
+		}
+
+		s := *system
+		if s.Owners == nil {
+			s.Owners = []string{}
+		}
+		if s.Metadata == nil {
+			s.Metadata = map[string]string{}
+		}
+		if s.DefaultRoles == nil {
+			s.DefaultRoles = []string{}
+		}
+		s.Revision = 1
+		return put(tx, db.SystemList, s.Name, &s)
+	})
+}
+
+// UpdateSystemContext replace description, owners, metadata, default roles and auto register of system
+func (dao *SystemDao) UpdateSystemContext(ctx context.Context, system *model.System) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var s model.System
+		if err := get(tx, db.SystemList, system.Name, &s); err != nil {
+			return err
+		}
+
+		s.Desc, s.Owners, s.Metadata = system.Desc, system.Owners, system.Metadata
+		s.DefaultRoles, s.AutoRegister = system.DefaultRoles, system.AutoRegister
+		if s.Owners == nil {
+			s.Owners = []string{}
+		}
+		if s.Metadata == nil {
+			s.Metadata = map[string]string{}
+		}
+		if s.DefaultRoles == nil {
+			s.DefaultRoles = []string{}
+		}
+		s.Revision++
+		return put(tx, db.SystemList, s.Name, &s)
+	})
+}
+
+// RemoveSystemContext unregister specified system, its permissions, roles, users and groups are kept
+func (dao *SystemDao) RemoveSystemContext(ctx context.Context, name string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return remove(tx, db.SystemList, name)
+	})
+}
+
+// removeAll remove all documents of system at bucket, return their names
+func removeAll(tx Tx, bucket, system string) ([]string, error) {
+	ks, err := keys(tx, bucket, systemPrefix(system))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, k := range ks {
+		if err = tx.Delete(bucket, k); err != nil {
+			return nil, err
+		}
+		names = append(names, strings.TrimPrefix(k, systemPrefix(system)))
+	}
+	return names, nil
+}
+
+// RemoveSystemCascadeContext remove system together with all its permissions, roles, users, groups, rules and delegations
+// atomically
+func (dao *SystemDao) RemoveSystemCascadeContext(ctx context.Context, name string) (affected db.Affected, err error) {
+	err = dao.engine.Update(ctx, func(tx Tx) (err error) {
+		if _, err = removeAll(tx, db.PermissionsList, name); err != nil {
+			return
+		}
+		if affected.Roles, err = removeAll(tx, db.RoleList, name); err != nil {
+			return
+		}
+		if affected.Users, err = removeAll(tx, db.UserList, name); err != nil {
+			return
+		}
+		if affected.Groups, err = removeAll(tx, db.GroupList, name); err != nil {
+			return
+		}
+		if _, err = removeAll(tx, db.SoDRuleList, name); err != nil {
+			return
+		}
+		if _, err = removeAll(tx, db.DelegationList, name); err != nil {
+			return
+		}
+		if tx.Get(db.SystemList, name) == nil {
+			return
+		}
+		return tx.Delete(db.SystemList, name)
+	})
+	return
+}
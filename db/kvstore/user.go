@@ -0,0 +1,375 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// UserDao is the key/value implementation of db.UserStore
+type UserDao struct {
+	engine Engine
+}
+
+// modify load user, apply fn and store it back within one transaction
+func (dao *UserDao) modify(ctx context.Context, system, uid string, fn func(user *model.UserPermModel)) error {
+	return dao.update(ctx, system, uid, func(user *model.UserPermModel) error {
+		fn(user)
+		return nil
+	})
+}
+
+// update is modify whose fn may fail, user isn't stored back then
+func (dao *UserDao) update(ctx context.Context, system, uid string, fn func(user *model.UserPermModel) error) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var user model.UserPermModel
+		key := docKey(system, uid)
+		if err := get(tx, db.UserList, key, &user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+		user.Revision++
+		return put(tx, db.UserList, key, &user)
+	})
+}
+
+// CreateUserPermModelContext store user permission model, replace it if already exist
+func (dao *UserDao) CreateUserPermModelContext(ctx context.Context, user *model.UserPermModel) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.UserPermModel
+		key := docKey(user.System, user.UID)
+		if err := get(tx, db.UserList, key, &old); err != nil && err != db.ErrNotFound {
+			return err
+		}
+
+		u := *user
+		u.Revision = old.Revision + 1
+		return put(tx, db.UserList, key, &u)
+	})
+}
+
+// InsertUserPermModelContext create user only if it doesn't exist, db.ErrAlreadyExists is returned otherwise
+func (dao *UserDao) InsertUserPermModelContext(ctx context.Context, user *model.UserPermModel) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		key := docKey(user.System, user.UID)
+		if tx.Get(db.UserList, key) != nil {
+			return db.ErrAlreadyExists
+		}
+
+		u := *user
+		u.Revision = 1
+		return put(tx, db.UserList, key, &u)
+	})
+}
+
+// RemoveUserPermModelContext remove user info
+func (dao *UserDao) RemoveUserPermModelContext(ctx context.Context, system, uid string) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		return remove(tx, db.UserList, docKey(system, uid))
+	})
+}
+
+// UpdateUserPermModelContext replace user info
+func (dao *UserDao) UpdateUserPermModelContext(ctx context.Context, system, uid string, user *model.UserPermModel) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.UserPermModel
+		oldkey, newkey := docKey(system, uid), docKey(user.System, user.UID)
+		if err := get(tx, db.UserList, oldkey, &old); err != nil {
+			return err
+		}
+		if oldkey != newkey && tx.Get(db.UserList, newkey) != nil {
+			return db.ErrAlreadyExists
+		}
+
+		if err := tx.Delete(db.UserList, oldkey); err != nil {
+			return err
+		}
+		u := *user
+		u.Revision = old.Revision + 1
+		return put(tx, db.UserList, newkey, &u)
+	})
+}
+
+// GetUserPermModelContext get user info
+func (dao *UserDao) GetUserPermModelContext(ctx context.Context, system, uid string) (user model.UserPermModel, err error) {
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return get(tx, db.UserList, docKey(system, uid), &user)
+	})
+	return
+}
+
+// GetAllRolesContext get all roles with uid
+func (dao *UserDao) GetAllRolesContext(ctx context.Context, system, uid string) ([]string, error) {
+	user, err := dao.GetUserPermModelContext(ctx, system, uid)
+	return user.Roles, err
+}
+
+// UpdateRolesContext update user's all roles
+func (dao *UserDao) UpdateRolesContext(ctx context.Context, system, uid string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.Roles = roles
+	})
+}
+
+// AddRolesContext add specified roles into user's permission model
+func (dao *UserDao) AddRolesContext(ctx context.Context, system, uid string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.Roles = append(user.Roles, roles...)
+	})
+}
+
+// RemoveRolesContext remove specified role from user's permission model
+func (dao *UserDao) RemoveRolesContext(ctx context.Context, system, uid string, role string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.Roles = pull(user.Roles, role)
+	})
+}
+
+// GetBlackListContext get user permission model's blacklist
+func (dao *UserDao) GetBlackListContext(ctx context.Context, system, uid string) ([]string, error) {
+	user, err := dao.GetUserPermModelContext(ctx, system, uid)
+	return user.BlackList, err
+}
+
+// AddToBlackListContext add specified permissions into blacklist
+func (dao *UserDao) AddToBlackListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.BlackList = append(user.BlackList, permissions...)
+	})
+}
+
+// RemoveFromBlackListContext remove specified permission from blacklist
+func (dao *UserDao) RemoveFromBlackListContext(ctx context.Context, system, uid string, permission string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.BlackList = pull(user.BlackList, permission)
+	})
+}
+
+// ClearBlackListContext clear blacklist
+func (dao *UserDao) ClearBlackListContext(ctx context.Context, system, uid string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.BlackList = []string{}
+	})
+}
+
+// GetWhiteListContext get user permission model's whitelist
+func (dao *UserDao) GetWhiteListContext(ctx context.Context, system, uid string) ([]string, error) {
+	user, err := dao.GetUserPermModelContext(ctx, system, uid)
+	return user.WhiteList, err
+}
+
+// UpdateWhiteListContext replace whitelist
+func (dao *UserDao) UpdateWhiteListContext(ctx context.Context, system, uid string, whitelist ...string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.WhiteList = whitelist
+	})
+}
+
+// AddToWhiteListContext add specified permissions into whitelist
+func (dao *UserDao) AddToWhiteListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.WhiteList = append(user.WhiteList, permissions...)
+	})
+}
+
+// RemoveFromWhiteListContext remove specified permission from whitelist
+func (dao *UserDao) RemoveFromWhiteListContext(ctx context.Context, system, uid string, permission string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.WhiteList = pull(user.WhiteList, permission)
+	})
+}
+
+// ClearWhiteListContext clear whitelist
+func (dao *UserDao) ClearWhiteListContext(ctx context.Context, system, uid string) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		user.WhiteList = []string{}
+	})
+}
+
+// AddGrantsContext add grants on resources to user, grants already present are ignored
+func (dao *UserDao) AddGrantsContext(ctx context.Context, system, uid string, grants ...model.Grant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		for _, g := range grants {
+			if !containsGrant(user.Grants, g) {
+				user.Grants = append(user.Grants, g)
+			}
+		}
+	})
+}
+
+// RemoveGrantContext remove specified grant from user
+func (dao *UserDao) RemoveGrantContext(ctx context.Context, system, uid string, grant model.Grant) error {
+	return dao.modify(ctx, system, uid, func(user *model.UserPermModel) {
+		pullGrants(&user.Grants, func(g model.Grant) bool {
+			return g == grant
+		})
+	})
+}
+
+// AddWithinContext add names to list of user and restrict them to period, names already present get the new period,
+// a zero period makes them permanent
+func (dao *UserDao) AddWithinContext(ctx context.Context, system, uid, list string, period model.Period, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	return dao.update(ctx, system, uid, func(user *model.UserPermModel) error {
+		return user.AddWithin(list, period, names...)
+	})
+}
+
+// AddInDomainContext add names to list of user within domain, names already present are ignored
+func (dao *UserDao) AddInDomainContext(ctx context.Context, system, uid, domain, list string, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	return dao.update(ctx, system, uid, func(user *model.UserPermModel) error {
+		return user.AddInDomain(domain, list, names...)
+	})
+}
+
+// RemoveInDomainContext remove name from list of user within domain
+func (dao *UserDao) RemoveInDomainContext(ctx context.Context, system, uid, domain, list, name string) error {
+	return dao.update(ctx, system, uid, func(user *model.UserPermModel) error {
+		return user.RemoveInDomain(domain, list, name)
+	})
+}
+
+// RemoveExpiredContext remove entries whose window has ended at now from users of all systems, return the changed users
+func (dao *UserDao) RemoveExpiredContext(ctx context.Context, now time.Time) (refs []db.UserRef, err error) {
+	refs = []db.UserRef{}
+	err = dao.engine.Update(ctx, func(tx Tx) error {
+		var users []model.UserPermModel
+		err := tx.ForEach(db.UserList, "", func(key string, value []byte) error {
+			var user model.UserPermModel
+			if err := json.Unmarshal(value, &user); err != nil {
+				return err
+			}
+			if user.RemoveExpired(now) {
+				users = append(users, user)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// bucket can't be modified while iterating
+		for i := range users {
+			users[i].Revision++
+			if err := put(tx, db.UserList, docKey(users[i].System, users[i].UID), &users[i]); err != nil {
+				return err
+			}
+			refs = append(refs, db.UserRef{System: users[i].System, UID: users[i].UID})
+		}
+		return nil
+	})
+	return
+}
+
+// GetAllUsersContext list all users of system
+func (dao *UserDao) GetAllUsersContext(ctx context.Context, system string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.UserList, systemPrefix(system), func(key string, value []byte) error {
+			var user model.UserPermModel
+			if err := json.Unmarshal(value, &user); err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	return
+}
+
+// GetUsersWithRolesContext list users of system holding any of roles
+func (dao *UserDao) GetUsersWithRolesContext(ctx context.Context, system string, roles ...string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	if len(roles) == 0 {
+		return
+	}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.UserList, systemPrefix(system), func(key string, value []byte) error {
+			var user model.UserPermModel
+			if err := json.Unmarshal(value, &user); err != nil {
+				return err
+			}
+			for _, r := range roles {
+				if contains(user.Roles, r) {
+					users = append(users, user)
+					break
+				}
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// GetUsersWithDomainRolesContext list users of system holding any of roles within any domain
+func (dao *UserDao) GetUsersWithDomainRolesContext(ctx context.Context, system string, roles ...string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	if len(roles) == 0 {
+		return
+	}
+	err = dao.engine.View(ctx, func(tx Tx) error {
+		return tx.ForEach(db.UserList, systemPrefix(system), func(key string, value []byte) error {
+			var user model.UserPermModel
+			if err := json.Unmarshal(value, &user); err != nil {
+				return err
+			}
+			for _, e := range user.DomainRoles {
+				if contains(roles, e.Name) {
+					users = append(users, user)
+					break
+				}
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// UpdateUserPermModelIfMatchContext replace roles, blacklist, whitelist, grants, windows, domain entries and provenance of user if its revision equals revision
+func (dao *UserDao) UpdateUserPermModelIfMatchContext(ctx context.Context, user *model.UserPermModel, revision int64) error {
+	return dao.engine.Update(ctx, func(tx Tx) error {
+		var old model.UserPermModel
+		key := docKey(user.System, user.UID)
+		if err := get(tx, db.UserList, key, &old); err != nil {
+			return err
+		}
+		if old.Revision != revision {
+			return db.ErrConflict
+		}
+
+		old.Roles, old.BlackList, old.WhiteList, old.Grants = user.Roles, user.BlackList, user.WhiteList, user.Grants
+		old.RoleWindows, old.WhiteListWindows, old.BlackListWindows = user.RoleWindows, user.WhiteListWindows, user.BlackListWindows
+		old.DomainRoles, old.DomainWhiteList, old.DomainBlackList = user.DomainRoles, user.DomainWhiteList, user.DomainBlackList
+		old.RoleProvenance, old.WhiteListProvenance, old.BlackListProvenance = user.RoleProvenance, user.WhiteListProvenance, user.BlackListProvenance
+		old.Revision = revision + 1
+		if err := put(tx, db.UserList, key, &old); err != nil {
+			return err
+		}
+		user.Revision = old.Revision
+		return nil
+	})
+}
@@ -1,10 +1,11 @@
 package db
 
 import (
+	"context"
 	"math"
 
 	"github.com/nzqpeace/rbac/model"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 const PermissionsList = "permissions"
@@ -19,21 +20,37 @@ func NewPermissionDao(db *DataBase) *PermissionDao {
 	}
 }
 
-func (dao *PermissionDao) GetAllPermissions(system string) (ps []model.Permission, err error) {
-	err = dao.FindAll(bson.M{"system": system}, &ps, 0, math.MaxInt32)
+func (dao *PermissionDao) GetAllPermissions(system string) ([]model.Permission, error) {
+	return dao.GetAllPermissionsContext(context.Background(), system)
+}
+
+func (dao *PermissionDao) GetAllPermissionsContext(ctx context.Context, system string) (ps []model.Permission, err error) {
+	err = dao.FindAllContext(ctx, bson.M{"system": system}, &ps, 0, math.MaxInt32)
 	return
 }
 
 func (dao *PermissionDao) CreatePermission(p *model.Permission) error {
-	return dao.Upsert(bson.M{"system": p.System, "name": p.Name}, p)
+	return dao.CreatePermissionContext(context.Background(), p)
+}
+
+func (dao *PermissionDao) CreatePermissionContext(ctx context.Context, p *model.Permission) error {
+	return dao.UpsertContext(ctx, bson.M{"system": p.System, "name": p.Name}, p)
 }
 
 func (dao *PermissionDao) RemovePermission(system, name string) error {
-	return dao.Remove(bson.M{"system": system, "name": name})
+	return dao.RemovePermissionContext(context.Background(), system, name)
+}
+
+func (dao *PermissionDao) RemovePermissionContext(ctx context.Context, system, name string) error {
+	return dao.RemoveContext(ctx, bson.M{"system": system, "name": name})
 }
 
 func (dao *PermissionDao) UpdatePermission(system, oldname, newname string) error {
-	return dao.Update(bson.M{"system": system, "name": oldname}, bson.M{
+	return dao.UpdatePermissionContext(context.Background(), system, oldname, newname)
+}
+
+func (dao *PermissionDao) UpdatePermissionContext(ctx context.Context, system, oldname, newname string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": oldname}, bson.M{
 		"$set": bson.M{
 			"name": newname,
 		},
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// incRevision is added to every update of roles and users
+var incRevision = bson.M{"revision": 1}
+
+// UpdateIfMatch apply change to the document matched by query only if it's at revision,
+// return ErrConflict if the document is at another revision
+func (m *Base) UpdateIfMatch(ctx context.Context, query bson.M, revision int64, change bson.M) error {
+	return m.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		filter := bson.M{"revision": revision}
+		if revision == 0 { // documents created before revision was introduced
+			filter["revision"] = bson.M{"$in": bson.A{0, nil}}
+		}
+		for k, v := range query {
+			filter[k] = v
+		}
+
+		res, err := col.UpdateOne(ctx, filter, change)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount > 0 {
+			return nil
+		}
+
+		n, err := col.CountDocuments(ctx, query)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	})
+}
@@ -1,10 +1,11 @@
 package db
 
 import (
+	"context"
 	"math"
 
 	"github.com/nzqpeace/rbac/model"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 const RoleList = "roles"
@@ -19,50 +20,93 @@ func NewRoleDao(db *DataBase) *RoleDao {
 	}
 }
 
-func (dao *RoleDao) GetRole(system, name string) (role model.Role, err error) {
-	err = dao.Find(bson.M{"system": system, "name": name}, &role)
+func (dao *RoleDao) GetRole(system, name string) (model.Role, error) {
+	return dao.GetRoleContext(context.Background(), system, name)
+}
+
+func (dao *RoleDao) GetRoleContext(ctx context.Context, system, name string) (role model.Role, err error) {
+	err = dao.FindContext(ctx, bson.M{"system": system, "name": name}, &role)
 	return
 }
 
-func (dao *RoleDao) GetAllRoles(system string) (roles []model.Role, err error) {
-	err = dao.FindAll(bson.M{"system": system}, &roles, 0, math.MaxInt32)
+func (dao *RoleDao) GetAllRoles(system string) ([]model.Role, error) {
+	return dao.GetAllRolesContext(context.Background(), system)
+}
+
+func (dao *RoleDao) GetAllRolesContext(ctx context.Context, system string) (roles []model.Role, err error) {
+	err = dao.FindAllContext(ctx, bson.M{"system": system}, &roles, 0, math.MaxInt32)
 	return
 }
 
 func (dao *RoleDao) CreateRole(role *model.Role) error {
-	return dao.Upsert(bson.M{"system": role.System, "name": role.Name}, role)
+	return dao.CreateRoleContext(context.Background(), role)
+}
+
+func (dao *RoleDao) CreateRoleContext(ctx context.Context, role *model.Role) error {
+	return dao.UpsertContext(ctx, bson.M{"system": role.System, "name": role.Name}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"desc":          role.Desc,
+			"permissions":   role.Permissions,
+			"parents":       role.Parents,
+			"denied":        values(role.Denied),
+			"conditions":    conditions(role.Conditions),
+			"max_members":   role.MaxMembers,
+			"prerequisites": values(role.Prerequisites),
+		},
+	})
 }
 
 func (dao *RoleDao) RemoveRole(system, name string) error {
-	return dao.Remove(bson.M{"system": system, "name": name})
+	return dao.RemoveRoleContext(context.Background(), system, name)
+}
+
+func (dao *RoleDao) RemoveRoleContext(ctx context.Context, system, name string) error {
+	return dao.RemoveContext(ctx, bson.M{"system": system, "name": name})
 }
 
 func (dao *RoleDao) RemoveAllRoles(system string) error {
-	return dao.RemoveAll(bson.M{"system": system})
+	return dao.RemoveAllRolesContext(context.Background(), system)
+}
+
+func (dao *RoleDao) RemoveAllRolesContext(ctx context.Context, system string) error {
+	return dao.RemoveAllContext(ctx, bson.M{"system": system})
 }
 
 func (dao *RoleDao) UpdateRoleName(system, oldname, newname string) error {
-	return dao.Update(bson.M{"system": system, "name": oldname},
-		bson.M{
-			"$set": bson.M{
-				"name": newname,
-			},
+	return dao.UpdateRoleNameContext(context.Background(), system, oldname, newname)
+}
+
+func (dao *RoleDao) UpdateRoleNameContext(ctx context.Context, system, oldname, newname string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": oldname}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"name": newname,
 		},
-	)
+	})
 }
 
 func (dao *RoleDao) GetPermissions(system, name string) ([]string, error) {
+	return dao.GetPermissionsContext(context.Background(), system, name)
+}
+
+func (dao *RoleDao) GetPermissionsContext(ctx context.Context, system, name string) ([]string, error) {
 	var role model.Role
-	err := dao.Find(bson.M{"system": system, "name": name}, &role)
+	err := dao.FindContext(ctx, bson.M{"system": system, "name": name}, &role)
 	return role.Permissions, err
 }
 
 func (dao *RoleDao) GrantPermissions(system, name string, permissions ...string) error {
+	return dao.GrantPermissionsContext(context.Background(), system, name, permissions...)
+}
+
+func (dao *RoleDao) GrantPermissionsContext(ctx context.Context, system, name string, permissions ...string) error {
 	if len(permissions) == 0 {
 		return nil
 	}
 
-	return dao.Update(bson.M{"system": system, "name": name}, bson.M{
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
 		"$push": bson.M{
 			"permissions": bson.M{
 				"$each": permissions,
@@ -72,9 +116,175 @@ func (dao *RoleDao) GrantPermissions(system, name string, permissions ...string)
 }
 
 func (dao *RoleDao) RemovePermission(system, name string, permission string) error {
-	return dao.Update(bson.M{"system": system, "name": name}, bson.M{
+	return dao.RemovePermissionContext(context.Background(), system, name, permission)
+}
+
+func (dao *RoleDao) RemovePermissionContext(ctx context.Context, system, name string, permission string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
 		"$pull": bson.M{
 			"permissions": permission,
 		},
 	})
 }
+
+func (dao *RoleDao) AddParents(system, name string, parents ...string) error {
+	return dao.AddParentsContext(context.Background(), system, name, parents...)
+}
+
+func (dao *RoleDao) AddParentsContext(ctx context.Context, system, name string, parents ...string) error {
+	if len(parents) == 0 {
+		return nil
+	}
+
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$addToSet": bson.M{
+			"parents": bson.M{
+				"$each": parents,
+			},
+		},
+	})
+}
+
+func (dao *RoleDao) RemoveParent(system, name string, parent string) error {
+	return dao.RemoveParentContext(context.Background(), system, name, parent)
+}
+
+func (dao *RoleDao) RemoveParentContext(ctx context.Context, system, name string, parent string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$pull": bson.M{
+			"parents": parent,
+		},
+	})
+}
+
+// DenyPermissions add permissions denied by specified role, permissions already denied are ignored
+func (dao *RoleDao) DenyPermissions(system, name string, permissions ...string) error {
+	return dao.DenyPermissionsContext(context.Background(), system, name, permissions...)
+}
+
+// DenyPermissionsContext is DenyPermissions with context
+func (dao *RoleDao) DenyPermissionsContext(ctx context.Context, system, name string, permissions ...string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$addToSet": bson.M{
+			"denied": bson.M{
+				"$each": permissions,
+			},
+		},
+	})
+}
+
+// RemoveDenied remove permission from those denied by specified role
+func (dao *RoleDao) RemoveDenied(system, name string, permission string) error {
+	return dao.RemoveDeniedContext(context.Background(), system, name, permission)
+}
+
+// RemoveDeniedContext is RemoveDenied with context
+func (dao *RoleDao) RemoveDeniedContext(ctx context.Context, system, name string, permission string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$pull": bson.M{
+			"denied": permission,
+		},
+	})
+}
+
+// SetCondition grant permission to role under condition, replacing the condition of the same permission
+func (dao *RoleDao) SetCondition(system, name string, condition model.Condition) error {
+	return dao.SetConditionContext(context.Background(), system, name, condition)
+}
+
+// SetConditionContext is SetCondition with context
+func (dao *RoleDao) SetConditionContext(ctx context.Context, system, name string, condition model.Condition) error {
+	// a field can't be pulled and pushed by one update
+	query := bson.M{"system": system, "name": name}
+	return dao.cascade(ctx, func(ctx context.Context) error {
+		col := dao.db.C(RoleList)
+		res, err := col.UpdateOne(ctx, query, bson.M{
+			"$inc":  incRevision,
+			"$pull": bson.M{"conditions": bson.M{"permission": condition.Permission}},
+		})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		_, err = col.UpdateOne(ctx, query, bson.M{"$push": bson.M{"conditions": condition}})
+		return err
+	})
+}
+
+// RemoveCondition remove condition of permission from role
+func (dao *RoleDao) RemoveCondition(system, name string, permission string) error {
+	return dao.RemoveConditionContext(context.Background(), system, name, permission)
+}
+
+// RemoveConditionContext is RemoveCondition with context
+func (dao *RoleDao) RemoveConditionContext(ctx context.Context, system, name string, permission string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$pull": bson.M{
+			"conditions": bson.M{"permission": permission},
+		},
+	})
+}
+
+// UpdateConstraints replace max members and prerequisites of specified role
+func (dao *RoleDao) UpdateConstraints(system, name string, maxMembers int, prerequisites ...string) error {
+	return dao.UpdateConstraintsContext(context.Background(), system, name, maxMembers, prerequisites...)
+}
+
+// UpdateConstraintsContext is UpdateConstraints with context
+func (dao *RoleDao) UpdateConstraintsContext(ctx context.Context, system, name string, maxMembers int, prerequisites ...string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "name": name}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"max_members":   maxMembers,
+			"prerequisites": values(prerequisites),
+		},
+	})
+}
+
+// values return vs, or an empty slice if it's nil, so that array operators can be applied to the field
+func values(vs []string) []string {
+	if vs == nil {
+		return []string{}
+	}
+	return vs
+}
+
+// conditions return cs, or an empty slice if it's nil
+func conditions(cs []model.Condition) []model.Condition {
+	if cs == nil {
+		return []model.Condition{}
+	}
+	return cs
+}
+
+// UpdateRoleIfMatch replace description and permissions of role if its revision equals revision
+func (dao *RoleDao) UpdateRoleIfMatch(role *model.Role, revision int64) error {
+	return dao.UpdateRoleIfMatchContext(context.Background(), role, revision)
+}
+
+// UpdateRoleIfMatchContext is UpdateRoleIfMatch with context
+func (dao *RoleDao) UpdateRoleIfMatchContext(ctx context.Context, role *model.Role, revision int64) error {
+	err := dao.UpdateIfMatch(ctx, bson.M{"system": role.System, "name": role.Name}, revision, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"desc":        role.Desc,
+			"permissions": role.Permissions,
+		},
+	})
+	if err == nil {
+		role.Revision = revision + 1
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// uniqueIndex is a unique compound index on fields of collection
+type uniqueIndex struct {
+	collection string
+	fields     []string
+}
+
+// schema list all indexes required by stores, documents are identified by these fields
+var schema = []uniqueIndex{
+	{PermissionsList, []string{"system", "name"}},
+	{RoleList, []string{"system", "name"}},
+	{UserList, []string{"system", "uid"}},
+	{GroupList, []string{"system", "name"}},
+	{SoDRuleList, []string{"system", "name"}},
+	{SystemList, []string{"name"}},
+	{DelegationList, []string{"system", "delegator", "delegate"}},
+}
+
+// Conflict is a group of existing documents sharing the same unique key
+type Conflict struct {
+	Collection string
+	Key        bson.M        // value of each indexed field
+	IDs        []interface{} // _id of all conflicting documents
+}
+
+func (c Conflict) String() string {
+	var pairs []string
+	for k, v := range c.Key {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("%s{%s} x%d %v", c.Collection, strings.Join(pairs, ","), len(c.IDs), c.IDs)
+}
+
+// ConflictError is returned by EnsureSchema when unique indexes can't be created due to duplicate documents,
+// they must be removed or merged by hand
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	var cs []string
+	for _, c := range e.Conflicts {
+		cs = append(cs, c.String())
+	}
+	return "duplicate documents prevent creating unique indexes: " + strings.Join(cs, "; ")
+}
+
+// EnsureSchema create unique indexes of all collections if they don't exist yet. Conflicting documents
+// are reported by *ConflictError, indexes of other collections are still created in that case
+func (m *DataBase) EnsureSchema(ctx context.Context) error {
+	var conflicts []Conflict
+	for _, index := range schema {
+		col := m.C(index.collection)
+
+		cs, err := findConflicts(ctx, col, index.fields)
+		if err != nil {
+			return err
+		}
+		if len(cs) > 0 {
+			conflicts = append(conflicts, cs...)
+			continue
+		}
+
+		keys := bson.D{}
+		for _, f := range index.fields {
+			keys = append(keys, bson.E{Key: f, Value: 1})
+		}
+		_, err = col.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    keys,
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			return fmt.Errorf("create index of %s error: %s", index.collection, err)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &ConflictError{conflicts}
+	}
+	return nil
+}
+
+// findConflicts group documents of col by fields and return groups having more than one document
+func findConflicts(ctx context.Context, col *mongo.Collection, fields []string) (conflicts []Conflict, err error) {
+	id := bson.M{}
+	for _, f := range fields {
+		id[f] = "$" + f
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": id, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+
+	cursor, err := col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return
+	}
+
+	var groups []struct {
+		Key bson.M        `bson:"_id"`
+		IDs []interface{} `bson:"ids"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return
+	}
+
+	for _, g := range groups {
+		conflicts = append(conflicts, Conflict{
+			Collection: col.Name(),
+			Key:        g.Key,
+			IDs:        g.IDs,
+		})
+	}
+	return
+}
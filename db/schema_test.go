@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestConflictError(t *testing.T) {
+	err := &ConflictError{[]Conflict{
+		{Collection: RoleList, Key: bson.M{"system": system, "name": "admin"}, IDs: []interface{}{1, 2}},
+		{Collection: UserList, Key: bson.M{"uid": "uid0", "system": system}, IDs: []interface{}{3, 4, 5}},
+	}}
+	assert.Equal(t, "duplicate documents prevent creating unique indexes: "+
+		"roles{name=admin,system=Cowshed} x2 [1 2]; user{system=Cowshed,uid=uid0} x3 [3 4 5]", err.Error())
+}
+
+func TestEnsureSchema(t *testing.T) {
+	ctx := context.Background()
+	col := db.C(RoleList)
+	assert.Nil(t, col.Drop(ctx))
+
+	// duplicates can only be inserted without index
+	doc := bson.M{"system": system, "name": "admin", "permissions": []string{}}
+	for i := 0; i < 2; i++ {
+		_, err := col.InsertOne(ctx, doc)
+		assert.Nil(t, err)
+	}
+
+	err := db.EnsureSchema(ctx)
+	conflict, ok := err.(*ConflictError)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, 1, len(conflict.Conflicts))
+		assert.Equal(t, RoleList, conflict.Conflicts[0].Collection)
+		assert.Equal(t, 2, len(conflict.Conflicts[0].IDs))
+	}
+
+	// unique index is created once conflicts are resolved
+	_, err = col.DeleteOne(ctx, bson.M{"system": system, "name": "admin"})
+	assert.Nil(t, err)
+	assert.Nil(t, db.EnsureSchema(ctx))
+
+	assert.Equal(t, ErrAlreadyExists, NewBase(db, RoleList).InsertContext(ctx, bson.M{"system": system, "name": "admin"}))
+	_, err = col.DeleteMany(ctx, bson.M{"system": system})
+	assert.Nil(t, err)
+}
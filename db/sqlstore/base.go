@@ -0,0 +1,237 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/nzqpeace/rbac/db"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type base struct {
+	db      *sql.DB
+	dialect *dialect
+}
+
+// listTable is a join table which hold a set of values for its owner
+type listTable struct {
+	table  string
+	owner  string
+	column string
+	parent string   // table of owners
+	key    string   // column identifying owner within system
+	extra  []string // other columns which identify a row together with owner and column
+}
+
+var (
+	rolePermissions = listTable{"role_permissions", "role_id", "permission", "roles", "name", nil}
+	roleParents     = listTable{"role_parents", "role_id", "parent", "roles", "name", nil}
+	rolePrereqs     = listTable{"role_prerequisites", "role_id", "prerequisite", "roles", "name", nil}
+	roleDenied      = listTable{"role_denied", "role_id", "permission", "roles", "name", nil}
+	roleConditions  = listTable{"role_conditions", "role_id", "permission", "roles", "name", nil} // rows also hold expr
+	userRoles       = listTable{"user_roles", "user_id", "role", "users", "uid", nil}
+	userBlackList   = listTable{"user_blacklist", "user_id", "permission", "users", "uid", nil}
+	userWhiteList   = listTable{"user_whitelist", "user_id", "permission", "users", "uid", nil}
+	userGrants      = listTable{"user_grants", "user_id", "permission", "users", "uid", []string{"resource_type", "resource_id"}}
+	groupRoles      = listTable{"group_roles", "group_id", "role", "groups", "name", nil}
+	groupMembers    = listTable{"group_members", "group_id", "uid", "groups", "name", nil}
+	sodRuleRoles    = listTable{"sod_rule_roles", "rule_id", "role", "sod_rules", "name", nil}
+	systemOwners    = listTable{"system_owners", "system_id", "owner", "systems", "name", nil}
+	systemMetadata  = listTable{"system_metadata", "system_id", "name", "systems", "name", nil} // rows also hold value
+	systemRoles     = listTable{"system_default_roles", "system_id", "role", "systems", "name", nil}
+	delegationRoles = listTable{"delegation_roles", "delegation_id", "role", "delegations", "delegate", nil}
+
+	// windows of entries, their rows also hold valid_from and expires_at
+	userRoleWindows      = listTable{"user_role_windows", "user_id", "role", "users", "uid", nil}
+	userWhiteListWindows = listTable{"user_whitelist_windows", "user_id", "permission", "users", "uid", nil}
+	userBlackListWindows = listTable{"user_blacklist_windows", "user_id", "permission", "users", "uid", nil}
+
+	// provenance of entries, their rows also hold granted_by, granted_at, reason and ticket
+	userRoleProvenance      = listTable{"user_role_provenance", "user_id", "role", "users", "uid", nil}
+	userWhiteListProvenance = listTable{"user_whitelist_provenance", "user_id", "permission", "users", "uid", nil}
+	userBlackListProvenance = listTable{"user_blacklist_provenance", "user_id", "permission", "users", "uid", nil}
+
+	// entries of users within single domains
+	userDomainRoles     = listTable{"user_domain_roles", "user_id", "role", "users", "uid", []string{"domain"}}
+	userDomainWhiteList = listTable{"user_domain_whitelist", "user_id", "permission", "users", "uid", []string{"domain"}}
+	userDomainBlackList = listTable{"user_domain_blacklist", "user_id", "permission", "users", "uid", []string{"domain"}}
+)
+
+func (b *base) exec(ctx context.Context, q querier, query string, args ...interface{}) (sql.Result, error) {
+	return q.ExecContext(ctx, b.dialect.rebind(query), args...)
+}
+
+func (b *base) queryRow(ctx context.Context, q querier, query string, args ...interface{}) *sql.Row {
+	return q.QueryRowContext(ctx, b.dialect.rebind(query), args...)
+}
+
+// queryStrings run a query which select one string column
+func (b *base) queryStrings(ctx context.Context, q querier, query string, args ...interface{}) (res []string, err error) {
+	rows, err := q.QueryContext(ctx, b.dialect.rebind(query), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	res = []string{}
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			return
+		}
+		res = append(res, s)
+	}
+	err = rows.Err()
+	return
+}
+
+// tx run fn within a transaction, it's rolled back if fn return error
+func (b *base) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// view run fn within a read only transaction, so all its queries see the same snapshot
+func (b *base) view(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := b.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// mustAffect return db.ErrNotFound if no row was affected
+func mustAffect(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return db.ErrNotFound
+	}
+	return nil
+}
+
+// bump increase revision of the row identified by id
+func (b *base) bump(ctx context.Context, q querier, table string, id int64) error {
+	_, err := b.exec(ctx, q, fmt.Sprintf("UPDATE %s SET revision = revision + 1 WHERE id = ?", table), id)
+	return err
+}
+
+// updateIfMatch run update statement on the row identified by id, which must contain a `revision = ?`
+// condition, return db.ErrConflict if no row was affected
+func (b *base) updateIfMatch(ctx context.Context, q querier, query string, args ...interface{}) error {
+	if err := mustAffect(b.exec(ctx, q, query, args...)); err != db.ErrNotFound {
+		return err
+	}
+	return db.ErrConflict
+}
+
+// id lookup primary key of table by system and key column
+func (b *base) id(ctx context.Context, q querier, table, column, system, value string) (id int64, err error) {
+	err = b.queryRow(ctx, q, fmt.Sprintf("SELECT id FROM %s WHERE system = ? AND %s = ?", table, column),
+		system, value).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = db.ErrNotFound
+	}
+	return
+}
+
+func (b *base) roleID(ctx context.Context, q querier, system, name string) (int64, error) {
+	return b.id(ctx, q, "roles", "name", system, name)
+}
+
+func (b *base) userID(ctx context.Context, q querier, system, uid string) (int64, error) {
+	return b.id(ctx, q, "users", "uid", system, uid)
+}
+
+func (b *base) groupID(ctx context.Context, q querier, system, name string) (int64, error) {
+	return b.id(ctx, q, "groups", "name", system, name)
+}
+
+// upsertID insert row identified by (system, column) if not exist and return its primary key
+func (b *base) upsertID(ctx context.Context, q querier, table, column, system, value string) (int64, error) {
+	_, err := b.exec(ctx, q, fmt.Sprintf("INSERT INTO %s (system, %s) VALUES (?, ?) ON CONFLICT (system, %s) DO NOTHING",
+		table, column, column), system, value)
+	if err != nil {
+		return 0, err
+	}
+	return b.id(ctx, q, table, column, system, value)
+}
+
+// values list all values of owner
+func (b *base) values(ctx context.Context, q querier, t listTable, owner int64) ([]string, error) {
+	return b.queryStrings(ctx, q, fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? ORDER BY %s",
+		t.column, t.table, t.owner, t.column), owner)
+}
+
+// addValues add values to owner, values already exist are ignored
+func (b *base) addValues(ctx context.Context, q querier, t listTable, owner int64, values ...string) error {
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (?, ?) ON CONFLICT DO NOTHING", t.table, t.owner, t.column)
+	for _, v := range values {
+		if _, err := b.exec(ctx, q, query, owner, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeValue remove value from owner
+func (b *base) removeValue(ctx context.Context, q querier, t listTable, owner int64, value string) error {
+	_, err := b.exec(ctx, q, fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s = ?", t.table, t.owner, t.column), owner, value)
+	return err
+}
+
+// clearValues remove all values of owner
+func (b *base) clearValues(ctx context.Context, q querier, t listTable, owner int64) error {
+	_, err := b.exec(ctx, q, fmt.Sprintf("DELETE FROM %s WHERE %s = ?", t.table, t.owner), owner)
+	return err
+}
+
+// setValues replace all values of owner
+func (b *base) setValues(ctx context.Context, q querier, t listTable, owner int64, values ...string) error {
+	if err := b.clearValues(ctx, q, t, owner); err != nil {
+		return err
+	}
+	return b.addValues(ctx, q, t, owner, values...)
+}
+
+// rename change key column of the row identified by (system, oldname)
+func (b *base) rename(ctx context.Context, q querier, table, column, system, oldname, newname string) error {
+	if _, err := b.id(ctx, q, table, column, system, oldname); err != nil {
+		return err
+	}
+	if oldname == newname {
+		return nil
+	}
+
+	if _, err := b.id(ctx, q, table, column, system, newname); err == nil {
+		return db.ErrAlreadyExists
+	} else if err != db.ErrNotFound {
+		return err
+	}
+
+	_, err := b.exec(ctx, q, fmt.Sprintf("UPDATE %s SET %s = ? WHERE system = ? AND %s = ?", table, column, column),
+		newname, system, oldname)
+	return err
+}
@@ -0,0 +1,197 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/nzqpeace/rbac/db"
+)
+
+// owners is a sub query selecting owners of system
+func owners(t listTable) string {
+	return fmt.Sprintf("SELECT id FROM %s WHERE system = ?", t.parent)
+}
+
+// referrers list distinct key of owners in system holding value at any of ts and increase their revision,
+// all ts must share the same parent
+func (b *base) referrers(ctx context.Context, q querier, system, value string, ts ...listTable) ([]string, error) {
+	var subs []string
+	args := []interface{}{system}
+	for _, t := range ts {
+		subs = append(subs, fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", t.owner, t.table, t.column))
+		args = append(args, value)
+	}
+	where := fmt.Sprintf("system = ? AND id IN (%s)", strings.Join(subs, " UNION "))
+
+	names, err := b.queryStrings(ctx, q, fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s ORDER BY %s",
+		ts[0].key, ts[0].parent, where, ts[0].key), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = b.exec(ctx, q, fmt.Sprintf("UPDATE %s SET revision = revision + 1 WHERE %s", ts[0].parent, where), args...)
+	return names, err
+}
+
+// pullRefs remove value from ts of all owners in system, return key of changed owners
+func (b *base) pullRefs(ctx context.Context, q querier, system, value string, ts ...listTable) ([]string, error) {
+	names, err := b.referrers(ctx, q, system, value, ts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range ts {
+		_, err = b.exec(ctx, q, fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s IN (%s)",
+			t.table, t.column, t.owner, owners(t)), value, system)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// renameRefs replace oldvalue with newvalue at ts of all owners in system, return key of changed owners
+func (b *base) renameRefs(ctx context.Context, q querier, system, oldvalue, newvalue string, ts ...listTable) ([]string, error) {
+	names, err := b.referrers(ctx, q, system, oldvalue, ts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range ts {
+		// values are sets, drop oldvalue where newvalue is already present
+		same := []string{fmt.Sprintf("d.%s = %s.%s", t.owner, t.table, t.owner)}
+		for _, c := range t.extra {
+			same = append(same, fmt.Sprintf("d.%s = %s.%s", c, t.table, c))
+		}
+		_, err = b.exec(ctx, q, fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s IN (%s) AND EXISTS (SELECT 1 FROM %s d WHERE d.%s = ? AND %s)",
+			t.table, t.column, t.owner, owners(t), t.table, t.column, strings.Join(same, " AND ")), oldvalue, system, newvalue)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = b.exec(ctx, q, fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ? AND %s IN (%s)",
+			t.table, t.column, t.column, t.owner, owners(t)), newvalue, oldvalue, system)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// RemovePermissionCascadeContext remove permission together with its references in roles and users
+func (dao *PermissionDao) RemovePermissionCascadeContext(ctx context.Context, system, name string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}}
+	err = dao.tx(ctx, func(tx *sql.Tx) (err error) {
+		err = mustAffect(dao.exec(ctx, tx, "DELETE FROM permissions WHERE system = ? AND name = ?", system, name))
+		if err != nil {
+			return
+		}
+
+		if affected.Roles, err = dao.pullRefs(ctx, tx, system, name, rolePermissions, roleDenied, roleConditions); err != nil {
+			return
+		}
+		affected.Users, err = dao.pullRefs(ctx, tx, system, name, userWhiteList, userBlackList, userGrants,
+			userWhiteListWindows, userBlackListWindows, userDomainWhiteList, userDomainBlackList,
+			userWhiteListProvenance, userBlackListProvenance)
+		return
+	})
+	return
+}
+
+// UpdatePermissionCascadeContext rename permission together with its references in roles and users
+func (dao *PermissionDao) UpdatePermissionCascadeContext(ctx context.Context, system, oldname, newname string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}}
+	err = dao.tx(ctx, func(tx *sql.Tx) (err error) {
+		if err = dao.rename(ctx, tx, "permissions", "name", system, oldname, newname); err != nil || oldname == newname {
+			return
+		}
+
+		if affected.Roles, err = dao.renameRefs(ctx, tx, system, oldname, newname, rolePermissions, roleDenied, roleConditions); err != nil {
+			return
+		}
+		affected.Users, err = dao.renameRefs(ctx, tx, system, oldname, newname, userWhiteList, userBlackList, userGrants,
+			userWhiteListWindows, userBlackListWindows, userDomainWhiteList, userDomainBlackList,
+			userWhiteListProvenance, userBlackListProvenance)
+		return
+	})
+	return
+}
+
+// RemoveRoleCascadeContext remove role and revoke it from users, groups, children and delegations, it's dropped from
+// separation-of-duty rules and default roles of system too
+func (dao *RoleDao) RemoveRoleCascadeContext(ctx context.Context, system, name string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}, Groups: []string{}, Delegates: []string{}}
+	err = dao.tx(ctx, func(tx *sql.Tx) (err error) {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return
+		}
+
+		for _, t := range []listTable{rolePermissions, roleParents, rolePrereqs, roleDenied, roleConditions} {
+			if err = dao.clearValues(ctx, tx, t, id); err != nil {
+				return
+			}
+		}
+		if _, err = dao.exec(ctx, tx, "DELETE FROM roles WHERE id = ?", id); err != nil {
+			return
+		}
+		if affected.Roles, err = dao.pullRefs(ctx, tx, system, name, roleParents, rolePrereqs); err != nil {
+			return
+		}
+		if affected.Groups, err = dao.pullRefs(ctx, tx, system, name, groupRoles); err != nil {
+			return
+		}
+		if _, err = dao.pullRefs(ctx, tx, system, name, sodRuleRoles); err != nil {
+			return
+		}
+		if err = dao.pullDefaultRole(ctx, tx, system, name); err != nil {
+			return
+		}
+		if affected.Delegates, err = dao.pullRefs(ctx, tx, system, name, delegationRoles); err != nil {
+			return
+		}
+		affected.Users, err = dao.pullRefs(ctx, tx, system, name, userRoles, userRoleWindows, userDomainRoles, userRoleProvenance)
+		return
+	})
+	return
+}
+
+// UpdateRoleNameCascadeContext rename role together with its references in users, groups, children, delegations,
+// separation-of-duty rules and default roles of system
+func (dao *RoleDao) UpdateRoleNameCascadeContext(ctx context.Context, system, oldname, newname string) (affected db.Affected, err error) {
+	affected = db.Affected{Roles: []string{}, Users: []string{}, Groups: []string{}, Delegates: []string{}}
+	err = dao.tx(ctx, func(tx *sql.Tx) (err error) {
+		if err = dao.rename(ctx, tx, "roles", "name", system, oldname, newname); err != nil || oldname == newname {
+			return
+		}
+
+		id, err := dao.roleID(ctx, tx, system, newname)
+		if err != nil {
+			return
+		}
+		if err = dao.bump(ctx, tx, "roles", id); err != nil {
+			return
+		}
+		if affected.Roles, err = dao.renameRefs(ctx, tx, system, oldname, newname, roleParents, rolePrereqs); err != nil {
+			return
+		}
+		if affected.Groups, err = dao.renameRefs(ctx, tx, system, oldname, newname, groupRoles); err != nil {
+			return
+		}
+		if _, err = dao.renameRefs(ctx, tx, system, oldname, newname, sodRuleRoles); err != nil {
+			return
+		}
+		if err = dao.renameDefaultRole(ctx, tx, system, oldname, newname); err != nil {
+			return
+		}
+		if affected.Delegates, err = dao.renameRefs(ctx, tx, system, oldname, newname, delegationRoles); err != nil {
+			return
+		}
+		affected.Users, err = dao.renameRefs(ctx, tx, system, oldname, newname, userRoles, userRoleWindows, userDomainRoles,
+			userRoleProvenance)
+		return
+	})
+	return
+}
@@ -0,0 +1,98 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// ConstraintDao is the sql implementation of db.ConstraintStore
+type ConstraintDao struct {
+	*base
+}
+
+// find list rules of system matched by where, which may refer to columns of sod_rules
+func (dao *ConstraintDao) find(ctx context.Context, system, where string, args ...interface{}) (rules []model.SoDRule, err error) {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind(`SELECT id, name, description, cardinality, dynamic, revision FROM sod_rules
+		WHERE system = ? AND `+where+` ORDER BY name`), append([]interface{}{system}, args...)...)
+	if err != nil {
+		return
+	}
+
+	var ids []int64
+	rules = []model.SoDRule{}
+	for rows.Next() {
+		var id int64
+		r := model.SoDRule{System: system}
+		if err = rows.Scan(&id, &r.Name, &r.Desc, &r.Cardinality, &r.Dynamic, &r.Revision); err != nil {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+		rules = append(rules, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// rows must be closed before further queries, sqlite share one connection
+	for i, id := range ids {
+		if rules[i].Roles, err = dao.values(ctx, dao.db, sodRuleRoles, id); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetSoDRuleContext get specified rule
+func (dao *ConstraintDao) GetSoDRuleContext(ctx context.Context, system, name string) (model.SoDRule, error) {
+	rules, err := dao.find(ctx, system, "name = ?", name)
+	if err != nil {
+		return model.SoDRule{}, err
+	}
+	if len(rules) == 0 {
+		return model.SoDRule{}, db.ErrNotFound
+	}
+	return rules[0], nil
+}
+
+// GetAllSoDRulesContext get all rules of specified system
+func (dao *ConstraintDao) GetAllSoDRulesContext(ctx context.Context, system string) ([]model.SoDRule, error) {
+	return dao.find(ctx, system, "1 = 1")
+}
+
+// CreateSoDRuleContext create rule, replace it if already exist
+func (dao *ConstraintDao) CreateSoDRuleContext(ctx context.Context, rule *model.SoDRule) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.upsertID(ctx, tx, "sod_rules", "name", rule.System, rule.Name)
+		if err != nil {
+			return err
+		}
+
+		_, err = dao.exec(ctx, tx, "UPDATE sod_rules SET description = ?, cardinality = ?, dynamic = ?, revision = revision + 1 WHERE id = ?",
+			rule.Desc, rule.Cardinality, rule.Dynamic, id)
+		if err != nil {
+			return err
+		}
+		return dao.setValues(ctx, tx, sodRuleRoles, id, rule.Roles...)
+	})
+}
+
+// RemoveSoDRuleContext remove specified rule
+func (dao *ConstraintDao) RemoveSoDRuleContext(ctx context.Context, system, name string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.id(ctx, tx, "sod_rules", "name", system, name)
+		if err != nil {
+			return err
+		}
+
+		if err = dao.clearValues(ctx, tx, sodRuleRoles, id); err != nil {
+			return err
+		}
+		_, err = dao.exec(ctx, tx, "DELETE FROM sod_rules WHERE id = ?", id)
+		return err
+	})
+}
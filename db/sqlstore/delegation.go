@@ -0,0 +1,125 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// DelegationDao is the sql implementation of db.DelegationStore
+type DelegationDao struct {
+	*base
+}
+
+// find list delegations of system matched by where, which may refer to columns of delegations
+func (dao *DelegationDao) find(ctx context.Context, system, where, order string, args ...interface{}) (ds []model.Delegation, err error) {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind(`SELECT id, delegator, delegate, valid_from, expires_at, transitive, revision
+		FROM delegations WHERE system = ? AND `+where+` ORDER BY `+order), append([]interface{}{system}, args...)...)
+	if err != nil {
+		return
+	}
+
+	var ids []int64
+	ds = []model.Delegation{}
+	for rows.Next() {
+		var id int64
+		var from, expires sql.NullTime
+		d := model.Delegation{System: system}
+		if err = rows.Scan(&id, &d.Delegator, &d.Delegate, &from, &expires, &d.Transitive, &d.Revision); err != nil {
+			rows.Close()
+			return
+		}
+		d.ValidFrom, d.ExpiresAt = timeOf(from), timeOf(expires)
+		ids = append(ids, id)
+		ds = append(ds, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// rows must be closed before further queries, sqlite share one connection
+	for i, id := range ids {
+		if ds[i].Roles, err = dao.values(ctx, dao.db, delegationRoles, id); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// delegationID lookup primary key of delegation from delegator to delegate
+func (dao *DelegationDao) delegationID(ctx context.Context, q querier, system, delegator, delegate string) (id int64, err error) {
+	err = dao.queryRow(ctx, q, "SELECT id FROM delegations WHERE system = ? AND delegator = ? AND delegate = ?",
+		system, delegator, delegate).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = db.ErrNotFound
+	}
+	return
+}
+
+// GetDelegationContext get delegation from delegator to delegate
+func (dao *DelegationDao) GetDelegationContext(ctx context.Context, system, delegator, delegate string) (model.Delegation, error) {
+	ds, err := dao.find(ctx, system, "delegator = ? AND delegate = ?", "id", delegator, delegate)
+	if err != nil {
+		return model.Delegation{}, err
+	}
+	if len(ds) == 0 {
+		return model.Delegation{}, db.ErrNotFound
+	}
+	return ds[0], nil
+}
+
+// GetAllDelegationsContext get all delegations of specified system
+func (dao *DelegationDao) GetAllDelegationsContext(ctx context.Context, system string) ([]model.Delegation, error) {
+	return dao.find(ctx, system, "1 = 1", "delegator, delegate")
+}
+
+// GetDelegationsFromContext list delegations made by uid
+func (dao *DelegationDao) GetDelegationsFromContext(ctx context.Context, system, uid string) ([]model.Delegation, error) {
+	return dao.find(ctx, system, "delegator = ?", "delegate", uid)
+}
+
+// GetDelegationsToContext list delegations received by uid
+func (dao *DelegationDao) GetDelegationsToContext(ctx context.Context, system, uid string) ([]model.Delegation, error) {
+	return dao.find(ctx, system, "delegate = ?", "delegator", uid)
+}
+
+// CreateDelegationContext create delegation, replace it if already exist
+func (dao *DelegationDao) CreateDelegationContext(ctx context.Context, d *model.Delegation) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		_, err := dao.exec(ctx, tx, `INSERT INTO delegations (system, delegator, delegate) VALUES (?, ?, ?)
+			ON CONFLICT (system, delegator, delegate) DO NOTHING`, d.System, d.Delegator, d.Delegate)
+		if err != nil {
+			return err
+		}
+		id, err := dao.delegationID(ctx, tx, d.System, d.Delegator, d.Delegate)
+		if err != nil {
+			return err
+		}
+
+		_, err = dao.exec(ctx, tx, "UPDATE delegations SET valid_from = ?, expires_at = ?, transitive = ?, revision = revision + 1 WHERE id = ?",
+			nullTime(d.ValidFrom), nullTime(d.ExpiresAt), d.Transitive, id)
+		if err != nil {
+			return err
+		}
+		return dao.setValues(ctx, tx, delegationRoles, id, d.Roles...)
+	})
+}
+
+// RemoveDelegationContext remove delegation from delegator to delegate
+func (dao *DelegationDao) RemoveDelegationContext(ctx context.Context, system, delegator, delegate string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.delegationID(ctx, tx, system, delegator, delegate)
+		if err != nil {
+			return err
+		}
+
+		if err = dao.clearValues(ctx, tx, delegationRoles, id); err != nil {
+			return err
+		}
+		_, err = dao.exec(ctx, tx, "DELETE FROM delegations WHERE id = ?", id)
+		return err
+	})
+}
@@ -0,0 +1,65 @@
+package sqlstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dialect hide differences between supported databases
+type dialect struct {
+	name string
+	// serial is the column definition of auto increment primary key
+	serial string
+	// numbered use $1, $2... as placeholders instead of ?
+	numbered bool
+}
+
+var (
+	sqlite = &dialect{
+		name:   "sqlite",
+		serial: "INTEGER PRIMARY KEY AUTOINCREMENT",
+	}
+
+	postgres = &dialect{
+		name:     "postgres",
+		serial:   "BIGSERIAL PRIMARY KEY",
+		numbered: true,
+	}
+)
+
+// dialectOf find dialect by name of database/sql driver
+func dialectOf(driver string) (*dialect, error) {
+	switch driver {
+	case "sqlite", "sqlite3":
+		return sqlite, nil
+	case "postgres", "pgx":
+		return postgres, nil
+	default:
+		return nil, fmt.Errorf("unsupported sql driver '%s'", driver)
+	}
+}
+
+// rebind convert ? placeholders of query into the dialect's style
+func (d *dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ddl fill dialect specific column definitions into statement
+func (d *dialect) ddl(stmt string) string {
+	return strings.Replace(stmt, "{serial}", d.serial, -1)
+}
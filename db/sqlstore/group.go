@@ -0,0 +1,169 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// GroupDao is the sql implementation of db.GroupStore
+type GroupDao struct {
+	*base
+}
+
+// modify run fn with primary key of specified group within one transaction
+func (dao *GroupDao) modify(ctx context.Context, system, name string, fn func(tx *sql.Tx, id int64) error) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.groupID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = fn(tx, id); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "groups", id)
+	})
+}
+
+// find list groups of system matched by where, which may refer to columns of groups
+func (dao *GroupDao) find(ctx context.Context, system, where string, args ...interface{}) (groups []model.Group, err error) {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind(`SELECT id, name, description, revision FROM groups
+		WHERE system = ? AND `+where+` ORDER BY name`), append([]interface{}{system}, args...)...)
+	if err != nil {
+		return
+	}
+
+	var ids []int64
+	groups = []model.Group{}
+	for rows.Next() {
+		var id int64
+		g := model.Group{System: system}
+		if err = rows.Scan(&id, &g.Name, &g.Desc, &g.Revision); err != nil {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// rows must be closed before further queries, sqlite share one connection
+	for i, id := range ids {
+		if groups[i].Roles, err = dao.values(ctx, dao.db, groupRoles, id); err != nil {
+			return
+		}
+		if groups[i].Members, err = dao.values(ctx, dao.db, groupMembers, id); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetGroupContext get specified group
+func (dao *GroupDao) GetGroupContext(ctx context.Context, system, name string) (model.Group, error) {
+	groups, err := dao.find(ctx, system, "name = ?", name)
+	if err != nil {
+		return model.Group{}, err
+	}
+	if len(groups) == 0 {
+		return model.Group{}, db.ErrNotFound
+	}
+	return groups[0], nil
+}
+
+// GetAllGroupsContext get all groups of specified system
+func (dao *GroupDao) GetAllGroupsContext(ctx context.Context, system string) ([]model.Group, error) {
+	return dao.find(ctx, system, "1 = 1")
+}
+
+// GetGroupsOfUserContext list groups which have uid as member
+func (dao *GroupDao) GetGroupsOfUserContext(ctx context.Context, system, uid string) ([]model.Group, error) {
+	return dao.find(ctx, system, "id IN (SELECT group_id FROM group_members WHERE uid = ?)", uid)
+}
+
+// CreateGroupContext create group, replace it if already exist
+func (dao *GroupDao) CreateGroupContext(ctx context.Context, group *model.Group) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.upsertID(ctx, tx, "groups", "name", group.System, group.Name)
+		if err != nil {
+			return err
+		}
+
+		_, err = dao.exec(ctx, tx, "UPDATE groups SET description = ?, revision = revision + 1 WHERE id = ?", group.Desc, id)
+		if err != nil {
+			return err
+		}
+		if err = dao.setValues(ctx, tx, groupRoles, id, group.Roles...); err != nil {
+			return err
+		}
+		return dao.setValues(ctx, tx, groupMembers, id, group.Members...)
+	})
+}
+
+// RemoveGroupContext remove specified group
+func (dao *GroupDao) RemoveGroupContext(ctx context.Context, system, name string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.groupID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range []listTable{groupRoles, groupMembers} {
+			if err = dao.clearValues(ctx, tx, t, id); err != nil {
+				return err
+			}
+		}
+		_, err = dao.exec(ctx, tx, "DELETE FROM groups WHERE id = ?", id)
+		return err
+	})
+}
+
+// AddMembersContext add users to group, members already present are ignored
+func (dao *GroupDao) AddMembersContext(ctx context.Context, system, name string, uids ...string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, name, func(tx *sql.Tx, id int64) error {
+		return dao.addValues(ctx, tx, groupMembers, id, uids...)
+	})
+}
+
+// RemoveMemberContext remove user from group
+func (dao *GroupDao) RemoveMemberContext(ctx context.Context, system, name string, uid string) error {
+	return dao.modify(ctx, system, name, func(tx *sql.Tx, id int64) error {
+		return dao.removeValue(ctx, tx, groupMembers, id, uid)
+	})
+}
+
+// RemoveMemberFromAllContext remove user from all groups of system, return names of changed groups
+func (dao *GroupDao) RemoveMemberFromAllContext(ctx context.Context, system, uid string) (names []string, err error) {
+	err = dao.tx(ctx, func(tx *sql.Tx) (err error) {
+		names, err = dao.pullRefs(ctx, tx, system, uid, groupMembers)
+		return
+	})
+	return
+}
+
+// AddRolesContext add roles to group, roles already present are ignored
+func (dao *GroupDao) AddRolesContext(ctx context.Context, system, name string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, name, func(tx *sql.Tx, id int64) error {
+		return dao.addValues(ctx, tx, groupRoles, id, roles...)
+	})
+}
+
+// RemoveRoleContext remove role from group
+func (dao *GroupDao) RemoveRoleContext(ctx context.Context, system, name string, role string) error {
+	return dao.modify(ctx, system, name, func(tx *sql.Tx, id int64) error {
+		return dao.removeValue(ctx, tx, groupRoles, id, role)
+	})
+}
@@ -0,0 +1,370 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// migration upgrade schema to version, statements may use {serial} for auto increment primary key
+type migration struct {
+	version int
+	stmts   []string
+}
+
+// migrations must be append only, applied migrations are recorded at schema_migrations
+var migrations = []migration{
+	{
+		version: 1,
+		stmts: []string{
+			`CREATE TABLE permissions (
+				id {serial},
+				system VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				UNIQUE (system, name)
+			)`,
+			`CREATE TABLE roles (
+				id {serial},
+				system VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				UNIQUE (system, name)
+			)`,
+			`CREATE TABLE role_permissions (
+				role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				PRIMARY KEY (role_id, permission)
+			)`,
+			`CREATE TABLE users (
+				id {serial},
+				system VARCHAR(255) NOT NULL,
+				uid VARCHAR(255) NOT NULL,
+				UNIQUE (system, uid)
+			)`,
+			`CREATE TABLE user_roles (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				role VARCHAR(255) NOT NULL,
+				PRIMARY KEY (user_id, role)
+			)`,
+			`CREATE TABLE user_blacklist (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				PRIMARY KEY (user_id, permission)
+			)`,
+			`CREATE TABLE user_whitelist (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				PRIMARY KEY (user_id, permission)
+			)`,
+		},
+	},
+	{
+		version: 2,
+		stmts: []string{
+			`ALTER TABLE roles ADD COLUMN revision BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE users ADD COLUMN revision BIGINT NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version: 3,
+		stmts: []string{
+			`CREATE TABLE role_parents (
+				role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+				parent VARCHAR(255) NOT NULL,
+				PRIMARY KEY (role_id, parent)
+			)`,
+		},
+	},
+	{
+		version: 4,
+		stmts: []string{
+			`CREATE TABLE user_grants (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				resource_type VARCHAR(255) NOT NULL,
+				resource_id VARCHAR(255) NOT NULL,
+				PRIMARY KEY (user_id, permission, resource_type, resource_id)
+			)`,
+		},
+	},
+	{
+		version: 5,
+		stmts: []string{
+			`CREATE TABLE groups (
+				id {serial},
+				system VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				revision BIGINT NOT NULL DEFAULT 0,
+				UNIQUE (system, name)
+			)`,
+			`CREATE TABLE group_roles (
+				group_id BIGINT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+				role VARCHAR(255) NOT NULL,
+				PRIMARY KEY (group_id, role)
+			)`,
+			`CREATE TABLE group_members (
+				group_id BIGINT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+				uid VARCHAR(255) NOT NULL,
+				PRIMARY KEY (group_id, uid)
+			)`,
+		},
+	},
+	{
+		version: 6,
+		stmts: []string{
+			`CREATE TABLE user_role_windows (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				role VARCHAR(255) NOT NULL,
+				valid_from TIMESTAMP,
+				expires_at TIMESTAMP,
+				PRIMARY KEY (user_id, role)
+			)`,
+			`CREATE TABLE user_whitelist_windows (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				valid_from TIMESTAMP,
+				expires_at TIMESTAMP,
+				PRIMARY KEY (user_id, permission)
+			)`,
+			`CREATE TABLE user_blacklist_windows (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				valid_from TIMESTAMP,
+				expires_at TIMESTAMP,
+				PRIMARY KEY (user_id, permission)
+			)`,
+		},
+	},
+	{
+		version: 7,
+		stmts: []string{
+			`CREATE TABLE sod_rules (
+				id {serial},
+				system VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				cardinality INTEGER NOT NULL DEFAULT 2,
+				revision BIGINT NOT NULL DEFAULT 0,
+				UNIQUE (system, name)
+			)`,
+			`CREATE TABLE sod_rule_roles (
+				rule_id BIGINT NOT NULL REFERENCES sod_rules (id) ON DELETE CASCADE,
+				role VARCHAR(255) NOT NULL,
+				PRIMARY KEY (rule_id, role)
+			)`,
+		},
+	},
+	{
+		version: 8,
+		stmts: []string{
+			`ALTER TABLE roles ADD COLUMN max_members INTEGER NOT NULL DEFAULT 0`,
+			`CREATE TABLE role_prerequisites (
+				role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+				prerequisite VARCHAR(255) NOT NULL,
+				PRIMARY KEY (role_id, prerequisite)
+			)`,
+		},
+	},
+	{
+		version: 9,
+		stmts: []string{
+			`CREATE TABLE role_conditions (
+				role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				expr TEXT NOT NULL,
+				PRIMARY KEY (role_id, permission)
+			)`,
+		},
+	},
+	{
+		version: 10,
+		stmts: []string{
+			`CREATE TABLE role_denied (
+				role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				PRIMARY KEY (role_id, permission)
+			)`,
+		},
+	},
+	{
+		version: 11,
+		stmts: []string{
+			`ALTER TABLE sod_rules ADD COLUMN dynamic BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+	},
+	{
+		version: 12,
+		stmts: []string{
+			`CREATE TABLE user_domain_roles (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				domain VARCHAR(255) NOT NULL,
+				role VARCHAR(255) NOT NULL,
+				PRIMARY KEY (user_id, domain, role)
+			)`,
+			`CREATE TABLE user_domain_whitelist (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				domain VARCHAR(255) NOT NULL,
+				permission VARCHAR(255) NOT NULL,
+				PRIMARY KEY (user_id, domain, permission)
+			)`,
+			`CREATE TABLE user_domain_blacklist (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				domain VARCHAR(255) NOT NULL,
+				permission VARCHAR(255) NOT NULL,
+				PRIMARY KEY (user_id, domain, permission)
+			)`,
+		},
+	},
+	{
+		version: 13,
+		stmts: []string{
+			`CREATE TABLE systems (
+				id {serial},
+				name VARCHAR(255) NOT NULL UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP,
+				revision BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE system_owners (
+				system_id BIGINT NOT NULL REFERENCES systems (id) ON DELETE CASCADE,
+				owner VARCHAR(255) NOT NULL,
+				PRIMARY KEY (system_id, owner)
+			)`,
+			`CREATE TABLE system_metadata (
+				system_id BIGINT NOT NULL REFERENCES systems (id) ON DELETE CASCADE,
+				name VARCHAR(255) NOT NULL,
+				value TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (system_id, name)
+			)`,
+		},
+	},
+	{
+		version: 14,
+		stmts: []string{
+			`ALTER TABLE systems ADD COLUMN auto_register BOOLEAN NOT NULL DEFAULT FALSE`,
+			`CREATE TABLE system_default_roles (
+				system_id BIGINT NOT NULL REFERENCES systems (id) ON DELETE CASCADE,
+				role VARCHAR(255) NOT NULL,
+				PRIMARY KEY (system_id, role)
+			)`,
+		},
+	},
+	{
+		version: 15,
+		stmts: []string{
+			`CREATE TABLE user_role_provenance (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				role VARCHAR(255) NOT NULL,
+				granted_by VARCHAR(255) NOT NULL DEFAULT '',
+				granted_at TIMESTAMP NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				ticket VARCHAR(255) NOT NULL DEFAULT '',
+				PRIMARY KEY (user_id, role)
+			)`,
+			`CREATE TABLE user_whitelist_provenance (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				granted_by VARCHAR(255) NOT NULL DEFAULT '',
+				granted_at TIMESTAMP NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				ticket VARCHAR(255) NOT NULL DEFAULT '',
+				PRIMARY KEY (user_id, permission)
+			)`,
+			`CREATE TABLE user_blacklist_provenance (
+				user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				permission VARCHAR(255) NOT NULL,
+				granted_by VARCHAR(255) NOT NULL DEFAULT '',
+				granted_at TIMESTAMP NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				ticket VARCHAR(255) NOT NULL DEFAULT '',
+				PRIMARY KEY (user_id, permission)
+			)`,
+		},
+	},
+	{
+		version: 16,
+		stmts: []string{
+			`CREATE TABLE delegations (
+				id {serial},
+				system VARCHAR(255) NOT NULL,
+				delegator VARCHAR(255) NOT NULL,
+				delegate VARCHAR(255) NOT NULL,
+				valid_from TIMESTAMP,
+				expires_at TIMESTAMP,
+				transitive BOOLEAN NOT NULL DEFAULT FALSE,
+				revision BIGINT NOT NULL DEFAULT 0,
+				UNIQUE (system, delegator, delegate)
+			)`,
+			`CREATE TABLE delegation_roles (
+				delegation_id BIGINT NOT NULL REFERENCES delegations (id) ON DELETE CASCADE,
+				role VARCHAR(255) NOT NULL,
+				PRIMARY KEY (delegation_id, role)
+			)`,
+		},
+	},
+	{
+		// entries within single domains hold their provenance, granted_at is NULL for entries without one
+		version: 17,
+		stmts: []string{
+			`ALTER TABLE user_domain_roles ADD COLUMN granted_by VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_roles ADD COLUMN granted_at TIMESTAMP`,
+			`ALTER TABLE user_domain_roles ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_roles ADD COLUMN ticket VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_whitelist ADD COLUMN granted_by VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_whitelist ADD COLUMN granted_at TIMESTAMP`,
+			`ALTER TABLE user_domain_whitelist ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_whitelist ADD COLUMN ticket VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_blacklist ADD COLUMN granted_by VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_blacklist ADD COLUMN granted_at TIMESTAMP`,
+			`ALTER TABLE user_domain_blacklist ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_domain_blacklist ADD COLUMN ticket VARCHAR(255) NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// migrate apply all pending migrations, each migration runs within its own transaction
+func (b *base) migrate() error {
+	ctx := context.Background()
+	_, err := b.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	current, err := b.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		err = b.tx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range m.stmts {
+				if _, err := tx.ExecContext(ctx, b.dialect.ddl(stmt)); err != nil {
+					return err
+				}
+			}
+			_, err := b.exec(ctx, tx, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+				m.version, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersion return version of the latest applied migration, 0 if none
+func (b *base) schemaVersion() (version int, err error) {
+	var v sql.NullInt64
+	err = b.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&v)
+	return int(v.Int64), err
+}
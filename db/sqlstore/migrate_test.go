@@ -0,0 +1,22 @@
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	version, err := store.schemaVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, migrations[len(migrations)-1].version, version)
+
+	// migrate again is a no-op
+	assert.Nil(t, store.migrate())
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT id FROM roles WHERE system = ? AND name = ?"
+	assert.Equal(t, query, sqlite.rebind(query))
+	assert.Equal(t, "SELECT id FROM roles WHERE system = $1 AND name = $2", postgres.rebind(query))
+}
@@ -0,0 +1,52 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nzqpeace/rbac/model"
+)
+
+// PermissionDao is the sql implementation of db.PermissionStore
+type PermissionDao struct {
+	*base
+}
+
+// GetAllPermissionsContext get all permissions of specified system
+func (dao *PermissionDao) GetAllPermissionsContext(ctx context.Context, system string) (ps []model.Permission, err error) {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind("SELECT name, description FROM permissions WHERE system = ? ORDER BY name"), system)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ps = []model.Permission{}
+	for rows.Next() {
+		p := model.Permission{System: system}
+		if err = rows.Scan(&p.Name, &p.Desc); err != nil {
+			return
+		}
+		ps = append(ps, p)
+	}
+	err = rows.Err()
+	return
+}
+
+// CreatePermissionContext create permission, replace its description if already exist
+func (dao *PermissionDao) CreatePermissionContext(ctx context.Context, p *model.Permission) error {
+	_, err := dao.exec(ctx, dao.db, `INSERT INTO permissions (system, name, description) VALUES (?, ?, ?)
+		ON CONFLICT (system, name) DO UPDATE SET description = excluded.description`, p.System, p.Name, p.Desc)
+	return err
+}
+
+// RemovePermissionContext remove specified permission
+func (dao *PermissionDao) RemovePermissionContext(ctx context.Context, system, name string) error {
+	return mustAffect(dao.exec(ctx, dao.db, "DELETE FROM permissions WHERE system = ? AND name = ?", system, name))
+}
+
+// UpdatePermissionContext rename specified permission
+func (dao *PermissionDao) UpdatePermissionContext(ctx context.Context, system, oldname, newname string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		return dao.rename(ctx, tx, "permissions", "name", system, oldname, newname)
+	})
+}
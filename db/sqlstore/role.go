@@ -0,0 +1,434 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// RoleDao is the sql implementation of db.RoleStore
+type RoleDao struct {
+	*base
+}
+
+// GetRoleContext get specified role
+func (dao *RoleDao) GetRoleContext(ctx context.Context, system, name string) (role model.Role, err error) {
+	var id int64
+	err = dao.queryRow(ctx, dao.db, "SELECT id, description, max_members, revision FROM roles WHERE system = ? AND name = ?",
+		system, name).Scan(&id, &role.Desc, &role.MaxMembers, &role.Revision)
+	if err == sql.ErrNoRows {
+		err = db.ErrNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	role.System, role.Name = system, name
+	if role.Permissions, err = dao.values(ctx, dao.db, rolePermissions, id); err != nil {
+		return
+	}
+	if role.Parents, err = dao.values(ctx, dao.db, roleParents, id); err != nil {
+		return
+	}
+	if role.Prerequisites, err = dao.values(ctx, dao.db, rolePrereqs, id); err != nil {
+		return
+	}
+	if role.Denied, err = dao.values(ctx, dao.db, roleDenied, id); err != nil {
+		return
+	}
+	role.Conditions, err = dao.conditions(ctx, dao.db, id)
+	return
+}
+
+// conditions list conditions of role ordered by permission
+func (dao *RoleDao) conditions(ctx context.Context, q querier, id int64) (conditions []model.Condition, err error) {
+	rows, err := q.QueryContext(ctx, dao.dialect.rebind(`SELECT permission, expr FROM role_conditions
+		WHERE role_id = ? ORDER BY permission`), id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	conditions = []model.Condition{}
+	for rows.Next() {
+		var c model.Condition
+		if err = rows.Scan(&c.Permission, &c.Expr); err != nil {
+			return
+		}
+		conditions = append(conditions, c)
+	}
+	err = rows.Err()
+	return
+}
+
+// setCondition replace condition of the same permission of role
+func (dao *RoleDao) setCondition(ctx context.Context, q querier, id int64, c model.Condition) error {
+	if err := dao.removeValue(ctx, q, roleConditions, id, c.Permission); err != nil {
+		return err
+	}
+	_, err := dao.exec(ctx, q, "INSERT INTO role_conditions (role_id, permission, expr) VALUES (?, ?, ?)", id, c.Permission, c.Expr)
+	return err
+}
+
+// GetAllRolesContext get all roles of specified system
+func (dao *RoleDao) GetAllRolesContext(ctx context.Context, system string) (roles []model.Role, err error) {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind(`SELECT r.name, r.description, r.max_members, r.revision, rp.permission
+		FROM roles r LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		WHERE r.system = ? ORDER BY r.name, rp.permission`), system)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	roles = []model.Role{}
+	for rows.Next() {
+		var name, desc string
+		var maxMembers int
+		var revision int64
+		var permission sql.NullString
+		if err = rows.Scan(&name, &desc, &maxMembers, &revision, &permission); err != nil {
+			return
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, model.Role{System: system, Name: name, Desc: desc, Permissions: []string{}, Parents: []string{},
+				Denied: []string{}, Conditions: []model.Condition{}, MaxMembers: maxMembers, Prerequisites: []string{}, Revision: revision})
+		}
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	if err = dao.loadValues(ctx, system, roles, roleParents, func(role *model.Role) *[]string {
+		return &role.Parents
+	}); err != nil {
+		return
+	}
+	if err = dao.loadValues(ctx, system, roles, rolePrereqs, func(role *model.Role) *[]string {
+		return &role.Prerequisites
+	}); err != nil {
+		return
+	}
+	if err = dao.loadValues(ctx, system, roles, roleDenied, func(role *model.Role) *[]string {
+		return &role.Denied
+	}); err != nil {
+		return
+	}
+	err = dao.loadConditions(ctx, system, roles)
+	return
+}
+
+// loadConditions fill conditions into roles, roles are sorted by name
+func (dao *RoleDao) loadConditions(ctx context.Context, system string, roles []model.Role) error {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind(`SELECT r.name, c.permission, c.expr
+		FROM roles r JOIN role_conditions c ON c.role_id = r.id
+		WHERE r.system = ? ORDER BY r.name, c.permission`), system)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		var name string
+		var c model.Condition
+		if err = rows.Scan(&name, &c.Permission, &c.Expr); err != nil {
+			return err
+		}
+
+		for i < len(roles) && roles[i].Name != name {
+			i++
+		}
+		if i < len(roles) {
+			roles[i].Conditions = append(roles[i].Conditions, c)
+		}
+	}
+	return rows.Err()
+}
+
+// loadValues fill values of t into the field of roles selected by field, roles are sorted by name
+func (dao *RoleDao) loadValues(ctx context.Context, system string, roles []model.Role, t listTable, field func(role *model.Role) *[]string) error {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind(fmt.Sprintf(`SELECT r.name, v.%s
+		FROM roles r JOIN %s v ON v.%s = r.id
+		WHERE r.system = ? ORDER BY r.name, v.%s`, t.column, t.table, t.owner, t.column)), system)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return err
+		}
+
+		for i < len(roles) && roles[i].Name != name {
+			i++
+		}
+		if i < len(roles) {
+			values := field(&roles[i])
+			*values = append(*values, value)
+		}
+	}
+	return rows.Err()
+}
+
+// CreateRoleContext create role, replace it if already exist
+func (dao *RoleDao) CreateRoleContext(ctx context.Context, role *model.Role) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.upsertID(ctx, tx, "roles", "name", role.System, role.Name)
+		if err != nil {
+			return err
+		}
+
+		_, err = dao.exec(ctx, tx, "UPDATE roles SET description = ?, max_members = ?, revision = revision + 1 WHERE id = ?",
+			role.Desc, role.MaxMembers, id)
+		if err != nil {
+			return err
+		}
+		if err = dao.setValues(ctx, tx, rolePermissions, id, role.Permissions...); err != nil {
+			return err
+		}
+		if err = dao.setValues(ctx, tx, roleParents, id, role.Parents...); err != nil {
+			return err
+		}
+		if err = dao.setValues(ctx, tx, roleDenied, id, role.Denied...); err != nil {
+			return err
+		}
+		if err = dao.clearValues(ctx, tx, roleConditions, id); err != nil {
+			return err
+		}
+		for _, c := range role.Conditions {
+			if err = dao.setCondition(ctx, tx, id, c); err != nil {
+				return err
+			}
+		}
+		return dao.setValues(ctx, tx, rolePrereqs, id, role.Prerequisites...)
+	})
+}
+
+// RemoveRoleContext remove specified role
+func (dao *RoleDao) RemoveRoleContext(ctx context.Context, system, name string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range []listTable{rolePermissions, roleParents, rolePrereqs, roleDenied, roleConditions} {
+			if err = dao.clearValues(ctx, tx, t, id); err != nil {
+				return err
+			}
+		}
+		_, err = dao.exec(ctx, tx, "DELETE FROM roles WHERE id = ?", id)
+		return err
+	})
+}
+
+// RemoveAllRolesContext remove all roles of specified system
+func (dao *RoleDao) RemoveAllRolesContext(ctx context.Context, system string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		for _, t := range []listTable{rolePermissions, roleParents, rolePrereqs, roleDenied, roleConditions} {
+			_, err := dao.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", t.table, t.owner, owners(t)), system)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := dao.exec(ctx, tx, "DELETE FROM roles WHERE system = ?", system)
+		return err
+	})
+}
+
+// UpdateRoleNameContext rename specified role
+func (dao *RoleDao) UpdateRoleNameContext(ctx context.Context, system, oldname, newname string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		if err := dao.rename(ctx, tx, "roles", "name", system, oldname, newname); err != nil {
+			return err
+		}
+
+		id, err := dao.roleID(ctx, tx, system, newname)
+		if err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// GetPermissionsContext get all permissions of specified role
+func (dao *RoleDao) GetPermissionsContext(ctx context.Context, system, name string) ([]string, error) {
+	id, err := dao.roleID(ctx, dao.db, system, name)
+	if err != nil {
+		return nil, err
+	}
+	return dao.values(ctx, dao.db, rolePermissions, id)
+}
+
+// GrantPermissionsContext grant permissions to specified role
+func (dao *RoleDao) GrantPermissionsContext(ctx context.Context, system, name string, permissions ...string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.addValues(ctx, tx, rolePermissions, id, permissions...); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// RemovePermissionContext remove permission from specified role
+func (dao *RoleDao) RemovePermissionContext(ctx context.Context, system, name string, permission string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.removeValue(ctx, tx, rolePermissions, id, permission); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// AddParentsContext add parents to specified role, parents already present are ignored
+func (dao *RoleDao) AddParentsContext(ctx context.Context, system, name string, parents ...string) error {
+	if len(parents) == 0 {
+		return nil
+	}
+
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.addValues(ctx, tx, roleParents, id, parents...); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// RemoveParentContext remove parent from specified role
+func (dao *RoleDao) RemoveParentContext(ctx context.Context, system, name string, parent string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.removeValue(ctx, tx, roleParents, id, parent); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// DenyPermissionsContext add permissions denied by specified role, permissions already denied are ignored
+func (dao *RoleDao) DenyPermissionsContext(ctx context.Context, system, name string, permissions ...string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.addValues(ctx, tx, roleDenied, id, permissions...); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// RemoveDeniedContext remove permission from those denied by specified role
+func (dao *RoleDao) RemoveDeniedContext(ctx context.Context, system, name string, permission string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.removeValue(ctx, tx, roleDenied, id, permission); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// SetConditionContext grant permission to role under condition, replacing the condition of the same permission
+func (dao *RoleDao) SetConditionContext(ctx context.Context, system, name string, condition model.Condition) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.setCondition(ctx, tx, id, condition); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// RemoveConditionContext remove condition of permission from specified role
+func (dao *RoleDao) RemoveConditionContext(ctx context.Context, system, name string, permission string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if err = dao.removeValue(ctx, tx, roleConditions, id, permission); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// UpdateConstraintsContext replace max members and prerequisites of specified role
+func (dao *RoleDao) UpdateConstraintsContext(ctx context.Context, system, name string, maxMembers int, prerequisites ...string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, system, name)
+		if err != nil {
+			return err
+		}
+		if _, err = dao.exec(ctx, tx, "UPDATE roles SET max_members = ? WHERE id = ?", maxMembers, id); err != nil {
+			return err
+		}
+		if err = dao.setValues(ctx, tx, rolePrereqs, id, prerequisites...); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "roles", id)
+	})
+}
+
+// UpdateRoleIfMatchContext replace description and permissions of role if its revision equals revision
+func (dao *RoleDao) UpdateRoleIfMatchContext(ctx context.Context, role *model.Role, revision int64) error {
+	err := dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.roleID(ctx, tx, role.System, role.Name)
+		if err != nil {
+			return err
+		}
+
+		err = dao.updateIfMatch(ctx, tx, "UPDATE roles SET description = ?, revision = revision + 1 WHERE id = ? AND revision = ?",
+			role.Desc, id, revision)
+		if err != nil {
+			return err
+		}
+		return dao.setValues(ctx, tx, rolePermissions, id, role.Permissions...)
+	})
+	if err == nil {
+		role.Revision = revision + 1
+	}
+	return err
+}
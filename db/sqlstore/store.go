@@ -0,0 +1,122 @@
+// Package sqlstore implements db.Store on top of database/sql, SQLite and PostgreSQL are supported.
+//
+// Roles, users, groups and their lists are normalized into tables, the permissions of a role, the roles,
+// blacklist and whitelist of a user and the roles and members of a group are sets, duplicated entries are ignored.
+// The sql driver must be imported by the application, e.g. `modernc.org/sqlite` or `github.com/lib/pq`.
+package sqlstore
+
+import (
+	"database/sql"
+
+	"github.com/nzqpeace/rbac/db"
+)
+
+var _ db.Store = (*Store)(nil)
+
+// Config is configuration of sql storage
+type Config struct {
+	// Driver is name of database/sql driver, sqlite, sqlite3, postgres and pgx are supported
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+}
+
+// Store is the sql implementation of db.Store
+type Store struct {
+	*base
+	permission *PermissionDao
+	role       *RoleDao
+	user       *UserDao
+	group      *GroupDao
+	constraint *ConstraintDao
+	system     *SystemDao
+	delegation *DelegationDao
+}
+
+// Open connect to database and migrate schema to the latest version
+func Open(config *Config) (*Store, error) {
+	conn, err := sql.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := New(conn, config.Driver)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New create store with an opened database, driver is used to choose sql dialect
+func New(conn *sql.DB, driver string) (*Store, error) {
+	d, err := dialectOf(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	if d == sqlite {
+		// sqlite serialize writers anyway, sharing one connection avoid `database is locked`
+		// errors and keep `:memory:` databases alive
+		conn.SetMaxOpenConns(1)
+	}
+
+	if err = conn.Ping(); err != nil {
+		return nil, err
+	}
+
+	b := &base{db: conn, dialect: d}
+	if err = b.migrate(); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		base:       b,
+		permission: &PermissionDao{b},
+		role:       &RoleDao{b},
+		user:       &UserDao{b},
+		group:      &GroupDao{b},
+		constraint: &ConstraintDao{b},
+		system:     &SystemDao{b},
+		delegation: &DelegationDao{b},
+	}, nil
+}
+
+// Permissions return permission dao
+func (s *Store) Permissions() db.PermissionStore {
+	return s.permission
+}
+
+// Roles return role dao
+func (s *Store) Roles() db.RoleStore {
+	return s.role
+}
+
+// Users return user dao
+func (s *Store) Users() db.UserStore {
+	return s.user
+}
+
+// Groups return group dao
+func (s *Store) Groups() db.GroupStore {
+	return s.group
+}
+
+// Constraints return constraint dao
+func (s *Store) Constraints() db.ConstraintStore {
+	return s.constraint
+}
+
+// Systems return system dao
+func (s *Store) Systems() db.SystemStore {
+	return s.system
+}
+
+// Delegations return delegation dao
+func (s *Store) Delegations() db.DelegationStore {
+	return s.delegation
+}
+
+// Close close database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
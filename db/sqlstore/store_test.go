@@ -0,0 +1,26 @@
+package sqlstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nzqpeace/rbac/db/storetest"
+	_ "modernc.org/sqlite"
+)
+
+var store *Store
+
+func init() {
+	var err error
+	store, err = Open(&Config{
+		Driver: "sqlite",
+		DSN:    ":memory:",
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, store)
+}
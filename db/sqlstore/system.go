@@ -0,0 +1,266 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// SystemDao is the sql implementation of db.SystemStore
+type SystemDao struct {
+	*base
+}
+
+// systemID lookup primary key of system
+func (dao *SystemDao) systemID(ctx context.Context, q querier, name string) (id int64, err error) {
+	err = dao.queryRow(ctx, q, "SELECT id FROM systems WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = db.ErrNotFound
+	}
+	return
+}
+
+// find list systems matched by where, which may refer to columns of systems
+func (dao *SystemDao) find(ctx context.Context, where string, args ...interface{}) (systems []model.System, err error) {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind(`SELECT id, name, description, auto_register, created_at, revision FROM systems
+		WHERE `+where+` ORDER BY name`), args...)
+	if err != nil {
+		return
+	}
+
+	var ids []int64
+	systems = []model.System{}
+	for rows.Next() {
+		var id int64
+		var created sql.NullTime
+		var s model.System
+		if err = rows.Scan(&id, &s.Name, &s.Desc, &s.AutoRegister, &created, &s.Revision); err != nil {
+			rows.Close()
+			return
+		}
+		if created.Valid {
+			s.CreatedAt = created.Time
+		}
+		ids = append(ids, id)
+		systems = append(systems, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// rows must be closed before further queries, sqlite share one connection
+	for i, id := range ids {
+		if systems[i].Owners, err = dao.values(ctx, dao.db, systemOwners, id); err != nil {
+			return
+		}
+		if systems[i].Metadata, err = dao.metadata(ctx, id); err != nil {
+			return
+		}
+		if systems[i].DefaultRoles, err = dao.values(ctx, dao.db, systemRoles, id); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// metadata get metadata of system
+func (dao *SystemDao) metadata(ctx context.Context, id int64) (m map[string]string, err error) {
+	rows, err := dao.db.QueryContext(ctx, dao.dialect.rebind("SELECT name, value FROM system_metadata WHERE system_id = ?"), id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	m = map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err = rows.Scan(&k, &v); err != nil {
+			return
+		}
+		m[k] = v
+	}
+	err = rows.Err()
+	return
+}
+
+// save replace owners, metadata and default roles of system
+func (dao *SystemDao) save(ctx context.Context, tx *sql.Tx, id int64, system *model.System) error {
+	if err := dao.setValues(ctx, tx, systemOwners, id, system.Owners...); err != nil {
+		return err
+	}
+	if err := dao.setValues(ctx, tx, systemRoles, id, system.DefaultRoles...); err != nil {
+		return err
+	}
+	if err := dao.clearValues(ctx, tx, systemMetadata, id); err != nil {
+		return err
+	}
+	for k, v := range system.Metadata {
+		if _, err := dao.exec(ctx, tx, "INSERT INTO system_metadata (system_id, name, value) VALUES (?, ?, ?)", id, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSystemContext get specified system
+func (dao *SystemDao) GetSystemContext(ctx context.Context, name string) (model.System, error) {
+	systems, err := dao.find(ctx, "name = ?", name)
+	if err != nil {
+		return model.System{}, err
+	}
+	if len(systems) == 0 {
+		return model.System{}, db.ErrNotFound
+	}
+	return systems[0], nil
+}
+
+// GetAllSystemsContext get all registered systems
+func (dao *SystemDao) GetAllSystemsContext(ctx context.Context) ([]model.System, error) {
+	return dao.find(ctx, "1 = 1")
+}
+
+// CreateSystemContext register system, db.ErrAlreadyExists is returned if it's registered already
+func (dao *SystemDao) CreateSystemContext(ctx context.Context, system *model.System) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		res, err := dao.exec(ctx, tx, `INSERT INTO systems (name, description, auto_register, created_at, revision) VALUES (?, ?, ?, ?, 1)
+			ON CONFLICT (name) DO NOTHING`, system.Name, system.Desc, system.AutoRegister, system.CreatedAt.UTC())
+		if err = mustAffect(res, err); err == db.ErrNotFound {
+			return db.ErrAlreadyExists
+		} else if err != nil {
+			return err
+		}
+
+		id, err := dao.systemID(ctx, tx, system.Name)
+		if err != nil {
+			return err
+		}
+		return dao.save(ctx, tx, id, system)
+	})
+}
+
+// UpdateSystemContext replace description, owners, metadata, default roles and auto register of system
+func (dao *SystemDao) UpdateSystemContext(ctx context.Context, system *model.System) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.systemID(ctx, tx, system.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = dao.exec(ctx, tx, "UPDATE systems SET description = ?, auto_register = ?, revision = revision + 1 WHERE id = ?",
+			system.Desc, system.AutoRegister, id); err != nil {
+			return err
+		}
+		return dao.save(ctx, tx, id, system)
+	})
+}
+
+// removeSystem remove system identified by id together with its owners, metadata and default roles
+func (dao *SystemDao) removeSystem(ctx context.Context, tx *sql.Tx, id int64) error {
+	for _, t := range []listTable{systemOwners, systemMetadata, systemRoles} {
+		if err := dao.clearValues(ctx, tx, t, id); err != nil {
+			return err
+		}
+	}
+	_, err := dao.exec(ctx, tx, "DELETE FROM systems WHERE id = ?", id)
+	return err
+}
+
+// RemoveSystemContext unregister specified system, its permissions, roles, users and groups are kept
+func (dao *SystemDao) RemoveSystemContext(ctx context.Context, name string) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.systemID(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		return dao.removeSystem(ctx, tx, id)
+	})
+}
+
+// removeAll remove all rows of system at parent together with their values at tables, return key of removed rows
+func (dao *SystemDao) removeAll(ctx context.Context, tx *sql.Tx, system, parent, key string, tables ...listTable) ([]string, error) {
+	names, err := dao.queryStrings(ctx, tx, fmt.Sprintf("SELECT %s FROM %s WHERE system = ? ORDER BY %s", key, parent, key), system)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tables {
+		_, err = dao.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT id FROM %s WHERE system = ?)", t.table, t.owner, parent), system)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = dao.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE system = ?", parent), system)
+	return names, err
+}
+
+// RemoveSystemCascadeContext remove system together with all its permissions, roles, users, groups, rules and delegations
+// atomically
+func (dao *SystemDao) RemoveSystemCascadeContext(ctx context.Context, name string) (affected db.Affected, err error) {
+	err = dao.tx(ctx, func(tx *sql.Tx) (err error) {
+		if _, err = dao.removeAll(ctx, tx, name, "permissions", "name"); err != nil {
+			return
+		}
+		if affected.Roles, err = dao.removeAll(ctx, tx, name, "roles", "name",
+			rolePermissions, roleParents, rolePrereqs, roleDenied, roleConditions); err != nil {
+			return
+		}
+		if affected.Users, err = dao.removeAll(ctx, tx, name, "users", "uid",
+			userRoles, userBlackList, userWhiteList, userGrants, userRoleWindows, userWhiteListWindows, userBlackListWindows,
+			userDomainRoles, userDomainWhiteList, userDomainBlackList, userRoleProvenance, userWhiteListProvenance,
+			userBlackListProvenance); err != nil {
+			return
+		}
+		if affected.Groups, err = dao.removeAll(ctx, tx, name, "groups", "name", groupRoles, groupMembers); err != nil {
+			return
+		}
+		if _, err = dao.removeAll(ctx, tx, name, "sod_rules", "name", sodRuleRoles); err != nil {
+			return
+		}
+		if _, err = dao.removeAll(ctx, tx, name, "delegations", "delegate", delegationRoles); err != nil {
+			return
+		}
+
+		id, err := dao.systemID(ctx, tx, name)
+		if err == db.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return dao.removeSystem(ctx, tx, id)
+	})
+	return
+}
+
+// pullDefaultRole remove role from default roles of system
+func (b *base) pullDefaultRole(ctx context.Context, q querier, system, role string) error {
+	_, err := b.exec(ctx, q, `UPDATE systems SET revision = revision + 1
+		WHERE name = ? AND id IN (SELECT system_id FROM system_default_roles WHERE role = ?)`, system, role)
+	if err != nil {
+		return err
+	}
+	_, err = b.exec(ctx, q, "DELETE FROM system_default_roles WHERE role = ? AND system_id IN (SELECT id FROM systems WHERE name = ?)", role, system)
+	return err
+}
+
+// renameDefaultRole replace oldname with newname at default roles of system
+func (b *base) renameDefaultRole(ctx context.Context, q querier, system, oldname, newname string) error {
+	_, err := b.exec(ctx, q, `UPDATE systems SET revision = revision + 1
+		WHERE name = ? AND id IN (SELECT system_id FROM system_default_roles WHERE role = ?)`, system, oldname)
+	if err != nil {
+		return err
+	}
+
+	// default roles are a set, drop oldname where newname is already present
+	_, err = b.exec(ctx, q, `DELETE FROM system_default_roles WHERE role = ? AND system_id IN (SELECT id FROM systems WHERE name = ?)
+		AND EXISTS (SELECT 1 FROM system_default_roles d WHERE d.system_id = system_default_roles.system_id AND d.role = ?)`, oldname, system, newname)
+	if err != nil {
+		return err
+	}
+	_, err = b.exec(ctx, q, "UPDATE system_default_roles SET role = ? WHERE role = ? AND system_id IN (SELECT id FROM systems WHERE name = ?)",
+		newname, oldname, system)
+	return err
+}
@@ -0,0 +1,765 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// UserDao is the sql implementation of db.UserStore
+type UserDao struct {
+	*base
+}
+
+// userList pair a list of user with the tables holding windows of its entries, its entries within single domains
+// and provenance of its entries
+type userList struct {
+	entries    listTable
+	windows    listTable
+	domains    listTable
+	provenance listTable
+}
+
+var userLists = map[string]userList{
+	model.ListRoles:     {userRoles, userRoleWindows, userDomainRoles, userRoleProvenance},
+	model.ListWhiteList: {userWhiteList, userWhiteListWindows, userDomainWhiteList, userWhiteListProvenance},
+	model.ListBlackList: {userBlackList, userBlackListWindows, userDomainBlackList, userBlackListProvenance},
+}
+
+// modify run fn with primary key of specified user within one transaction
+func (dao *UserDao) modify(ctx context.Context, system, uid string, fn func(tx *sql.Tx, id int64) error) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.userID(ctx, tx, system, uid)
+		if err != nil {
+			return err
+		}
+		if err = fn(tx, id); err != nil {
+			return err
+		}
+		return dao.bump(ctx, tx, "users", id)
+	})
+}
+
+// list get values of specified user from join table
+func (dao *UserDao) list(ctx context.Context, system, uid string, t listTable) ([]string, error) {
+	id, err := dao.userID(ctx, dao.db, system, uid)
+	if err != nil {
+		return nil, err
+	}
+	return dao.values(ctx, dao.db, t, id)
+}
+
+// save store roles, blacklist, whitelist, grants, windows, domain entries and provenance of user
+func (dao *UserDao) save(ctx context.Context, tx *sql.Tx, id int64, user *model.UserPermModel) error {
+	if err := dao.setValues(ctx, tx, userRoles, id, user.Roles...); err != nil {
+		return err
+	}
+	if err := dao.setValues(ctx, tx, userBlackList, id, user.BlackList...); err != nil {
+		return err
+	}
+	if err := dao.setValues(ctx, tx, userWhiteList, id, user.WhiteList...); err != nil {
+		return err
+	}
+	if err := dao.clearValues(ctx, tx, userGrants, id); err != nil {
+		return err
+	}
+	if err := dao.addGrants(ctx, tx, id, user.Grants...); err != nil {
+		return err
+	}
+
+	if err := dao.setWindows(ctx, tx, userRoleWindows, id, user.RoleWindows...); err != nil {
+		return err
+	}
+	if err := dao.setWindows(ctx, tx, userWhiteListWindows, id, user.WhiteListWindows...); err != nil {
+		return err
+	}
+	if err := dao.setWindows(ctx, tx, userBlackListWindows, id, user.BlackListWindows...); err != nil {
+		return err
+	}
+
+	for _, l := range []struct {
+		t       listTable
+		entries []model.DomainEntry
+	}{
+		{userDomainRoles, user.DomainRoles},
+		{userDomainWhiteList, user.DomainWhiteList},
+		{userDomainBlackList, user.DomainBlackList},
+	} {
+		if err := dao.clearValues(ctx, tx, l.t, id); err != nil {
+			return err
+		}
+		if err := dao.addDomainEntries(ctx, tx, l.t, id, l.entries...); err != nil {
+			return err
+		}
+	}
+
+	if err := dao.setProvenance(ctx, tx, userRoleProvenance, id, user.RoleProvenance...); err != nil {
+		return err
+	}
+	if err := dao.setProvenance(ctx, tx, userWhiteListProvenance, id, user.WhiteListProvenance...); err != nil {
+		return err
+	}
+	return dao.setProvenance(ctx, tx, userBlackListProvenance, id, user.BlackListProvenance...)
+}
+
+// setWindows replace all windows of user at t
+func (dao *UserDao) setWindows(ctx context.Context, q querier, t listTable, id int64, windows ...model.Window) error {
+	if err := dao.clearValues(ctx, q, t, id); err != nil {
+		return err
+	}
+	return dao.addWindows(ctx, q, t, id, windows...)
+}
+
+// nullTime convert an open bound of period into NULL, times are stored in UTC
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// timeOf convert NULL into an open bound of period
+func timeOf(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// windows list windows of user at t
+func (dao *UserDao) windows(ctx context.Context, q querier, t listTable, id int64) (windows []model.Window, err error) {
+	rows, err := q.QueryContext(ctx, dao.dialect.rebind(fmt.Sprintf("SELECT %s, valid_from, expires_at FROM %s WHERE %s = ? ORDER BY %s",
+		t.column, t.table, t.owner, t.column)), id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	windows = []model.Window{}
+	for rows.Next() {
+		var w model.Window
+		var from, expires sql.NullTime
+		if err = rows.Scan(&w.Name, &from, &expires); err != nil {
+			return
+		}
+		w.ValidFrom, w.ExpiresAt = timeOf(from), timeOf(expires)
+		windows = append(windows, w)
+	}
+	err = rows.Err()
+	return
+}
+
+// addWindows add windows to user at t, windows of the same entries are replaced
+func (dao *UserDao) addWindows(ctx context.Context, q querier, t listTable, id int64, windows ...model.Window) error {
+	for _, w := range windows {
+		if err := dao.removeValue(ctx, q, t, id, w.Name); err != nil {
+			return err
+		}
+		_, err := dao.exec(ctx, q, fmt.Sprintf("INSERT INTO %s (%s, %s, valid_from, expires_at) VALUES (?, ?, ?, ?)",
+			t.table, t.owner, t.column), id, w.Name, nullTime(w.ValidFrom), nullTime(w.ExpiresAt))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// domainEntries list entries of user within single domains at t
+func (dao *UserDao) domainEntries(ctx context.Context, q querier, t listTable, id int64) (entries []model.DomainEntry, err error) {
+	rows, err := q.QueryContext(ctx, dao.dialect.rebind(fmt.Sprintf(`SELECT domain, %s, granted_by, granted_at, reason, ticket FROM %s
+		WHERE %s = ? ORDER BY domain, %s`, t.column, t.table, t.owner, t.column)), id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	entries = []model.DomainEntry{}
+	for rows.Next() {
+		var e model.DomainEntry
+		var p model.Provenance
+		var at sql.NullTime
+		if err = rows.Scan(&e.Domain, &e.Name, &p.GrantedBy, &at, &p.Reason, &p.Ticket); err != nil {
+			return
+		}
+		if at.Valid {
+			p.Name, p.GrantedAt = e.Name, at.Time
+			e.Provenance = &p
+		}
+		entries = append(entries, e)
+	}
+	err = rows.Err()
+	return
+}
+
+// addDomainEntries add entries within single domains to user at t together with their provenance, entries
+// already exist are ignored
+func (dao *UserDao) addDomainEntries(ctx context.Context, q querier, t listTable, id int64, entries ...model.DomainEntry) error {
+	query := fmt.Sprintf(`INSERT INTO %s (%s, domain, %s, granted_by, granted_at, reason, ticket) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`, t.table, t.owner, t.column)
+	for _, e := range entries {
+		var p model.Provenance
+		var at sql.NullTime
+		if e.Provenance != nil {
+			p, at = *e.Provenance, sql.NullTime{Time: e.Provenance.GrantedAt.UTC(), Valid: true}
+		}
+		if _, err := dao.exec(ctx, q, query, id, e.Domain, e.Name, p.GrantedBy, at, p.Reason, p.Ticket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// provenance list provenance of entries of user at t
+func (dao *UserDao) provenance(ctx context.Context, q querier, t listTable, id int64) (provenance []model.Provenance, err error) {
+	rows, err := q.QueryContext(ctx, dao.dialect.rebind(fmt.Sprintf("SELECT %s, granted_by, granted_at, reason, ticket FROM %s WHERE %s = ? ORDER BY %s",
+		t.column, t.table, t.owner, t.column)), id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	provenance = []model.Provenance{}
+	for rows.Next() {
+		var p model.Provenance
+		if err = rows.Scan(&p.Name, &p.GrantedBy, &p.GrantedAt, &p.Reason, &p.Ticket); err != nil {
+			return
+		}
+		provenance = append(provenance, p)
+	}
+	err = rows.Err()
+	return
+}
+
+// addProvenance add provenance of entries to user at t, provenance of the same entries is replaced
+func (dao *UserDao) addProvenance(ctx context.Context, q querier, t listTable, id int64, provenance ...model.Provenance) error {
+	for _, p := range provenance {
+		if err := dao.removeValue(ctx, q, t, id, p.Name); err != nil {
+			return err
+		}
+		_, err := dao.exec(ctx, q, fmt.Sprintf("INSERT INTO %s (%s, %s, granted_by, granted_at, reason, ticket) VALUES (?, ?, ?, ?, ?, ?)",
+			t.table, t.owner, t.column), id, p.Name, p.GrantedBy, p.GrantedAt.UTC(), p.Reason, p.Ticket)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setProvenance replace all provenance of user at t
+func (dao *UserDao) setProvenance(ctx context.Context, q querier, t listTable, id int64, provenance ...model.Provenance) error {
+	if err := dao.clearValues(ctx, q, t, id); err != nil {
+		return err
+	}
+	return dao.addProvenance(ctx, q, t, id, provenance...)
+}
+
+// grants list grants of user
+func (dao *UserDao) grants(ctx context.Context, q querier, id int64) (grants []model.Grant, err error) {
+	rows, err := q.QueryContext(ctx, dao.dialect.rebind(`SELECT permission, resource_type, resource_id FROM user_grants
+		WHERE user_id = ? ORDER BY permission, resource_type, resource_id`), id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	grants = []model.Grant{}
+	for rows.Next() {
+		var g model.Grant
+		if err = rows.Scan(&g.Permission, &g.Resource.Type, &g.Resource.ID); err != nil {
+			return
+		}
+		grants = append(grants, g)
+	}
+	err = rows.Err()
+	return
+}
+
+// addGrants add grants to user, grants already exist are ignored
+func (dao *UserDao) addGrants(ctx context.Context, q querier, id int64, grants ...model.Grant) error {
+	for _, g := range grants {
+		_, err := dao.exec(ctx, q, `INSERT INTO user_grants (user_id, permission, resource_type, resource_id)
+			VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`, id, g.Permission, g.Resource.Type, g.Resource.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateUserPermModelContext store user permission model, replace it if already exist
+func (dao *UserDao) CreateUserPermModelContext(ctx context.Context, user *model.UserPermModel) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.upsertID(ctx, tx, "users", "uid", user.System, user.UID)
+		if err != nil {
+			return err
+		}
+		if err = dao.bump(ctx, tx, "users", id); err != nil {
+			return err
+		}
+		return dao.save(ctx, tx, id, user)
+	})
+}
+
+// InsertUserPermModelContext create user only if it doesn't exist, db.ErrAlreadyExists is returned otherwise
+func (dao *UserDao) InsertUserPermModelContext(ctx context.Context, user *model.UserPermModel) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		res, err := dao.exec(ctx, tx, "INSERT INTO users (system, uid) VALUES (?, ?) ON CONFLICT (system, uid) DO NOTHING",
+			user.System, user.UID)
+		if err = mustAffect(res, err); err == db.ErrNotFound {
+			return db.ErrAlreadyExists
+		} else if err != nil {
+			return err
+		}
+
+		id, err := dao.userID(ctx, tx, user.System, user.UID)
+		if err != nil {
+			return err
+		}
+		if err = dao.bump(ctx, tx, "users", id); err != nil {
+			return err
+		}
+		return dao.save(ctx, tx, id, user)
+	})
+}
+
+// RemoveUserPermModelContext remove user info
+func (dao *UserDao) RemoveUserPermModelContext(ctx context.Context, system, uid string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		for _, t := range []listTable{userRoles, userBlackList, userWhiteList, userGrants,
+			userRoleWindows, userWhiteListWindows, userBlackListWindows, userDomainRoles, userDomainWhiteList, userDomainBlackList,
+			userRoleProvenance, userWhiteListProvenance, userBlackListProvenance} {
+			if err := dao.clearValues(ctx, tx, t, id); err != nil {
+				return err
+			}
+		}
+		_, err := dao.exec(ctx, tx, "DELETE FROM users WHERE id = ?", id)
+		return err
+	})
+}
+
+// UpdateUserPermModelContext replace user info
+func (dao *UserDao) UpdateUserPermModelContext(ctx context.Context, system, uid string, user *model.UserPermModel) error {
+	return dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.userID(ctx, tx, system, uid)
+		if err != nil {
+			return err
+		}
+
+		if user.System != system || user.UID != uid {
+			if _, err = dao.userID(ctx, tx, user.System, user.UID); err == nil {
+				return db.ErrAlreadyExists
+			} else if err != db.ErrNotFound {
+				return err
+			}
+
+			_, err = dao.exec(ctx, tx, "UPDATE users SET system = ?, uid = ? WHERE id = ?", user.System, user.UID, id)
+			if err != nil {
+				return err
+			}
+		}
+		if err = dao.bump(ctx, tx, "users", id); err != nil {
+			return err
+		}
+		return dao.save(ctx, tx, id, user)
+	})
+}
+
+// GetUserPermModelContext get user info, it's read within one transaction so concurrent writes aren't mixed
+func (dao *UserDao) GetUserPermModelContext(ctx context.Context, system, uid string) (user model.UserPermModel, err error) {
+	err = dao.view(ctx, func(tx *sql.Tx) (err error) {
+		user, err = dao.get(ctx, tx, system, uid)
+		return
+	})
+	return
+}
+
+// get read user info with q
+func (dao *UserDao) get(ctx context.Context, q querier, system, uid string) (user model.UserPermModel, err error) {
+	var id int64
+	err = dao.queryRow(ctx, q, "SELECT id, revision FROM users WHERE system = ? AND uid = ?",
+		system, uid).Scan(&id, &user.Revision)
+	if err == sql.ErrNoRows {
+		err = db.ErrNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	user.System, user.UID = system, uid
+	if user.Roles, err = dao.values(ctx, q, userRoles, id); err != nil {
+		return
+	}
+	if user.BlackList, err = dao.values(ctx, q, userBlackList, id); err != nil {
+		return
+	}
+	if user.WhiteList, err = dao.values(ctx, q, userWhiteList, id); err != nil {
+		return
+	}
+	if user.Grants, err = dao.grants(ctx, q, id); err != nil {
+		return
+	}
+	if user.RoleWindows, err = dao.windows(ctx, q, userRoleWindows, id); err != nil {
+		return
+	}
+	if user.WhiteListWindows, err = dao.windows(ctx, q, userWhiteListWindows, id); err != nil {
+		return
+	}
+	if user.BlackListWindows, err = dao.windows(ctx, q, userBlackListWindows, id); err != nil {
+		return
+	}
+	if user.DomainRoles, err = dao.domainEntries(ctx, q, userDomainRoles, id); err != nil {
+		return
+	}
+	if user.DomainWhiteList, err = dao.domainEntries(ctx, q, userDomainWhiteList, id); err != nil {
+		return
+	}
+	if user.DomainBlackList, err = dao.domainEntries(ctx, q, userDomainBlackList, id); err != nil {
+		return
+	}
+	if user.RoleProvenance, err = dao.provenance(ctx, q, userRoleProvenance, id); err != nil {
+		return
+	}
+	if user.WhiteListProvenance, err = dao.provenance(ctx, q, userWhiteListProvenance, id); err != nil {
+		return
+	}
+	user.BlackListProvenance, err = dao.provenance(ctx, q, userBlackListProvenance, id)
+	return
+}
+
+// GetAllRolesContext get all roles with uid
+func (dao *UserDao) GetAllRolesContext(ctx context.Context, system, uid string) ([]string, error) {
+	return dao.list(ctx, system, uid, userRoles)
+}
+
+// UpdateRolesContext update user's all roles
+func (dao *UserDao) UpdateRolesContext(ctx context.Context, system, uid string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.setValues(ctx, tx, userRoles, id, roles...)
+	})
+}
+
+// AddRolesContext add specified roles into user's permission model
+func (dao *UserDao) AddRolesContext(ctx context.Context, system, uid string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.addValues(ctx, tx, userRoles, id, roles...)
+	})
+}
+
+// RemoveRolesContext remove specified role from user's permission model
+func (dao *UserDao) RemoveRolesContext(ctx context.Context, system, uid string, role string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.removeValue(ctx, tx, userRoles, id, role)
+	})
+}
+
+// GetBlackListContext get user permission model's blacklist
+func (dao *UserDao) GetBlackListContext(ctx context.Context, system, uid string) ([]string, error) {
+	return dao.list(ctx, system, uid, userBlackList)
+}
+
+// AddToBlackListContext add specified permissions into blacklist
+func (dao *UserDao) AddToBlackListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.addValues(ctx, tx, userBlackList, id, permissions...)
+	})
+}
+
+// RemoveFromBlackListContext remove specified permission from blacklist
+func (dao *UserDao) RemoveFromBlackListContext(ctx context.Context, system, uid string, permission string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.removeValue(ctx, tx, userBlackList, id, permission)
+	})
+}
+
+// ClearBlackListContext clear blacklist
+func (dao *UserDao) ClearBlackListContext(ctx context.Context, system, uid string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.clearValues(ctx, tx, userBlackList, id)
+	})
+}
+
+// GetWhiteListContext get user permission model's whitelist
+func (dao *UserDao) GetWhiteListContext(ctx context.Context, system, uid string) ([]string, error) {
+	return dao.list(ctx, system, uid, userWhiteList)
+}
+
+// UpdateWhiteListContext replace whitelist
+func (dao *UserDao) UpdateWhiteListContext(ctx context.Context, system, uid string, whitelist ...string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.setValues(ctx, tx, userWhiteList, id, whitelist...)
+	})
+}
+
+// AddToWhiteListContext add specified permissions into whitelist
+func (dao *UserDao) AddToWhiteListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.addValues(ctx, tx, userWhiteList, id, permissions...)
+	})
+}
+
+// RemoveFromWhiteListContext remove specified permission from whitelist
+func (dao *UserDao) RemoveFromWhiteListContext(ctx context.Context, system, uid string, permission string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.removeValue(ctx, tx, userWhiteList, id, permission)
+	})
+}
+
+// ClearWhiteListContext clear whitelist
+func (dao *UserDao) ClearWhiteListContext(ctx context.Context, system, uid string) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.clearValues(ctx, tx, userWhiteList, id)
+	})
+}
+
+// AddGrantsContext add grants on resources to user, grants already present are ignored
+func (dao *UserDao) AddGrantsContext(ctx context.Context, system, uid string, grants ...model.Grant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.addGrants(ctx, tx, id, grants...)
+	})
+}
+
+// RemoveGrantContext remove specified grant from user
+func (dao *UserDao) RemoveGrantContext(ctx context.Context, system, uid string, grant model.Grant) error {
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		_, err := dao.exec(ctx, tx, "DELETE FROM user_grants WHERE user_id = ? AND permission = ? AND resource_type = ? AND resource_id = ?",
+			id, grant.Permission, grant.Resource.Type, grant.Resource.ID)
+		return err
+	})
+}
+
+// AddWithinContext add names to list of user and restrict them to period, names already present get the new period,
+// a zero period makes them permanent
+func (dao *UserDao) AddWithinContext(ctx context.Context, system, uid, list string, period model.Period, names ...string) error {
+	l, ok := userLists[list]
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		if err := dao.addValues(ctx, tx, l.entries, id, names...); err != nil {
+			return err
+		}
+		for _, n := range names {
+			if err := dao.removeValue(ctx, tx, l.windows, id, n); err != nil {
+				return err
+			}
+		}
+		if period.IsZero() {
+			return nil
+		}
+
+		var ws []model.Window
+		for _, n := range names {
+			ws = append(ws, model.Window{Name: n, Period: period})
+		}
+		return dao.addWindows(ctx, tx, l.windows, id, ws...)
+	})
+}
+
+// AddInDomainContext add names to list of user within domain, names already present are ignored
+func (dao *UserDao) AddInDomainContext(ctx context.Context, system, uid, domain, list string, names ...string) error {
+	l, ok := userLists[list]
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	entries := []model.DomainEntry{}
+	for _, n := range names {
+		entries = append(entries, model.DomainEntry{Domain: domain, Name: n})
+	}
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		return dao.addDomainEntries(ctx, tx, l.domains, id, entries...)
+	})
+}
+
+// RemoveInDomainContext remove name from list of user within domain
+func (dao *UserDao) RemoveInDomainContext(ctx context.Context, system, uid, domain, list, name string) error {
+	l, ok := userLists[list]
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+
+	return dao.modify(ctx, system, uid, func(tx *sql.Tx, id int64) error {
+		_, err := dao.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND domain = ? AND %s = ?",
+			l.domains.table, l.domains.owner, l.domains.column), id, domain, name)
+		return err
+	})
+}
+
+// RemoveExpiredContext remove entries whose window has ended at now from users of all systems, return the changed users
+func (dao *UserDao) RemoveExpiredContext(ctx context.Context, now time.Time) (refs []db.UserRef, err error) {
+	refs = []db.UserRef{}
+	err = dao.tx(ctx, func(tx *sql.Tx) error {
+		changed := map[int64]db.UserRef{}
+		for _, l := range userLists {
+			// bounds are compared here, times aren't comparable by all drivers at sql
+			expired, err := dao.expired(ctx, tx, l.windows, now)
+			if err != nil {
+				return err
+			}
+			for _, e := range expired {
+				if err = dao.removeValue(ctx, tx, l.entries, e.id, e.name); err != nil {
+					return err
+				}
+				if err = dao.removeValue(ctx, tx, l.windows, e.id, e.name); err != nil {
+					return err
+				}
+				changed[e.id] = e.user
+			}
+		}
+
+		for id, u := range changed {
+			if err := dao.bump(ctx, tx, "users", id); err != nil {
+				return err
+			}
+			refs = append(refs, u)
+		}
+		return nil
+	})
+	return
+}
+
+// expiredWindow is a window of user whose period has ended
+type expiredWindow struct {
+	id   int64
+	user db.UserRef
+	name string
+}
+
+// expired list windows at t which have ended at now
+func (dao *UserDao) expired(ctx context.Context, q querier, t listTable, now time.Time) (res []expiredWindow, err error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`SELECT u.id, u.system, u.uid, w.%s, w.expires_at FROM %s w
+		JOIN users u ON u.id = w.%s WHERE w.expires_at IS NOT NULL`, t.column, t.table, t.owner))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e expiredWindow
+		var expires sql.NullTime
+		if err = rows.Scan(&e.id, &e.user.System, &e.user.UID, &e.name, &expires); err != nil {
+			return
+		}
+		if (model.Period{ExpiresAt: timeOf(expires)}).ExpiredAt(now) {
+			res = append(res, e)
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// GetAllUsersContext list all users of system
+func (dao *UserDao) GetAllUsersContext(ctx context.Context, system string) (users []model.UserPermModel, err error) {
+	err = dao.view(ctx, func(tx *sql.Tx) error {
+		uids, err := dao.queryStrings(ctx, tx, "SELECT uid FROM users WHERE system = ? ORDER BY uid", system)
+		if err != nil {
+			return err
+		}
+		users, err = dao.getAll(ctx, tx, system, uids)
+		return err
+	})
+	return
+}
+
+// GetUsersWithRolesContext list users of system holding any of roles
+func (dao *UserDao) GetUsersWithRolesContext(ctx context.Context, system string, roles ...string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	if len(roles) == 0 {
+		return
+	}
+
+	args := []interface{}{system}
+	for _, r := range roles {
+		args = append(args, r)
+	}
+	err = dao.view(ctx, func(tx *sql.Tx) error {
+		uids, err := dao.queryStrings(ctx, tx, fmt.Sprintf(`SELECT uid FROM users WHERE system = ? AND id IN
+			(SELECT user_id FROM user_roles WHERE role IN (?%s)) ORDER BY uid`, strings.Repeat(", ?", len(roles)-1)), args...)
+		if err != nil {
+			return err
+		}
+		users, err = dao.getAll(ctx, tx, system, uids)
+		return err
+	})
+	return
+}
+
+// GetUsersWithDomainRolesContext list users of system holding any of roles within any domain
+func (dao *UserDao) GetUsersWithDomainRolesContext(ctx context.Context, system string, roles ...string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	if len(roles) == 0 {
+		return
+	}
+
+	args := []interface{}{system}
+	for _, r := range roles {
+		args = append(args, r)
+	}
+	err = dao.view(ctx, func(tx *sql.Tx) error {
+		uids, err := dao.queryStrings(ctx, tx, fmt.Sprintf(`SELECT uid FROM users WHERE system = ? AND id IN
+			(SELECT user_id FROM user_domain_roles WHERE role IN (?%s)) ORDER BY uid`, strings.Repeat(", ?", len(roles)-1)), args...)
+		if err != nil {
+			return err
+		}
+		users, err = dao.getAll(ctx, tx, system, uids)
+		return err
+	})
+	return
+}
+
+// getAll read info of users with q
+func (dao *UserDao) getAll(ctx context.Context, q querier, system string, uids []string) ([]model.UserPermModel, error) {
+	users := []model.UserPermModel{}
+	for _, uid := range uids {
+		user, err := dao.get(ctx, q, system, uid)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// UpdateUserPermModelIfMatchContext replace roles, blacklist, whitelist, grants, windows, domain entries and provenance of user if its revision equals revision
+func (dao *UserDao) UpdateUserPermModelIfMatchContext(ctx context.Context, user *model.UserPermModel, revision int64) error {
+	err := dao.tx(ctx, func(tx *sql.Tx) error {
+		id, err := dao.userID(ctx, tx, user.System, user.UID)
+		if err != nil {
+			return err
+		}
+
+		err = dao.updateIfMatch(ctx, tx, "UPDATE users SET revision = revision + 1 WHERE id = ? AND revision = ?", id, revision)
+		if err != nil {
+			return err
+		}
+		return dao.save(ctx, tx, id, user)
+	})
+	if err == nil {
+		user.Revision = revision + 1
+	}
+	return err
+}
@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nzqpeace/rbac/model"
+)
+
+var (
+	// ErrNotFound is returned by every store when the requested document doesn't exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlreadyExists is returned when renaming a document onto another existing one,
+	// or when a document violates uniqueness of the backend
+	ErrAlreadyExists = errors.New("already exists")
+
+	// ErrConflict is returned by conditional updates when the document was changed since the expected revision
+	ErrConflict = errors.New("revision conflict")
+)
+
+// Affected is summary of a cascading change, it lists documents changed because they refer to
+// the removed or renamed one
+type Affected struct {
+	Roles  []string `json:"roles"`            // names of roles
+	Users  []string `json:"users"`            // uids of users
+	Groups []string `json:"groups,omitempty"` // names of groups, only changes of roles affect groups
+
+	// Delegates are uids of users receiving changed delegations, only changes of roles affect delegations
+	Delegates []string `json:"delegates,omitempty"`
+}
+
+// UserRef identify a user of a system
+type UserRef struct {
+	System string `json:"system"`
+	UID    string `json:"uid"`
+}
+
+// PermissionStore persists permissions registered by each system
+type PermissionStore interface {
+	GetAllPermissionsContext(ctx context.Context, system string) ([]model.Permission, error)
+	CreatePermissionContext(ctx context.Context, p *model.Permission) error
+	RemovePermissionContext(ctx context.Context, system, name string) error
+	UpdatePermissionContext(ctx context.Context, system, oldname, newname string) error
+
+	// RemovePermissionCascadeContext remove permission together with its references in permissions,
+	// denied permissions and conditions of roles, whitelist, blacklist and grants of users atomically
+	RemovePermissionCascadeContext(ctx context.Context, system, name string) (Affected, error)
+	// UpdatePermissionCascadeContext rename permission together with its references in permissions,
+	// denied permissions and conditions of roles, whitelist, blacklist and grants of users atomically
+	UpdatePermissionCascadeContext(ctx context.Context, system, oldname, newname string) (Affected, error)
+}
+
+// RoleStore persists roles and the permissions granted to them
+type RoleStore interface {
+	GetRoleContext(ctx context.Context, system, name string) (model.Role, error)
+	GetAllRolesContext(ctx context.Context, system string) ([]model.Role, error)
+	CreateRoleContext(ctx context.Context, role *model.Role) error
+	RemoveRoleContext(ctx context.Context, system, name string) error
+	RemoveAllRolesContext(ctx context.Context, system string) error
+	UpdateRoleNameContext(ctx context.Context, system, oldname, newname string) error
+	GetPermissionsContext(ctx context.Context, system, name string) ([]string, error)
+	GrantPermissionsContext(ctx context.Context, system, name string, permissions ...string) error
+	RemovePermissionContext(ctx context.Context, system, name string, permission string) error
+	// AddParentsContext add parents to specified role, parents already present are ignored
+	AddParentsContext(ctx context.Context, system, name string, parents ...string) error
+	RemoveParentContext(ctx context.Context, system, name string, parent string) error
+	// DenyPermissionsContext add permissions denied by specified role, permissions already denied are ignored
+	DenyPermissionsContext(ctx context.Context, system, name string, permissions ...string) error
+	RemoveDeniedContext(ctx context.Context, system, name string, permission string) error
+	// SetConditionContext grant permission to role under condition, replacing the condition of the same permission
+	SetConditionContext(ctx context.Context, system, name string, condition model.Condition) error
+	RemoveConditionContext(ctx context.Context, system, name string, permission string) error
+	// UpdateConstraintsContext replace max members and prerequisites of specified role
+	UpdateConstraintsContext(ctx context.Context, system, name string, maxMembers int, prerequisites ...string) error
+
+	// RemoveRoleCascadeContext remove role and revoke it from users, groups, children, delegations and default roles
+	// of system atomically
+	RemoveRoleCascadeContext(ctx context.Context, system, name string) (Affected, error)
+	// UpdateRoleNameCascadeContext rename role together with its references in users, groups, children, delegations
+	// and default roles of system atomically
+	UpdateRoleNameCascadeContext(ctx context.Context, system, oldname, newname string) (Affected, error)
+
+	// UpdateRoleIfMatchContext replace description and permissions of role only if its revision
+	// equals revision, role.Revision is set to the new revision on success
+	UpdateRoleIfMatchContext(ctx context.Context, role *model.Role, revision int64) error
+}
+
+// UserStore persists user permission models
+type UserStore interface {
+	CreateUserPermModelContext(ctx context.Context, user *model.UserPermModel) error
+	// InsertUserPermModelContext create user only if it doesn't exist, ErrAlreadyExists is returned otherwise
+	InsertUserPermModelContext(ctx context.Context, user *model.UserPermModel) error
+	RemoveUserPermModelContext(ctx context.Context, system, uid string) error
+	UpdateUserPermModelContext(ctx context.Context, system, uid string, user *model.UserPermModel) error
+	GetUserPermModelContext(ctx context.Context, system, uid string) (model.UserPermModel, error)
+	GetAllRolesContext(ctx context.Context, system, uid string) ([]string, error)
+	UpdateRolesContext(ctx context.Context, system, uid string, roles ...string) error
+	AddRolesContext(ctx context.Context, system, uid string, roles ...string) error
+	RemoveRolesContext(ctx context.Context, system, uid string, role string) error
+	GetBlackListContext(ctx context.Context, system, uid string) ([]string, error)
+	AddToBlackListContext(ctx context.Context, system, uid string, permissions ...string) error
+	RemoveFromBlackListContext(ctx context.Context, system, uid string, permission string) error
+	ClearBlackListContext(ctx context.Context, system, uid string) error
+	GetWhiteListContext(ctx context.Context, system, uid string) ([]string, error)
+	UpdateWhiteListContext(ctx context.Context, system, uid string, whitelist ...string) error
+	AddToWhiteListContext(ctx context.Context, system, uid string, permissions ...string) error
+	RemoveFromWhiteListContext(ctx context.Context, system, uid string, permission string) error
+	ClearWhiteListContext(ctx context.Context, system, uid string) error
+	// AddGrantsContext add grants on resources to user, grants already present are ignored
+	AddGrantsContext(ctx context.Context, system, uid string, grants ...model.Grant) error
+	RemoveGrantContext(ctx context.Context, system, uid string, grant model.Grant) error
+	// AddWithinContext add names to list of user, which is one of model.ListRoles, model.ListWhiteList and
+	// model.ListBlackList, and restrict them to period. names already present get the new period,
+	// a zero period makes them permanent
+	AddWithinContext(ctx context.Context, system, uid, list string, period model.Period, names ...string) error
+	// AddInDomainContext add names to list of user within domain, which is one of model.ListRoles, model.ListWhiteList
+	// and model.ListBlackList, names already present are ignored
+	AddInDomainContext(ctx context.Context, system, uid, domain, list string, names ...string) error
+	// RemoveInDomainContext remove name from list of user within domain
+	RemoveInDomainContext(ctx context.Context, system, uid, domain, list, name string) error
+	// RemoveExpiredContext remove entries whose window has ended at now from users of all systems,
+	// together with their windows, return the changed users
+	RemoveExpiredContext(ctx context.Context, now time.Time) ([]UserRef, error)
+	// GetAllUsersContext list all users of system, ordered by uid
+	GetAllUsersContext(ctx context.Context, system string) ([]model.UserPermModel, error)
+	// GetUsersWithRolesContext list users of system holding any of roles, ordered by uid
+	GetUsersWithRolesContext(ctx context.Context, system string, roles ...string) ([]model.UserPermModel, error)
+	// GetUsersWithDomainRolesContext list users of system holding any of roles within any domain, ordered by uid
+	GetUsersWithDomainRolesContext(ctx context.Context, system string, roles ...string) ([]model.UserPermModel, error)
+
+	// UpdateUserPermModelIfMatchContext replace roles, blacklist, whitelist, grants, windows, domain entries and provenance of user only if its revision
+	// equals revision, user.Revision is set to the new revision on success
+	UpdateUserPermModelIfMatchContext(ctx context.Context, user *model.UserPermModel, revision int64) error
+}
+
+// GroupStore persists groups of users, roles of a group are assigned to all its members
+type GroupStore interface {
+	GetGroupContext(ctx context.Context, system, name string) (model.Group, error)
+	GetAllGroupsContext(ctx context.Context, system string) ([]model.Group, error)
+	// GetGroupsOfUserContext list groups which have uid as member
+	GetGroupsOfUserContext(ctx context.Context, system, uid string) ([]model.Group, error)
+	CreateGroupContext(ctx context.Context, group *model.Group) error
+	RemoveGroupContext(ctx context.Context, system, name string) error
+	// AddMembersContext add users to group, members already present are ignored
+	AddMembersContext(ctx context.Context, system, name string, uids ...string) error
+	RemoveMemberContext(ctx context.Context, system, name string, uid string) error
+	// RemoveMemberFromAllContext remove uid from all groups of system, return names of changed groups
+	RemoveMemberFromAllContext(ctx context.Context, system, uid string) ([]string, error)
+	// AddRolesContext add roles to group, roles already present are ignored
+	AddRolesContext(ctx context.Context, system, name string, roles ...string) error
+	RemoveRoleContext(ctx context.Context, system, name string, role string) error
+}
+
+// ConstraintStore persists separation-of-duty rules between roles. Rules refer to roles by name,
+// removing or renaming a role updates the rules too
+type ConstraintStore interface {
+	GetSoDRuleContext(ctx context.Context, system, name string) (model.SoDRule, error)
+	GetAllSoDRulesContext(ctx context.Context, system string) ([]model.SoDRule, error)
+	// CreateSoDRuleContext create rule, replace it if already exist
+	CreateSoDRuleContext(ctx context.Context, rule *model.SoDRule) error
+	RemoveSoDRuleContext(ctx context.Context, system, name string) error
+}
+
+// DelegationStore persists roles delegated between users of a system. Delegations refer to roles by name,
+// removing or renaming a role updates them too. delegator and delegate needn't be registered
+type DelegationStore interface {
+	GetDelegationContext(ctx context.Context, system, delegator, delegate string) (model.Delegation, error)
+	// GetAllDelegationsContext list all delegations of system, ordered by delegator and delegate
+	GetAllDelegationsContext(ctx context.Context, system string) ([]model.Delegation, error)
+	// GetDelegationsFromContext list delegations made by uid, ordered by delegate
+	GetDelegationsFromContext(ctx context.Context, system, uid string) ([]model.Delegation, error)
+	// GetDelegationsToContext list delegations received by uid, ordered by delegator
+	GetDelegationsToContext(ctx context.Context, system, uid string) ([]model.Delegation, error)
+	// CreateDelegationContext create delegation from d.Delegator to d.Delegate, replace it if already exist
+	CreateDelegationContext(ctx context.Context, d *model.Delegation) error
+	RemoveDelegationContext(ctx context.Context, system, delegator, delegate string) error
+}
+
+// SystemStore persists registered systems. Permissions, roles, users, groups and rules refer to systems
+// by name, they may exist whether or not their system is registered
+type SystemStore interface {
+	GetSystemContext(ctx context.Context, name string) (model.System, error)
+	// GetAllSystemsContext list all registered systems, ordered by name
+	GetAllSystemsContext(ctx context.Context) ([]model.System, error)
+	// CreateSystemContext register system, ErrAlreadyExists is returned if it's registered already
+	CreateSystemContext(ctx context.Context, system *model.System) error
+	// UpdateSystemContext replace description, owners, metadata, default roles and auto register of system
+	UpdateSystemContext(ctx context.Context, system *model.System) error
+	RemoveSystemContext(ctx context.Context, name string) error
+
+	// RemoveSystemCascadeContext remove system together with all its permissions, roles, users, groups,
+	// rules and delegations atomically, it succeeds whether or not system is registered. names of removed roles and groups
+	// and uids of removed users are returned
+	RemoveSystemCascadeContext(ctx context.Context, name string) (Affected, error)
+}
+
+// Store is the storage backend used by rbac, it gives access to permissions, roles, users, groups, constraints, systems
+// and delegations.
+// All methods of stores accept a context, which bounds the time spent at backend.
+// Every change of a role, user, group, rule, system or delegation increases its revision by one
+type Store interface {
+	Permissions() PermissionStore
+	Roles() RoleStore
+	Users() UserStore
+	Groups() GroupStore
+	Constraints() ConstraintStore
+	Systems() SystemStore
+	Delegations() DelegationStore
+}
+
+var (
+	_ PermissionStore = (*PermissionDao)(nil)
+	_ RoleStore       = (*RoleDao)(nil)
+	_ UserStore       = (*UserDao)(nil)
+	_ GroupStore      = (*GroupDao)(nil)
+	_ ConstraintStore = (*ConstraintDao)(nil)
+	_ SystemStore     = (*SystemDao)(nil)
+	_ DelegationStore = (*DelegationDao)(nil)
+	_ Store           = (*MgoStore)(nil)
+)
+
+// MgoStore is the mongo implementation of Store
+type MgoStore struct {
+	permission *PermissionDao
+	role       *RoleDao
+	user       *UserDao
+	group      *GroupDao
+	constraint *ConstraintDao
+	system     *SystemDao
+	delegation *DelegationDao
+}
+
+// NewMgoStore create a store backed by specified mongo database
+func NewMgoStore(db *DataBase) *MgoStore {
+	return &MgoStore{
+		permission: NewPermissionDao(db),
+		role:       NewRoleDao(db),
+		user:       NewUserDao(db),
+		group:      NewGroupDao(db),
+		constraint: NewConstraintDao(db),
+		system:     NewSystemDao(db),
+		delegation: NewDelegationDao(db),
+	}
+}
+
+// Permissions return permission dao
+func (s *MgoStore) Permissions() PermissionStore {
+	return s.permission
+}
+
+// Roles return role dao
+func (s *MgoStore) Roles() RoleStore {
+	return s.role
+}
+
+// Users return user dao
+func (s *MgoStore) Users() UserStore {
+	return s.user
+}
+
+// Groups return group dao
+func (s *MgoStore) Groups() GroupStore {
+	return s.group
+}
+
+// Constraints return constraint dao
+func (s *MgoStore) Constraints() ConstraintStore {
+	return s.constraint
+}
+
+// Systems return system dao
+func (s *MgoStore) Systems() SystemStore {
+	return s.system
+}
+
+// Delegations return delegation dao
+func (s *MgoStore) Delegations() DelegationStore {
+	return s.delegation
+}
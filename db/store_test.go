@@ -0,0 +1,17 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/db/storetest"
+)
+
+func TestStore(t *testing.T) {
+	conn, err := db.Init(&db.MgoConf{Url: "localhost/test"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	storetest.Run(t, db.NewMgoStore(conn))
+}
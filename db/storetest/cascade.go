@@ -0,0 +1,113 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func fillCascadeData(t *testing.T, store db.Store) {
+	for _, name := range []string{"read", "write", "manage"} {
+		assert.Nil(t, store.Permissions().CreatePermissionContext(ctx, &model.Permission{System: system, Name: name}))
+	}
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "common", "", "read", "write")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "admin", "", "read", "write", "manage")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "guest", "", "read")))
+
+	common := model.NewUserPermModel(system, "uid_common", "common")
+	common.WhiteList = []string{"manage"}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, common))
+	admin := model.NewUserPermModel(system, "uid_admin", "admin", "common")
+	admin.BlackList = []string{"write"}
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, admin))
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, model.NewUserPermModel(system, "uid_guest", "guest")))
+
+	// same names at another system are left untouched
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system+"_other", "admin", "", "manage")))
+}
+
+func clearCascadeData(t *testing.T, store db.Store) {
+	for _, s := range []string{system, system + "_other"} {
+		ps, err := store.Permissions().GetAllPermissionsContext(ctx, s)
+		assert.Nil(t, err)
+		for _, p := range ps {
+			assert.Nil(t, store.Permissions().RemovePermissionContext(ctx, s, p.Name))
+		}
+		assert.Nil(t, store.Roles().RemoveAllRolesContext(ctx, s))
+	}
+	for _, uid := range []string{"uid_common", "uid_admin", "uid_guest"} {
+		assert.Nil(t, store.Users().RemoveUserPermModelContext(ctx, system, uid))
+	}
+}
+
+func testCascade(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	// rename permission, entries give way to existing ones of the new name
+	doc := model.Resource{Type: "document", ID: "42"}
+	assert.Nil(t, store.Users().AddToWhiteListContext(ctx, system, "uid_common", "admin"))
+	assert.Nil(t, store.Users().AddGrantsContext(ctx, system, "uid_common", model.Grant{Permission: "manage", Resource: doc},
+		model.Grant{Permission: "admin", Resource: doc}, model.Grant{Permission: "manage", Resource: model.Resource{Type: "document", ID: "7"}}))
+	affected, err := store.Permissions().UpdatePermissionCascadeContext(ctx, system, "manage", "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{"admin"}, Users: []string{"uid_common"}}, affected)
+	user, err := store.Users().GetUserPermModelContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin"}, user.WhiteList)
+	assert.ElementsMatch(t, []model.Grant{{Permission: "admin", Resource: doc},
+		{Permission: "admin", Resource: model.Resource{Type: "document", ID: "7"}}}, user.Grants)
+	role, err := store.Roles().GetRoleContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"read", "write", "admin"}, role.Permissions)
+	role, err = store.Roles().GetRoleContext(ctx, system+"_other", "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"manage"}, role.Permissions)
+
+	_, err = store.Permissions().UpdatePermissionCascadeContext(ctx, system, "admin", "read")
+	assert.Equal(t, db.ErrAlreadyExists, err)
+	_, err = store.Permissions().UpdatePermissionCascadeContext(ctx, system, "manage", "admin")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// remove permission
+	affected, err = store.Permissions().RemovePermissionCascadeContext(ctx, system, "write")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{"admin", "common"}, Users: []string{"uid_admin"}}, affected)
+	role, err = store.Roles().GetRoleContext(ctx, system, "common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"read"}, role.Permissions)
+	bl, err := store.Users().GetBlackListContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(bl))
+
+	_, err = store.Permissions().RemovePermissionCascadeContext(ctx, system, "write")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// rename role
+	assert.Nil(t, store.Users().AddRolesContext(ctx, system, "uid_admin", "member"))
+	affected, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "common", "member")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{}, Users: []string{"uid_admin", "uid_common"}, Groups: []string{}, Delegates: []string{}}, affected)
+	roles, err := store.Users().GetAllRolesContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"admin", "member"}, roles)
+
+	_, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "member", "admin")
+	assert.Equal(t, db.ErrAlreadyExists, err)
+
+	// remove role
+	affected, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{}, Users: []string{"uid_admin"}, Groups: []string{}, Delegates: []string{}}, affected)
+	roles, err = store.Users().GetAllRolesContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"member"}, roles)
+
+	affected, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"uid_guest"}, affected.Users)
+	_, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "guest")
+	assert.Equal(t, db.ErrNotFound, err)
+}
@@ -0,0 +1,70 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSoDRule(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	constraintDao := store.Constraints()
+	assert.Nil(t, constraintDao.CreateSoDRuleContext(ctx, model.NewSoDRule(system, "exclusive", "", 2, "admin", "guest")))
+
+	// query rule
+	rule, err := constraintDao.GetSoDRuleContext(ctx, system, "exclusive")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"admin", "guest"}, rule.Roles)
+	assert.Equal(t, 2, rule.Cardinality)
+	assert.Equal(t, int64(1), rule.Revision)
+	_, err = constraintDao.GetSoDRuleContext(ctx, system, "not_exist")
+	assert.Equal(t, db.ErrNotFound, err)
+	rules, err := constraintDao.GetAllSoDRulesContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rules))
+
+	// holders of roles
+	users, err := store.Users().GetUsersWithRolesContext(ctx, system, "admin", "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, "uid_admin", users[0].UID)
+	assert.ElementsMatch(t, []string{"admin", "common"}, users[0].Roles)
+	assert.Equal(t, "uid_guest", users[1].UID)
+	users, err = store.Users().GetUsersWithRolesContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
+	assert.Nil(t, store.Users().AddInDomainContext(ctx, system, "uid_guest", "org1", model.ListRoles, "admin"))
+	users, err = store.Users().GetUsersWithDomainRolesContext(ctx, system, "admin", "common")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, "uid_guest", users[0].UID)
+	users, err = store.Users().GetUsersWithDomainRolesContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
+
+	// rules follow renamed and removed roles
+	_, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "admin", "root")
+	assert.Nil(t, err)
+	_, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	rule, err = constraintDao.GetSoDRuleContext(ctx, system, "exclusive")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"root"}, rule.Roles)
+	assert.Equal(t, int64(3), rule.Revision)
+
+	// replace and remove rule
+	replaced := model.NewSoDRule(system, "exclusive", "", 3, "root", "common", "guest")
+	replaced.Dynamic = true
+	assert.Nil(t, constraintDao.CreateSoDRuleContext(ctx, replaced))
+	rule, err = constraintDao.GetSoDRuleContext(ctx, system, "exclusive")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, rule.Cardinality)
+	assert.True(t, rule.Dynamic)
+	assert.Equal(t, int64(4), rule.Revision)
+	assert.Nil(t, constraintDao.RemoveSoDRuleContext(ctx, system, "exclusive"))
+	assert.Equal(t, db.ErrNotFound, constraintDao.RemoveSoDRuleContext(ctx, system, "exclusive"))
+}
@@ -0,0 +1,85 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDelegation(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	delegationDao := store.Delegations()
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	d := model.NewDelegation(system, "uid_admin", "uid_deputy", "admin", "common")
+	d.ExpiresAt = &expires
+	assert.Nil(t, delegationDao.CreateDelegationContext(ctx, d))
+	assert.Nil(t, delegationDao.CreateDelegationContext(ctx, model.NewDelegation(system, "uid_common", "uid_deputy", "common")))
+	assert.Nil(t, delegationDao.CreateDelegationContext(ctx, model.NewDelegation(system, "uid_admin", "uid_guest", "admin")))
+
+	// query delegations
+	delegation, err := delegationDao.GetDelegationContext(ctx, system, "uid_admin", "uid_deputy")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"admin", "common"}, delegation.Roles)
+	assert.True(t, expires.Equal(*delegation.ExpiresAt))
+	assert.Nil(t, delegation.ValidFrom)
+	assert.False(t, delegation.Transitive)
+	assert.Equal(t, int64(1), delegation.Revision)
+	_, err = delegationDao.GetDelegationContext(ctx, system, "uid_deputy", "uid_admin")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	ds, err := delegationDao.GetDelegationsFromContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ds))
+	assert.Equal(t, "uid_deputy", ds[0].Delegate)
+	assert.Equal(t, "uid_guest", ds[1].Delegate)
+	ds, err = delegationDao.GetDelegationsToContext(ctx, system, "uid_deputy")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ds))
+	assert.Equal(t, "uid_admin", ds[0].Delegator)
+	assert.Equal(t, "uid_common", ds[1].Delegator)
+	ds, err = delegationDao.GetAllDelegationsContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(ds))
+
+	// delegations follow renamed and removed roles
+	affected, err := store.Roles().UpdateRoleNameCascadeContext(ctx, system, "admin", "root")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"uid_deputy", "uid_guest"}, affected.Delegates)
+	affected, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"uid_deputy"}, affected.Delegates)
+	delegation, err = delegationDao.GetDelegationContext(ctx, system, "uid_admin", "uid_deputy")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"root"}, delegation.Roles)
+	assert.Equal(t, int64(3), delegation.Revision)
+	delegation, err = delegationDao.GetDelegationContext(ctx, system, "uid_common", "uid_deputy")
+	assert.Nil(t, err)
+	assert.Empty(t, delegation.Roles)
+
+	// replace and remove delegation
+	replaced := model.NewDelegation(system, "uid_admin", "uid_deputy", "root")
+	replaced.Transitive = true
+	assert.Nil(t, delegationDao.CreateDelegationContext(ctx, replaced))
+	delegation, err = delegationDao.GetDelegationContext(ctx, system, "uid_admin", "uid_deputy")
+	assert.Nil(t, err)
+	assert.True(t, delegation.Transitive)
+	assert.Nil(t, delegation.ExpiresAt)
+	assert.Equal(t, int64(4), delegation.Revision)
+	assert.Nil(t, delegationDao.RemoveDelegationContext(ctx, system, "uid_admin", "uid_deputy"))
+	assert.Equal(t, db.ErrNotFound, delegationDao.RemoveDelegationContext(ctx, system, "uid_admin", "uid_deputy"))
+	assert.Nil(t, delegationDao.RemoveDelegationContext(ctx, system, "uid_common", "uid_deputy"))
+	assert.Nil(t, delegationDao.RemoveDelegationContext(ctx, system, "uid_admin", "uid_guest"))
+
+	// delegations are removed together with their system
+	assert.Nil(t, delegationDao.CreateDelegationContext(ctx, model.NewDelegation(system+"_other", "uid_admin", "uid_deputy", "admin")))
+	_, err = store.Systems().RemoveSystemCascadeContext(ctx, system+"_other")
+	assert.Nil(t, err)
+	ds, err = delegationDao.GetAllDelegationsContext(ctx, system+"_other")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ds))
+}
@@ -0,0 +1,82 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testGroup(t *testing.T, store db.Store) {
+	groupDao := store.Groups()
+	dev := model.NewGroup(system, "dev", "", "common")
+	dev.Members = []string{"uid_a", "uid_b"}
+	ops := model.NewGroup(system, "ops", "", "admin")
+	ops.Members = []string{"uid_b"}
+	assert.Nil(t, groupDao.CreateGroupContext(ctx, dev))
+	assert.Nil(t, groupDao.CreateGroupContext(ctx, ops))
+
+	// query group
+	g, err := groupDao.GetGroupContext(ctx, system, "dev")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"common"}, g.Roles)
+	assert.ElementsMatch(t, []string{"uid_a", "uid_b"}, g.Members)
+	assert.Equal(t, int64(1), g.Revision)
+	_, err = groupDao.GetGroupContext(ctx, system, "not_exist")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	gs, err := groupDao.GetAllGroupsContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(gs))
+
+	// groups of user
+	gs, err = groupDao.GetGroupsOfUserContext(ctx, system, "uid_b")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(gs))
+	gs, err = groupDao.GetGroupsOfUserContext(ctx, system, "uid_c")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(gs))
+
+	// members, duplicated member is ignored
+	assert.Nil(t, groupDao.AddMembersContext(ctx, system, "dev", "uid_c", "uid_a"))
+	assert.Nil(t, groupDao.RemoveMemberContext(ctx, system, "dev", "uid_b"))
+	assert.Equal(t, db.ErrNotFound, groupDao.AddMembersContext(ctx, system, "not_exist", "uid_a"))
+	g, err = groupDao.GetGroupContext(ctx, system, "dev")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"uid_a", "uid_c"}, g.Members)
+	assert.Equal(t, int64(3), g.Revision)
+
+	names, err := groupDao.RemoveMemberFromAllContext(ctx, system, "uid_a")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dev"}, names)
+	gs, err = groupDao.GetGroupsOfUserContext(ctx, system, "uid_a")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(gs))
+
+	// roles, duplicated role is ignored
+	assert.Nil(t, groupDao.AddRolesContext(ctx, system, "dev", "guest", "common"))
+	assert.Nil(t, groupDao.RemoveRoleContext(ctx, system, "dev", "common"))
+	g, err = groupDao.GetGroupContext(ctx, system, "dev")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"guest"}, g.Roles)
+
+	// groups follow renamed and removed roles
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "guest", "", "read")))
+	affected, err := store.Roles().UpdateRoleNameCascadeContext(ctx, system, "guest", "visitor")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dev"}, affected.Groups)
+	affected, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "visitor")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dev"}, affected.Groups)
+	g, err = groupDao.GetGroupContext(ctx, system, "dev")
+	assert.Nil(t, err)
+	assert.Empty(t, g.Roles)
+
+	assert.Nil(t, groupDao.RemoveGroupContext(ctx, system, "dev"))
+	assert.Nil(t, groupDao.RemoveGroupContext(ctx, system, "ops"))
+	assert.Equal(t, db.ErrNotFound, groupDao.RemoveGroupContext(ctx, system, "ops"))
+	gs, err = groupDao.GetAllGroupsContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(gs))
+}
@@ -0,0 +1,71 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func fillPermissionData(t *testing.T, store db.Store) {
+	read := &model.Permission{
+		System: system,
+		Name:   "read",
+		Desc:   "read question/answer/comment",
+	}
+
+	write := &model.Permission{
+		System: system,
+		Name:   "write",
+		Desc:   "post question/answer/comment",
+	}
+
+	manage := &model.Permission{
+		System: system,
+		Name:   "manage",
+		Desc:   "manage question and answer",
+	}
+
+	// insert test
+	assert.Nil(t, store.Permissions().CreatePermissionContext(ctx, read))
+	assert.Nil(t, store.Permissions().CreatePermissionContext(ctx, write))
+	assert.Nil(t, store.Permissions().CreatePermissionContext(ctx, manage))
+}
+
+func clearPermissionData(t *testing.T, store db.Store) {
+	// remove all documents
+	assert.Nil(t, store.Permissions().RemovePermissionContext(ctx, system, "read"))
+	assert.Nil(t, store.Permissions().RemovePermissionContext(ctx, system, "write"))
+	assert.Nil(t, store.Permissions().RemovePermissionContext(ctx, system, "admin"))
+}
+
+func testPermission(t *testing.T, store db.Store) {
+	fillPermissionData(t, store)
+	pdao := store.Permissions()
+
+	// create again only replace description
+	assert.Nil(t, pdao.CreatePermissionContext(ctx, &model.Permission{System: system, Name: "read", Desc: "read"}))
+
+	// update
+	assert.Nil(t, pdao.UpdatePermissionContext(ctx, system, "manage", "admin"))
+	assert.Equal(t, db.ErrNotFound, pdao.RemovePermissionContext(ctx, system, "manage"))
+	assert.Equal(t, db.ErrAlreadyExists, pdao.UpdatePermissionContext(ctx, system, "admin", "read"))
+
+	// get all permissions, their order differs between stores
+	ps, err := pdao.GetAllPermissionsContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(ps))
+	for _, p := range ps {
+		if p.Name == "read" {
+			assert.Equal(t, "read", p.Desc)
+		}
+	}
+
+	// permissions of other system are invisible
+	ps, err = pdao.GetAllPermissionsContext(ctx, system+"_other")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ps))
+
+	clearPermissionData(t, store)
+}
@@ -0,0 +1,69 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRevision(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	// every change increase revision
+	role, err := store.Roles().GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), role.Revision)
+	assert.Nil(t, store.Roles().GrantPermissionsContext(ctx, system, "guest", "write"))
+	role, err = store.Roles().GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), role.Revision)
+
+	// stale revision is rejected and nothing is written
+	update := model.NewRole(system, "guest", "visitor", "read")
+	assert.Equal(t, db.ErrConflict, store.Roles().UpdateRoleIfMatchContext(ctx, update, 1))
+	role, err = store.Roles().GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"read", "write"}, role.Permissions)
+
+	assert.Nil(t, store.Roles().UpdateRoleIfMatchContext(ctx, update, 2))
+	assert.Equal(t, int64(3), update.Revision)
+	role, err = store.Roles().GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, "visitor", role.Desc)
+	assert.Equal(t, []string{"read"}, role.Permissions)
+	assert.Equal(t, int64(3), role.Revision)
+
+	assert.Equal(t, db.ErrNotFound, store.Roles().UpdateRoleIfMatchContext(ctx, model.NewRole(system, "not_exist", ""), 0))
+
+	// users
+	user, err := store.Users().GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), user.Revision)
+
+	change := model.NewUserPermModel(system, "uid_guest", "common")
+	assert.Equal(t, db.ErrConflict, store.Users().UpdateUserPermModelIfMatchContext(ctx, change, 0))
+	assert.Nil(t, store.Users().UpdateUserPermModelIfMatchContext(ctx, change, 1))
+	assert.Equal(t, int64(2), change.Revision)
+	user, err = store.Users().GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"common"}, user.Roles)
+	assert.Equal(t, int64(2), user.Revision)
+
+	assert.Equal(t, db.ErrNotFound,
+		store.Users().UpdateUserPermModelIfMatchContext(ctx, model.NewUserPermModel(system, "not_exist"), 0))
+
+	// cascading changes increase revision of referrers
+	_, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "common")
+	assert.Nil(t, err)
+	user, err = store.Users().GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), user.Revision)
+	_, err = store.Permissions().RemovePermissionCascadeContext(ctx, system, "read")
+	assert.Nil(t, err)
+	role, err = store.Roles().GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), role.Revision)
+}
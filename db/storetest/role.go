@@ -0,0 +1,248 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func fillRoleData(t *testing.T, store db.Store) {
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "guest", "", "read")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "common", "", "read", "write")))
+	assert.Nil(t, store.Roles().CreateRoleContext(ctx, model.NewRole(system, "admin", "", "read", "write", "manage")))
+}
+
+func clearRoleData(t *testing.T, store db.Store) {
+	// remove role
+	assert.Nil(t, store.Roles().RemoveRoleContext(ctx, system, "guest"))
+	assert.Nil(t, store.Roles().RemoveAllRolesContext(ctx, system))
+}
+
+func testRole(t *testing.T, store db.Store) {
+	fillRoleData(t, store)
+	roleDao := store.Roles()
+
+	// query role
+	r, err := roleDao.GetRoleContext(ctx, system, "common")
+	assert.Nil(t, err)
+	assert.Equal(t, "common", r.Name)
+	assert.Equal(t, "", r.Desc)
+	assert.ElementsMatch(t, []string{"read", "write"}, r.Permissions)
+
+	// get all roles, their order differs between stores
+	rs, err := roleDao.GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(rs))
+	for _, role := range rs {
+		if role.Name == "admin" {
+			assert.ElementsMatch(t, []string{"read", "write", "manage"}, role.Permissions)
+		}
+	}
+
+	// update role
+	assert.Nil(t, roleDao.UpdateRoleNameContext(ctx, system, "common", "user"))
+	r, err = roleDao.GetRoleContext(ctx, system, "common")
+	assert.NotNil(t, err)
+
+	r, err = roleDao.GetRoleContext(ctx, system, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "user", r.Name)
+	assert.Equal(t, 2, len(r.Permissions))
+
+	// query role which not exist
+	r, err = roleDao.GetRoleContext(ctx, system, "not_exist")
+	assert.NotNil(t, err)
+	assert.Equal(t, "not found", err.Error())
+
+	// grant permissions, whether granting one again duplicates it differs between stores
+	assert.Nil(t, roleDao.GrantPermissionsContext(ctx, system, "guest", "write", "manage"))
+	r, err = roleDao.GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"read", "write", "manage"}, r.Permissions)
+
+	// remove permission
+	assert.Nil(t, roleDao.RemovePermissionContext(ctx, system, "guest", "manage"))
+	ps, err := roleDao.GetPermissionsContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"read", "write"}, ps)
+
+	// create again replace permissions
+	assert.Nil(t, roleDao.CreateRoleContext(ctx, model.NewRole(system, "guest", "guest", "read")))
+	r, err = roleDao.GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, "guest", r.Desc)
+	assert.Equal(t, []string{"read"}, r.Permissions)
+
+	clearRoleData(t, store)
+
+	rs, err = roleDao.GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rs))
+}
+
+func testRoleParents(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	assert.Nil(t, store.Roles().AddParentsContext(ctx, system, "admin", "common", "guest", "common"))
+	assert.Nil(t, store.Roles().AddParentsContext(ctx, system, "admin", "guest"))
+	assert.Nil(t, store.Roles().AddParentsContext(ctx, system, "common", "guest"))
+	assert.Equal(t, db.ErrNotFound, store.Roles().AddParentsContext(ctx, system, "not_exist", "guest"))
+	role, err := store.Roles().GetRoleContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"common", "guest"}, role.Parents)
+
+	roles, err := store.Roles().GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	parents := map[string][]string{}
+	for _, r := range roles {
+		parents[r.Name] = r.Parents
+	}
+	assert.Equal(t, []string{"common", "guest"}, parents["admin"])
+	assert.Equal(t, []string{"guest"}, parents["common"])
+	assert.Empty(t, parents["guest"])
+
+	assert.Nil(t, store.Roles().RemoveParentContext(ctx, system, "admin", "guest"))
+	role, err = store.Roles().GetRoleContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"common"}, role.Parents)
+
+	// children follow renamed and removed parents
+	affected, err := store.Roles().UpdateRoleNameCascadeContext(ctx, system, "common", "member")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{"admin"}, Users: []string{"uid_admin", "uid_common"}, Groups: []string{}, Delegates: []string{}}, affected)
+	role, err = store.Roles().GetRoleContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"member"}, role.Parents)
+
+	affected, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{"member"}, Users: []string{"uid_guest"}, Groups: []string{}, Delegates: []string{}}, affected)
+	role, err = store.Roles().GetRoleContext(ctx, system, "member")
+	assert.Nil(t, err)
+	assert.Empty(t, role.Parents)
+}
+
+func testRoleConstraints(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	assert.Nil(t, store.Roles().UpdateConstraintsContext(ctx, system, "admin", 1, "common", "guest"))
+	assert.Equal(t, db.ErrNotFound, store.Roles().UpdateConstraintsContext(ctx, system, "not_exist", 1))
+	role, err := store.Roles().GetRoleContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, role.MaxMembers)
+	assert.Equal(t, []string{"common", "guest"}, role.Prerequisites)
+	assert.Equal(t, int64(2), role.Revision)
+
+	roles, err := store.Roles().GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	for _, r := range roles {
+		if r.Name == "admin" {
+			assert.Equal(t, 1, r.MaxMembers)
+			assert.Equal(t, []string{"common", "guest"}, r.Prerequisites)
+		} else {
+			assert.Equal(t, 0, r.MaxMembers)
+			assert.Empty(t, r.Prerequisites)
+		}
+	}
+
+	// prerequisites follow renamed and removed roles
+	affected, err := store.Roles().UpdateRoleNameCascadeContext(ctx, system, "common", "member")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin"}, affected.Roles)
+	_, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	role, err = store.Roles().GetRoleContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"member"}, role.Prerequisites)
+
+	// constraints are cleared
+	assert.Nil(t, store.Roles().UpdateConstraintsContext(ctx, system, "admin", 0))
+	role, err = store.Roles().GetRoleContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, role.MaxMembers)
+	assert.Empty(t, role.Prerequisites)
+}
+
+func testRoleConditions(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+	assert.Nil(t, store.Permissions().CreatePermissionContext(ctx, &model.Permission{System: system, Name: "refund"}))
+
+	refund := model.Condition{Permission: "refund", Expr: "amount < 1000"}
+	assert.Nil(t, store.Roles().SetConditionContext(ctx, system, "common", model.Condition{Permission: "manage", Expr: "owner == uid"}))
+	assert.Nil(t, store.Roles().SetConditionContext(ctx, system, "common", refund))
+	assert.Equal(t, db.ErrNotFound, store.Roles().SetConditionContext(ctx, system, "not_exist", refund))
+
+	// condition of the same permission is replaced
+	refund.Expr = "amount < 500"
+	assert.Nil(t, store.Roles().SetConditionContext(ctx, system, "common", refund))
+	role, err := store.Roles().GetRoleContext(ctx, system, "common")
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Condition{{Permission: "manage", Expr: "owner == uid"}, refund}, role.Conditions)
+	assert.Equal(t, int64(4), role.Revision)
+
+	roles, err := store.Roles().GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	for _, r := range roles {
+		if r.Name == "common" {
+			assert.Equal(t, role.Conditions, r.Conditions)
+		} else {
+			assert.Empty(t, r.Conditions)
+		}
+	}
+
+	// conditions follow renamed and removed permissions
+	affected, err := store.Permissions().UpdatePermissionCascadeContext(ctx, system, "manage", "administrate")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin", "common"}, affected.Roles)
+	affected, err = store.Permissions().RemovePermissionCascadeContext(ctx, system, "refund")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"common"}, affected.Roles)
+	role, err = store.Roles().GetRoleContext(ctx, system, "common")
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Condition{{Permission: "administrate", Expr: "owner == uid"}}, role.Conditions)
+
+	assert.Nil(t, store.Roles().RemoveConditionContext(ctx, system, "common", "administrate"))
+	role, err = store.Roles().GetRoleContext(ctx, system, "common")
+	assert.Nil(t, err)
+	assert.Empty(t, role.Conditions)
+}
+
+func testRoleDenied(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	assert.Nil(t, store.Roles().DenyPermissionsContext(ctx, system, "guest", "write", "manage"))
+	assert.Nil(t, store.Roles().DenyPermissionsContext(ctx, system, "guest", "write"))
+	assert.Equal(t, db.ErrNotFound, store.Roles().DenyPermissionsContext(ctx, system, "not_exist", "write"))
+	role, err := store.Roles().GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"write", "manage"}, role.Denied)
+	assert.Equal(t, int64(3), role.Revision)
+
+	// denied permissions follow renamed and removed permissions
+	affected, err := store.Permissions().UpdatePermissionCascadeContext(ctx, system, "manage", "administrate")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin", "guest"}, affected.Roles)
+	affected, err = store.Permissions().RemovePermissionCascadeContext(ctx, system, "write")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin", "common", "guest"}, affected.Roles)
+	roles, err := store.Roles().GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	for _, r := range roles {
+		if r.Name == "guest" {
+			assert.Equal(t, []string{"administrate"}, r.Denied)
+		} else {
+			assert.Empty(t, r.Denied)
+		}
+	}
+
+	assert.Nil(t, store.Roles().RemoveDeniedContext(ctx, system, "guest", "administrate"))
+	role, err = store.Roles().GetRoleContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	assert.Empty(t, role.Denied)
+}
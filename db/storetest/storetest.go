@@ -0,0 +1,43 @@
+// Package storetest is the conformance suite of db.Store, all implementations run it so they behave the same
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+)
+
+const system = "Cowshed"
+
+var ctx = context.Background()
+
+// Run run the whole suite against store, which must not hold any data of the systems used by the suite
+func Run(t *testing.T, store db.Store) {
+	for _, test := range []struct {
+		name string
+		fn   func(t *testing.T, store db.Store)
+	}{
+		{"Permission", testPermission},
+		{"Role", testRole},
+		{"UserPermModel", testUserPermModel},
+		{"Cascade", testCascade},
+		{"RoleParents", testRoleParents},
+		{"RoleConstraints", testRoleConstraints},
+		{"RoleConditions", testRoleConditions},
+		{"RoleDenied", testRoleDenied},
+		{"UserGrants", testUserGrants},
+		{"UserWindows", testUserWindows},
+		{"UserDomains", testUserDomains},
+		{"UserProvenance", testUserProvenance},
+		{"Revision", testRevision},
+		{"Group", testGroup},
+		{"SoDRule", testSoDRule},
+		{"System", testSystem},
+		{"Delegation", testDelegation},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, store)
+		})
+	}
+}
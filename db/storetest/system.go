@@ -0,0 +1,102 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSystem(t *testing.T, store db.Store) {
+	systemDao := store.Systems()
+	s := model.NewSystem(system, "question and answer", "alice")
+	s.Metadata["env"] = "prod"
+	assert.Nil(t, systemDao.CreateSystemContext(ctx, s))
+	assert.Equal(t, db.ErrAlreadyExists, systemDao.CreateSystemContext(ctx, s))
+
+	// query system
+	got, err := systemDao.GetSystemContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, "question and answer", got.Desc)
+	assert.Equal(t, []string{"alice"}, got.Owners)
+	assert.Equal(t, map[string]string{"env": "prod"}, got.Metadata)
+	assert.True(t, s.CreatedAt.Equal(got.CreatedAt))
+	assert.Equal(t, int64(1), got.Revision)
+	_, err = systemDao.GetSystemContext(ctx, "not_exist")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// update system
+	s = model.NewSystem(system, "", "alice", "bob")
+	assert.Nil(t, systemDao.UpdateSystemContext(ctx, s))
+	assert.Equal(t, db.ErrNotFound, systemDao.UpdateSystemContext(ctx, model.NewSystem("not_exist", "")))
+	got, err = systemDao.GetSystemContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, "", got.Desc)
+	assert.ElementsMatch(t, []string{"alice", "bob"}, got.Owners)
+	assert.Equal(t, map[string]string{}, got.Metadata)
+	assert.Equal(t, int64(2), got.Revision)
+
+	assert.Nil(t, systemDao.CreateSystemContext(ctx, model.NewSystem(system+"_other", "")))
+	systems, err := systemDao.GetAllSystemsContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(systems))
+	assert.Equal(t, system, systems[0].Name)
+	assert.Nil(t, systemDao.RemoveSystemContext(ctx, system+"_other"))
+
+	// default roles follow renamed and removed roles
+	fillCascadeData(t, store)
+	s = model.NewSystem(system, "")
+	s.DefaultRoles, s.AutoRegister = []string{"guest", "common"}, true
+	assert.Nil(t, systemDao.UpdateSystemContext(ctx, s))
+	_, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "guest", "visitor")
+	assert.Nil(t, err)
+	_, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "common")
+	assert.Nil(t, err)
+	got, err = systemDao.GetSystemContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"visitor"}, got.DefaultRoles)
+	assert.True(t, got.AutoRegister)
+	assert.Equal(t, int64(5), got.Revision)
+
+	// remove system with all its data, data of other systems is kept
+	group := model.NewGroup(system, "staff", "", "admin")
+	group.Members = []string{"uid_staff"}
+	assert.Nil(t, store.Groups().CreateGroupContext(ctx, group))
+	assert.Nil(t, store.Constraints().CreateSoDRuleContext(ctx, model.NewSoDRule(system, "exclusive", "", 2, "admin", "guest")))
+	users, err := store.Users().GetAllUsersContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(users))
+	assert.Equal(t, "uid_admin", users[0].UID)
+	assert.Equal(t, []string{"write"}, users[0].BlackList)
+
+	affected, err := systemDao.RemoveSystemCascadeContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin", "visitor"}, affected.Roles)
+	assert.Equal(t, []string{"uid_admin", "uid_common", "uid_guest"}, affected.Users)
+	assert.Equal(t, []string{"staff"}, affected.Groups)
+	_, err = systemDao.GetSystemContext(ctx, system)
+	assert.Equal(t, db.ErrNotFound, err)
+	ps, err := store.Permissions().GetAllPermissionsContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ps))
+	roles, err := store.Roles().GetAllRolesContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(roles))
+	users, err = store.Users().GetAllUsersContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
+	groups, err := store.Groups().GetAllGroupsContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(groups))
+	rules, err := store.Constraints().GetAllSoDRulesContext(ctx, system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rules))
+	_, err = store.Roles().GetRoleContext(ctx, system+"_other", "admin")
+	assert.Nil(t, err)
+
+	// unregistered systems are removed too
+	affected, err = systemDao.RemoveSystemCascadeContext(ctx, system+"_other")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin"}, affected.Roles)
+}
@@ -0,0 +1,356 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func fillUserData(t *testing.T, store db.Store) {
+	guestUser := model.NewUserPermModel(system, "uid_guest", "guest")
+	commonUser := model.NewUserPermModel(system, "uid_common", "common")
+	adminUser := model.NewUserPermModel(system, "uid_admin", "common", "admin")
+
+	// create user permission model
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, guestUser))
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, commonUser))
+	assert.Nil(t, store.Users().CreateUserPermModelContext(ctx, adminUser))
+}
+
+func clearUserData(t *testing.T, store db.Store) {
+	assert.Nil(t, store.Users().RemoveUserPermModelContext(ctx, system, "uid_guest"))
+	assert.Nil(t, store.Users().RemoveUserPermModelContext(ctx, system, "uid_common"))
+	assert.Nil(t, store.Users().RemoveUserPermModelContext(ctx, system, "uid_admin"))
+}
+
+func testUserPermModel(t *testing.T, store db.Store) {
+	fillUserData(t, store)
+	userDao := store.Users()
+
+	// get user permission model
+	u, err := userDao.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, "uid_guest", u.UID)
+	u, err = userDao.GetUserPermModelContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.Equal(t, "uid_admin", u.UID)
+	assert.ElementsMatch(t, []string{"common", "admin"}, u.Roles)
+
+	// insert keeps existing users
+	assert.Equal(t, db.ErrAlreadyExists, userDao.InsertUserPermModelContext(ctx, model.NewUserPermModel(system, "uid_admin", "guest")))
+	roles, err := userDao.GetAllRolesContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"common", "admin"}, roles)
+	assert.Nil(t, userDao.InsertUserPermModelContext(ctx, model.NewUserPermModel(system, "uid_inserted", "guest")))
+	u, err = userDao.GetUserPermModelContext(ctx, system, "uid_inserted")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"guest"}, u.Roles)
+	assert.Equal(t, int64(1), u.Revision)
+	assert.Nil(t, userDao.RemoveUserPermModelContext(ctx, system, "uid_inserted"))
+
+	// update roles
+	assert.Nil(t, userDao.UpdateRolesContext(ctx, system, "uid_common", "manage"))
+
+	roles, err = userDao.GetAllRolesContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"manage"}, roles)
+
+	// add roles, whether adding one again duplicates it differs between stores
+	assert.Nil(t, userDao.AddRolesContext(ctx, system, "uid_common", "write"))
+	roles, err = userDao.GetAllRolesContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"manage", "write"}, roles)
+
+	// remove roles
+	assert.Nil(t, userDao.RemoveRolesContext(ctx, system, "uid_common", "manage"))
+	roles, err = userDao.GetAllRolesContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"write"}, roles)
+
+	// add to blacklist
+	assert.Nil(t, userDao.AddToBlackListContext(ctx, system, "uid_common", "write"))
+	bl, err := userDao.GetBlackListContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"write"}, bl)
+
+	// remove from blacklist
+	assert.Nil(t, userDao.RemoveFromBlackListContext(ctx, system, "uid_common", "write"))
+	bl, err = userDao.GetBlackListContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(bl))
+
+	// add to whitelist
+	assert.Nil(t, userDao.AddToWhiteListContext(ctx, system, "uid_common", "write"))
+	wl, err := userDao.GetWhiteListContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"write"}, wl)
+
+	// remove from whitelist
+	assert.Nil(t, userDao.RemoveFromWhiteListContext(ctx, system, "uid_common", "write"))
+	wl, err = userDao.GetWhiteListContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(wl))
+
+	// replace whole model
+	assert.Nil(t, userDao.UpdateUserPermModelContext(ctx, system, "uid_guest", model.NewUserPermModel(system, "uid_guest", "common", "admin")))
+	roles, err = userDao.GetAllRolesContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(roles))
+
+	// user which not exist
+	assert.NotNil(t, userDao.AddRolesContext(ctx, system, "uid_not_exist", "guest"))
+
+	clearUserData(t, store)
+}
+
+func testUserGrants(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	doc := model.Resource{Type: "document", ID: "42"}
+	drafts := model.Resource{Type: "document", ID: "draft-*"}
+	grants := []model.Grant{{Permission: "write", Resource: doc}, {Permission: "manage", Resource: drafts}}
+	assert.Nil(t, store.Users().AddGrantsContext(ctx, system, "uid_guest", append(grants, grants[0])...))
+	assert.Nil(t, store.Users().AddGrantsContext(ctx, system, "uid_guest", grants[1]))
+	assert.Equal(t, db.ErrNotFound, store.Users().AddGrantsContext(ctx, system, "not_exist", grants...))
+	user, err := store.Users().GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, grants, user.Grants)
+
+	assert.Nil(t, store.Users().RemoveGrantContext(ctx, system, "uid_guest", model.Grant{Permission: "write", Resource: drafts}))
+	assert.Nil(t, store.Users().RemoveGrantContext(ctx, system, "uid_guest", grants[0]))
+	user, err = store.Users().GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, grants[1:], user.Grants)
+
+	// grants follow renamed and removed permissions
+	affected, err := store.Permissions().UpdatePermissionCascadeContext(ctx, system, "manage", "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"uid_common", "uid_guest"}, affected.Users)
+	user, err = store.Users().GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Grant{{Permission: "admin", Resource: drafts}}, user.Grants)
+
+	affected, err = store.Permissions().RemovePermissionCascadeContext(ctx, system, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"uid_common", "uid_guest"}, affected.Users)
+	user, err = store.Users().GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Empty(t, user.Grants)
+}
+
+func testUserWindows(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	now := time.Now().Truncate(time.Second)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	users := store.Users()
+	assert.Nil(t, users.AddWithinContext(ctx, system, "uid_guest", model.ListRoles, model.Period{ExpiresAt: &future}, "common"))
+	assert.Nil(t, users.AddWithinContext(ctx, system, "uid_guest", model.ListWhiteList, model.Period{ValidFrom: &past, ExpiresAt: &now}, "manage"))
+	assert.Nil(t, users.AddWithinContext(ctx, system, "uid_guest", model.ListBlackList, model.Period{ExpiresAt: &now}, "write"))
+	assert.NotNil(t, users.AddWithinContext(ctx, system, "uid_guest", "unknown", model.Period{}, "read"))
+	assert.Equal(t, db.ErrNotFound, users.AddWithinContext(ctx, system, "not_exist", model.ListRoles, model.Period{}, "guest"))
+
+	user, err := users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"guest", "common"}, user.Roles)
+	assert.Equal(t, []string{"manage"}, user.WhiteList)
+	assert.Len(t, user.RoleWindows, 1)
+	assert.Equal(t, "common", user.RoleWindows[0].Name)
+	assert.Nil(t, user.RoleWindows[0].ValidFrom)
+	assert.True(t, future.Equal(*user.RoleWindows[0].ExpiresAt))
+	assert.Len(t, user.WhiteListWindows, 1)
+	assert.True(t, past.Equal(*user.WhiteListWindows[0].ValidFrom))
+
+	// windows follow renamed roles
+	_, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "common", "member")
+	assert.Nil(t, err)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, "member", user.RoleWindows[0].Name)
+
+	// expired entries are removed together with their windows
+	refs, err := users.RemoveExpiredContext(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.UserRef{{System: system, UID: "uid_guest"}}, refs)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"guest", "member"}, user.Roles)
+	assert.Empty(t, user.WhiteList)
+	assert.Empty(t, user.BlackList)
+	assert.Empty(t, user.WhiteListWindows)
+	assert.Empty(t, user.BlackListWindows)
+	assert.Len(t, user.RoleWindows, 1)
+	refs, err = users.RemoveExpiredContext(ctx, now)
+	assert.Nil(t, err)
+	assert.Empty(t, refs)
+
+	// a zero period makes entries permanent
+	assert.Nil(t, users.AddWithinContext(ctx, system, "uid_guest", model.ListRoles, model.Period{}, "member"))
+	refs, err = users.RemoveExpiredContext(ctx, future)
+	assert.Nil(t, err)
+	assert.Empty(t, refs)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"guest", "member"}, user.Roles)
+	assert.Empty(t, user.RoleWindows)
+
+	// windows are revoked together with removed roles
+	assert.Nil(t, users.AddWithinContext(ctx, system, "uid_guest", model.ListRoles, model.Period{ExpiresAt: &future}, "guest"))
+	_, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "guest")
+	assert.Nil(t, err)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"member"}, user.Roles)
+	assert.Empty(t, user.RoleWindows)
+}
+
+func testUserDomains(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	users := store.Users()
+	assert.Nil(t, users.AddInDomainContext(ctx, system, "uid_guest", "eu", model.ListRoles, "admin", "admin"))
+	assert.Nil(t, users.AddInDomainContext(ctx, system, "uid_guest", "eu", model.ListWhiteList, "manage"))
+	assert.Nil(t, users.AddInDomainContext(ctx, system, "uid_guest", "us", model.ListBlackList, "read"))
+	assert.NotNil(t, users.AddInDomainContext(ctx, system, "uid_guest", "eu", "unknown", "read"))
+	assert.Equal(t, db.ErrNotFound, users.AddInDomainContext(ctx, system, "not_exist", "eu", model.ListRoles, "guest"))
+
+	user, err := users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"guest"}, user.Roles)
+	assert.Equal(t, []model.DomainEntry{{Domain: "eu", Name: "admin"}}, user.DomainRoles)
+	assert.Equal(t, []model.DomainEntry{{Domain: "eu", Name: "manage"}}, user.DomainWhiteList)
+	assert.Equal(t, []model.DomainEntry{{Domain: "us", Name: "read"}}, user.DomainBlackList)
+	assert.Equal(t, []string{"eu", "us"}, user.Domains())
+	assert.ElementsMatch(t, []string{"guest", "admin"}, user.InDomain("eu").Roles)
+
+	// domain entries follow renamed roles and permissions
+	_, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "admin", "boss")
+	assert.Nil(t, err)
+	_, err = store.Permissions().UpdatePermissionCascadeContext(ctx, system, "manage", "control")
+	assert.Nil(t, err)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Equal(t, []model.DomainEntry{{Domain: "eu", Name: "boss"}}, user.DomainRoles)
+	assert.Equal(t, []model.DomainEntry{{Domain: "eu", Name: "control"}}, user.DomainWhiteList)
+
+	// and are revoked together with removed ones
+	affected, err := store.Roles().RemoveRoleCascadeContext(ctx, system, "boss")
+	assert.Nil(t, err)
+	assert.Contains(t, affected.Users, "uid_guest")
+	assert.Nil(t, users.RemoveInDomainContext(ctx, system, "uid_guest", "us", model.ListBlackList, "read"))
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_guest")
+	assert.Nil(t, err)
+	assert.Empty(t, user.DomainRoles)
+	assert.Empty(t, user.DomainBlackList)
+	assert.Equal(t, []string{"eu"}, user.Domains())
+}
+
+func testUserProvenance(t *testing.T, store db.Store) {
+	fillCascadeData(t, store)
+	defer clearCascadeData(t, store)
+
+	now := time.Now().Truncate(time.Second)
+	p := model.Provenance{GrantedBy: "alice", GrantedAt: now, Reason: "on call", Ticket: "OPS-1"}
+	users := store.Users()
+	// provenance is stored by the same update as entries
+	setProvenance := func(uid, list string, p model.Provenance, names ...string) {
+		user, err := users.GetUserPermModelContext(ctx, system, uid)
+		assert.Nil(t, err)
+		assert.Nil(t, user.SetProvenance(list, p, names...))
+		assert.Nil(t, users.UpdateUserPermModelIfMatchContext(ctx, &user, user.Revision))
+	}
+	setProvenance("uid_common", model.ListRoles, p, "common")
+	setProvenance("uid_common", model.ListWhiteList, p, "manage")
+	setProvenance("uid_admin", model.ListBlackList, model.Provenance{GrantedAt: now}, "write")
+
+	user, err := users.GetUserPermModelContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Len(t, user.RoleProvenance, 1)
+	got, ok := user.ProvenanceOf(model.ListRoles, "common")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", got.GrantedBy)
+	assert.Equal(t, "on call", got.Reason)
+	assert.Equal(t, "OPS-1", got.Ticket)
+	assert.True(t, now.Equal(got.GrantedAt))
+	_, ok = user.ProvenanceOf(model.ListWhiteList, "manage")
+	assert.True(t, ok)
+
+	// provenance of the same entry is replaced
+	setProvenance("uid_common", model.ListRoles, model.Provenance{GrantedBy: "bob", GrantedAt: now}, "common")
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Len(t, user.RoleProvenance, 1)
+	assert.Equal(t, "bob", user.RoleProvenance[0].GrantedBy)
+
+	// provenance follows renamed roles and permissions
+	_, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "common", "member")
+	assert.Nil(t, err)
+	_, err = store.Permissions().UpdatePermissionCascadeContext(ctx, system, "manage", "control")
+	assert.Nil(t, err)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	_, ok = user.ProvenanceOf(model.ListRoles, "member")
+	assert.True(t, ok)
+	_, ok = user.ProvenanceOf(model.ListWhiteList, "control")
+	assert.True(t, ok)
+
+	// and is revoked together with removed ones
+	_, err = store.Roles().RemoveRoleCascadeContext(ctx, system, "member")
+	assert.Nil(t, err)
+	_, err = store.Permissions().RemovePermissionCascadeContext(ctx, system, "write")
+	assert.Nil(t, err)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_common")
+	assert.Nil(t, err)
+	assert.Empty(t, user.RoleProvenance)
+	assert.Len(t, user.WhiteListProvenance, 1)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.Empty(t, user.BlackListProvenance)
+
+	// full updates keep provenance
+	user.RoleProvenance = []model.Provenance{{Name: "admin", GrantedBy: "carol", GrantedAt: now}}
+	assert.Nil(t, users.UpdateUserPermModelContext(ctx, system, "uid_admin", &user))
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	got, ok = user.ProvenanceOf(model.ListRoles, "admin")
+	assert.True(t, ok)
+	assert.Equal(t, "carol", got.GrantedBy)
+
+	// entries within single domains hold their provenance
+	assert.Nil(t, user.AddInDomainWithProvenance("eu", model.ListRoles, p, "admin"))
+	assert.Nil(t, user.AddInDomainWithProvenance("eu", model.ListWhiteList, p, "read"))
+	assert.Nil(t, users.UpdateUserPermModelIfMatchContext(ctx, &user, user.Revision))
+	assert.Nil(t, users.AddInDomainContext(ctx, system, "uid_admin", "eu", model.ListRoles, "admin", "guest"))
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.Len(t, user.DomainRoles, 2)
+	got, ok = user.ProvenanceInDomain("eu", model.ListRoles, "admin")
+	assert.True(t, ok)
+	assert.Equal(t, "admin", got.Name)
+	assert.Equal(t, "alice", got.GrantedBy)
+	assert.Equal(t, "on call", got.Reason)
+	assert.Equal(t, "OPS-1", got.Ticket)
+	assert.True(t, now.Equal(got.GrantedAt))
+	_, ok = user.ProvenanceInDomain("eu", model.ListRoles, "guest")
+	assert.False(t, ok)
+
+	// and keep it when renamed
+	_, err = store.Roles().UpdateRoleNameCascadeContext(ctx, system, "admin", "boss")
+	assert.Nil(t, err)
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	got, ok = user.ProvenanceInDomain("eu", model.ListRoles, "boss")
+	assert.True(t, ok)
+	assert.Equal(t, "boss", got.Name)
+	assert.Equal(t, "alice", got.GrantedBy)
+	assert.Nil(t, users.RemoveInDomainContext(ctx, system, "uid_admin", "eu", model.ListWhiteList, "read"))
+	user, err = users.GetUserPermModelContext(ctx, system, "uid_admin")
+	assert.Nil(t, err)
+	assert.Empty(t, user.DomainWhiteList)
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"math"
+
+	"github.com/nzqpeace/rbac/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SystemList is name of collection
+const SystemList = "systems"
+
+// SystemDao define dao of system
+type SystemDao struct {
+	*Base
+}
+
+// NewSystemDao create a new instance of SystemDao
+func NewSystemDao(db *DataBase) *SystemDao {
+	return &SystemDao{
+		NewBase(db, SystemList),
+	}
+}
+
+// metadata return m, or an empty map if it's nil
+func metadata(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// GetSystem get specified system
+func (dao *SystemDao) GetSystem(name string) (model.System, error) {
+	return dao.GetSystemContext(context.Background(), name)
+}
+
+// GetSystemContext is GetSystem with context
+func (dao *SystemDao) GetSystemContext(ctx context.Context, name string) (system model.System, err error) {
+	err = dao.FindContext(ctx, bson.M{"name": name}, &system)
+	return
+}
+
+// GetAllSystems get all registered systems
+func (dao *SystemDao) GetAllSystems() ([]model.System, error) {
+	return dao.GetAllSystemsContext(context.Background())
+}
+
+// GetAllSystemsContext is GetAllSystems with context
+func (dao *SystemDao) GetAllSystemsContext(ctx context.Context) (systems []model.System, err error) {
+	systems = []model.System{}
+	err = dao.FindAllContext(ctx, bson.M{}, &systems, 0, math.MaxInt32, "name")
+	return
+}
+
+// CreateSystem register system, ErrAlreadyExists is returned if it's registered already
+func (dao *SystemDao) CreateSystem(system *model.System) error {
+	return dao.CreateSystemContext(context.Background(), system)
+}
+
+// CreateSystemContext is CreateSystem with context
+func (dao *SystemDao) CreateSystemContext(ctx context.Context, system *model.System) error {
+	return dao.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		res, err := updateOne(ctx, col, bson.M{"name": system.Name}, bson.M{
+			"$setOnInsert": bson.M{
+				"desc":          system.Desc,
+				"owners":        values(system.Owners),
+				"metadata":      metadata(system.Metadata),
+				"default_roles": values(system.DefaultRoles),
+				"auto_register": system.AutoRegister,
+				"created_at":    system.CreatedAt,
+				"revision":      int64(1),
+			},
+		}, true)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount > 0 {
+			return ErrAlreadyExists
+		}
+		return nil
+	})
+}
+
+// UpdateSystem replace description, owners, metadata, default roles and auto register of system
+func (dao *SystemDao) UpdateSystem(system *model.System) error {
+	return dao.UpdateSystemContext(context.Background(), system)
+}
+
+// UpdateSystemContext is UpdateSystem with context
+func (dao *SystemDao) UpdateSystemContext(ctx context.Context, system *model.System) error {
+	return dao.UpdateContext(ctx, bson.M{"name": system.Name}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"desc":          system.Desc,
+			"owners":        values(system.Owners),
+			"metadata":      metadata(system.Metadata),
+			"default_roles": values(system.DefaultRoles),
+			"auto_register": system.AutoRegister,
+		},
+	})
+}
+
+// RemoveSystem unregister specified system, its permissions, roles, users and groups are kept
+func (dao *SystemDao) RemoveSystem(name string) error {
+	return dao.RemoveSystemContext(context.Background(), name)
+}
+
+// RemoveSystemContext is RemoveSystem with context
+func (dao *SystemDao) RemoveSystemContext(ctx context.Context, name string) error {
+	return dao.RemoveContext(ctx, bson.M{"name": name})
+}
+
+// RemoveSystemCascade remove system together with all its permissions, roles, users, groups, rules and delegations
+func (dao *SystemDao) RemoveSystemCascade(name string) (Affected, error) {
+	return dao.RemoveSystemCascadeContext(context.Background(), name)
+}
+
+// RemoveSystemCascadeContext is RemoveSystemCascade with context
+func (dao *SystemDao) RemoveSystemCascadeContext(ctx context.Context, name string) (affected Affected, err error) {
+	affected = Affected{Roles: []string{}, Users: []string{}, Groups: []string{}}
+	err = dao.cascade(ctx, func(ctx context.Context) (err error) {
+		filter := bson.M{"system": name}
+		if affected.Roles, err = referrers(ctx, dao.db.C(RoleList), "name", filter); err != nil {
+			return
+		}
+		if affected.Users, err = referrers(ctx, dao.db.C(UserList), "uid", filter); err != nil {
+			return
+		}
+		if affected.Groups, err = referrers(ctx, dao.db.C(GroupList), "name", filter); err != nil {
+			return
+		}
+		for _, c := range []string{PermissionsList, RoleList, UserList, GroupList, SoDRuleList, DelegationList} {
+			if _, err = dao.db.C(c).DeleteMany(ctx, filter); err != nil {
+				return
+			}
+		}
+		_, err = dao.db.C(SystemList).DeleteOne(ctx, bson.M{"name": name})
+		return
+	})
+	return
+}
+
+// pullDefaultRole remove role from default roles of system
+func pullDefaultRole(ctx context.Context, col *mongo.Collection, system, role string) error {
+	_, err := col.UpdateOne(ctx, bson.M{"name": system, "default_roles": role},
+		bson.M{"$pull": bson.M{"default_roles": role}, "$inc": incRevision})
+	return err
+}
+
+// renameDefaultRole replace oldname with newname at default roles of system
+func renameDefaultRole(ctx context.Context, col *mongo.Collection, system, oldname, newname string) error {
+	filter := bson.M{"name": system, "default_roles": oldname}
+	// default roles are a set, drop oldname where newname is already present
+	_, err := col.UpdateOne(ctx, bson.M{"name": system, "default_roles": bson.M{"$all": bson.A{oldname, newname}}},
+		bson.M{"$pull": bson.M{"default_roles": oldname}, "$inc": incRevision})
+	if err != nil {
+		return err
+	}
+	_, err = col.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"default_roles.$": newname}, "$inc": incRevision})
+	return err
+}
@@ -1,13 +1,56 @@
 package db
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/nzqpeace/rbac/model"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // UserList is name of collection
 const UserList = "user"
 
+// windowFields map lists of user to the field holding their windows
+var windowFields = map[string]string{
+	model.ListRoles:     "role_windows",
+	model.ListWhiteList: "whitelist_windows",
+	model.ListBlackList: "blacklist_windows",
+}
+
+// windows return ws, or an empty slice if it's nil, so that array operators can be applied to the field
+func windows(ws []model.Window) []model.Window {
+	if ws == nil {
+		return []model.Window{}
+	}
+	return ws
+}
+
+// domainFields map lists of user to the field holding their entries within single domains
+var domainFields = map[string]string{
+	model.ListRoles:     "domain_roles",
+	model.ListWhiteList: "domain_whitelist",
+	model.ListBlackList: "domain_blacklist",
+}
+
+// domainEntries return es, or an empty slice if it's nil, so that array operators can be applied to the field
+func domainEntries(es []model.DomainEntry) []model.DomainEntry {
+	if es == nil {
+		return []model.DomainEntry{}
+	}
+	return es
+}
+
+// provenance return ps, or an empty slice if it's nil, so that array operators can be applied to the field
+func provenance(ps []model.Provenance) []model.Provenance {
+	if ps == nil {
+		return []model.Provenance{}
+	}
+	return ps
+}
+
 // UserDao define dao of user
 type UserDao struct {
 	*Base
@@ -22,29 +65,136 @@ func NewUserDao(db *DataBase) *UserDao {
 
 // CreateUserPermModel associate user info with permission, and store it into db
 func (dao *UserDao) CreateUserPermModel(user *model.UserPermModel) error {
-	return dao.Upsert(bson.M{"system": user.System, "uid": user.UID}, user)
+	return dao.CreateUserPermModelContext(context.Background(), user)
+}
+
+// CreateUserPermModelContext is CreateUserPermModel with context
+func (dao *UserDao) CreateUserPermModelContext(ctx context.Context, user *model.UserPermModel) error {
+	return dao.UpsertContext(ctx, bson.M{"system": user.System, "uid": user.UID}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"roles":     user.Roles,
+			"blacklist": user.BlackList,
+			"whitelist": user.WhiteList,
+			"grants":    user.Grants,
+
+			"role_windows":      windows(user.RoleWindows),
+			"whitelist_windows": windows(user.WhiteListWindows),
+			"blacklist_windows": windows(user.BlackListWindows),
+
+			"domain_roles":     domainEntries(user.DomainRoles),
+			"domain_whitelist": domainEntries(user.DomainWhiteList),
+			"domain_blacklist": domainEntries(user.DomainBlackList),
+
+			"role_provenance":      provenance(user.RoleProvenance),
+			"whitelist_provenance": provenance(user.WhiteListProvenance),
+			"blacklist_provenance": provenance(user.BlackListProvenance),
+		},
+	})
+}
+
+// InsertUserPermModel create user only if it doesn't exist, ErrAlreadyExists is returned otherwise
+func (dao *UserDao) InsertUserPermModel(user *model.UserPermModel) error {
+	return dao.InsertUserPermModelContext(context.Background(), user)
+}
+
+// InsertUserPermModelContext is InsertUserPermModel with context
+func (dao *UserDao) InsertUserPermModelContext(ctx context.Context, user *model.UserPermModel) error {
+	return dao.InvokeContext(ctx, func(ctx context.Context, col *mongo.Collection) error {
+		res, err := updateOne(ctx, col, bson.M{"system": user.System, "uid": user.UID}, bson.M{
+			"$setOnInsert": bson.M{
+				"roles":     user.Roles,
+				"blacklist": user.BlackList,
+				"whitelist": user.WhiteList,
+				"grants":    user.Grants,
+
+				"role_windows":      windows(user.RoleWindows),
+				"whitelist_windows": windows(user.WhiteListWindows),
+				"blacklist_windows": windows(user.BlackListWindows),
+
+				"domain_roles":     domainEntries(user.DomainRoles),
+				"domain_whitelist": domainEntries(user.DomainWhiteList),
+				"domain_blacklist": domainEntries(user.DomainBlackList),
+
+				"role_provenance":      provenance(user.RoleProvenance),
+				"whitelist_provenance": provenance(user.WhiteListProvenance),
+				"blacklist_provenance": provenance(user.BlackListProvenance),
+
+				"revision": int64(1),
+			},
+		}, true)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount > 0 {
+			return ErrAlreadyExists
+		}
+		return nil
+	})
 }
 
 // RemoveUserPermModel remove user info from mongo
 func (dao *UserDao) RemoveUserPermModel(system, uid string) error {
-	return dao.Remove(bson.M{"system": system, "uid": uid})
+	return dao.RemoveUserPermModelContext(context.Background(), system, uid)
+}
+
+// RemoveUserPermModelContext is RemoveUserPermModel with context
+func (dao *UserDao) RemoveUserPermModelContext(ctx context.Context, system, uid string) error {
+	return dao.RemoveContext(ctx, bson.M{"system": system, "uid": uid})
 }
 
 // UpdateUserPermModel update user info
 func (dao *UserDao) UpdateUserPermModel(system, uid string, user *model.UserPermModel) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, user)
+	return dao.UpdateUserPermModelContext(context.Background(), system, uid, user)
+}
+
+// UpdateUserPermModelContext is UpdateUserPermModel with context
+func (dao *UserDao) UpdateUserPermModelContext(ctx context.Context, system, uid string, user *model.UserPermModel) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"system":    user.System,
+			"uid":       user.UID,
+			"roles":     user.Roles,
+			"blacklist": user.BlackList,
+			"whitelist": user.WhiteList,
+			"grants":    user.Grants,
+
+			"role_windows":      windows(user.RoleWindows),
+			"whitelist_windows": windows(user.WhiteListWindows),
+			"blacklist_windows": windows(user.BlackListWindows),
+
+			"domain_roles":     domainEntries(user.DomainRoles),
+			"domain_whitelist": domainEntries(user.DomainWhiteList),
+			"domain_blacklist": domainEntries(user.DomainBlackList),
+
+			"role_provenance":      provenance(user.RoleProvenance),
+			"whitelist_provenance": provenance(user.WhiteListProvenance),
+			"blacklist_provenance": provenance(user.BlackListProvenance),
+		},
+	})
 }
 
 // GetUserPermModel get user info
-func (dao *UserDao) GetUserPermModel(system, uid string) (user model.UserPermModel, err error) {
-	err = dao.Find(bson.M{"system": system, "uid": uid}, &user)
+func (dao *UserDao) GetUserPermModel(system, uid string) (model.UserPermModel, error) {
+	return dao.GetUserPermModelContext(context.Background(), system, uid)
+}
+
+// GetUserPermModelContext is GetUserPermModel with context
+func (dao *UserDao) GetUserPermModelContext(ctx context.Context, system, uid string) (user model.UserPermModel, err error) {
+	err = dao.FindContext(ctx, bson.M{"system": system, "uid": uid}, &user)
 	return
 }
 
 // GetAllRoles get all roles with uid
-func (dao *UserDao) GetAllRoles(system, uid string) (roles []string, err error) {
+func (dao *UserDao) GetAllRoles(system, uid string) ([]string, error) {
+	return dao.GetAllRolesContext(context.Background(), system, uid)
+}
+
+// GetAllRolesContext is GetAllRoles with context
+func (dao *UserDao) GetAllRolesContext(ctx context.Context, system, uid string) (roles []string, err error) {
 	var user model.UserPermModel
-	err = dao.Find(bson.M{"system": system, "uid": uid}, &user)
+	err = dao.FindContext(ctx, bson.M{"system": system, "uid": uid}, &user)
 	if err == nil {
 		roles = user.Roles
 	}
@@ -53,11 +203,17 @@ func (dao *UserDao) GetAllRoles(system, uid string) (roles []string, err error)
 
 // UpdateRoles update user's all roles
 func (dao *UserDao) UpdateRoles(system, uid string, roles ...string) error {
+	return dao.UpdateRolesContext(context.Background(), system, uid, roles...)
+}
+
+// UpdateRolesContext is UpdateRoles with context
+func (dao *UserDao) UpdateRolesContext(ctx context.Context, system, uid string, roles ...string) error {
 	if len(roles) == 0 {
 		return nil
 	}
 
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$set": bson.M{
 			"roles": roles,
 		},
@@ -66,11 +222,17 @@ func (dao *UserDao) UpdateRoles(system, uid string, roles ...string) error {
 
 // AddRoles add specified roles into user's permission model
 func (dao *UserDao) AddRoles(system, uid string, roles ...string) error {
+	return dao.AddRolesContext(context.Background(), system, uid, roles...)
+}
+
+// AddRolesContext is AddRoles with context
+func (dao *UserDao) AddRolesContext(ctx context.Context, system, uid string, roles ...string) error {
 	if len(roles) == 0 {
 		return nil
 	}
 
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$push": bson.M{
 			"roles": bson.M{
 				"$each": roles,
@@ -81,7 +243,13 @@ func (dao *UserDao) AddRoles(system, uid string, roles ...string) error {
 
 // RemoveRoles remove specified role from user's permission model
 func (dao *UserDao) RemoveRoles(system, uid string, role string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.RemoveRolesContext(context.Background(), system, uid, role)
+}
+
+// RemoveRolesContext is RemoveRoles with context
+func (dao *UserDao) RemoveRolesContext(ctx context.Context, system, uid string, role string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$pull": bson.M{
 			"roles": role,
 		},
@@ -89,9 +257,14 @@ func (dao *UserDao) RemoveRoles(system, uid string, role string) error {
 }
 
 // GetBlackList get user permission model's blacklist, which contain all permissions forbidden
-func (dao *UserDao) GetBlackList(system, uid string) (bl []string, err error) {
+func (dao *UserDao) GetBlackList(system, uid string) ([]string, error) {
+	return dao.GetBlackListContext(context.Background(), system, uid)
+}
+
+// GetBlackListContext is GetBlackList with context
+func (dao *UserDao) GetBlackListContext(ctx context.Context, system, uid string) (bl []string, err error) {
 	var user model.UserPermModel
-	err = dao.Find(bson.M{"system": system, "uid": uid}, &user)
+	err = dao.FindContext(ctx, bson.M{"system": system, "uid": uid}, &user)
 	if err == nil {
 		bl = user.BlackList
 	}
@@ -100,7 +273,13 @@ func (dao *UserDao) GetBlackList(system, uid string) (bl []string, err error) {
 
 // AddToBlackList add specified permissions into user permission model's blacklist
 func (dao *UserDao) AddToBlackList(system, uid string, permissions ...string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.AddToBlackListContext(context.Background(), system, uid, permissions...)
+}
+
+// AddToBlackListContext is AddToBlackList with context
+func (dao *UserDao) AddToBlackListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$push": bson.M{
 			"blacklist": bson.M{
 				"$each": permissions,
@@ -111,7 +290,13 @@ func (dao *UserDao) AddToBlackList(system, uid string, permissions ...string) er
 
 // RemoveFromBlackList remove specified permission from blacklist
 func (dao *UserDao) RemoveFromBlackList(system, uid string, permission string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.RemoveFromBlackListContext(context.Background(), system, uid, permission)
+}
+
+// RemoveFromBlackListContext is RemoveFromBlackList with context
+func (dao *UserDao) RemoveFromBlackListContext(ctx context.Context, system, uid string, permission string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$pull": bson.M{
 			"blacklist": permission,
 		},
@@ -120,7 +305,13 @@ func (dao *UserDao) RemoveFromBlackList(system, uid string, permission string) e
 
 // ClearBlackList clear blacklist
 func (dao *UserDao) ClearBlackList(system, uid string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.ClearBlackListContext(context.Background(), system, uid)
+}
+
+// ClearBlackListContext is ClearBlackList with context
+func (dao *UserDao) ClearBlackListContext(ctx context.Context, system, uid string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$set": bson.M{
 			"blacklist": []string{},
 		},
@@ -128,9 +319,14 @@ func (dao *UserDao) ClearBlackList(system, uid string) error {
 }
 
 // GetWhiteList get user permission model's whitelist, which contain all permissions allowed all the time
-func (dao *UserDao) GetWhiteList(system, uid string) (whitelist []string, err error) {
+func (dao *UserDao) GetWhiteList(system, uid string) ([]string, error) {
+	return dao.GetWhiteListContext(context.Background(), system, uid)
+}
+
+// GetWhiteListContext is GetWhiteList with context
+func (dao *UserDao) GetWhiteListContext(ctx context.Context, system, uid string) (whitelist []string, err error) {
 	var user model.UserPermModel
-	err = dao.Find(bson.M{"system": system, "uid": uid}, &user)
+	err = dao.FindContext(ctx, bson.M{"system": system, "uid": uid}, &user)
 	if err == nil {
 		whitelist = user.WhiteList
 	}
@@ -139,7 +335,13 @@ func (dao *UserDao) GetWhiteList(system, uid string) (whitelist []string, err er
 
 // UpdateWhiteList update whitelist with 'wl'
 func (dao *UserDao) UpdateWhiteList(system, uid string, whitelist ...string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.UpdateWhiteListContext(context.Background(), system, uid, whitelist...)
+}
+
+// UpdateWhiteListContext is UpdateWhiteList with context
+func (dao *UserDao) UpdateWhiteListContext(ctx context.Context, system, uid string, whitelist ...string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$set": bson.M{
 			"whitelist": whitelist,
 		},
@@ -148,7 +350,13 @@ func (dao *UserDao) UpdateWhiteList(system, uid string, whitelist ...string) err
 
 // AddToWhiteList add specified permission into user permission model's whitelist
 func (dao *UserDao) AddToWhiteList(system, uid string, permissions ...string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.AddToWhiteListContext(context.Background(), system, uid, permissions...)
+}
+
+// AddToWhiteListContext is AddToWhiteList with context
+func (dao *UserDao) AddToWhiteListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$push": bson.M{
 			"whitelist": bson.M{
 				"$each": permissions,
@@ -159,7 +367,13 @@ func (dao *UserDao) AddToWhiteList(system, uid string, permissions ...string) er
 
 // RemoveFromWhiteList remove specified permission from user's permission model's whitelist
 func (dao *UserDao) RemoveFromWhiteList(system, uid string, permission string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.RemoveFromWhiteListContext(context.Background(), system, uid, permission)
+}
+
+// RemoveFromWhiteListContext is RemoveFromWhiteList with context
+func (dao *UserDao) RemoveFromWhiteListContext(ctx context.Context, system, uid string, permission string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$pull": bson.M{
 			"whitelist": permission,
 		},
@@ -168,9 +382,275 @@ func (dao *UserDao) RemoveFromWhiteList(system, uid string, permission string) e
 
 // ClearWhiteList clear all permission at user's permission model's whitelist
 func (dao *UserDao) ClearWhiteList(system, uid string) error {
-	return dao.Update(bson.M{"system": system, "uid": uid}, bson.M{
+	return dao.ClearWhiteListContext(context.Background(), system, uid)
+}
+
+// ClearWhiteListContext is ClearWhiteList with context
+func (dao *UserDao) ClearWhiteListContext(ctx context.Context, system, uid string) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
 		"$set": bson.M{
 			"whitelist": []string{},
 		},
 	})
 }
+
+// AddGrants add grants on resources to user, grants already present are ignored
+func (dao *UserDao) AddGrants(system, uid string, grants ...model.Grant) error {
+	return dao.AddGrantsContext(context.Background(), system, uid, grants...)
+}
+
+// AddGrantsContext is AddGrants with context
+func (dao *UserDao) AddGrantsContext(ctx context.Context, system, uid string, grants ...model.Grant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
+		"$addToSet": bson.M{
+			"grants": bson.M{
+				"$each": grants,
+			},
+		},
+	})
+}
+
+// RemoveGrant remove specified grant from user
+func (dao *UserDao) RemoveGrant(system, uid string, grant model.Grant) error {
+	return dao.RemoveGrantContext(context.Background(), system, uid, grant)
+}
+
+// RemoveGrantContext is RemoveGrant with context
+func (dao *UserDao) RemoveGrantContext(ctx context.Context, system, uid string, grant model.Grant) error {
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
+		"$pull": bson.M{
+			"grants": grant,
+		},
+	})
+}
+
+// AddWithin add names to list of user and restrict them to period, names already present get the new period,
+// a zero period makes them permanent
+func (dao *UserDao) AddWithin(system, uid, list string, period model.Period, names ...string) error {
+	return dao.AddWithinContext(context.Background(), system, uid, list, period, names...)
+}
+
+// AddWithinContext is AddWithin with context
+func (dao *UserDao) AddWithinContext(ctx context.Context, system, uid, list string, period model.Period, names ...string) error {
+	field, ok := windowFields[list]
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	// a field can't be pulled and pushed by one update
+	query := bson.M{"system": system, "uid": uid}
+	return dao.cascade(ctx, func(ctx context.Context) error {
+		col := dao.db.C(UserList)
+		res, err := col.UpdateOne(ctx, query, bson.M{
+			"$inc":      incRevision,
+			"$addToSet": bson.M{list: bson.M{"$each": names}},
+			"$pull":     bson.M{field: bson.M{"name": bson.M{"$in": names}}},
+		})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		if period.IsZero() {
+			return nil
+		}
+
+		ws := []model.Window{}
+		for _, n := range names {
+			ws = append(ws, model.Window{Name: n, Period: period})
+		}
+		_, err = col.UpdateOne(ctx, query, bson.M{"$push": bson.M{field: bson.M{"$each": ws}}})
+		return err
+	})
+}
+
+// AddInDomain add names to list of user within domain, names already present are ignored
+func (dao *UserDao) AddInDomain(system, uid, domain, list string, names ...string) error {
+	return dao.AddInDomainContext(context.Background(), system, uid, domain, list, names...)
+}
+
+// AddInDomainContext is AddInDomain with context
+func (dao *UserDao) AddInDomainContext(ctx context.Context, system, uid, domain, list string, names ...string) error {
+	field, ok := domainFields[list]
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	// entries may hold provenance, so $addToSet can't tell whether they are present
+	query := bson.M{"system": system, "uid": uid}
+	return dao.cascade(ctx, func(ctx context.Context) error {
+		col := dao.db.C(UserList)
+		res, err := col.UpdateOne(ctx, query, bson.M{"$inc": incRevision})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+
+		for _, n := range names {
+			absent := bson.M{"system": system, "uid": uid, field: bson.M{"$not": bson.M{"$elemMatch": bson.M{"domain": domain, "name": n}}}}
+			_, err = col.UpdateOne(ctx, absent, bson.M{"$push": bson.M{field: model.DomainEntry{Domain: domain, Name: n}}})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveInDomain remove name from list of user within domain
+func (dao *UserDao) RemoveInDomain(system, uid, domain, list, name string) error {
+	return dao.RemoveInDomainContext(context.Background(), system, uid, domain, list, name)
+}
+
+// RemoveInDomainContext is RemoveInDomain with context
+func (dao *UserDao) RemoveInDomainContext(ctx context.Context, system, uid, domain, list, name string) error {
+	field, ok := domainFields[list]
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+
+	return dao.UpdateContext(ctx, bson.M{"system": system, "uid": uid}, bson.M{
+		"$inc": incRevision,
+		"$pull": bson.M{
+			field: bson.M{"domain": domain, "name": name},
+		},
+	})
+}
+
+// RemoveExpired remove entries whose window has ended at now from users of all systems, return the changed users
+func (dao *UserDao) RemoveExpired(now time.Time) ([]UserRef, error) {
+	return dao.RemoveExpiredContext(context.Background(), now)
+}
+
+// RemoveExpiredContext is RemoveExpired with context
+func (dao *UserDao) RemoveExpiredContext(ctx context.Context, now time.Time) (refs []UserRef, err error) {
+	or := bson.A{}
+	for _, f := range windowFields {
+		or = append(or, bson.M{f + ".expires_at": bson.M{"$lte": now}})
+	}
+	var users []model.UserPermModel
+	if err = dao.FindAllContext(ctx, bson.M{"$or": or}, &users, 0, 0); err != nil {
+		return
+	}
+
+	refs = []UserRef{}
+	for i := range users {
+		u := &users[i]
+		if !u.RemoveExpired(now) {
+			continue
+		}
+
+		err = dao.UpdateIfMatch(ctx, bson.M{"system": u.System, "uid": u.UID}, u.Revision, bson.M{
+			"$inc": incRevision,
+			"$set": bson.M{
+				"roles":             u.Roles,
+				"blacklist":         u.BlackList,
+				"whitelist":         u.WhiteList,
+				"role_windows":      u.RoleWindows,
+				"whitelist_windows": u.WhiteListWindows,
+				"blacklist_windows": u.BlackListWindows,
+			},
+		})
+		if err == ErrConflict || err == ErrNotFound { // changed meanwhile, it's left to the next sweep
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		refs = append(refs, UserRef{System: u.System, UID: u.UID})
+	}
+	return
+}
+
+// GetAllUsers list all users of system
+func (dao *UserDao) GetAllUsers(system string) ([]model.UserPermModel, error) {
+	return dao.GetAllUsersContext(context.Background(), system)
+}
+
+// GetAllUsersContext is GetAllUsers with context
+func (dao *UserDao) GetAllUsersContext(ctx context.Context, system string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	err = dao.FindAllContext(ctx, bson.M{"system": system}, &users, 0, 0, "uid")
+	return
+}
+
+// GetUsersWithRoles list users of system holding any of roles
+func (dao *UserDao) GetUsersWithRoles(system string, roles ...string) ([]model.UserPermModel, error) {
+	return dao.GetUsersWithRolesContext(context.Background(), system, roles...)
+}
+
+// GetUsersWithRolesContext is GetUsersWithRoles with context
+func (dao *UserDao) GetUsersWithRolesContext(ctx context.Context, system string, roles ...string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	if len(roles) == 0 {
+		return
+	}
+	err = dao.FindAllContext(ctx, bson.M{"system": system, "roles": bson.M{"$in": roles}}, &users, 0, 0, "uid")
+	return
+}
+
+// GetUsersWithDomainRoles list users of system holding any of roles within any domain
+func (dao *UserDao) GetUsersWithDomainRoles(system string, roles ...string) ([]model.UserPermModel, error) {
+	return dao.GetUsersWithDomainRolesContext(context.Background(), system, roles...)
+}
+
+// GetUsersWithDomainRolesContext is GetUsersWithDomainRoles with context
+func (dao *UserDao) GetUsersWithDomainRolesContext(ctx context.Context, system string, roles ...string) (users []model.UserPermModel, err error) {
+	users = []model.UserPermModel{}
+	if len(roles) == 0 {
+		return
+	}
+	err = dao.FindAllContext(ctx, bson.M{"system": system, "domain_roles.name": bson.M{"$in": roles}}, &users, 0, 0, "uid")
+	return
+}
+
+// UpdateUserPermModelIfMatch replace roles, blacklist, whitelist, grants, windows, domain entries and provenance of user if its revision equals revision
+func (dao *UserDao) UpdateUserPermModelIfMatch(user *model.UserPermModel, revision int64) error {
+	return dao.UpdateUserPermModelIfMatchContext(context.Background(), user, revision)
+}
+
+// UpdateUserPermModelIfMatchContext is UpdateUserPermModelIfMatch with context
+func (dao *UserDao) UpdateUserPermModelIfMatchContext(ctx context.Context, user *model.UserPermModel, revision int64) error {
+	err := dao.UpdateIfMatch(ctx, bson.M{"system": user.System, "uid": user.UID}, revision, bson.M{
+		"$inc": incRevision,
+		"$set": bson.M{
+			"roles":     user.Roles,
+			"blacklist": user.BlackList,
+			"whitelist": user.WhiteList,
+			"grants":    user.Grants,
+
+			"role_windows":      windows(user.RoleWindows),
+			"whitelist_windows": windows(user.WhiteListWindows),
+			"blacklist_windows": windows(user.BlackListWindows),
+
+			"domain_roles":     domainEntries(user.DomainRoles),
+			"domain_whitelist": domainEntries(user.DomainWhiteList),
+			"domain_blacklist": domainEntries(user.DomainBlackList),
+
+			"role_provenance":      provenance(user.RoleProvenance),
+			"whitelist_provenance": provenance(user.WhiteListProvenance),
+			"blacklist_provenance": provenance(user.BlackListProvenance),
+		},
+	})
+	if err == nil {
+		user.Revision = revision + 1
+	}
+	return err
+}
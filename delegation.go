@@ -0,0 +1,181 @@
+package rbac
+
+import (
+	"context"
+
+	"github.com/nzqpeace/rbac/model"
+)
+
+// Delegate hand roles of delegator to delegate within period, e.g. to a deputy during leave, a zero period never
+// expires. delegator may delegate roles assigned to it directly and roles delegated to it transitively, roles of
+// its groups can't be delegated. delegated roles count as roles of delegate as long as delegator holds them, they
+// may be delegated further only if transitive. an existing delegation from delegator to delegate is replaced.
+// *NotDelegableError is returned if delegator doesn't hold any of roles now, *SoDError, *PrerequisiteError or
+// *MaxMembersError if delegate would violate constraints of roles, whatever the period is
+func (r *RBAC) Delegate(system, delegator, delegate string, period model.Period, transitive bool, roles ...string) error {
+	return r.DelegateContext(context.Background(), system, delegator, delegate, period, transitive, roles...)
+}
+
+// DelegateContext is Delegate with context
+func (r *RBAC) DelegateContext(ctx context.Context, system, delegator, delegate string, period model.Period, transitive bool, roles ...string) error {
+	d := model.NewDelegation(system, delegator, delegate, roles...)
+	d.Period, d.Transitive = period, transitive
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	held, err := r.Cache.DelegableRolesContext(ctx, system, delegator)
+	if err != nil {
+		return err
+	}
+	if m := missing(roles, held); len(m) > 0 {
+		return &NotDelegableError{System: system, UID: delegator, Roles: m}
+	}
+	own, err := r.heldRoles(ctx, system, delegate)
+	if err != nil {
+		return err
+	}
+	if err = r.checkConstraints(ctx, system, delegate, own, append(append([]string{}, own...), roles...)); err != nil {
+		return err
+	}
+
+	if err = r.Delegation.CreateDelegationContext(ctx, d); err != nil {
+		return err
+	}
+	return r.revokeLost(ctx, system, delegator)
+}
+
+// Revoke remove delegation from delegator to delegate, roles delegate delegated further and no longer holds are
+// revoked too
+func (r *RBAC) Revoke(system, delegator, delegate string) error {
+	return r.RevokeContext(context.Background(), system, delegator, delegate)
+}
+
+// RevokeContext is Revoke with context
+func (r *RBAC) RevokeContext(ctx context.Context, system, delegator, delegate string) error {
+	if err := r.Delegation.RemoveDelegationContext(ctx, system, delegator, delegate); err != nil {
+		return err
+	}
+	_, err := r.Cache.RemoveUserContext(ctx, system, delegate)
+	if e := r.revokeLost(ctx, system, delegate); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// GetDelegationsFrom list delegations made by uid, including those not in effect
+func (r *RBAC) GetDelegationsFrom(system, uid string) ([]model.Delegation, error) {
+	return r.GetDelegationsFromContext(context.Background(), system, uid)
+}
+
+// GetDelegationsFromContext is GetDelegationsFrom with context
+func (r *RBAC) GetDelegationsFromContext(ctx context.Context, system, uid string) ([]model.Delegation, error) {
+	return r.Delegation.GetDelegationsFromContext(ctx, system, uid)
+}
+
+// GetDelegationsTo list delegations received by uid, including those not in effect
+func (r *RBAC) GetDelegationsTo(system, uid string) ([]model.Delegation, error) {
+	return r.GetDelegationsToContext(context.Background(), system, uid)
+}
+
+// GetDelegationsToContext is GetDelegationsTo with context
+func (r *RBAC) GetDelegationsToContext(ctx context.Context, system, uid string) ([]model.Delegation, error) {
+	return r.Delegation.GetDelegationsToContext(ctx, system, uid)
+}
+
+// heldForDelegation return roles uid holds for delegation whatever their periods, i.e. roles assigned to it and
+// roles of transitive delegations to it which their delegators hold in turn. path holds users already on the chain
+func (r *RBAC) heldForDelegation(ctx context.Context, system, uid string, path []string) ([]string, error) {
+	roles, err := r.heldRoles(ctx, system, uid)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := r.Delegation.GetDelegationsToContext(ctx, system, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	path = append(path, uid)
+	for _, d := range ds {
+		if !d.Transitive || contains(path, d.Delegator) {
+			continue
+		}
+		held, err := r.heldForDelegation(ctx, system, d.Delegator, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range d.Roles {
+			if contains(held, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles, nil
+}
+
+// revokeLost revoke roles delegated by uid which it no longer holds, delegations left without roles are removed.
+// cached permissions of delegates are dropped and their delegations are revoked in turn, so it's called whenever
+// roles of uid may have changed
+func (r *RBAC) revokeLost(ctx context.Context, system, uid string) error {
+	return r.revokeLostFrom(ctx, system, uid, map[string]bool{})
+}
+
+// revokeLostFrom is revokeLost, delegates already visited are only visited again if their delegations changed
+func (r *RBAC) revokeLostFrom(ctx context.Context, system, uid string, visited map[string]bool) error {
+	visited[uid] = true
+	ds, err := r.Delegation.GetDelegationsFromContext(ctx, system, uid)
+	if err != nil || len(ds) == 0 {
+		return err
+	}
+	held, err := r.heldForDelegation(ctx, system, uid, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range ds {
+		kept := []string{}
+		for _, role := range d.Roles {
+			if contains(held, role) {
+				kept = append(kept, role)
+			}
+		}
+
+		if _, err = r.Cache.RemoveUserContext(ctx, system, d.Delegate); err != nil {
+			return err
+		}
+		if len(kept) == 0 {
+			err = r.Delegation.RemoveDelegationContext(ctx, system, uid, d.Delegate)
+		} else if len(kept) < len(d.Roles) {
+			d.Roles = kept
+			err = r.Delegation.CreateDelegationContext(ctx, &d)
+		} else if visited[d.Delegate] {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = r.revokeLostFrom(ctx, system, d.Delegate, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEmptyDelegations remove delegations of system left without roles, e.g. after their roles were unregistered
+func (r *RBAC) removeEmptyDelegations(ctx context.Context, system string) error {
+	ds, err := r.Delegation.GetAllDelegationsContext(ctx, system)
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if len(d.Roles) > 0 {
+			continue
+		}
+		if err = r.Delegation.RemoveDelegationContext(ctx, system, d.Delegator, d.Delegate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
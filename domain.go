@@ -0,0 +1,134 @@
+package rbac
+
+import (
+	"context"
+
+	"github.com/nzqpeace/rbac/model"
+)
+
+// IsPermitInDomain check whether have specified permission within domain, e.g. an organization of a multi-tenant
+// system. roles, whitelist and blacklist of user within domain apply together with its global ones, entries of
+// other domains don't. an empty domain is the same as IsPermit
+func (r *RBAC) IsPermitInDomain(system, uid, domain, permission string) (bool, error) {
+	return r.IsPermitInDomainContext(context.Background(), system, uid, domain, permission)
+}
+
+// IsPermitInDomainContext is IsPermitInDomain with context
+func (r *RBAC) IsPermitInDomainContext(ctx context.Context, system, uid, domain, permission string) (bool, error) {
+	return r.Cache.IsPermitInDomainContext(ctx, system, uid, domain, permission)
+}
+
+// GetDomainsOfUser list domains in which user holds any role, whitelisted or blacklisted permission
+func (r *RBAC) GetDomainsOfUser(system, uid string) ([]string, error) {
+	return r.GetDomainsOfUserContext(context.Background(), system, uid)
+}
+
+// GetDomainsOfUserContext is GetDomainsOfUser with context
+func (r *RBAC) GetDomainsOfUserContext(ctx context.Context, system, uid string) ([]string, error) {
+	u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+	if err != nil {
+		return nil, err
+	}
+	return u.Domains(), nil
+}
+
+// AddRolesInDomain assign roles to user within domain only
+func (r *RBAC) AddRolesInDomain(system, uid, domain string, roles ...string) error {
+	return r.AddRolesInDomainContext(context.Background(), system, uid, domain, roles...)
+}
+
+// AddRolesInDomainContext is AddRolesInDomain with context, *SoDError, *PrerequisiteError or *MaxMembersError is
+// returned if roles together with those held within domain violate a constraint. users holding a role within
+// any domain count towards its max members once
+func (r *RBAC) AddRolesInDomainContext(ctx context.Context, system, uid, domain string, roles ...string) error {
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	held := u.InDomain(domain).Roles
+	if err = r.checkConstraints(ctx, system, uid, held, append(append([]string{}, held...), roles...)); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.addInDomain(ctx, system, uid, domain, model.ListRoles, roles...)
+}
+
+// RemoveRoleInDomain revoke role assigned to user within domain, it's still held if assigned globally
+func (r *RBAC) RemoveRoleInDomain(system, uid, domain, role string) error {
+	return r.RemoveRoleInDomainContext(context.Background(), system, uid, domain, role)
+}
+
+// RemoveRoleInDomainContext is RemoveRoleInDomain with context, *PrerequisiteError is returned if another role
+// of user within domain requires role
+func (r *RBAC) RemoveRoleInDomainContext(ctx context.Context, system, uid, domain, role string) error {
+	u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	held := u.InDomain(domain).Roles
+	if err = u.RemoveInDomain(domain, model.ListRoles, role); err != nil {
+		return err
+	}
+	if err = r.checkConstraints(ctx, system, uid, held, u.InDomain(domain).Roles); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.RemoveInDomainContext(ctx, system, uid, domain, model.ListRoles, role)
+}
+
+// AddToWhiteListInDomain grant permissions to user within domain only
+func (r *RBAC) AddToWhiteListInDomain(system, uid, domain string, permissions ...string) error {
+	return r.AddToWhiteListInDomainContext(context.Background(), system, uid, domain, permissions...)
+}
+
+// AddToWhiteListInDomainContext is AddToWhiteListInDomain with context
+func (r *RBAC) AddToWhiteListInDomainContext(ctx context.Context, system, uid, domain string, permissions ...string) error {
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.addInDomain(ctx, system, uid, domain, model.ListWhiteList, permissions...)
+}
+
+// RemoveFromWhiteListInDomain remove permission whitelisted within domain
+func (r *RBAC) RemoveFromWhiteListInDomain(system, uid, domain, permission string) error {
+	return r.RemoveFromWhiteListInDomainContext(context.Background(), system, uid, domain, permission)
+}
+
+// RemoveFromWhiteListInDomainContext is RemoveFromWhiteListInDomain with context
+func (r *RBAC) RemoveFromWhiteListInDomainContext(ctx context.Context, system, uid, domain, permission string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.RemoveInDomainContext(ctx, system, uid, domain, model.ListWhiteList, permission)
+}
+
+// AddToBlackListInDomain forbid permissions to user within domain only
+func (r *RBAC) AddToBlackListInDomain(system, uid, domain string, permissions ...string) error {
+	return r.AddToBlackListInDomainContext(context.Background(), system, uid, domain, permissions...)
+}
+
+// AddToBlackListInDomainContext is AddToBlackListInDomain with context
+func (r *RBAC) AddToBlackListInDomainContext(ctx context.Context, system, uid, domain string, permissions ...string) error {
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.addInDomain(ctx, system, uid, domain, model.ListBlackList, permissions...)
+}
+
+// RemoveFromBlackListInDomain remove permission blacklisted within domain
+func (r *RBAC) RemoveFromBlackListInDomain(system, uid, domain, permission string) error {
+	return r.RemoveFromBlackListInDomainContext(context.Background(), system, uid, domain, permission)
+}
+
+// RemoveFromBlackListInDomainContext is RemoveFromBlackListInDomain with context
+func (r *RBAC) RemoveFromBlackListInDomainContext(ctx context.Context, system, uid, domain, permission string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.RemoveInDomainContext(ctx, system, uid, domain, model.ListBlackList, permission)
+}
@@ -0,0 +1,124 @@
+package rbac
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReferenceError is returned in strict mode when a write refers to permissions or roles
+// which are not registered in the system
+type ReferenceError struct {
+	System      string
+	Permissions []string // unknown permissions
+	Roles       []string // unknown roles
+}
+
+func (e *ReferenceError) Error() string {
+	var parts []string
+	if len(e.Permissions) > 0 {
+		parts = append(parts, fmt.Sprintf("unknown permissions %v", e.Permissions))
+	}
+	if len(e.Roles) > 0 {
+		parts = append(parts, fmt.Sprintf("unknown roles %v", e.Roles))
+	}
+	return fmt.Sprintf("%s of system %s", strings.Join(parts, " and "), e.System)
+}
+
+// unknown return names not contained in known, each name is reported once
+func unknown(known map[string]bool, names []string) (res []string) {
+	for _, n := range names {
+		if !known[n] {
+			known[n] = true // report duplicates once
+			res = append(res, n)
+		}
+	}
+	return
+}
+
+// CycleError is returned when adding parents to a role would make the role inherit from itself
+type CycleError struct {
+	System string
+	Path   []string // chain of parents starting and ending with the role
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("role inheritance cycle %s of system %s", strings.Join(e.Path, " -> "), e.System)
+}
+
+// SoDError is returned when a user would hold roles which are mutually exclusive by a separation-of-duty rule,
+// or activate them together within a session for a dynamic rule
+type SoDError struct {
+	System      string
+	UID         string
+	Rule        string
+	Roles       []string // roles of rule the user would hold, inherited ones included
+	Cardinality int
+}
+
+func (e *SoDError) Error() string {
+	return fmt.Sprintf("user %s would hold roles %v, separation-of-duty rule %s of system %s allows at most %d of them",
+		e.UID, e.Roles, e.Rule, e.System, e.Cardinality-1)
+}
+
+// NotAssignedError is returned when a user activates roles within a session which are neither assigned
+// to it nor inherited by assigned roles
+type NotAssignedError struct {
+	System string
+	UID    string
+	Roles  []string
+}
+
+func (e *NotAssignedError) Error() string {
+	return fmt.Sprintf("roles %v of system %s aren't assigned to user %s", e.Roles, e.System, e.UID)
+}
+
+// PrerequisiteError is returned when a user would hold a role without the roles it requires
+type PrerequisiteError struct {
+	System  string
+	UID     string
+	Role    string
+	Missing []string // prerequisites of role the user wouldn't hold
+}
+
+func (e *PrerequisiteError) Error() string {
+	return fmt.Sprintf("role %s of system %s requires roles %v, which user %s wouldn't hold", e.Role, e.System, e.Missing, e.UID)
+}
+
+// MaxMembersError is returned when a role would be assigned to more users than it allows
+type MaxMembersError struct {
+	System     string
+	Role       string
+	MaxMembers int
+}
+
+func (e *MaxMembersError) Error() string {
+	return fmt.Sprintf("role %s of system %s may be assigned to at most %d users", e.Role, e.System, e.MaxMembers)
+}
+
+// NotDelegableError is returned when a user delegates roles it neither holds directly nor received through
+// transitive delegations
+type NotDelegableError struct {
+	System string
+	UID    string
+	Roles  []string
+}
+
+func (e *NotDelegableError) Error() string {
+	return fmt.Sprintf("roles %v of system %s can't be delegated by user %s", e.Roles, e.System, e.UID)
+}
+
+// RollbackError is returned when a change failed and undoing what it had done already failed too, e.g. removing
+// a partial copy of a system
+type RollbackError struct {
+	Err         error // error which failed the change
+	RollbackErr error // error which failed undoing it
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%v, rolling back failed: %v", e.Err, e.RollbackErr)
+}
+
+// Unwrap return the error which failed the change
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
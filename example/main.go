@@ -33,7 +33,8 @@ const (
 
 func init() {
 	conf := &rbac.RBACConfig{
-		Redis: cache.DefaultConfig(),
+		Redis:        cache.DefaultConfig(),
+		SessionRedis: &cache.RedisConfig{Address: "localhost:6379", DB: 1, MaxConn: 100, IdleTimeout: 60},
 		Mgo: &db.MgoConf{
 			Url: "localhost/test",
 		},
@@ -52,10 +53,12 @@ func main() {
 	r.RegisterPermission(system, write, "post question/answer/comment")
 	r.RegisterPermission(system, manage, "manage question and answer")
 
-	// register roles
+	// register roles, common inherits read from guest and admin inherits both from common
 	r.RegisterRole(system, guest, "", read)
-	r.RegisterRole(system, common, "", read, write)
-	r.RegisterRole(system, admin, "", read, write, manage)
+	r.RegisterRole(system, common, "", write)
+	r.RegisterRole(system, admin, "", manage)
+	r.AddParentsToRole(system, common, guest)
+	r.AddParentsToRole(system, admin, common)
 
 	// register users
 	r.RegisterUser(system, uid_guest, guest)
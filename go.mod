@@ -10,9 +10,12 @@ require (
 	github.com/imdario/mergo v0.3.8
 	github.com/kataras/iris/v12 v12.0.1
 	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/lib/pq v1.10.9
 	github.com/sirupsen/logrus v1.4.2
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.8.1
+	go.etcd.io/bbolt v1.3.9
+	go.mongodb.org/mongo-driver v1.13.4
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v9 v9.30.0
-	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+	modernc.org/sqlite v1.20.4
 )
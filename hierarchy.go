@@ -0,0 +1,97 @@
+package rbac
+
+import (
+	"sort"
+
+	"github.com/nzqpeace/rbac/model"
+)
+
+// hierarchy map name of each role to its parents
+type hierarchy map[string][]string
+
+func newHierarchy(roles []model.Role) hierarchy {
+	h := make(hierarchy)
+	for _, role := range roles {
+		h[role.Name] = role.Parents
+	}
+	return h
+}
+
+// path find a chain of parents leading from role from to role to, nil if to isn't reachable
+func (h hierarchy) path(from, to string) []string {
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if name == to {
+			res := []string{}
+			for ; name != ""; name = prev[name] {
+				res = append([]string{name}, res...)
+			}
+			return res
+		}
+
+		for _, p := range h[name] {
+			if _, ok := prev[p]; !ok {
+				prev[p] = name
+				queue = append(queue, p)
+			}
+		}
+	}
+	return nil
+}
+
+// walk collect all roles reachable from name through next in ascending order, name itself is excluded
+func walk(name string, next func(string) []string) []string {
+	visited := map[string]bool{name: true}
+	res := []string{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		for _, n := range next(queue[0]) {
+			if !visited[n] {
+				visited[n] = true
+				res = append(res, n)
+				queue = append(queue, n)
+			}
+		}
+		queue = queue[1:]
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ancestors list all roles inherited by name directly or indirectly
+func (h hierarchy) ancestors(name string) []string {
+	return walk(name, func(n string) []string {
+		return h[n]
+	})
+}
+
+// descendants list all roles inheriting name directly or indirectly
+func (h hierarchy) descendants(name string) []string {
+	children := make(map[string][]string)
+	for n, parents := range h {
+		for _, p := range parents {
+			children[p] = append(children[p], n)
+		}
+	}
+	return walk(name, func(n string) []string {
+		return children[n]
+	})
+}
+
+// expand return roles together with all roles they inherit, each role once
+func (h hierarchy) expand(roles []string) []string {
+	res := []string{}
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		for _, n := range append([]string{role}, h.ancestors(role)...) {
+			if !seen[n] {
+				seen[n] = true
+				res = append(res, n)
+			}
+		}
+	}
+	return res
+}
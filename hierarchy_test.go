@@ -0,0 +1,32 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHierarchy(t *testing.T) {
+	h := newHierarchy([]model.Role{
+		{Name: guest},
+		{Name: common, Parents: []string{guest}},
+		{Name: admin, Parents: []string{common, "auditor"}},
+		{Name: "auditor", Parents: []string{guest}},
+	})
+
+	assert.Equal(t, []string{"auditor", common, guest}, h.ancestors(admin))
+	assert.Equal(t, []string{}, h.ancestors(guest))
+	assert.Equal(t, []string{admin, "auditor", common}, h.descendants(guest))
+	assert.Equal(t, []string{}, h.descendants(admin))
+
+	assert.Equal(t, []string{admin, common, guest}, h.path(admin, guest))
+	assert.Equal(t, []string{guest}, h.path(guest, guest))
+	assert.Nil(t, h.path(guest, admin))
+
+	assert.Equal(t, []string{common, guest, "auditor"}, h.expand([]string{common, "auditor"}))
+
+	// walking a cycle terminates
+	h[guest] = []string{admin}
+	assert.Equal(t, []string{admin, "auditor", common}, h.ancestors(guest))
+}
@@ -0,0 +1,361 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Condition restrict a permission granted to a role to requests whose attributes satisfy Expr.
+// Expr is written in Go expression syntax over attributes of the request, e.g.
+// `amount < 1000 && region == user.region`. Supported are literals, true, false and nil, attributes
+// and their fields or elements, comparison, arithmetic and logical operators, and `in(x, a, b...)`
+// which report whether x equals any of the values or is an element of a single list
+type Condition struct {
+	Permission string `json:"permission" bson:"permission" validate:"required"`
+	Expr       string `json:"expr" bson:"expr" validate:"required"`
+}
+
+// ConditionError is returned when expression of a condition is malformed or unsupported
+type ConditionError struct {
+	Expr string
+	Err  error
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("invalid condition %q: %v", e.Expr, e.Err)
+}
+
+// parsed hold expressions already checked by parseCondition, so conditions are parsed once when they're set or
+// first evaluated after being loaded, not on every evaluation. conditions of roles are few and long lived
+var parsed sync.Map
+
+// Validate return *ConditionError if Expr can't be evaluated
+func (c Condition) Validate() error {
+	_, err := parseCondition(c.Expr)
+	return err
+}
+
+// Covers report whether condition apply to permission, its permission may be a wildcard
+func (c Condition) Covers(permission string) bool {
+	return MatchPermission(c.Permission, permission)
+}
+
+// Eval evaluate Expr against attrs, an error is returned if Expr is invalid, doesn't result in a
+// bool or apply operators to values of wrong types, e.g. comparing a missing attribute with a number
+func (c Condition) Eval(attrs map[string]interface{}) (bool, error) {
+	expr, err := parseCondition(c.Expr)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := eval(expr, attrs)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q result in %v instead of bool", c.Expr, v)
+	}
+	return b, nil
+}
+
+// parseCondition parse s and check it only use supported syntax, the result is shared by all conditions of s
+func parseCondition(s string) (ast.Expr, error) {
+	if expr, ok := parsed.Load(s); ok {
+		return expr.(ast.Expr), nil
+	}
+
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return nil, &ConditionError{Expr: s, Err: err}
+	}
+
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case nil, *ast.Ident, *ast.BasicLit, *ast.ParenExpr, *ast.SelectorExpr, *ast.IndexExpr:
+		case *ast.UnaryExpr:
+			if n.Op != token.NOT && n.Op != token.SUB {
+				err = fmt.Errorf("unsupported operator %s", n.Op)
+			}
+		case *ast.BinaryExpr:
+			if _, ok := binaryOps[n.Op]; !ok {
+				err = fmt.Errorf("unsupported operator %s", n.Op)
+			}
+		case *ast.CallExpr:
+			if id, ok := n.Fun.(*ast.Ident); !ok || id.Name != "in" || len(n.Args) == 0 {
+				err = fmt.Errorf("unsupported call, only in(x, values...) is allowed")
+			}
+		default:
+			err = fmt.Errorf("unsupported expression %T", n)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, &ConditionError{Expr: s, Err: err}
+	}
+	parsed.Store(s, expr)
+	return expr, nil
+}
+
+var binaryOps = map[token.Token]bool{
+	token.LAND: true, token.LOR: true,
+	token.EQL: true, token.NEQ: true, token.LSS: true, token.LEQ: true, token.GTR: true, token.GEQ: true,
+	token.ADD: true, token.SUB: true, token.MUL: true, token.QUO: true, token.REM: true,
+}
+
+// eval evaluate expr checked by parseCondition, numbers are evaluated as float64
+func eval(expr ast.Expr, attrs map[string]interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT, token.FLOAT:
+			return strconv.ParseFloat(e.Value, 64)
+		case token.STRING, token.CHAR:
+			return strconv.Unquote(e.Value)
+		}
+		return nil, fmt.Errorf("unsupported literal %s", e.Value)
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil":
+			return nil, nil
+		}
+		return attrs[e.Name], nil
+	case *ast.ParenExpr:
+		return eval(e.X, attrs)
+	case *ast.SelectorExpr:
+		x, err := eval(e.X, attrs)
+		if err != nil {
+			return nil, err
+		}
+		return field(x, e.Sel.Name)
+	case *ast.IndexExpr:
+		x, err := eval(e.X, attrs)
+		if err != nil {
+			return nil, err
+		}
+		i, err := eval(e.Index, attrs)
+		if err != nil {
+			return nil, err
+		}
+		return index(x, i)
+	case *ast.UnaryExpr:
+		x, err := eval(e.X, attrs)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == token.NOT {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, fmt.Errorf("operator ! applied to %v", x)
+			}
+			return !b, nil
+		}
+		n, ok := number(x)
+		if !ok {
+			return nil, fmt.Errorf("operator - applied to %v", x)
+		}
+		return -n, nil
+	case *ast.BinaryExpr:
+		return evalBinary(e, attrs)
+	case *ast.CallExpr:
+		return evalIn(e.Args, attrs)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+// evalBinary evaluate binary expression, && and || are short-circuit
+func evalBinary(e *ast.BinaryExpr, attrs map[string]interface{}) (interface{}, error) {
+	x, err := eval(e.X, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Op == token.LAND || e.Op == token.LOR {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s applied to %v", e.Op, x)
+		}
+		if b == (e.Op == token.LOR) {
+			return b, nil
+		}
+		y, err := eval(e.Y, attrs)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok = y.(bool); !ok {
+			return nil, fmt.Errorf("operator %s applied to %v", e.Op, y)
+		}
+		return b, nil
+	}
+
+	y, err := eval(e.Y, attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case token.EQL:
+		return equal(x, y), nil
+	case token.NEQ:
+		return !equal(x, y), nil
+	}
+
+	if a, ok := x.(string); ok {
+		b, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("operator %s applied to %q and %v", e.Op, a, y)
+		}
+		switch e.Op {
+		case token.LSS:
+			return a < b, nil
+		case token.LEQ:
+			return a <= b, nil
+		case token.GTR:
+			return a > b, nil
+		case token.GEQ:
+			return a >= b, nil
+		case token.ADD:
+			return a + b, nil
+		}
+		return nil, fmt.Errorf("operator %s applied to strings", e.Op)
+	}
+
+	a, ok := number(x)
+	b, ok2 := number(y)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("operator %s applied to %v and %v", e.Op, x, y)
+	}
+	switch e.Op {
+	case token.LSS:
+		return a < b, nil
+	case token.LEQ:
+		return a <= b, nil
+	case token.GTR:
+		return a > b, nil
+	case token.GEQ:
+		return a >= b, nil
+	case token.ADD:
+		return a + b, nil
+	case token.SUB:
+		return a - b, nil
+	case token.MUL:
+		return a * b, nil
+	case token.QUO:
+		return a / b, nil
+	}
+	return math.Mod(a, b), nil
+}
+
+// evalIn report whether first of args equals any of the others, or is an element of the only other one if it's a list
+func evalIn(args []ast.Expr, attrs map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		v, err := eval(a, attrs)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	candidates := values[1:]
+	if len(candidates) == 1 {
+		if rv := reflect.ValueOf(candidates[0]); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			candidates = nil
+			for i := 0; i < rv.Len(); i++ {
+				candidates = append(candidates, rv.Index(i).Interface())
+			}
+		}
+	}
+	for _, c := range candidates {
+		if equal(values[0], c) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// field get field of map or struct x, a missing field is nil
+func field(x interface{}, name string) (interface{}, error) {
+	if x == nil {
+		return nil, nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(x))
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key())); v.IsValid() {
+			return v.Interface(), nil
+		}
+		return nil, nil
+	case reflect.Struct:
+		if v := rv.FieldByName(name); v.IsValid() && v.CanInterface() {
+			return v.Interface(), nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("field %s of %v", name, x)
+}
+
+// index get element i of list x, or field i of map x
+func index(x, i interface{}) (interface{}, error) {
+	if s, ok := i.(string); ok {
+		return field(x, s)
+	}
+
+	rv := reflect.ValueOf(x)
+	n, ok := number(i)
+	if !ok || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return nil, fmt.Errorf("index %v of %v", i, x)
+	}
+	if n != math.Trunc(n) || n < 0 || int(n) >= rv.Len() {
+		return nil, fmt.Errorf("index %v out of range", i)
+	}
+	return rv.Index(int(n)).Interface(), nil
+}
+
+// number convert any numeric value to float64
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// equal compare numbers by value and other values as they are
+func equal(x, y interface{}) bool {
+	if a, ok := number(x); ok {
+		b, ok := number(y)
+		return ok && a == b
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCondition(t *testing.T) {
+	c := Condition{Permission: "refund", Expr: `amount < 1000 && region == user.region`}
+	assert.Nil(t, c.Validate())
+	expr, ok := parsed.Load(c.Expr)
+	assert.True(t, ok)
+	assert.True(t, c.Covers("refund"))
+	assert.False(t, c.Covers("refund:big"))
+
+	attrs := map[string]interface{}{
+		"amount": 500,
+		"region": "eu",
+		"user":   map[string]interface{}{"region": "eu"},
+	}
+	ok, err := c.Eval(attrs)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	reused, _ := parsed.Load(c.Expr)
+	assert.True(t, expr == reused, "expression is parsed once")
+
+	attrs["amount"] = 1000.0
+	ok, err = c.Eval(attrs)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// attributes decoded from json
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"amount":999.5,"region":"us","user":{"region":"us"}}`), &decoded))
+	ok, err = c.Eval(decoded)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// missing attributes can't be compared with numbers
+	_, err = c.Eval(map[string]interface{}{"region": "eu"})
+	assert.NotNil(t, err)
+	_, err = Condition{Expr: `amount + 1`}.Eval(attrs)
+	assert.NotNil(t, err)
+
+	for expr, want := range map[string]bool{
+		`in(region, "eu", "us")`:                    true,
+		`in(region, tags)`:                          false,
+		`in("a", tags)`:                             true,
+		`tags[1] == "b" && user["region"] == "eu"`:  true,
+		`!(amount >= 2000) || missing.field == nil`: true,
+		`-amount + 10 * 2 < 0 && amount % 7 == 6`:   true,
+		`name + "!" == "bob!" && name > "alice"`:    true,
+		`missing == nil && user.missing == nil`:     true,
+	} {
+		ok, err := Condition{Expr: expr}.Eval(map[string]interface{}{
+			"amount": 1000,
+			"region": "eu",
+			"name":   "bob",
+			"tags":   []string{"a", "b"},
+			"user":   map[string]string{"region": "eu"},
+		})
+		assert.Nil(t, err, expr)
+		assert.Equal(t, want, ok, expr)
+	}
+
+	for _, expr := range []string{`amount <`, `amount & 1 == 0`, `len(tags) > 0`, `func() bool { return true }()`, `x.(int) == 1`} {
+		err := Condition{Permission: "refund", Expr: expr}.Validate()
+		assert.IsType(t, &ConditionError{}, err, expr)
+		_, ok := parsed.Load(expr)
+		assert.False(t, ok, expr)
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSelfDelegation is returned when a user delegates roles to itself
+var ErrSelfDelegation = errors.New("invalid delegation, delegator and delegate must differ")
+
+// Delegation hand a subset of roles of delegator to delegate, e.g. to a deputy during leave. delegated roles count
+// as roles of delegate only within period and as long as delegator holds them
+type Delegation struct {
+	System    string   `json:"system" bson:"system" validate:"required"`
+	Delegator string   `json:"delegator" bson:"delegator" validate:"required"`
+	Delegate  string   `json:"delegate" bson:"delegate" validate:"required"`
+	Roles     []string `json:"roles" bson:"roles" validate:"required"`
+
+	// Period restricts delegation, a zero period never expires
+	Period `bson:",inline"`
+	// Transitive allows delegate to delegate the roles further
+	Transitive bool `json:"transitive" bson:"transitive"`
+
+	// Revision is increased by every change of delegation
+	Revision int64 `json:"revision" bson:"revision"`
+}
+
+func NewDelegation(system, delegator, delegate string, roles ...string) *Delegation {
+	if roles == nil {
+		roles = []string{}
+	}
+	return &Delegation{
+		System:    system,
+		Delegator: delegator,
+		Delegate:  delegate,
+		Roles:     roles,
+	}
+}
+
+// Validate return ErrSelfDelegation if delegator is delegate, or ErrInvalidPeriod if period ends before it starts
+func (d *Delegation) Validate() error {
+	if d.Delegator == d.Delegate {
+		return ErrSelfDelegation
+	}
+	return d.Period.Validate()
+}
+
+// NextChange return the bound of period after t, nil if delegation is in effect or not for ever after t
+func (d *Delegation) NextChange(t time.Time) *time.Time {
+	for _, b := range []*time.Time{d.ValidFrom, d.ExpiresAt} {
+		if b != nil && b.After(t) {
+			return b
+		}
+	}
+	return nil
+}
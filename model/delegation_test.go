@@ -0,0 +1,27 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelegation(t *testing.T) {
+	d := NewDelegation("system", "manager", "deputy", "approver")
+	assert.Nil(t, d.Validate())
+	assert.Nil(t, d.NextChange(time.Now()))
+	assert.Equal(t, ErrSelfDelegation, NewDelegation("system", "manager", "manager", "approver").Validate())
+
+	now := time.Now()
+	from, expires := now.Add(time.Hour), now.Add(2*time.Hour)
+	d.Period = Period{ValidFrom: &from, ExpiresAt: &expires}
+	assert.Nil(t, d.Validate())
+	assert.False(t, d.ActiveAt(now))
+	assert.Equal(t, &from, d.NextChange(now))
+	assert.Equal(t, &expires, d.NextChange(from))
+	assert.Nil(t, d.NextChange(expires))
+
+	d.Period = Period{ValidFrom: &expires, ExpiresAt: &from}
+	assert.Equal(t, ErrInvalidPeriod, d.Validate())
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DomainEntry is an entry of roles, whitelist or blacklist of a user which only applies within Domain
+type DomainEntry struct {
+	Domain string `json:"domain" bson:"domain"`
+	Name   string `json:"name" bson:"name"`
+	// Provenance record who assigned the entry, nil if it was added without one
+	Provenance *Provenance `json:"provenance,omitempty" bson:"provenance,omitempty"`
+}
+
+// domainList return entries of list which apply within single domains, list is one of ListRoles,
+// ListWhiteList and ListBlackList
+func (u *UserPermModel) domainList(list string) (*[]DomainEntry, error) {
+	switch list {
+	case ListRoles:
+		return &u.DomainRoles, nil
+	case ListWhiteList:
+		return &u.DomainWhiteList, nil
+	case ListBlackList:
+		return &u.DomainBlackList, nil
+	}
+	return nil, fmt.Errorf("unknown list %q", list)
+}
+
+// AddInDomain add names to list of user within domain, names already present are ignored
+func (u *UserPermModel) AddInDomain(domain, list string, names ...string) error {
+	return u.addInDomain(domain, list, nil, names...)
+}
+
+// AddInDomainWithProvenance is AddInDomain recording p as provenance of the added names, names already present
+// keep theirs
+func (u *UserPermModel) AddInDomainWithProvenance(domain, list string, p Provenance, names ...string) error {
+	return u.addInDomain(domain, list, &p, names...)
+}
+
+// addInDomain add names to list of user within domain with provenance p, names already present are ignored
+func (u *UserPermModel) addInDomain(domain, list string, p *Provenance, names ...string) error {
+	entries, err := u.domainList(list)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		e := DomainEntry{Domain: domain, Name: n}
+		if containsEntry(*entries, e) {
+			continue
+		}
+		if p != nil {
+			named := *p
+			named.Name = n
+			e.Provenance = &named
+		}
+		*entries = append(*entries, e)
+	}
+	return nil
+}
+
+// ProvenanceInDomain return provenance of entry name at list within domain, false if it's not an entry or has none
+func (u *UserPermModel) ProvenanceInDomain(domain, list, name string) (Provenance, bool) {
+	entries, err := u.domainList(list)
+	if err != nil {
+		return Provenance{}, false
+	}
+	for _, e := range *entries {
+		if e.same(DomainEntry{Domain: domain, Name: name}) && e.Provenance != nil {
+			// entries may have been renamed since
+			p := *e.Provenance
+			p.Name = e.Name
+			return p, true
+		}
+	}
+	return Provenance{}, false
+}
+
+// RemoveInDomain remove name from list of user within domain
+func (u *UserPermModel) RemoveInDomain(domain, list, name string) error {
+	entries, err := u.domainList(list)
+	if err != nil {
+		return err
+	}
+
+	res := []DomainEntry{}
+	for _, e := range *entries {
+		if !e.same(DomainEntry{Domain: domain, Name: name}) {
+			res = append(res, e)
+		}
+	}
+	*entries = res
+	return nil
+}
+
+// InDomain return a copy of user whose roles, whitelist and blacklist also contain their entries within domain,
+// entries of other domains are left out. user is returned as it is for the empty domain
+func (u UserPermModel) InDomain(domain string) UserPermModel {
+	if domain == "" {
+		return u
+	}
+
+	for _, list := range []string{ListRoles, ListWhiteList, ListBlackList} {
+		names, _, _ := u.lists(list)
+		entries, _ := u.domainList(list)
+		res := append([]string{}, *names...)
+		for _, e := range *entries {
+			if e.Domain == domain && !contains(res, e.Name) {
+				res = append(res, e.Name)
+			}
+		}
+		*names = res
+	}
+	return u
+}
+
+// Domains list domains in which user holds any entry in ascending order
+func (u *UserPermModel) Domains() []string {
+	res := []string{}
+	for _, entries := range [][]DomainEntry{u.DomainRoles, u.DomainWhiteList, u.DomainBlackList} {
+		for _, e := range entries {
+			if !contains(res, e.Domain) {
+				res = append(res, e.Domain)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// same report whether e and other are the same entry, whatever their provenance
+func (e DomainEntry) same(other DomainEntry) bool {
+	return e.Domain == other.Domain && e.Name == other.Name
+}
+
+// containsEntry report whether entries contains e
+func containsEntry(entries []DomainEntry, e DomainEntry) bool {
+	for _, v := range entries {
+		if v.same(e) {
+			return true
+		}
+	}
+	return false
+}
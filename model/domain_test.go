@@ -0,0 +1,56 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserDomains(t *testing.T) {
+	u := NewUserPermModel("system", "uid", "guest")
+	u.BlackList = []string{"delete"}
+	assert.Nil(t, u.AddInDomain("org_a", ListRoles, "admin", "guest"))
+	assert.Nil(t, u.AddInDomain("org_a", ListRoles, "admin"))
+	assert.Nil(t, u.AddInDomain("org_b", ListWhiteList, "export"))
+	assert.Nil(t, u.AddInDomain("org_b", ListBlackList, "read"))
+	assert.NotNil(t, u.AddInDomain("org_b", "unknown", "read"))
+	assert.Equal(t, []DomainEntry{{Domain: "org_a", Name: "admin"}, {Domain: "org_a", Name: "guest"}}, u.DomainRoles)
+	assert.Equal(t, []string{"org_a", "org_b"}, u.Domains())
+
+	// entries apply within their domain only, on top of those of all domains
+	a := u.InDomain("org_a")
+	assert.Equal(t, []string{"guest", "admin"}, a.Roles)
+	assert.Equal(t, []string{"delete"}, a.BlackList)
+	b := u.InDomain("org_b")
+	assert.Equal(t, []string{"guest"}, b.Roles)
+	assert.Equal(t, []string{"export"}, b.WhiteList)
+	assert.Equal(t, []string{"delete", "read"}, b.BlackList)
+	assert.Equal(t, []string{"guest"}, u.InDomain("").Roles)
+	assert.Equal(t, []string{"guest"}, u.Roles)
+	assert.Equal(t, []string{"delete"}, u.BlackList)
+
+	assert.Nil(t, u.RemoveInDomain("org_a", ListRoles, "admin"))
+	assert.Nil(t, u.RemoveInDomain("org_b", ListRoles, "guest"))
+	assert.Equal(t, []DomainEntry{{Domain: "org_a", Name: "guest"}}, u.DomainRoles)
+	assert.Nil(t, u.RemoveInDomain("org_b", ListWhiteList, "export"))
+	assert.Nil(t, u.RemoveInDomain("org_b", ListBlackList, "read"))
+	assert.Equal(t, []string{"org_a"}, u.Domains())
+
+	// entries within domains record their provenance, entries already present keep theirs
+	now := time.Now().UTC().Truncate(time.Second)
+	p := Provenance{GrantedBy: "alice", GrantedAt: now, Reason: "audit"}
+	assert.Nil(t, u.AddInDomainWithProvenance("org_b", ListRoles, p, "auditor"))
+	assert.Nil(t, u.AddInDomainWithProvenance("org_b", ListRoles, Provenance{GrantedBy: "bob"}, "auditor"))
+	assert.NotNil(t, u.AddInDomainWithProvenance("org_b", "unknown", p, "read"))
+	got, ok := u.ProvenanceInDomain("org_b", ListRoles, "auditor")
+	assert.True(t, ok)
+	assert.Equal(t, Provenance{Name: "auditor", GrantedBy: "alice", GrantedAt: now, Reason: "audit"}, got)
+	_, ok = u.ProvenanceInDomain("org_a", ListRoles, "auditor")
+	assert.False(t, ok)
+	_, ok = u.ProvenanceInDomain("org_a", ListRoles, "guest")
+	assert.False(t, ok)
+	assert.Nil(t, u.RemoveInDomain("org_b", ListRoles, "auditor"))
+	_, ok = u.ProvenanceInDomain("org_b", ListRoles, "auditor")
+	assert.False(t, ok)
+}
@@ -0,0 +1,29 @@
+package model
+
+// Group carries roles which are assigned to all its members
+type Group struct {
+	System string `json:"system" bson:"system" validate:"required"`
+	Name   string `json:"name" bson:"name" validate:"required"`
+	Desc   string `json:"desc" bson:"desc"`
+
+	// Roles are assigned to every member of group
+	Roles []string `json:"roles" bson:"roles"`
+	// Members are uids of users belonging to group, they needn't be registered
+	Members []string `json:"members" bson:"members"`
+
+	// Revision is increased by every change of group
+	Revision int64 `json:"revision" bson:"revision"`
+}
+
+func NewGroup(system, name, desc string, roles ...string) *Group {
+	if roles == nil {
+		roles = []string{}
+	}
+	return &Group{
+		System:  system,
+		Name:    name,
+		Desc:    desc,
+		Roles:   roles,
+		Members: []string{},
+	}
+}
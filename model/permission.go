@@ -1,8 +1,44 @@
 package model
 
+import "strings"
+
+const (
+	// Wildcard as the last segment of a permission name matches all names below the preceding segments,
+	// e.g. `article:*` or `billing.invoice.*`, a single `*` matches every name
+	Wildcard = "*"
+
+	// separators of segments of a permission name
+	separators = ":."
+)
+
 // Permission exports `Name` `Tag` `Desc`
 type Permission struct {
 	System string `json:"system" bson:"system" validate:"required"`
 	Name   string `json:"name" bson:"name" validate:"required"`
 	Desc   string `json:"desc" bson:"desc"`
 }
+
+func isSeparator(c byte) bool {
+	return strings.IndexByte(separators, c) >= 0
+}
+
+// IsWildcard report whether name is a wildcard pattern rather than a plain permission name
+func IsWildcard(name string) bool {
+	n := len(name)
+	return name == Wildcard || (n >= 2 && name[n-1] == '*' && isSeparator(name[n-2]))
+}
+
+// MatchPermission report whether name is covered by pattern, a plain pattern only covers itself
+// while a wildcard covers every name with at least one more segment, e.g. `article:*` matches
+// `article:read` and `article:comment:delete` but not `article`
+func MatchPermission(pattern, name string) bool {
+	if pattern == name {
+		return true
+	}
+	if !IsWildcard(pattern) {
+		return false
+	}
+
+	prefix := strings.TrimSuffix(pattern, Wildcard)
+	return len(name) > len(prefix) && strings.HasPrefix(name, prefix)
+}
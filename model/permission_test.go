@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsWildcard(t *testing.T) {
+	for _, name := range []string{"*", "article:*", "billing.invoice.*", "a:b.*"} {
+		assert.True(t, IsWildcard(name), name)
+	}
+	for _, name := range []string{"", "read", "article:read", "article*", "article:*:read"} {
+		assert.False(t, IsWildcard(name), name)
+	}
+}
+
+func TestMatchPermission(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"read", "read", true},
+		{"read", "reader", false},
+		{"*", "read", true},
+		{"*", "article:read", true},
+		{"article:*", "article:read", true},
+		{"article:*", "article:comment:delete", true},
+		{"article:*", "article", false},
+		{"article:*", "article:", false},
+		{"article:*", "articles:read", false},
+		{"article:*", "article.read", false},
+		{"billing.invoice.*", "billing.invoice.create", true},
+		{"billing.invoice.*", "billing.refund", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, MatchPermission(c.pattern, c.name), c.pattern+" "+c.name)
+	}
+}
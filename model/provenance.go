@@ -0,0 +1,79 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Provenance record who assigned an entry of roles, whitelist or blacklist to a user, when and why
+type Provenance struct {
+	Name      string    `json:"name" bson:"name"`
+	GrantedBy string    `json:"granted_by" bson:"granted_by"`
+	GrantedAt time.Time `json:"granted_at" bson:"granted_at"`
+	Reason    string    `json:"reason" bson:"reason"`
+	// Ticket refer to a change request or issue approving the assignment
+	Ticket string `json:"ticket" bson:"ticket"`
+}
+
+// provenance return entries and their provenance of list, which is one of ListRoles, ListWhiteList and ListBlackList
+func (u *UserPermModel) provenance(list string) (*[]string, *[]Provenance, error) {
+	switch list {
+	case ListRoles:
+		return &u.Roles, &u.RoleProvenance, nil
+	case ListWhiteList:
+		return &u.WhiteList, &u.WhiteListProvenance, nil
+	case ListBlackList:
+		return &u.BlackList, &u.BlackListProvenance, nil
+	}
+	return nil, nil, fmt.Errorf("unknown list %q", list)
+}
+
+// SetProvenance record p as provenance of names at list, replacing their former one. names needn't be
+// entries of list yet
+func (u *UserPermModel) SetProvenance(list string, p Provenance, names ...string) error {
+	_, provenance, err := u.provenance(list)
+	if err != nil {
+		return err
+	}
+
+	res := []Provenance{}
+	for _, e := range *provenance {
+		if !contains(names, e.Name) {
+			res = append(res, e)
+		}
+	}
+	for _, n := range names {
+		p.Name = n
+		res = append(res, p)
+	}
+	*provenance = res
+	return nil
+}
+
+// ProvenanceOf return provenance of entry name at list, false if it's not an entry or has none
+func (u *UserPermModel) ProvenanceOf(list, name string) (Provenance, bool) {
+	entries, provenance, err := u.provenance(list)
+	if err != nil || !contains(*entries, name) {
+		return Provenance{}, false
+	}
+	for _, p := range *provenance {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Provenance{}, false
+}
+
+// PruneProvenance drop provenance of names which are no longer entries of their lists
+func (u *UserPermModel) PruneProvenance() {
+	for _, list := range []string{ListRoles, ListWhiteList, ListBlackList} {
+		entries, provenance, _ := u.provenance(list)
+		res := []Provenance{}
+		for _, p := range *provenance {
+			if contains(*entries, p.Name) {
+				res = append(res, p)
+			}
+		}
+		*provenance = res
+	}
+}
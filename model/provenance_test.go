@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserProvenance(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	u := NewUserPermModel("system", "uid", "admin", "guest")
+	p := Provenance{GrantedBy: "alice", GrantedAt: now, Reason: "on call", Ticket: "OPS-1"}
+	assert.Nil(t, u.SetProvenance(ListRoles, p, "admin", "guest"))
+	assert.NotNil(t, u.SetProvenance("unknown", p, "admin"))
+
+	got, ok := u.ProvenanceOf(ListRoles, "admin")
+	assert.True(t, ok)
+	assert.Equal(t, Provenance{Name: "admin", GrantedBy: "alice", GrantedAt: now, Reason: "on call", Ticket: "OPS-1"}, got)
+	_, ok = u.ProvenanceOf(ListWhiteList, "admin")
+	assert.False(t, ok)
+
+	// a later assignment replaces provenance
+	assert.Nil(t, u.SetProvenance(ListRoles, Provenance{GrantedBy: "bob", GrantedAt: now}, "guest"))
+	got, _ = u.ProvenanceOf(ListRoles, "guest")
+	assert.Equal(t, "bob", got.GrantedBy)
+	assert.Len(t, u.RoleProvenance, 2)
+
+	// provenance of removed entries is ignored and pruned
+	u.Roles = []string{"guest"}
+	_, ok = u.ProvenanceOf(ListRoles, "admin")
+	assert.False(t, ok)
+	u.PruneProvenance()
+	assert.Equal(t, []Provenance{{Name: "guest", GrantedBy: "bob", GrantedAt: now}}, u.RoleProvenance)
+}
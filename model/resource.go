@@ -0,0 +1,43 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Resource identify a specific object of a system, e.g. document 42
+type Resource struct {
+	Type string `json:"type" bson:"type" validate:"required"`
+	ID   string `json:"id" bson:"id" validate:"required"`
+}
+
+// ParseResource parse resource formatted as `type/id`, id may contain further slashes
+func ParseResource(s string) (Resource, error) {
+	i := strings.Index(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return Resource{}, fmt.Errorf("invalid resource %q, expect type/id", s)
+	}
+	return Resource{Type: s[:i], ID: s[i+1:]}, nil
+}
+
+func (r Resource) String() string {
+	return r.Type + "/" + r.ID
+}
+
+// Grant is a permission scoped to resources, ID of its resource may be a pattern
+// as understood by path.Match, e.g. `*` or `2019-*`
+type Grant struct {
+	Permission string   `json:"permission" bson:"permission" validate:"required"`
+	Resource   Resource `json:"resource" bson:"resource" validate:"required"`
+}
+
+// Covers report whether grant permit permission on resource
+func (g Grant) Covers(permission string, resource Resource) bool {
+	if g.Resource.Type != resource.Type || !MatchPermission(g.Permission, permission) {
+		return false
+	}
+
+	matched, err := path.Match(g.Resource.ID, resource.ID)
+	return err == nil && matched
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResource(t *testing.T) {
+	r, err := ParseResource("document/42")
+	assert.Nil(t, err)
+	assert.Equal(t, Resource{Type: "document", ID: "42"}, r)
+	assert.Equal(t, "document/42", r.String())
+
+	r, err = ParseResource("file/home/readme.md")
+	assert.Nil(t, err)
+	assert.Equal(t, Resource{Type: "file", ID: "home/readme.md"}, r)
+
+	for _, s := range []string{"", "document", "/42", "document/"} {
+		_, err = ParseResource(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestGrantCovers(t *testing.T) {
+	g := Grant{Permission: "edit", Resource: Resource{Type: "document", ID: "42"}}
+	assert.True(t, g.Covers("edit", Resource{"document", "42"}))
+	assert.False(t, g.Covers("edit", Resource{"document", "43"}))
+	assert.False(t, g.Covers("edit", Resource{"folder", "42"}))
+	assert.False(t, g.Covers("delete", Resource{"document", "42"}))
+
+	g = Grant{Permission: "article:*", Resource: Resource{Type: "document", ID: "2019-*"}}
+	assert.True(t, g.Covers("article:edit", Resource{"document", "2019-07"}))
+	assert.False(t, g.Covers("article:edit", Resource{"document", "2020-01"}))
+	assert.False(t, g.Covers("edit", Resource{"document", "2019-07"}))
+
+	// malformed pattern match nothing
+	g = Grant{Permission: "edit", Resource: Resource{Type: "document", ID: "[4"}}
+	assert.False(t, g.Covers("edit", Resource{"document", "[4"}))
+}
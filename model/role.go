@@ -1,11 +1,35 @@
 package model
 
+import "errors"
+
+// ErrInvalidMaxMembers is returned when max members of a role is negative
+var ErrInvalidMaxMembers = errors.New("invalid max members, it must not be negative")
+
 // Role contains multi-permission
 type Role struct {
 	System      string   `json:"system" bson:"system" validate:"required"`
 	Name        string   `json:"name" bson:"name" validate:"required"`
 	Desc        string   `json:"desc" bson:"desc"`
 	Permissions []string `json:"permissions" bson:"permissions" validate:"required"`
+
+	// Denied are permissions taken away from every user holding the role, they beat permissions granted by
+	// any role and by whitelist of user, wildcards are allowed
+	Denied []string `json:"denied" bson:"denied"`
+
+	// Conditions are permissions granted only to requests whose attributes satisfy their expression,
+	// each permission has one condition at most
+	Conditions []Condition `json:"conditions" bson:"conditions"`
+
+	// Parents are roles whose permissions are inherited by this role
+	Parents []string `json:"parents" bson:"parents"`
+
+	// MaxMembers is the most users the role may be assigned to directly, 0 means unlimited
+	MaxMembers int `json:"max_members" bson:"max_members"`
+	// Prerequisites are roles a user must hold, directly or by inheritance, before being assigned this role
+	Prerequisites []string `json:"prerequisites" bson:"prerequisites"`
+
+	// Revision is increased by every change of role, it's used for optimistic concurrency control
+	Revision int64 `json:"revision" bson:"revision"`
 }
 
 func NewRole(system, name, desc string, permissions ...string) *Role {
@@ -14,5 +38,10 @@ func NewRole(system, name, desc string, permissions ...string) *Role {
 		Name:        name,
 		Desc:        desc,
 		Permissions: permissions,
+		Parents:     []string{},
+		Denied:      []string{},
+		Conditions:  []Condition{},
+
+		Prerequisites: []string{},
 	}
 }
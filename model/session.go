@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Session is a subset of roles assigned to a user which it has activated, permissions checked
+// within a session come only from its active roles. sessions are kept in cache until they expire
+type Session struct {
+	ID        string    `json:"id"`
+	System    string    `json:"system"`
+	UID       string    `json:"uid"`
+	Roles     []string  `json:"roles"` // active roles
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewSession(system, uid string, expiresAt time.Time, roles ...string) *Session {
+	if roles == nil {
+		roles = []string{}
+	}
+	return &Session{
+		System:    system,
+		UID:       uid,
+		Roles:     roles,
+		ExpiresAt: expiresAt,
+	}
+}
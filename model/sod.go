@@ -0,0 +1,62 @@
+package model
+
+import "errors"
+
+// ErrInvalidCardinality is returned when cardinality of a separation-of-duty rule is out of range
+var ErrInvalidCardinality = errors.New("invalid cardinality, it must be at least 2 and at most the number of roles")
+
+// SoDRule is a separation-of-duty rule, no user may hold Cardinality or more of its roles.
+// A rule of two roles and cardinality 2 makes them mutually exclusive. A static rule restricts roles
+// assigned to users, a dynamic one only restricts roles activated together within a session
+type SoDRule struct {
+	System      string   `json:"system" bson:"system" validate:"required"`
+	Name        string   `json:"name" bson:"name" validate:"required"`
+	Desc        string   `json:"desc" bson:"desc"`
+	Roles       []string `json:"roles" bson:"roles" validate:"required"`
+	Cardinality int      `json:"cardinality" bson:"cardinality"`
+	Dynamic     bool     `json:"dynamic" bson:"dynamic"`
+
+	// Revision is increased by every change of rule
+	Revision int64 `json:"revision" bson:"revision"`
+}
+
+func NewSoDRule(system, name, desc string, cardinality int, roles ...string) *SoDRule {
+	if roles == nil {
+		roles = []string{}
+	}
+	return &SoDRule{
+		System:      system,
+		Name:        name,
+		Desc:        desc,
+		Roles:       roles,
+		Cardinality: cardinality,
+	}
+}
+
+// Validate return ErrInvalidCardinality if rule can never be violated or is violated by any single role
+func (r *SoDRule) Validate() error {
+	distinct := []string{}
+	for _, role := range r.Roles {
+		if !contains(distinct, role) {
+			distinct = append(distinct, role)
+		}
+	}
+	if r.Cardinality < 2 || r.Cardinality > len(distinct) {
+		return ErrInvalidCardinality
+	}
+	return nil
+}
+
+// Violated return roles of rule within held if they reach cardinality, nil otherwise
+func (r *SoDRule) Violated(held []string) []string {
+	res := []string{}
+	for _, role := range r.Roles {
+		if contains(held, role) && !contains(res, role) {
+			res = append(res, role)
+		}
+	}
+	if len(res) < r.Cardinality {
+		return nil
+	}
+	return res
+}
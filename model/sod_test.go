@@ -0,0 +1,21 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoDRule(t *testing.T) {
+	rule := NewSoDRule("system", "payment", "", 2, "requester", "approver", "auditor")
+	assert.Nil(t, rule.Validate())
+	assert.Nil(t, rule.Violated([]string{"requester", "guest"}))
+	assert.Equal(t, []string{"requester", "approver"}, rule.Violated([]string{"approver", "requester"}))
+
+	rule.Cardinality = 3
+	assert.Nil(t, rule.Violated([]string{"approver", "requester"}))
+	assert.Len(t, rule.Violated([]string{"approver", "requester", "auditor"}), 3)
+
+	assert.Equal(t, ErrInvalidCardinality, NewSoDRule("system", "payment", "", 1, "requester", "approver").Validate())
+	assert.Equal(t, ErrInvalidCardinality, NewSoDRule("system", "payment", "", 2, "requester", "requester").Validate())
+}
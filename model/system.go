@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// System is an application whose permissions, roles, users and groups are managed by rbac, they refer to it
+// by name. Registering a system is optional, it records who owns the system and arbitrary metadata about it
+type System struct {
+	Name string `json:"name" bson:"name" validate:"required"`
+	Desc string `json:"desc" bson:"desc"`
+
+	// Owners are uids of people responsible for system
+	Owners   []string          `json:"owners" bson:"owners"`
+	Metadata map[string]string `json:"metadata" bson:"metadata"`
+
+	// DefaultRoles are held by users of system which aren't registered, e.g. "anonymous"
+	DefaultRoles []string `json:"default_roles" bson:"default_roles"`
+	// AutoRegister register unknown users with DefaultRoles when their permissions are checked first
+	AutoRegister bool `json:"auto_register" bson:"auto_register"`
+
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+
+	// Revision is increased by every change of system
+	Revision int64 `json:"revision" bson:"revision"`
+}
+
+func NewSystem(name, desc string, owners ...string) *System {
+	if owners == nil {
+		owners = []string{}
+	}
+	return &System{
+		Name:         name,
+		Desc:         desc,
+		Owners:       owners,
+		Metadata:     map[string]string{},
+		DefaultRoles: []string{},
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+}
@@ -6,6 +6,30 @@ type UserPermModel struct {
 	Roles     []string `json:"roles" bson:"roles" validate:"required"`
 	BlackList []string `json:"blacklist" bson:"blacklist"`
 	WhiteList []string `json:"whitelist" bson:"whitelist"`
+
+	// Grants are permissions on specific resources only
+	Grants []Grant `json:"grants" bson:"grants"`
+
+	// RoleWindows, WhiteListWindows and BlackListWindows restrict entries of roles, whitelist and blacklist
+	// to a period, entries without window are permanent
+	RoleWindows      []Window `json:"role_windows" bson:"role_windows"`
+	WhiteListWindows []Window `json:"whitelist_windows" bson:"whitelist_windows"`
+	BlackListWindows []Window `json:"blacklist_windows" bson:"blacklist_windows"`
+
+	// DomainRoles, DomainWhiteList and DomainBlackList hold entries which only apply within one domain of
+	// system, e.g. an organization of a tenant. entries above apply within all domains
+	DomainRoles     []DomainEntry `json:"domain_roles" bson:"domain_roles"`
+	DomainWhiteList []DomainEntry `json:"domain_whitelist" bson:"domain_whitelist"`
+	DomainBlackList []DomainEntry `json:"domain_blacklist" bson:"domain_blacklist"`
+
+	// RoleProvenance, WhiteListProvenance and BlackListProvenance record who assigned entries of roles, whitelist
+	// and blacklist, entries assigned directly through store have none
+	RoleProvenance      []Provenance `json:"role_provenance" bson:"role_provenance"`
+	WhiteListProvenance []Provenance `json:"whitelist_provenance" bson:"whitelist_provenance"`
+	BlackListProvenance []Provenance `json:"blacklist_provenance" bson:"blacklist_provenance"`
+
+	// Revision is increased by every change of user, it's used for optimistic concurrency control
+	Revision int64 `json:"revision" bson:"revision"`
 }
 
 func NewUserPermModel(system, uid string, roles ...string) *UserPermModel {
@@ -15,5 +39,18 @@ func NewUserPermModel(system, uid string, roles ...string) *UserPermModel {
 		Roles:     roles,
 		BlackList: []string{},
 		WhiteList: []string{},
+		Grants:    []Grant{},
+
+		RoleWindows:      []Window{},
+		WhiteListWindows: []Window{},
+		BlackListWindows: []Window{},
+
+		DomainRoles:     []DomainEntry{},
+		DomainWhiteList: []DomainEntry{},
+		DomainBlackList: []DomainEntry{},
+
+		RoleProvenance:      []Provenance{},
+		WhiteListProvenance: []Provenance{},
+		BlackListProvenance: []Provenance{},
 	}
 }
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// lists of a user whose entries may be restricted to a period by windows
+const (
+	ListRoles     = "roles"
+	ListWhiteList = "whitelist"
+	ListBlackList = "blacklist"
+)
+
+// ErrInvalidPeriod is returned when a period ends before it starts
+var ErrInvalidPeriod = errors.New("invalid period, expires_at must be after valid_from")
+
+// Period is the time an entry is effective, a nil bound is open
+type Period struct {
+	ValidFrom *time.Time `json:"valid_from,omitempty" bson:"valid_from,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// IsZero report whether both bounds are open, i.e. entries are permanent
+func (p Period) IsZero() bool {
+	return p.ValidFrom == nil && p.ExpiresAt == nil
+}
+
+// Validate return ErrInvalidPeriod if period ends before it starts
+func (p Period) Validate() error {
+	if p.ValidFrom != nil && p.ExpiresAt != nil && !p.ExpiresAt.After(*p.ValidFrom) {
+		return ErrInvalidPeriod
+	}
+	return nil
+}
+
+// ActiveAt report whether t is within period, valid_from is inclusive and expires_at is exclusive
+func (p Period) ActiveAt(t time.Time) bool {
+	return (p.ValidFrom == nil || !t.Before(*p.ValidFrom)) && !p.ExpiredAt(t)
+}
+
+// ExpiredAt report whether period has ended at t
+func (p Period) ExpiredAt(t time.Time) bool {
+	return p.ExpiresAt != nil && !t.Before(*p.ExpiresAt)
+}
+
+// Window restricts an entry of roles, whitelist or blacklist of a user to a period
+type Window struct {
+	Name   string `json:"name" bson:"name"`
+	Period `bson:",inline"`
+}
+
+// lists return entries and windows of list, which is one of ListRoles, ListWhiteList and ListBlackList
+func (u *UserPermModel) lists(list string) (*[]string, *[]Window, error) {
+	switch list {
+	case ListRoles:
+		return &u.Roles, &u.RoleWindows, nil
+	case ListWhiteList:
+		return &u.WhiteList, &u.WhiteListWindows, nil
+	case ListBlackList:
+		return &u.BlackList, &u.BlackListWindows, nil
+	}
+	return nil, nil, fmt.Errorf("unknown list %q", list)
+}
+
+// AddWithin add names to list of user and restrict them to period, names already present get
+// the new period, a zero period makes them permanent
+func (u *UserPermModel) AddWithin(list string, period Period, names ...string) error {
+	entries, windows, err := u.lists(list)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		if !contains(*entries, n) {
+			*entries = append(*entries, n)
+		}
+	}
+	res := []Window{}
+	for _, w := range *windows {
+		if !contains(names, w.Name) {
+			res = append(res, w)
+		}
+	}
+	if !period.IsZero() {
+		for _, n := range names {
+			res = append(res, Window{Name: n, Period: period})
+		}
+	}
+	*windows = res
+	return nil
+}
+
+// EffectiveAt return a copy of user without entries which aren't active at t
+func (u UserPermModel) EffectiveAt(t time.Time) UserPermModel {
+	for _, list := range []string{ListRoles, ListWhiteList, ListBlackList} {
+		entries, windows, _ := u.lists(list)
+		res := []string{}
+		for _, e := range *entries {
+			if w, ok := findWindow(*windows, e); !ok || w.ActiveAt(t) {
+				res = append(res, e)
+			}
+		}
+		*entries = res
+	}
+	return u
+}
+
+// NextChange return the earliest bound of windows after t, nil if the effective entries never change
+func (u *UserPermModel) NextChange(t time.Time) *time.Time {
+	var next *time.Time
+	for _, windows := range [][]Window{u.RoleWindows, u.WhiteListWindows, u.BlackListWindows} {
+		for _, w := range windows {
+			for _, b := range []*time.Time{w.ValidFrom, w.ExpiresAt} {
+				if b != nil && b.After(t) && (next == nil || b.Before(*next)) {
+					next = b
+				}
+			}
+		}
+	}
+	return next
+}
+
+// RemoveExpired remove entries whose window has ended at t together with the window, report whether user is changed
+func (u *UserPermModel) RemoveExpired(t time.Time) (changed bool) {
+	for _, list := range []string{ListRoles, ListWhiteList, ListBlackList} {
+		entries, windows, _ := u.lists(list)
+		expired := []string{}
+		kept := []Window{}
+		for _, w := range *windows {
+			if w.ExpiredAt(t) {
+				expired = append(expired, w.Name)
+			} else {
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) == len(*windows) {
+			continue
+		}
+
+		res := []string{}
+		for _, e := range *entries {
+			if !contains(expired, e) {
+				res = append(res, e)
+			}
+		}
+		*entries, *windows = res, kept
+		changed = true
+	}
+	return
+}
+
+// findWindow return window of name
+func findWindow(windows []Window, name string) (Window, bool) {
+	for _, w := range windows {
+		if w.Name == name {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
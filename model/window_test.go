@@ -0,0 +1,56 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriod(t *testing.T) {
+	now := time.Now()
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	assert.True(t, Period{}.IsZero())
+	assert.True(t, Period{}.ActiveAt(now))
+	assert.True(t, Period{ValidFrom: &before, ExpiresAt: &after}.ActiveAt(now))
+	assert.False(t, Period{ValidFrom: &after}.ActiveAt(now))
+	assert.False(t, Period{ExpiresAt: &before}.ActiveAt(now))
+	assert.True(t, Period{ExpiresAt: &now}.ExpiredAt(now))
+	assert.False(t, Period{ValidFrom: &after}.ExpiredAt(now))
+
+	assert.Nil(t, Period{ValidFrom: &before, ExpiresAt: &after}.Validate())
+	assert.Equal(t, ErrInvalidPeriod, Period{ValidFrom: &after, ExpiresAt: &before}.Validate())
+}
+
+func TestUserWindows(t *testing.T) {
+	now := time.Now()
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	u := NewUserPermModel("system", "uid", "admin")
+	assert.Nil(t, u.AddWithin(ListRoles, Period{ExpiresAt: &before}, "guest"))
+	assert.Nil(t, u.AddWithin(ListWhiteList, Period{ValidFrom: &after}, "read"))
+	assert.Nil(t, u.AddWithin(ListBlackList, Period{ExpiresAt: &after}, "write"))
+	assert.NotNil(t, u.AddWithin("unknown", Period{}, "read"))
+	assert.Equal(t, []string{"admin", "guest"}, u.Roles)
+
+	e := u.EffectiveAt(now)
+	assert.Equal(t, []string{"admin"}, e.Roles)
+	assert.Equal(t, []string{}, e.WhiteList)
+	assert.Equal(t, []string{"write"}, e.BlackList)
+	assert.Equal(t, []string{"admin", "guest"}, u.Roles)
+	assert.Equal(t, &after, u.NextChange(now))
+	assert.Nil(t, u.NextChange(after))
+
+	assert.True(t, u.RemoveExpired(now))
+	assert.Equal(t, []string{"admin"}, u.Roles)
+	assert.Equal(t, []Window{}, u.RoleWindows)
+	assert.Len(t, u.WhiteListWindows, 1)
+	assert.False(t, u.RemoveExpired(now))
+
+	// a zero period makes entries permanent
+	assert.Nil(t, u.AddWithin(ListWhiteList, Period{}, "read"))
+	assert.Equal(t, []string{"read"}, u.WhiteList)
+	assert.Equal(t, []Window{}, u.WhiteListWindows)
+	assert.Equal(t, []string{"read"}, u.EffectiveAt(now).WhiteList)
+}
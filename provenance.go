@@ -0,0 +1,98 @@
+package rbac
+
+import (
+	"context"
+	"time"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+type provenanceKey struct{}
+
+// WithProvenance return a copy of ctx carrying p, roles, whitelisted and blacklisted permissions assigned to users
+// with it record p as their provenance, see model.Provenance. Name of p is ignored, a zero GrantedAt means the time
+// of assignment. entries assigned without it only record when they were assigned
+func WithProvenance(ctx context.Context, p model.Provenance) context.Context {
+	return context.WithValue(ctx, provenanceKey{}, p)
+}
+
+// provenanceOf return provenance carried by ctx, stamped with now if it has no time
+func provenanceOf(ctx context.Context) model.Provenance {
+	p, _ := ctx.Value(provenanceKey{}).(model.Provenance)
+	if p.GrantedAt.IsZero() {
+		p.GrantedAt = time.Now()
+	}
+	return p
+}
+
+// modifyUser apply fn to user and store it by one write, so that entries are never stored without their
+// provenance. fn is applied again to the fresh user if user was changed meanwhile
+func (r *RBAC) modifyUser(ctx context.Context, system, uid string, fn func(u *model.UserPermModel) error) error {
+	for {
+		u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+		if err != nil {
+			return err
+		}
+		if err = fn(&u); err != nil {
+			return err
+		}
+		if err = r.User.UpdateUserPermModelIfMatchContext(ctx, &u, u.Revision); err != db.ErrConflict {
+			return err
+		}
+	}
+}
+
+// addWithin add names to list of user within period, recording provenance carried by ctx as theirs
+func (r *RBAC) addWithin(ctx context.Context, system, uid, list string, period model.Period, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	p := provenanceOf(ctx)
+	return r.modifyUser(ctx, system, uid, func(u *model.UserPermModel) error {
+		if err := u.AddWithin(list, period, names...); err != nil {
+			return err
+		}
+		return u.SetProvenance(list, p, names...)
+	})
+}
+
+// addInDomain add names to list of user within domain, recording provenance carried by ctx as theirs
+func (r *RBAC) addInDomain(ctx context.Context, system, uid, domain, list string, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	p := provenanceOf(ctx)
+	return r.modifyUser(ctx, system, uid, func(u *model.UserPermModel) error {
+		return u.AddInDomainWithProvenance(domain, list, p, names...)
+	})
+}
+
+// replacedProvenance return provenance of names replacing held entries, names already held keep their provenance
+// from old, the others get the one carried by ctx
+func replacedProvenance(ctx context.Context, held []string, old []model.Provenance, names []string) []model.Provenance {
+	p := provenanceOf(ctx)
+	res := []model.Provenance{}
+	seen := []string{}
+	for _, n := range names {
+		if contains(seen, n) {
+			continue
+		}
+		seen = append(seen, n)
+
+		if !contains(held, n) {
+			p.Name = n
+			res = append(res, p)
+			continue
+		}
+		for _, o := range old {
+			if o.Name == n {
+				res = append(res, o)
+				break
+			}
+		}
+	}
+	return res
+}
@@ -1,207 +1,1176 @@
 package rbac
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/nzqpeace/rbac/cache"
 	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/db/kvstore"
+	"github.com/nzqpeace/rbac/db/sqlstore"
 	"github.com/nzqpeace/rbac/model"
 )
 
 // RBAC entry of rbac system
 type RBAC struct {
 	Cache      *cache.PermissionDao
-	Permission *db.PermissionDao
-	Role       *db.RoleDao
-	User       *db.UserDao
+	Session    *cache.SessionDao
+	Permission db.PermissionStore
+	Role       db.RoleStore
+	User       db.UserStore
+	Group      db.GroupStore
+	Constraint db.ConstraintStore
+	System     db.SystemStore
+	Delegation db.DelegationStore
+
+	// Strict reject writes referring to unknown permissions or roles
+	Strict bool
 }
 
 // NewRBAC create a new instance
 func NewRBAC(config *RBACConfig) (rbac *RBAC, err error) {
-	r := cache.NewRedis(config.Redis)
-	d, err := db.Init(config.Mgo)
+	sessionRedis, err := newSessionRedis(config)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newStore(config)
 	if err != nil {
 		return nil, err
 	}
 
+	var backend cache.Backend = cache.NewMemory()
+	if config.Redis != nil {
+		backend = cache.NewRedis(config.Redis)
+	}
+	var sessions cache.Backend = cache.NewMemory()
+	if sessionRedis != nil {
+		sessions = cache.NewRedis(sessionRedis)
+	}
+
+	permissions := cache.NewPermissionDao(backend, store)
+	if config.NegativeTTL != 0 {
+		permissions.NegativeTTL = config.NegativeTTL
+	}
+
 	rbac = &RBAC{
-		Cache:      cache.NewPermissionDao(r, d),
-		Permission: db.NewPermissionDao(d),
-		Role:       db.NewRoleDao(d),
-		User:       db.NewUserDao(d),
+		Cache:      permissions,
+		Session:    cache.NewSessionDao(sessions),
+		Permission: store.Permissions(),
+		Role:       store.Roles(),
+		User:       store.Users(),
+		Group:      store.Groups(),
+		Constraint: store.Constraints(),
+		System:     store.Systems(),
+		Delegation: store.Delegations(),
+		Strict:     config.Strict,
 	}
+	permissions.Register = rbac.registerDefault
+	permissions.Authorized = rbac.authorized
 	return
 }
 
+// invalidate drop cached permissions of users affected by a cascading change
+func (r *RBAC) invalidate(ctx context.Context, system string, affected db.Affected) {
+	if len(affected.Roles) > 0 || len(affected.Groups) > 0 { // members of changed roles are unknown
+		r.Cache.ClearAllKeysContext(ctx)
+		return
+	}
+	for _, uid := range append(affected.Users, affected.Delegates...) {
+		r.Cache.RemoveUserContext(ctx, system, uid)
+	}
+}
+
+// checkPermissions return *ReferenceError in strict mode if any of permissions isn't registered,
+// a wildcard is accepted if it matches any registered permission
+func (r *RBAC) checkPermissions(ctx context.Context, system string, permissions []string) error {
+	if !r.Strict || len(permissions) == 0 {
+		return nil
+	}
+
+	ps, err := r.Permission.GetAllPermissionsContext(ctx, system)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, p := range ps {
+		known[p.Name] = true
+	}
+	for _, name := range permissions {
+		if !model.IsWildcard(name) {
+			continue
+		}
+		for _, p := range ps {
+			if model.MatchPermission(name, p.Name) {
+				known[name] = true
+				break
+			}
+		}
+	}
+
+	if names := unknown(known, permissions); len(names) > 0 {
+		return &ReferenceError{System: system, Permissions: names}
+	}
+	return nil
+}
+
+// checkRoles return *ReferenceError in strict mode if any of roles isn't registered
+func (r *RBAC) checkRoles(ctx context.Context, system string, roles []string) error {
+	if !r.Strict || len(roles) == 0 {
+		return nil
+	}
+
+	rs, err := r.Role.GetAllRolesContext(ctx, system)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, role := range rs {
+		known[role.Name] = true
+	}
+
+	if names := unknown(known, roles); len(names) > 0 {
+		return &ReferenceError{System: system, Roles: names}
+	}
+	return nil
+}
+
+// newStore create storage backend according to config
+func newStore(config *RBACConfig) (db.Store, error) {
+	if config.Store != nil {
+		return config.Store, nil
+	}
+
+	switch config.Backend {
+	case "", BackendMongo:
+		d, err := db.Init(config.Mgo)
+		if err != nil {
+			return nil, err
+		}
+		return db.NewMgoStore(d), nil
+	case BackendMemory:
+		return kvstore.NewMemoryStore(), nil
+	case BackendSQL:
+		return sqlstore.Open(config.SQL)
+	case BackendBolt:
+		return kvstore.OpenBoltStore(config.Bolt)
+	default:
+		return nil, fmt.Errorf("unknown backend '%s'", config.Backend)
+	}
+}
+
+// newSessionRedis return redis keeping sessions, it must be configured along with Redis so sessions are
+// shared by all instances as cached permissions are
+func newSessionRedis(config *RBACConfig) (*cache.RedisConfig, error) {
+	if config.SessionRedis == nil {
+		if config.Redis != nil {
+			return nil, errors.New("sessions must be kept in redis too, SessionRedis is required along with Redis")
+		}
+		return nil, nil
+	}
+
+	if r := config.Redis; r != nil && r.Address == config.SessionRedis.Address && r.DB == config.SessionRedis.DB {
+		return nil, fmt.Errorf("sessions can't be kept in database %d of redis %s, it's flushed to drop cached permissions",
+			r.DB, r.Address)
+	}
+	return config.SessionRedis, nil
+}
+
 // IsPermit check whether have specified permission
 func (r *RBAC) IsPermit(system, uid, permission string) (bool, error) {
-	return r.Cache.IsPermit(system, uid, permission)
+	return r.IsPermitContext(context.Background(), system, uid, permission)
+}
+
+// IsPermitContext is IsPermit with context
+func (r *RBAC) IsPermitContext(ctx context.Context, system, uid, permission string) (bool, error) {
+	return r.Cache.IsPermitContext(ctx, system, uid, permission)
 }
 
-// RegisterPermission register permission
+// IsPermitOn check whether have specified permission on resource, either through an unscoped
+// permission or a grant covering resource
+func (r *RBAC) IsPermitOn(system, uid, permission string, resource model.Resource) (bool, error) {
+	return r.IsPermitOnContext(context.Background(), system, uid, permission, resource)
+}
+
+// IsPermitOnContext is IsPermitOn with context
+func (r *RBAC) IsPermitOnContext(ctx context.Context, system, uid, permission string, resource model.Resource) (bool, error) {
+	return r.Cache.IsPermitOnContext(ctx, system, uid, permission, resource)
+}
+
+// IsPermitWithContext check whether have specified permission, either unconditionally or through a condition
+// of role satisfied by attributes of request. unconditional permissions are checked first and don't need attrs,
+// a condition which can't be evaluated against attrs, e.g. because an attribute is missing, doesn't permit
+func (r *RBAC) IsPermitWithContext(system, uid, permission string, attrs map[string]interface{}) (bool, error) {
+	return r.IsPermitWithContextContext(context.Background(), system, uid, permission, attrs)
+}
+
+// IsPermitWithContextContext is IsPermitWithContext with context
+func (r *RBAC) IsPermitWithContextContext(ctx context.Context, system, uid, permission string, attrs map[string]interface{}) (bool, error) {
+	return r.Cache.IsPermitWithAttrsContext(ctx, system, uid, permission, attrs)
+}
+
+// RegisterPermission register permission, cached permissions are dropped so that wildcards granted
+// before cover it
 func (r *RBAC) RegisterPermission(system, name, desc string) error {
+	return r.RegisterPermissionContext(context.Background(), system, name, desc)
+}
+
+// RegisterPermissionContext is RegisterPermission with context
+func (r *RBAC) RegisterPermissionContext(ctx context.Context, system, name, desc string) error {
 	p := &model.Permission{
 		System: system,
 		Name:   name,
 		Desc:   desc,
 	}
-	return r.Permission.CreatePermission(p)
+	if err := r.Permission.CreatePermissionContext(ctx, p); err != nil {
+		return err
+	}
+
+	r.Cache.ClearAllKeysContext(ctx)
+	return nil
 }
 
-// UnregisterPermission remove permission from system
-func (r *RBAC) UnregisterPermission(system, permission string) error {
-	return r.Permission.RemovePermission(system, permission)
+// UnregisterPermission remove permission from system, and from all roles and users referring to it, the returned summary list roles and users changed
+func (r *RBAC) UnregisterPermission(system, permission string) (db.Affected, error) {
+	return r.UnregisterPermissionContext(context.Background(), system, permission)
+}
+
+// UnregisterPermissionContext is UnregisterPermission with context
+func (r *RBAC) UnregisterPermissionContext(ctx context.Context, system, permission string) (db.Affected, error) {
+	affected, err := r.Permission.RemovePermissionCascadeContext(ctx, system, permission)
+	if err != nil {
+		return affected, err
+	}
+
+	r.invalidate(ctx, system, affected)
+	return affected, nil
 }
 
 // GetAllPermissionsBySystem get all permissions of specified system
 func (r *RBAC) GetAllPermissionsBySystem(system string) ([]model.Permission, error) {
-	return r.Permission.GetAllPermissions(system)
+	return r.GetAllPermissionsBySystemContext(context.Background(), system)
 }
 
-// UpdatePermission update permission
-func (r *RBAC) UpdatePermission(system, oldname, newname string) error {
-	return r.Permission.UpdatePermission(system, oldname, newname)
+// GetAllPermissionsBySystemContext is GetAllPermissionsBySystem with context
+func (r *RBAC) GetAllPermissionsBySystemContext(ctx context.Context, system string) ([]model.Permission, error) {
+	return r.Permission.GetAllPermissionsContext(ctx, system)
+}
+
+// GetPermissionsMatching get permissions of specified system matched by pattern, a wildcard like
+// `article:*` list the whole subtree below `article`
+func (r *RBAC) GetPermissionsMatching(system, pattern string) ([]model.Permission, error) {
+	return r.GetPermissionsMatchingContext(context.Background(), system, pattern)
+}
+
+// GetPermissionsMatchingContext is GetPermissionsMatching with context
+func (r *RBAC) GetPermissionsMatchingContext(ctx context.Context, system, pattern string) ([]model.Permission, error) {
+	ps, err := r.Permission.GetAllPermissionsContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []model.Permission{}
+	for _, p := range ps {
+		if model.MatchPermission(pattern, p.Name) {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// UpdatePermission rename permission, roles and users referring to it are updated too, the returned summary list roles and users changed
+func (r *RBAC) UpdatePermission(system, oldname, newname string) (db.Affected, error) {
+	return r.UpdatePermissionContext(context.Background(), system, oldname, newname)
+}
+
+// UpdatePermissionContext is UpdatePermission with context
+func (r *RBAC) UpdatePermissionContext(ctx context.Context, system, oldname, newname string) (db.Affected, error) {
+	affected, err := r.Permission.UpdatePermissionCascadeContext(ctx, system, oldname, newname)
+	if err != nil {
+		return affected, err
+	}
+
+	r.invalidate(ctx, system, affected)
+	return affected, nil
 }
 
 // RegisterRole register role
 func (r *RBAC) RegisterRole(system, name, desc string, permissions ...string) error {
+	return r.RegisterRoleContext(context.Background(), system, name, desc, permissions...)
+}
+
+// RegisterRoleContext is RegisterRole with context
+func (r *RBAC) RegisterRoleContext(ctx context.Context, system, name, desc string, permissions ...string) error {
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
 	role := model.NewRole(system, name, desc, permissions...)
-	return r.Role.CreateRole(role)
+	return r.Role.CreateRoleContext(ctx, role)
+}
+
+// UpdateRoleIfMatch replace description and permissions of role if its revision equals revision,
+// db.ErrConflict is returned if role was changed meanwhile, otherwise the new revision is returned
+func (r *RBAC) UpdateRoleIfMatch(system, name, desc string, revision int64, permissions ...string) (int64, error) {
+	return r.UpdateRoleIfMatchContext(context.Background(), system, name, desc, revision, permissions...)
+}
+
+// UpdateRoleIfMatchContext is UpdateRoleIfMatch with context
+func (r *RBAC) UpdateRoleIfMatchContext(ctx context.Context, system, name, desc string, revision int64, permissions ...string) (int64, error) {
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return 0, err
+	}
+
+	role := model.NewRole(system, name, desc, permissions...)
+	if err := r.Role.UpdateRoleIfMatchContext(ctx, role, revision); err != nil {
+		return 0, err
+	}
+
+	r.Cache.ClearAllKeysContext(ctx)
+	return role.Revision, nil
+}
+
+// UnregisterRole unregister specified role of specified system, and revoke it from users and sessions, the returned summary list roles and users changed
+func (r *RBAC) UnregisterRole(system, name string) (db.Affected, error) {
+	return r.UnregisterRoleContext(context.Background(), system, name)
 }
 
-// UnregisterRole unregister specified role of specified system
-func (r *RBAC) UnregisterRole(system, name string) error {
-	return r.Role.RemoveRole(system, name)
+// UnregisterRoleContext is UnregisterRole with context, delegations left without roles are removed
+func (r *RBAC) UnregisterRoleContext(ctx context.Context, system, name string) (db.Affected, error) {
+	affected, err := r.Role.RemoveRoleCascadeContext(ctx, system, name)
+	if err != nil {
+		return affected, err
+	}
+
+	r.invalidate(ctx, system, affected)
+	if err = r.Session.RemoveRoleFromSessionsContext(ctx, system, name); err != nil {
+		return affected, err
+	}
+	if len(affected.Delegates) > 0 {
+		return affected, r.removeEmptyDelegations(ctx, system)
+	}
+	return affected, nil
 }
 
 // UnregisterAllRoles unregister all role of specified system
 func (r *RBAC) UnregisterAllRoles(system string) error {
-	return r.Role.RemoveAllRoles(system)
+	return r.UnregisterAllRolesContext(context.Background(), system)
+}
+
+// UnregisterAllRolesContext is UnregisterAllRoles with context
+func (r *RBAC) UnregisterAllRolesContext(ctx context.Context, system string) error {
+	r.Cache.ClearAllKeysContext(ctx)
+	return r.Role.RemoveAllRolesContext(ctx, system)
 }
 
 // GetRoleOfSystem get specified role of system by name
 func (r *RBAC) GetRoleOfSystem(system, name string) (model.Role, error) {
-	return r.Role.GetRole(system, name)
+	return r.GetRoleOfSystemContext(context.Background(), system, name)
+}
+
+// GetRoleOfSystemContext is GetRoleOfSystem with context
+func (r *RBAC) GetRoleOfSystemContext(ctx context.Context, system, name string) (model.Role, error) {
+	return r.Role.GetRoleContext(ctx, system, name)
 }
 
 // GetAllRolesOfSystem get all roles of specified system
 func (r *RBAC) GetAllRolesOfSystem(system string) ([]model.Role, error) {
-	return r.Role.GetAllRoles(system)
+	return r.GetAllRolesOfSystemContext(context.Background(), system)
 }
 
-// UpdateRoleName update name of specified role
-func (r *RBAC) UpdateRoleName(system, oldname, newname string) error {
-	return r.Role.UpdateRoleName(system, oldname, newname)
+// GetAllRolesOfSystemContext is GetAllRolesOfSystem with context
+func (r *RBAC) GetAllRolesOfSystemContext(ctx context.Context, system string) ([]model.Role, error) {
+	return r.Role.GetAllRolesContext(ctx, system)
+}
+
+// UpdateRoleName update name of specified role, users and sessions referring to it are updated too, the returned summary list roles and users changed
+func (r *RBAC) UpdateRoleName(system, oldname, newname string) (db.Affected, error) {
+	return r.UpdateRoleNameContext(context.Background(), system, oldname, newname)
+}
+
+// UpdateRoleNameContext is UpdateRoleName with context
+func (r *RBAC) UpdateRoleNameContext(ctx context.Context, system, oldname, newname string) (db.Affected, error) {
+	affected, err := r.Role.UpdateRoleNameCascadeContext(ctx, system, oldname, newname)
+	if err != nil || oldname == newname {
+		return affected, err
+	}
+
+	r.invalidate(ctx, system, affected)
+	return affected, r.Session.RenameRoleInSessionsContext(ctx, system, oldname, newname)
 }
 
 // GetPermissionsOfRole get all permissions of role
 func (r *RBAC) GetPermissionsOfRole(system, name string) ([]string, error) {
-	return r.Role.GetPermissions(system, name)
+	return r.GetPermissionsOfRoleContext(context.Background(), system, name)
+}
+
+// GetPermissionsOfRoleContext is GetPermissionsOfRole with context
+func (r *RBAC) GetPermissionsOfRoleContext(ctx context.Context, system, name string) ([]string, error) {
+	return r.Role.GetPermissionsContext(ctx, system, name)
 }
 
 // GrantPermissionsToRole grant specified permissions to role
 func (r *RBAC) GrantPermissionsToRole(system, name string, permissions ...string) error {
-	r.Cache.ClearAllKeys()
-	return r.Role.GrantPermissions(system, name, permissions...)
+	return r.GrantPermissionsToRoleContext(context.Background(), system, name, permissions...)
+}
+
+// GrantPermissionsToRoleContext is GrantPermissionsToRole with context
+func (r *RBAC) GrantPermissionsToRoleContext(ctx context.Context, system, name string, permissions ...string) error {
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
+	r.Cache.ClearAllKeysContext(ctx)
+	return r.Role.GrantPermissionsContext(ctx, system, name, permissions...)
 }
 
 // RemovePermissionFromRole remove specified permission from specified role
 func (r *RBAC) RemovePermissionFromRole(system, name string, permission string) error {
-	r.Cache.ClearAllKeys()
-	return r.Role.RemovePermission(system, name, permission)
+	return r.RemovePermissionFromRoleContext(context.Background(), system, name, permission)
+}
+
+// RemovePermissionFromRoleContext is RemovePermissionFromRole with context
+func (r *RBAC) RemovePermissionFromRoleContext(ctx context.Context, system, name string, permission string) error {
+	r.Cache.ClearAllKeysContext(ctx)
+	return r.Role.RemovePermissionContext(ctx, system, name, permission)
+}
+
+// DenyPermissionsToRole deny permissions to every user holding role, whichever other role or whitelist grants
+// them. denials are inherited by children of role like permissions, wildcards deny all permissions they match
+func (r *RBAC) DenyPermissionsToRole(system, name string, permissions ...string) error {
+	return r.DenyPermissionsToRoleContext(context.Background(), system, name, permissions...)
+}
+
+// DenyPermissionsToRoleContext is DenyPermissionsToRole with context
+func (r *RBAC) DenyPermissionsToRoleContext(ctx context.Context, system, name string, permissions ...string) error {
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
+	if err := r.Role.DenyPermissionsContext(ctx, system, name, permissions...); err != nil {
+		return err
+	}
+	r.Cache.ClearAllKeysContext(ctx)
+	return nil
+}
+
+// RemoveDeniedPermissionFromRole stop denying permission to users holding role
+func (r *RBAC) RemoveDeniedPermissionFromRole(system, name, permission string) error {
+	return r.RemoveDeniedPermissionFromRoleContext(context.Background(), system, name, permission)
+}
+
+// RemoveDeniedPermissionFromRoleContext is RemoveDeniedPermissionFromRole with context
+func (r *RBAC) RemoveDeniedPermissionFromRoleContext(ctx context.Context, system, name, permission string) error {
+	if err := r.Role.RemoveDeniedContext(ctx, system, name, permission); err != nil {
+		return err
+	}
+	r.Cache.ClearAllKeysContext(ctx)
+	return nil
+}
+
+// GrantConditionalPermission grant permission to role only for requests whose attributes satisfy expr, see
+// model.Condition for its syntax. it replaces the condition of permission granted before, *model.ConditionError
+// is returned if expr is invalid. permissions granted unconditionally too don't need the condition
+func (r *RBAC) GrantConditionalPermission(system, name, permission, expr string) error {
+	return r.GrantConditionalPermissionContext(context.Background(), system, name, permission, expr)
+}
+
+// GrantConditionalPermissionContext is GrantConditionalPermission with context
+func (r *RBAC) GrantConditionalPermissionContext(ctx context.Context, system, name, permission, expr string) error {
+	condition := model.Condition{Permission: permission, Expr: expr}
+	if err := condition.Validate(); err != nil {
+		return err
+	}
+	if err := r.checkPermissions(ctx, system, []string{permission}); err != nil {
+		return err
+	}
+
+	if err := r.Role.SetConditionContext(ctx, system, name, condition); err != nil {
+		return err
+	}
+	r.Cache.ClearAllKeysContext(ctx)
+	return nil
+}
+
+// RemoveConditionalPermission remove conditional permission from role
+func (r *RBAC) RemoveConditionalPermission(system, name, permission string) error {
+	return r.RemoveConditionalPermissionContext(context.Background(), system, name, permission)
+}
+
+// RemoveConditionalPermissionContext is RemoveConditionalPermission with context
+func (r *RBAC) RemoveConditionalPermissionContext(ctx context.Context, system, name, permission string) error {
+	if err := r.Role.RemoveConditionContext(ctx, system, name, permission); err != nil {
+		return err
+	}
+	r.Cache.ClearAllKeysContext(ctx)
+	return nil
+}
+
+// hierarchyOf load inheritance graph of roles of system, db.ErrNotFound is returned if role doesn't exist
+func (r *RBAC) hierarchyOf(ctx context.Context, system, role string) (hierarchy, error) {
+	roles, err := r.Role.GetAllRolesContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHierarchy(roles)
+	if _, ok := h[role]; !ok {
+		return nil, db.ErrNotFound
+	}
+	return h, nil
+}
+
+// AddParentsToRole make role inherit permissions of parents, *CycleError is returned if any parent
+// already inherits role
+func (r *RBAC) AddParentsToRole(system, name string, parents ...string) error {
+	return r.AddParentsToRoleContext(context.Background(), system, name, parents...)
+}
+
+// AddParentsToRoleContext is AddParentsToRole with context
+func (r *RBAC) AddParentsToRoleContext(ctx context.Context, system, name string, parents ...string) error {
+	if err := r.checkRoles(ctx, system, parents); err != nil {
+		return err
+	}
+
+	h, err := r.hierarchyOf(ctx, system, name)
+	if err != nil {
+		return err
+	}
+	for _, p := range parents {
+		if path := h.path(p, name); path != nil {
+			return &CycleError{System: system, Path: append([]string{name}, path...)}
+		}
+	}
+
+	r.Cache.ClearAllKeysContext(ctx)
+	return r.Role.AddParentsContext(ctx, system, name, parents...)
 }
 
-// RegisterUser register user permission info into mongo
+// RemoveParentFromRole stop role inheriting permissions of parent
+func (r *RBAC) RemoveParentFromRole(system, name string, parent string) error {
+	return r.RemoveParentFromRoleContext(context.Background(), system, name, parent)
+}
+
+// RemoveParentFromRoleContext is RemoveParentFromRole with context
+func (r *RBAC) RemoveParentFromRoleContext(ctx context.Context, system, name string, parent string) error {
+	r.Cache.ClearAllKeysContext(ctx)
+	return r.Role.RemoveParentContext(ctx, system, name, parent)
+}
+
+// GetAncestorsOfRole list all roles inherited by role directly or indirectly
+func (r *RBAC) GetAncestorsOfRole(system, name string) ([]string, error) {
+	return r.GetAncestorsOfRoleContext(context.Background(), system, name)
+}
+
+// GetAncestorsOfRoleContext is GetAncestorsOfRole with context
+func (r *RBAC) GetAncestorsOfRoleContext(ctx context.Context, system, name string) ([]string, error) {
+	h, err := r.hierarchyOf(ctx, system, name)
+	if err != nil {
+		return nil, err
+	}
+	return h.ancestors(name), nil
+}
+
+// GetDescendantsOfRole list all roles inheriting role directly or indirectly
+func (r *RBAC) GetDescendantsOfRole(system, name string) ([]string, error) {
+	return r.GetDescendantsOfRoleContext(context.Background(), system, name)
+}
+
+// GetDescendantsOfRoleContext is GetDescendantsOfRole with context
+func (r *RBAC) GetDescendantsOfRoleContext(ctx context.Context, system, name string) ([]string, error) {
+	h, err := r.hierarchyOf(ctx, system, name)
+	if err != nil {
+		return nil, err
+	}
+	return h.descendants(name), nil
+}
+
+// RegisterUser register user permission info into store
 func (r *RBAC) RegisterUser(system, uid string, roles ...string) error {
+	return r.RegisterUserContext(context.Background(), system, uid, roles...)
+}
+
+// RegisterUserContext is RegisterUser with context, *SoDError, *PrerequisiteError or *MaxMembersError is returned if roles violate a constraint
+func (r *RBAC) RegisterUserContext(ctx context.Context, system, uid string, roles ...string) error {
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	held, err := r.heldRoles(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	if err = r.checkConstraints(ctx, system, uid, held, roles); err != nil {
+		return err
+	}
+
+	// user may be remembered as unknown or hold default roles of system
+	r.Cache.RemoveUserContext(ctx, system, uid)
 	u := model.NewUserPermModel(system, uid, roles...)
-	return r.User.CreateUserPermModel(u)
+	u.RoleProvenance = replacedProvenance(ctx, nil, nil, roles)
+	return r.User.CreateUserPermModelContext(ctx, u)
 }
 
-// UnregisterUser remove user info from mongo
+// UnregisterUser remove user info from store
 func (r *RBAC) UnregisterUser(system, uid string) error {
-	return r.User.RemoveUserPermModel(system, uid)
+	return r.UnregisterUserContext(context.Background(), system, uid)
+}
+
+// UnregisterUserContext is UnregisterUser with context, user leaves all its groups too and roles it delegated
+// are revoked unless they were delegated to it transitively
+func (r *RBAC) UnregisterUserContext(ctx context.Context, system, uid string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	if _, err := r.Group.RemoveMemberFromAllContext(ctx, system, uid); err != nil {
+		return err
+	}
+	if err := r.User.RemoveUserPermModelContext(ctx, system, uid); err != nil {
+		return err
+	}
+	return r.revokeLost(ctx, system, uid)
 }
 
 // UpdateUser update user info
 func (r *RBAC) UpdateUser(system, uid string, new_roles ...string) error {
+	return r.UpdateUserContext(context.Background(), system, uid, new_roles...)
+}
+
+// UpdateUserContext is UpdateUser with context, *SoDError, *PrerequisiteError or *MaxMembersError is returned if roles violate a constraint
+func (r *RBAC) UpdateUserContext(ctx context.Context, system, uid string, new_roles ...string) error {
+	if err := r.checkRoles(ctx, system, new_roles); err != nil {
+		return err
+	}
+	old, err := r.heldUser(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	if err = r.checkConstraints(ctx, system, uid, old.Roles, new_roles); err != nil {
+		return err
+	}
+
 	u := model.NewUserPermModel(system, uid, new_roles...)
-	return r.User.UpdateUserPermModel(system, uid, u)
+	u.RoleProvenance = replacedProvenance(ctx, old.Roles, old.RoleProvenance, new_roles)
+	if err = r.User.UpdateUserPermModelContext(ctx, system, uid, u); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.revokeLost(ctx, system, uid)
+}
+
+// UpdateUserIfMatch replace roles of user if its revision equals revision,
+// db.ErrConflict is returned if user was changed meanwhile, otherwise the new revision is returned
+func (r *RBAC) UpdateUserIfMatch(system, uid string, revision int64, roles ...string) (int64, error) {
+	return r.UpdateUserIfMatchContext(context.Background(), system, uid, revision, roles...)
+}
+
+// UpdateUserIfMatchContext is UpdateUserIfMatch with context
+func (r *RBAC) UpdateUserIfMatchContext(ctx context.Context, system, uid string, revision int64, roles ...string) (int64, error) {
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return 0, err
+	}
+	old, err := r.heldUser(ctx, system, uid)
+	if err != nil {
+		return 0, err
+	}
+	if err = r.checkConstraints(ctx, system, uid, old.Roles, roles); err != nil {
+		return 0, err
+	}
+
+	u := model.NewUserPermModel(system, uid, roles...)
+	u.RoleProvenance = replacedProvenance(ctx, old.Roles, old.RoleProvenance, roles)
+	if err := r.User.UpdateUserPermModelIfMatchContext(ctx, u, revision); err != nil {
+		return 0, err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return u.Revision, r.revokeLost(ctx, system, uid)
 }
 
 // GetUser get user info
 func (r *RBAC) GetUser(system, uid string) (model.UserPermModel, error) {
-	return r.User.GetUserPermModel(system, uid)
+	return r.GetUserContext(context.Background(), system, uid)
+}
+
+// GetUserContext is GetUser with context, provenance is only returned for entries still held
+func (r *RBAC) GetUserContext(ctx context.Context, system, uid string) (model.UserPermModel, error) {
+	u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+	if err != nil {
+		return u, err
+	}
+	u.PruneProvenance()
+	return u, nil
 }
 
 // GetAllRolesByUID get all roles with uid
-func (r *RBAC) GetAllRolesByUID(system, uid string) (roles []string, err error) {
-	return r.User.GetAllRoles(system, uid)
+func (r *RBAC) GetAllRolesByUID(system, uid string) ([]string, error) {
+	return r.GetAllRolesByUIDContext(context.Background(), system, uid)
+}
+
+// GetAllRolesByUIDContext is GetAllRolesByUID with context
+func (r *RBAC) GetAllRolesByUIDContext(ctx context.Context, system, uid string) (roles []string, err error) {
+	return r.User.GetAllRolesContext(ctx, system, uid)
 }
 
 // UpdateRoles update user's all roles
 func (r *RBAC) UpdateRoles(system, uid string, roles ...string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.UpdateRoles(system, uid, roles...)
+	return r.UpdateRolesContext(context.Background(), system, uid, roles...)
+}
+
+// UpdateRolesContext is UpdateRoles with context, *SoDError, *PrerequisiteError or *MaxMembersError is returned if roles violate a constraint
+func (r *RBAC) UpdateRolesContext(ctx context.Context, system, uid string, roles ...string) error {
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	held, err := r.heldRoles(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	if err = r.checkConstraints(ctx, system, uid, held, roles); err != nil {
+		return err
+	}
+
+	// like the store, no roles leave user unchanged
+	if len(roles) == 0 {
+		return nil
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	err = r.modifyUser(ctx, system, uid, func(u *model.UserPermModel) error {
+		u.RoleProvenance = replacedProvenance(ctx, u.Roles, u.RoleProvenance, roles)
+		u.Roles = append([]string{}, roles...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.revokeLost(ctx, system, uid)
 }
 
-// AddRoles add specified roles into user's permission model
+// AddRoles add specified roles into user's permission model, roles assigned within a period become permanent
 func (r *RBAC) AddRoles(system, uid string, roles ...string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.AddRoles(system, uid, roles...)
+	return r.AddRolesContext(context.Background(), system, uid, roles...)
+}
+
+// AddRolesContext is AddRoles with context
+func (r *RBAC) AddRolesContext(ctx context.Context, system, uid string, roles ...string) error {
+	return r.AddRolesWithinContext(ctx, system, uid, model.Period{}, roles...)
+}
+
+// AddRolesWithin assign roles to user only within period, roles already assigned get the new period
+func (r *RBAC) AddRolesWithin(system, uid string, period model.Period, roles ...string) error {
+	return r.AddRolesWithinContext(context.Background(), system, uid, period, roles...)
+}
+
+// AddRolesWithinContext is AddRolesWithin with context, *SoDError, *PrerequisiteError or *MaxMembersError is returned
+// if roles together with those already assigned violate a constraint, whatever the periods are
+func (r *RBAC) AddRolesWithinContext(ctx context.Context, system, uid string, period model.Period, roles ...string) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	held, err := r.User.GetAllRolesContext(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	if err = r.checkConstraints(ctx, system, uid, held, append(append([]string{}, held...), roles...)); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	if err = r.addWithin(ctx, system, uid, model.ListRoles, period, roles...); err != nil {
+		return err
+	}
+	// roles delegated by user may get another period
+	return r.revokeLost(ctx, system, uid)
 }
 
 // RemoveRoles remove specified role from user's permission model
 func (r *RBAC) RemoveRoles(system, uid string, role string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.RemoveRoles(system, uid, role)
+	return r.RemoveRolesContext(context.Background(), system, uid, role)
+}
+
+// RemoveRolesContext is RemoveRoles with context, *PrerequisiteError is returned if another role of user requires role.
+// role is revoked from delegates of user too unless user still holds it through a transitive delegation
+func (r *RBAC) RemoveRolesContext(ctx context.Context, system, uid string, role string) error {
+	held, err := r.User.GetAllRolesContext(ctx, system, uid)
+	if err != nil {
+		return err
+	}
+	if err = r.checkConstraints(ctx, system, uid, held, missing(held, []string{role})); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	if err = r.User.RemoveRolesContext(ctx, system, uid, role); err != nil {
+		return err
+	}
+	return r.revokeLost(ctx, system, uid)
 }
 
 // GetBlackList get user permission model's blacklist, which contain all permissions forbidden
 func (r *RBAC) GetBlackList(system, uid string) ([]string, error) {
-	return r.User.GetBlackList(system, uid)
+	return r.GetBlackListContext(context.Background(), system, uid)
 }
 
-// AddToBlackList add specified permissions into user permission model's blacklist
+// GetBlackListContext is GetBlackList with context
+func (r *RBAC) GetBlackListContext(ctx context.Context, system, uid string) ([]string, error) {
+	return r.User.GetBlackListContext(ctx, system, uid)
+}
+
+// AddToBlackList add specified permissions into user permission model's blacklist,
+// permissions blacklisted within a period become permanent
 func (r *RBAC) AddToBlackList(system, uid string, permissions ...string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.AddToBlackList(system, uid, permissions...)
+	return r.AddToBlackListContext(context.Background(), system, uid, permissions...)
+}
+
+// AddToBlackListContext is AddToBlackList with context
+func (r *RBAC) AddToBlackListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return r.AddToBlackListWithinContext(ctx, system, uid, model.Period{}, permissions...)
+}
+
+// AddToBlackListWithin forbid permissions to user only within period, permissions already blacklisted get the new period
+func (r *RBAC) AddToBlackListWithin(system, uid string, period model.Period, permissions ...string) error {
+	return r.AddToBlackListWithinContext(context.Background(), system, uid, period, permissions...)
+}
+
+// AddToBlackListWithinContext is AddToBlackListWithin with context
+func (r *RBAC) AddToBlackListWithinContext(ctx context.Context, system, uid string, period model.Period, permissions ...string) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.addWithin(ctx, system, uid, model.ListBlackList, period, permissions...)
 }
 
 // RemoveFromBlackList remove specified permission from blacklist
 func (r *RBAC) RemoveFromBlackList(system, uid string, permission string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.RemoveFromBlackList(system, uid, permission)
+	return r.RemoveFromBlackListContext(context.Background(), system, uid, permission)
+}
+
+// RemoveFromBlackListContext is RemoveFromBlackList with context
+func (r *RBAC) RemoveFromBlackListContext(ctx context.Context, system, uid string, permission string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.RemoveFromBlackListContext(ctx, system, uid, permission)
 }
 
 // ClearBlackList clear blacklist
 func (r *RBAC) ClearBlackList(system, uid string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.ClearBlackList(system, uid)
+	return r.ClearBlackListContext(context.Background(), system, uid)
+}
+
+// ClearBlackListContext is ClearBlackList with context
+func (r *RBAC) ClearBlackListContext(ctx context.Context, system, uid string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.ClearBlackListContext(ctx, system, uid)
 }
 
 // GetWhiteList get user permission model's whitelist, which contain all permissions allowed all the time
 func (r *RBAC) GetWhiteList(system, uid string) ([]string, error) {
-	return r.User.GetWhiteList(system, uid)
+	return r.GetWhiteListContext(context.Background(), system, uid)
+}
+
+// GetWhiteListContext is GetWhiteList with context
+func (r *RBAC) GetWhiteListContext(ctx context.Context, system, uid string) ([]string, error) {
+	return r.User.GetWhiteListContext(ctx, system, uid)
 }
 
 // UpdateWhiteList update whitelist with 'wl'
 func (r *RBAC) UpdateWhiteList(system, uid string, whitelist ...string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.UpdateWhiteList(system, uid, whitelist...)
+	return r.UpdateWhiteListContext(context.Background(), system, uid, whitelist...)
 }
 
-// AddToWhiteList add specified permission into user permission model's whitelist
+// UpdateWhiteListContext is UpdateWhiteList with context
+func (r *RBAC) UpdateWhiteListContext(ctx context.Context, system, uid string, whitelist ...string) error {
+	if err := r.checkPermissions(ctx, system, whitelist); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.modifyUser(ctx, system, uid, func(u *model.UserPermModel) error {
+		u.WhiteListProvenance = replacedProvenance(ctx, u.WhiteList, u.WhiteListProvenance, whitelist)
+		u.WhiteList = append([]string{}, whitelist...)
+		return nil
+	})
+}
+
+// AddToWhiteList add specified permission into user permission model's whitelist,
+// permissions whitelisted within a period become permanent
 func (r *RBAC) AddToWhiteList(system, uid string, permissions ...string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.AddToWhiteList(system, uid, permissions...)
+	return r.AddToWhiteListContext(context.Background(), system, uid, permissions...)
+}
+
+// AddToWhiteListContext is AddToWhiteList with context
+func (r *RBAC) AddToWhiteListContext(ctx context.Context, system, uid string, permissions ...string) error {
+	return r.AddToWhiteListWithinContext(ctx, system, uid, model.Period{}, permissions...)
+}
+
+// AddToWhiteListWithin grant permissions to user only within period, permissions already whitelisted get the new period
+func (r *RBAC) AddToWhiteListWithin(system, uid string, period model.Period, permissions ...string) error {
+	return r.AddToWhiteListWithinContext(context.Background(), system, uid, period, permissions...)
+}
+
+// AddToWhiteListWithinContext is AddToWhiteListWithin with context
+func (r *RBAC) AddToWhiteListWithinContext(ctx context.Context, system, uid string, period model.Period, permissions ...string) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.addWithin(ctx, system, uid, model.ListWhiteList, period, permissions...)
 }
 
 // RemoveFromWhiteList remove specified permission from user's permission model's whitelist
 func (r *RBAC) RemoveFromWhiteList(system, uid string, permission string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.RemoveFromWhiteList(system, uid, permission)
+	return r.RemoveFromWhiteListContext(context.Background(), system, uid, permission)
+}
+
+// RemoveFromWhiteListContext is RemoveFromWhiteList with context
+func (r *RBAC) RemoveFromWhiteListContext(ctx context.Context, system, uid string, permission string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.RemoveFromWhiteListContext(ctx, system, uid, permission)
 }
 
 // ClearWhiteList clear all permission at user's permission model's whitelist
 func (r *RBAC) ClearWhiteList(system, uid string) error {
-	r.Cache.RemoveUser(system, uid)
-	return r.User.ClearWhiteList(system, uid)
+	return r.ClearWhiteListContext(context.Background(), system, uid)
+}
+
+// ClearWhiteListContext is ClearWhiteList with context
+func (r *RBAC) ClearWhiteListContext(ctx context.Context, system, uid string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.ClearWhiteListContext(ctx, system, uid)
+}
+
+// GetGrants get grants on resources of user
+func (r *RBAC) GetGrants(system, uid string) ([]model.Grant, error) {
+	return r.GetGrantsContext(context.Background(), system, uid)
+}
+
+// GetGrantsContext is GetGrants with context
+func (r *RBAC) GetGrantsContext(ctx context.Context, system, uid string) ([]model.Grant, error) {
+	u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+	return u.Grants, err
+}
+
+// AddGrants grant permissions on resources to user
+func (r *RBAC) AddGrants(system, uid string, grants ...model.Grant) error {
+	return r.AddGrantsContext(context.Background(), system, uid, grants...)
+}
+
+// AddGrantsContext is AddGrants with context
+func (r *RBAC) AddGrantsContext(ctx context.Context, system, uid string, grants ...model.Grant) error {
+	var permissions []string
+	for _, g := range grants {
+		permissions = append(permissions, g.Permission)
+	}
+	if err := r.checkPermissions(ctx, system, permissions); err != nil {
+		return err
+	}
+
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.AddGrantsContext(ctx, system, uid, grants...)
+}
+
+// RemoveGrant remove specified grant from user
+func (r *RBAC) RemoveGrant(system, uid string, grant model.Grant) error {
+	return r.RemoveGrantContext(context.Background(), system, uid, grant)
+}
+
+// RemoveGrantContext is RemoveGrant with context
+func (r *RBAC) RemoveGrantContext(ctx context.Context, system, uid string, grant model.Grant) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.User.RemoveGrantContext(ctx, system, uid, grant)
+}
+
+// SweepExpired remove roles, whitelist and blacklist entries whose window has ended from users of all systems
+// and drop their cached permissions, roles they delegated are revoked too. return the changed users
+func (r *RBAC) SweepExpired() ([]db.UserRef, error) {
+	return r.SweepExpiredContext(context.Background())
+}
+
+// SweepExpiredContext is SweepExpired with context
+func (r *RBAC) SweepExpiredContext(ctx context.Context) ([]db.UserRef, error) {
+	refs, err := r.User.RemoveExpiredContext(ctx, time.Now())
+	for _, u := range refs {
+		if _, e := r.Cache.RemoveUserContext(ctx, u.System, u.UID); e != nil && err == nil {
+			err = e
+		}
+		if e := r.revokeLost(ctx, u.System, u.UID); e != nil && err == nil {
+			err = e
+		}
+	}
+	return refs, err
+}
+
+// StartSweeper run SweepExpired every interval in background until ctx is done, errors are passed to
+// onError if it's not nil. Expired entries are ignored by IsPermit anyway, sweeping keeps stores tidy
+func (r *RBAC) StartSweeper(ctx context.Context, interval time.Duration, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := r.SweepExpiredContext(ctx); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// invalidateGroup drop cached permissions of all members of specified group
+func (r *RBAC) invalidateGroup(ctx context.Context, system, name string) error {
+	g, err := r.Group.GetGroupContext(ctx, system, name)
+	if err != nil {
+		return err
+	}
+	for _, uid := range g.Members {
+		r.Cache.RemoveUserContext(ctx, system, uid)
+	}
+	return nil
+}
+
+// RegisterGroup register group without members, replace it if already exist. constraints of roles are checked
+// as members are added
+func (r *RBAC) RegisterGroup(system, name, desc string, roles ...string) error {
+	return r.RegisterGroupContext(context.Background(), system, name, desc, roles...)
+}
+
+// RegisterGroupContext is RegisterGroup with context
+func (r *RBAC) RegisterGroupContext(ctx context.Context, system, name, desc string, roles ...string) error {
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	if err := r.invalidateGroup(ctx, system, name); err != nil && err != db.ErrNotFound {
+		return err
+	}
+
+	return r.Group.CreateGroupContext(ctx, model.NewGroup(system, name, desc, roles...))
+}
+
+// UnregisterGroup unregister specified group, its members lose roles of it
+func (r *RBAC) UnregisterGroup(system, name string) error {
+	return r.UnregisterGroupContext(context.Background(), system, name)
+}
+
+// UnregisterGroupContext is UnregisterGroup with context
+func (r *RBAC) UnregisterGroupContext(ctx context.Context, system, name string) error {
+	if err := r.invalidateGroup(ctx, system, name); err != nil {
+		return err
+	}
+	return r.Group.RemoveGroupContext(ctx, system, name)
+}
+
+// GetGroup get specified group of system by name
+func (r *RBAC) GetGroup(system, name string) (model.Group, error) {
+	return r.GetGroupContext(context.Background(), system, name)
+}
+
+// GetGroupContext is GetGroup with context
+func (r *RBAC) GetGroupContext(ctx context.Context, system, name string) (model.Group, error) {
+	return r.Group.GetGroupContext(ctx, system, name)
+}
+
+// GetAllGroups get all groups of specified system
+func (r *RBAC) GetAllGroups(system string) ([]model.Group, error) {
+	return r.GetAllGroupsContext(context.Background(), system)
+}
+
+// GetAllGroupsContext is GetAllGroups with context
+func (r *RBAC) GetAllGroupsContext(ctx context.Context, system string) ([]model.Group, error) {
+	return r.Group.GetAllGroupsContext(ctx, system)
+}
+
+// GetGroupsOfUser get all groups which user belongs to
+func (r *RBAC) GetGroupsOfUser(system, uid string) ([]model.Group, error) {
+	return r.GetGroupsOfUserContext(context.Background(), system, uid)
+}
+
+// GetGroupsOfUserContext is GetGroupsOfUser with context
+func (r *RBAC) GetGroupsOfUserContext(ctx context.Context, system, uid string) ([]model.Group, error) {
+	return r.Group.GetGroupsOfUserContext(ctx, system, uid)
+}
+
+// AddMembersToGroup add users to group, they needn't be registered. roles of group count as held by them for
+// constraints of roles, *SoDError, *PrerequisiteError or *MaxMembersError is returned if any of them is violated
+func (r *RBAC) AddMembersToGroup(system, name string, uids ...string) error {
+	return r.AddMembersToGroupContext(context.Background(), system, name, uids...)
+}
+
+// AddMembersToGroupContext is AddMembersToGroup with context
+func (r *RBAC) AddMembersToGroupContext(ctx context.Context, system, name string, uids ...string) error {
+	g, err := r.Group.GetGroupContext(ctx, system, name)
+	if err != nil {
+		return err
+	}
+	if err = r.checkMembers(ctx, system, missing(uids, g.Members), g.Roles); err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		r.Cache.RemoveUserContext(ctx, system, uid)
+	}
+	return r.Group.AddMembersContext(ctx, system, name, uids...)
+}
+
+// RemoveMemberFromGroup remove user from group
+func (r *RBAC) RemoveMemberFromGroup(system, name string, uid string) error {
+	return r.RemoveMemberFromGroupContext(context.Background(), system, name, uid)
+}
+
+// RemoveMemberFromGroupContext is RemoveMemberFromGroup with context
+func (r *RBAC) RemoveMemberFromGroupContext(ctx context.Context, system, name string, uid string) error {
+	r.Cache.RemoveUserContext(ctx, system, uid)
+	return r.Group.RemoveMemberContext(ctx, system, name, uid)
+}
+
+// AddRolesToGroup assign roles to all members of group, *SoDError, *PrerequisiteError or *MaxMembersError is
+// returned if constraints of roles are violated for any member
+func (r *RBAC) AddRolesToGroup(system, name string, roles ...string) error {
+	return r.AddRolesToGroupContext(context.Background(), system, name, roles...)
+}
+
+// AddRolesToGroupContext is AddRolesToGroup with context
+func (r *RBAC) AddRolesToGroupContext(ctx context.Context, system, name string, roles ...string) error {
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	g, err := r.Group.GetGroupContext(ctx, system, name)
+	if err != nil {
+		return err
+	}
+	if err = r.checkMembers(ctx, system, g.Members, missing(roles, g.Roles)); err != nil {
+		return err
+	}
+
+	if err = r.invalidateGroup(ctx, system, name); err != nil {
+		return err
+	}
+	return r.Group.AddRolesContext(ctx, system, name, roles...)
+}
+
+// RemoveRoleFromGroup remove role from group
+func (r *RBAC) RemoveRoleFromGroup(system, name string, role string) error {
+	return r.RemoveRoleFromGroupContext(context.Background(), system, name, role)
+}
+
+// RemoveRoleFromGroupContext is RemoveRoleFromGroup with context
+func (r *RBAC) RemoveRoleFromGroupContext(ctx context.Context, system, name string, role string) error {
+	if err := r.invalidateGroup(ctx, system, name); err != nil {
+		return err
+	}
+	return r.Group.RemoveRoleContext(ctx, system, name, role)
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nzqpeace/rbac"
+	"github.com/nzqpeace/rbac/db"
 	"github.com/nzqpeace/rbac/model"
 	log "github.com/sirupsen/logrus"
 
@@ -29,12 +33,20 @@ const (
 	ErrNotFound
 	ErrBadPrams
 	ErrInternelServerError
+	ErrConflict
+	ErrConstraint
 )
 
 func NewRbacApi(config *Config) (*RbacApi, error) {
 	rc := &rbac.RBACConfig{
-		Redis: config.Redis,
-		Mgo:   config.Mongo,
+		Backend:      config.Backend,
+		Redis:        config.Redis,
+		SessionRedis: config.SessionRedis,
+		Mgo:          config.Mongo,
+		SQL:          config.SQL,
+		Bolt:         config.Bolt,
+		Strict:       config.Strict,
+		NegativeTTL:  time.Duration(config.NegativeTTL) * time.Second,
 	}
 
 	r, err := rbac.NewRBAC(rc)
@@ -43,6 +55,12 @@ func NewRbacApi(config *Config) (*RbacApi, error) {
 		return nil, err
 	}
 
+	if config.SweepInterval > 0 {
+		r.StartSweeper(context.Background(), time.Duration(config.SweepInterval)*time.Second, func(err error) {
+			log.Errorf("sweep expired entries error: %v", err)
+		})
+	}
+
 	return &RbacApi{r}, nil
 }
 
@@ -86,23 +104,202 @@ func checkUrlParams(c iris.Context, names ...string) (params map[string]string,
 	return
 }
 
-func (api *RbacApi) responseByError(c iris.Context, err error) {
+// anyRevision is parsed from `If-Match: *`, which only requires the role or user to exist
+const anyRevision int64 = -1
+
+// ifMatch parse revision from If-Match header, ok is false if header is absent. a response is written if header
+// is malformed, or status 412 if it's a weak validator, which never matches a revision
+func ifMatch(c iris.Context) (revision int64, ok bool, err error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return 0, false, nil
+	}
+	if header == "*" {
+		return anyRevision, true, nil
+	}
+	if strings.HasPrefix(header, "W/") {
+		c.StatusCode(iris.StatusPreconditionFailed)
+		c.JSON(iris.Map{
+			"code":    ErrConflict,
+			"message": fmt.Sprintf("weak validator of If-Match header[%s] never matches", header),
+		})
+		return 0, false, errors.New("weak If-Match validator")
+	}
+
+	revision, err = strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err == nil && revision < 0 {
+		err = errors.New("negative revision")
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), NotFound) {
-			c.StatusCode(iris.StatusOK)
-			c.JSON(iris.Map{
-				"code":    ErrNotFound,
-				"message": err.Error(),
-			})
-			return
+		c.StatusCode(iris.StatusBadRequest)
+		c.JSON(iris.Map{
+			"code":    ErrBadPrams,
+			"message": fmt.Sprintf("invalid If-Match header[%s]", header),
+		})
+		return 0, false, err
+	}
+	return revision, true, nil
+}
+
+// updateIfMatch write by update if the current revision still equals revision, which is read by current when
+// revision is anyRevision. a missing role or user fails the precondition then, and conflicts with writes in the
+// meantime are retried
+func updateIfMatch(revision int64, current func() (int64, error), update func(revision int64) (int64, error)) (int64, error) {
+	if revision != anyRevision {
+		return update(revision)
+	}
+	for {
+		rev, err := current()
+		if err == db.ErrNotFound {
+			return 0, db.ErrConflict
+		} else if err != nil {
+			return 0, err
 		}
-		c.StatusCode(iris.StatusInternalServerError)
+		if rev, err = update(rev); err != db.ErrConflict {
+			return rev, err
+		}
+	}
+}
+
+// setETag set ETag header to revision
+func setETag(c iris.Context, revision int64) {
+	c.Header("ETag", strconv.Quote(strconv.FormatInt(revision, 10)))
+}
+
+// responseError write error response according to type of err
+func (api *RbacApi) responseError(c iris.Context, err error) {
+	if err == db.ErrConflict {
+		c.StatusCode(iris.StatusPreconditionFailed)
+		c.JSON(iris.Map{
+			"code":    ErrConflict,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err == db.ErrAlreadyExists {
+		c.StatusCode(iris.StatusConflict)
+		c.JSON(iris.Map{
+			"code":    ErrConflict,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if e, ok := err.(*rbac.ReferenceError); ok {
+		c.StatusCode(iris.StatusBadRequest)
+		c.JSON(iris.Map{
+			"code":                ErrBadPrams,
+			"message":             err.Error(),
+			"unknown_permissions": e.Permissions,
+			"unknown_roles":       e.Roles,
+		})
+		return
+	}
+
+	if e, ok := err.(*rbac.SoDError); ok {
+		c.StatusCode(iris.StatusConflict)
+		c.JSON(iris.Map{
+			"code":    ErrConstraint,
+			"message": err.Error(),
+			"rule":    e.Rule,
+			"roles":   e.Roles,
+		})
+		return
+	}
+
+	if e, ok := err.(*rbac.NotAssignedError); ok {
+		c.StatusCode(iris.StatusConflict)
+		c.JSON(iris.Map{
+			"code":    ErrConstraint,
+			"message": err.Error(),
+			"roles":   e.Roles,
+		})
+		return
+	}
+
+	if e, ok := err.(*rbac.NotDelegableError); ok {
+		c.StatusCode(iris.StatusConflict)
+		c.JSON(iris.Map{
+			"code":    ErrConstraint,
+			"message": err.Error(),
+			"roles":   e.Roles,
+		})
+		return
+	}
+
+	if e, ok := err.(*rbac.PrerequisiteError); ok {
+		c.StatusCode(iris.StatusConflict)
+		c.JSON(iris.Map{
+			"code":    ErrConstraint,
+			"message": err.Error(),
+			"role":    e.Role,
+			"missing": e.Missing,
+		})
+		return
+	}
+
+	if e, ok := err.(*rbac.MaxMembersError); ok {
+		c.StatusCode(iris.StatusConflict)
+		c.JSON(iris.Map{
+			"code":        ErrConstraint,
+			"message":     err.Error(),
+			"role":        e.Role,
+			"max_members": e.MaxMembers,
+		})
+		return
+	}
+
+	if err == model.ErrInvalidPeriod || err == model.ErrInvalidCardinality || err == model.ErrInvalidMaxMembers ||
+		err == model.ErrSelfDelegation {
+		c.StatusCode(iris.StatusBadRequest)
+		c.JSON(iris.Map{
+			"code":    ErrBadPrams,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if _, ok := err.(*model.ConditionError); ok {
+		c.StatusCode(iris.StatusBadRequest)
+		c.JSON(iris.Map{
+			"code":    ErrBadPrams,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if e, ok := err.(*rbac.CycleError); ok {
+		c.StatusCode(iris.StatusBadRequest)
+		c.JSON(iris.Map{
+			"code":    ErrBadPrams,
+			"message": err.Error(),
+			"cycle":   e.Path,
+		})
+		return
+	}
+
+	if strings.Contains(err.Error(), NotFound) {
+		c.StatusCode(iris.StatusOK)
 		c.JSON(iris.Map{
-			"code":    ErrInternelServerError,
+			"code":    ErrNotFound,
 			"message": err.Error(),
 		})
 		return
 	}
+
+	c.StatusCode(iris.StatusInternalServerError)
+	c.JSON(iris.Map{
+		"code":    ErrInternelServerError,
+		"message": err.Error(),
+	})
+}
+
+func (api *RbacApi) responseByError(c iris.Context, err error) {
+	if err != nil {
+		api.responseError(c, err)
+		return
+	}
 	c.JSON(iris.Map{
 		"code":    ErrOK,
 		"message": Success,
@@ -111,20 +308,7 @@ func (api *RbacApi) responseByError(c iris.Context, err error) {
 
 func (api *RbacApi) responseAdditionData(c iris.Context, err error, jsonKey string, jsonValue interface{}) {
 	if err != nil {
-		if strings.Contains(err.Error(), NotFound) {
-			c.StatusCode(iris.StatusOK)
-			c.JSON(iris.Map{
-				"code":    ErrNotFound,
-				"message": err.Error(),
-			})
-			return
-		}
-
-		c.StatusCode(iris.StatusInternalServerError)
-		c.JSON(iris.Map{
-			"code":    ErrInternelServerError,
-			"message": err.Error(),
-		})
+		api.responseError(c, err)
 		return
 	}
 	c.JSON(iris.Map{
@@ -141,7 +325,45 @@ func (api *RbacApi) IsPermit(c iris.Context) {
 		return
 	}
 
-	permit, err := api.rbac.IsPermit(params["system"], params["uid"], params["permission"])
+	var permit bool
+	domain := c.URLParam("domain")
+	if s := c.URLParam("resource"); s != "" {
+		var resource model.Resource
+		resource, err = model.ParseResource(s)
+		if err == nil && domain != "" {
+			err = errors.New("resource can't be checked within domain")
+		}
+		if err != nil {
+			c.StatusCode(iris.StatusBadRequest)
+			c.JSON(iris.Map{
+				"code":    ErrBadPrams,
+				"message": err.Error(),
+			})
+			return
+		}
+		permit, err = api.rbac.IsPermitOnContext(c.Request().Context(), params["system"], params["uid"], params["permission"], resource)
+	} else if domain != "" {
+		permit, err = api.rbac.IsPermitInDomainContext(c.Request().Context(), params["system"], params["uid"], domain, params["permission"])
+	} else {
+		permit, err = api.rbac.IsPermitContext(c.Request().Context(), params["system"], params["uid"], params["permission"])
+	}
+	api.responseAdditionData(c, err, "permit", permit)
+}
+
+// IsPermitWithContext check whether have specified permission, attributes of request at json body are
+// evaluated against conditional permissions
+func (api *RbacApi) IsPermitWithContext(c iris.Context) {
+	var p struct {
+		System     string                 `json:"system" validate:"required"`
+		UID        string                 `json:"uid" validate:"required"`
+		Permission string                 `json:"permission" validate:"required"`
+		Attrs      map[string]interface{} `json:"attrs"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	permit, err := api.rbac.IsPermitWithContextContext(c.Request().Context(), p.System, p.UID, p.Permission, p.Attrs)
 	api.responseAdditionData(c, err, "permit", permit)
 }
 
@@ -152,7 +374,7 @@ func (api *RbacApi) RegisterPermission(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.RegisterPermission(p.System, p.Name, p.Desc)
+	err := api.rbac.RegisterPermissionContext(c.Request().Context(), p.System, p.Name, p.Desc)
 	api.responseByError(c, err)
 }
 
@@ -163,8 +385,8 @@ func (api *RbacApi) UnregisterPermission(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.UnregisterPermission(p.System, p.Name)
-	api.responseByError(c, err)
+	affected, err := api.rbac.UnregisterPermissionContext(c.Request().Context(), p.System, p.Name)
+	api.responseAdditionData(c, err, "affected", affected)
 }
 
 // GetAllPermissionsBySystem get all permissions of specified system
@@ -174,7 +396,12 @@ func (api *RbacApi) GetAllPermissionsBySystem(c iris.Context) {
 		return
 	}
 
-	ps, err := api.rbac.GetAllPermissionsBySystem(params["system"])
+	var ps []model.Permission
+	if pattern := c.URLParam("pattern"); pattern != "" {
+		ps, err = api.rbac.GetPermissionsMatchingContext(c.Request().Context(), params["system"], pattern)
+	} else {
+		ps, err = api.rbac.GetAllPermissionsBySystemContext(c.Request().Context(), params["system"])
+	}
 	if err != nil && strings.Contains(err.Error(), NotFound) {
 		c.StatusCode(iris.StatusOK)
 		c.JSON(iris.Map{
@@ -198,8 +425,8 @@ func (api *RbacApi) UpdatePermission(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.UpdatePermission(p.System, p.OldName, p.NewName)
-	api.responseByError(c, err)
+	affected, err := api.rbac.UpdatePermissionContext(c.Request().Context(), p.System, p.OldName, p.NewName)
+	api.responseAdditionData(c, err, "affected", affected)
 }
 
 // RegisterRole register role
@@ -209,7 +436,26 @@ func (api *RbacApi) RegisterRole(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.RegisterRole(role.System, role.Name, role.Desc, role.Permissions...)
+	revision, ok, err := ifMatch(c)
+	if err != nil {
+		return
+	}
+	if ok {
+		ctx := c.Request().Context()
+		revision, err = updateIfMatch(revision, func() (int64, error) {
+			current, err := api.rbac.GetRoleOfSystemContext(ctx, role.System, role.Name)
+			return current.Revision, err
+		}, func(revision int64) (int64, error) {
+			return api.rbac.UpdateRoleIfMatchContext(ctx, role.System, role.Name, role.Desc, revision, role.Permissions...)
+		})
+		if err == nil {
+			setETag(c, revision)
+		}
+		api.responseByError(c, err)
+		return
+	}
+
+	err = api.rbac.RegisterRoleContext(c.Request().Context(), role.System, role.Name, role.Desc, role.Permissions...)
 	api.responseByError(c, err)
 }
 
@@ -223,8 +469,8 @@ func (api *RbacApi) UnregisterRole(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.UnregisterRole(role.System, role.Name)
-	api.responseByError(c, err)
+	affected, err := api.rbac.UnregisterRoleContext(c.Request().Context(), role.System, role.Name)
+	api.responseAdditionData(c, err, "affected", affected)
 }
 
 // UnregisterAllRoles unregister all role of specified system
@@ -237,7 +483,7 @@ func (api *RbacApi) UnregisterAllRoles(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.UnregisterAllRoles(role.System)
+	err := api.rbac.UnregisterAllRolesContext(c.Request().Context(), role.System)
 	api.responseByError(c, err)
 }
 
@@ -248,7 +494,7 @@ func (api *RbacApi) GetRoleOfSystem(c iris.Context) {
 		return
 	}
 
-	role, err := api.rbac.GetRoleOfSystem(params["system"], params["role"])
+	role, err := api.rbac.GetRoleOfSystemContext(c.Request().Context(), params["system"], params["role"])
 	if err != nil && strings.Contains(err.Error(), NotFound) {
 		c.StatusCode(iris.StatusOK)
 		c.JSON(iris.Map{
@@ -258,6 +504,9 @@ func (api *RbacApi) GetRoleOfSystem(c iris.Context) {
 		return
 	}
 
+	if err == nil {
+		setETag(c, role.Revision)
+	}
 	api.responseAdditionData(c, err, "role", role)
 }
 
@@ -268,7 +517,7 @@ func (api *RbacApi) GetAllRolesOfSystem(c iris.Context) {
 		return
 	}
 
-	roles, err := api.rbac.GetAllRolesOfSystem(params["system"])
+	roles, err := api.rbac.GetAllRolesOfSystemContext(c.Request().Context(), params["system"])
 	if err != nil && strings.Contains(err.Error(), NotFound) {
 		c.StatusCode(iris.StatusOK)
 		c.JSON(iris.Map{
@@ -292,8 +541,8 @@ func (api *RbacApi) UpdateRoleName(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.UpdateRoleName(p.System, p.OldName, p.NewName)
-	api.responseByError(c, err)
+	affected, err := api.rbac.UpdateRoleNameContext(c.Request().Context(), p.System, p.OldName, p.NewName)
+	api.responseAdditionData(c, err, "affected", affected)
 }
 
 // GetPermissionsOfRole get all permissions of role
@@ -303,7 +552,7 @@ func (api *RbacApi) GetPermissionsOfRole(c iris.Context) {
 		return
 	}
 
-	ps, err := api.rbac.GetPermissionsOfRole(params["system"], params["role"])
+	ps, err := api.rbac.GetPermissionsOfRoleContext(c.Request().Context(), params["system"], params["role"])
 	if err != nil && strings.Contains(err.Error(), NotFound) {
 		c.StatusCode(iris.StatusOK)
 		c.JSON(iris.Map{
@@ -327,7 +576,7 @@ func (api *RbacApi) GrantPermissionsToRole(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.GrantPermissionsToRole(p.System, p.Role, p.Permissions...)
+	err := api.rbac.GrantPermissionsToRoleContext(c.Request().Context(), p.System, p.Role, p.Permissions...)
 	api.responseByError(c, err)
 }
 
@@ -342,202 +591,384 @@ func (api *RbacApi) RemovePermissionFromRole(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.RemovePermissionFromRole(p.System, p.Role, p.Permission)
+	err := api.rbac.RemovePermissionFromRoleContext(c.Request().Context(), p.System, p.Role, p.Permission)
 	api.responseByError(c, err)
 }
 
-// RegisterUser register user permission info into mongo
-func (api *RbacApi) RegisterUser(c iris.Context) {
-	var p model.UserPermModel
+// DenyPermissionsToRole deny permissions to users holding specified role
+func (api *RbacApi) DenyPermissionsToRole(c iris.Context) {
+	var p struct {
+		System      string   `json:"system" validate:"required"`
+		Role        string   `json:"role" validate:"required"`
+		Permissions []string `json:"permissions" validate:"required"`
+	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.RegisterUser(p.System, p.UID, p.Roles...)
+	err := api.rbac.DenyPermissionsToRoleContext(c.Request().Context(), p.System, p.Role, p.Permissions...)
 	api.responseByError(c, err)
 }
 
-// UnregisterUser remove user info from mongo
-func (api *RbacApi) UnregisterUser(c iris.Context) {
+// RemoveDeniedPermissionFromRole stop denying permission to users holding specified role
+func (api *RbacApi) RemoveDeniedPermissionFromRole(c iris.Context) {
 	var p struct {
-		System string `json:"system" validate:"required"`
-		UID    string `json:"uid" validate:"required"`
+		System     string `json:"system" validate:"required"`
+		Role       string `json:"role" validate:"required"`
+		Permission string `json:"permission" validate:"required"`
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.UnregisterUser(p.System, p.UID)
+	err := api.rbac.RemoveDeniedPermissionFromRoleContext(c.Request().Context(), p.System, p.Role, p.Permission)
 	api.responseByError(c, err)
 }
 
-// UpdateUser update user info
-func (api *RbacApi) UpdateUser(c iris.Context) {
+// GrantConditionalPermission grant permission to specified role under condition
+func (api *RbacApi) GrantConditionalPermission(c iris.Context) {
 	var p struct {
-		System   string   `json:"system" validate:"required"`
-		UID      string   `json:"uid" validate:"required"`
-		NewRoles []string `json:"new_roles" validate:"required"`
+		System     string `json:"system" validate:"required"`
+		Role       string `json:"role" validate:"required"`
+		Permission string `json:"permission" validate:"required"`
+		Expr       string `json:"expr" validate:"required"`
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.UpdateUser(p.System, p.UID, p.NewRoles...)
+	err := api.rbac.GrantConditionalPermissionContext(c.Request().Context(), p.System, p.Role, p.Permission, p.Expr)
 	api.responseByError(c, err)
 }
 
-// GetUser get user info
-func (api *RbacApi) GetUser(c iris.Context) {
-	params, err := checkUrlParams(c, "system", "uid")
-	if err != nil {
-		return
+// RemoveConditionalPermission remove conditional permission from specified role
+func (api *RbacApi) RemoveConditionalPermission(c iris.Context) {
+	var p struct {
+		System     string `json:"system" validate:"required"`
+		Role       string `json:"role" validate:"required"`
+		Permission string `json:"permission" validate:"required"`
 	}
-
-	u, err := api.rbac.GetUser(params["system"], params["uid"])
-	api.responseAdditionData(c, err, "user", u)
-}
-
-// GetAllRolesByUID get all roles with uid
-func (api *RbacApi) GetAllRolesByUID(c iris.Context) {
-	params, err := checkUrlParams(c, "system", "uid")
-	if err != nil {
+	if validateParams(c, &p) != nil {
 		return
 	}
 
-	roles, err := api.rbac.GetAllRolesByUID(params["system"], params["uid"])
-	api.responseAdditionData(c, err, "roles", roles)
+	err := api.rbac.RemoveConditionalPermissionContext(c.Request().Context(), p.System, p.Role, p.Permission)
+	api.responseByError(c, err)
 }
 
-// UpdateRoles update user's all roles
-func (api *RbacApi) UpdateRoles(c iris.Context) {
-	var p model.UserPermModel
+// AddParentsToRole add parents to specified role
+func (api *RbacApi) AddParentsToRole(c iris.Context) {
+	var p struct {
+		System  string   `json:"system" validate:"required"`
+		Role    string   `json:"role" validate:"required"`
+		Parents []string `json:"parents" validate:"required"`
+	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.UpdateRoles(p.System, p.UID, p.Roles...)
+	err := api.rbac.AddParentsToRoleContext(c.Request().Context(), p.System, p.Role, p.Parents...)
 	api.responseByError(c, err)
 }
 
-// AddRoles add specified roles into user's permission model
-func (api *RbacApi) AddRoles(c iris.Context) {
-	var p model.UserPermModel
+// RemoveParentFromRole remove specified parent from specified role
+func (api *RbacApi) RemoveParentFromRole(c iris.Context) {
+	var p struct {
+		System string `json:"system" validate:"required"`
+		Role   string `json:"role" validate:"required"`
+		Parent string `json:"parent" validate:"required"`
+	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.AddRoles(p.System, p.UID, p.Roles...)
+	err := api.rbac.RemoveParentFromRoleContext(c.Request().Context(), p.System, p.Role, p.Parent)
 	api.responseByError(c, err)
 }
 
-// RemoveRoles remove specified role from user's permission model
-func (api *RbacApi) RemoveRoles(c iris.Context) {
+// SetRoleConstraints replace max members and prerequisites of specified role
+func (api *RbacApi) SetRoleConstraints(c iris.Context) {
 	var p struct {
-		System string `json:"system"  validate:"required"`
-		UID    string `json:"uid" validate:"required"`
-		Role   string `json:"role" validate:"required"`
+		System        string   `json:"system" validate:"required"`
+		Role          string   `json:"role" validate:"required"`
+		MaxMembers    int      `json:"max_members"`
+		Prerequisites []string `json:"prerequisites"`
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.RemoveRoles(p.System, p.UID, p.Role)
+	err := api.rbac.SetRoleConstraintsContext(c.Request().Context(), p.System, p.Role, p.MaxMembers, p.Prerequisites...)
 	api.responseByError(c, err)
 }
 
-// GetBlackList get user permission model's blacklist, which contain all permissions forbidden
-func (api *RbacApi) GetBlackList(c iris.Context) {
-	params, err := checkUrlParams(c, "system", "uid")
+// GetAncestorsOfRole get all roles inherited by specified role
+func (api *RbacApi) GetAncestorsOfRole(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "role")
 	if err != nil {
 		return
 	}
 
-	bl, err := api.rbac.GetBlackList(params["system"], params["uid"])
-	api.responseAdditionData(c, err, "blacklist", bl)
+	roles, err := api.rbac.GetAncestorsOfRoleContext(c.Request().Context(), params["system"], params["role"])
+	api.responseAdditionData(c, err, "ancestors", roles)
 }
 
-// AddToBlackList add specified permissions into user permission model's blacklist
-func (api *RbacApi) AddToBlackList(c iris.Context) {
-	var p struct {
-		System      string   `json:"system"  validate:"required"`
-		UID         string   `json:"uid" validate:"required"`
-		Permissions []string `json:"permissions"validate:"required"`
-	}
-	if validateParams(c, &p) != nil {
+// GetDescendantsOfRole get all roles inheriting specified role
+func (api *RbacApi) GetDescendantsOfRole(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "role")
+	if err != nil {
 		return
 	}
 
-	err := api.rbac.AddToBlackList(p.System, p.UID, p.Permissions...)
-	api.responseByError(c, err)
+	roles, err := api.rbac.GetDescendantsOfRoleContext(c.Request().Context(), params["system"], params["role"])
+	api.responseAdditionData(c, err, "descendants", roles)
 }
 
-// RemoveFromBlackList remove specified permission from blacklist
-func (api *RbacApi) RemoveFromBlackList(c iris.Context) {
+// provenance hold optional fields of requests assigning roles, whitelisted or blacklisted permissions to user,
+// which are recorded as provenance of the assigned entries
+type provenance struct {
+	GrantedBy string `json:"granted_by"`
+	Reason    string `json:"reason"`
+	Ticket    string `json:"ticket"`
+}
+
+// context return context of request carrying p
+func (p provenance) context(c iris.Context) context.Context {
+	return rbac.WithProvenance(c.Request().Context(), model.Provenance{GrantedBy: p.GrantedBy, Reason: p.Reason, Ticket: p.Ticket})
+}
+
+// RegisterUser register user permission info into mongo
+func (api *RbacApi) RegisterUser(c iris.Context) {
 	var p struct {
-		System     string `json:"system"  validate:"required"`
-		UID        string `json:"uid" validate:"required"`
-		Permission string `json:"permission"validate:"required"`
+		model.UserPermModel
+		provenance
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.RemoveFromBlackList(p.System, p.UID, p.Permission)
+	err := api.rbac.RegisterUserContext(p.context(c), p.System, p.UID, p.Roles...)
 	api.responseByError(c, err)
 }
 
-// ClearBlackList clear blacklist
-func (api *RbacApi) ClearBlackList(c iris.Context) {
+// UnregisterUser remove user info from mongo
+func (api *RbacApi) UnregisterUser(c iris.Context) {
 	var p struct {
-		System string `json:"system"  validate:"required"`
+		System string `json:"system" validate:"required"`
 		UID    string `json:"uid" validate:"required"`
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.ClearBlackList(p.System, p.UID)
+	err := api.rbac.UnregisterUserContext(c.Request().Context(), p.System, p.UID)
 	api.responseByError(c, err)
 }
 
-// GetWhiteList get user permission model's whitelist, which contain all permissions allowed all the time
-func (api *RbacApi) GetWhiteList(c iris.Context) {
-	params, err := checkUrlParams(c, "system", "uid")
-	if err != nil {
+// UpdateUser update user info
+func (api *RbacApi) UpdateUser(c iris.Context) {
+	var p struct {
+		System   string   `json:"system" validate:"required"`
+		UID      string   `json:"uid" validate:"required"`
+		NewRoles []string `json:"new_roles" validate:"required"`
+		provenance
+	}
+	if validateParams(c, &p) != nil {
 		return
 	}
 
-	wl, err := api.rbac.GetWhiteList(params["system"], params["uid"])
-	api.responseAdditionData(c, err, "whitelist", wl)
-}
-
-// UpdateWhiteList update whitelist with 'wl'
-func (api *RbacApi) UpdateWhiteList(c iris.Context) {
+	revision, ok, err := ifMatch(c)
+	if err != nil {
+		return
+	}
+	if ok {
+		ctx := p.context(c)
+		revision, err = updateIfMatch(revision, func() (int64, error) {
+			current, err := api.rbac.GetUserContext(ctx, p.System, p.UID)
+			return current.Revision, err
+		}, func(revision int64) (int64, error) {
+			return api.rbac.UpdateUserIfMatchContext(ctx, p.System, p.UID, revision, p.NewRoles...)
+		})
+		if err == nil {
+			setETag(c, revision)
+		}
+		api.responseByError(c, err)
+		return
+	}
+
+	err = api.rbac.UpdateUserContext(p.context(c), p.System, p.UID, p.NewRoles...)
+	api.responseByError(c, err)
+}
+
+// GetUser get user info
+func (api *RbacApi) GetUser(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	u, err := api.rbac.GetUserContext(c.Request().Context(), params["system"], params["uid"])
+	if err == nil {
+		setETag(c, u.Revision)
+	}
+	api.responseAdditionData(c, err, "user", u)
+}
+
+// GetAllRolesByUID get all roles with uid
+func (api *RbacApi) GetAllRolesByUID(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	roles, err := api.rbac.GetAllRolesByUIDContext(c.Request().Context(), params["system"], params["uid"])
+	api.responseAdditionData(c, err, "roles", roles)
+}
+
+// UpdateRoles update user's all roles
+func (api *RbacApi) UpdateRoles(c iris.Context) {
+	var p struct {
+		model.UserPermModel
+		provenance
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.UpdateRolesContext(p.context(c), p.System, p.UID, p.Roles...)
+	api.responseByError(c, err)
+}
+
+// AddRoles add specified roles into user's permission model, optionally within a period
+func (api *RbacApi) AddRoles(c iris.Context) {
+	var p struct {
+		System string   `json:"system"  validate:"required"`
+		UID    string   `json:"uid" validate:"required"`
+		Roles  []string `json:"roles" validate:"required"`
+		model.Period
+		provenance
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddRolesWithinContext(p.context(c), p.System, p.UID, p.Period, p.Roles...)
+	api.responseByError(c, err)
+}
+
+// RemoveRoles remove specified role from user's permission model
+func (api *RbacApi) RemoveRoles(c iris.Context) {
+	var p struct {
+		System string `json:"system"  validate:"required"`
+		UID    string `json:"uid" validate:"required"`
+		Role   string `json:"role" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveRolesContext(c.Request().Context(), p.System, p.UID, p.Role)
+	api.responseByError(c, err)
+}
+
+// GetBlackList get user permission model's blacklist, which contain all permissions forbidden
+func (api *RbacApi) GetBlackList(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	bl, err := api.rbac.GetBlackListContext(c.Request().Context(), params["system"], params["uid"])
+	api.responseAdditionData(c, err, "blacklist", bl)
+}
+
+// AddToBlackList add specified permissions into user permission model's blacklist, optionally within a period
+func (api *RbacApi) AddToBlackList(c iris.Context) {
+	var p struct {
+		System      string   `json:"system"  validate:"required"`
+		UID         string   `json:"uid" validate:"required"`
+		Permissions []string `json:"permissions" validate:"required"`
+		model.Period
+		provenance
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddToBlackListWithinContext(p.context(c), p.System, p.UID, p.Period, p.Permissions...)
+	api.responseByError(c, err)
+}
+
+// RemoveFromBlackList remove specified permission from blacklist
+func (api *RbacApi) RemoveFromBlackList(c iris.Context) {
+	var p struct {
+		System     string `json:"system"  validate:"required"`
+		UID        string `json:"uid" validate:"required"`
+		Permission string `json:"permission" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveFromBlackListContext(c.Request().Context(), p.System, p.UID, p.Permission)
+	api.responseByError(c, err)
+}
+
+// ClearBlackList clear blacklist
+func (api *RbacApi) ClearBlackList(c iris.Context) {
+	var p struct {
+		System string `json:"system"  validate:"required"`
+		UID    string `json:"uid" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.ClearBlackListContext(c.Request().Context(), p.System, p.UID)
+	api.responseByError(c, err)
+}
+
+// GetWhiteList get user permission model's whitelist, which contain all permissions allowed all the time
+func (api *RbacApi) GetWhiteList(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	wl, err := api.rbac.GetWhiteListContext(c.Request().Context(), params["system"], params["uid"])
+	api.responseAdditionData(c, err, "whitelist", wl)
+}
+
+// UpdateWhiteList update whitelist with 'wl'
+func (api *RbacApi) UpdateWhiteList(c iris.Context) {
 	var p struct {
 		System    string   `json:"system"  validate:"required"`
 		UID       string   `json:"uid" validate:"required"`
-		WhiteList []string `json:"whitelist"validate:"required"`
+		WhiteList []string `json:"whitelist" validate:"required"`
+		provenance
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.UpdateWhiteList(p.System, p.UID, p.WhiteList...)
+	err := api.rbac.UpdateWhiteListContext(p.context(c), p.System, p.UID, p.WhiteList...)
 	api.responseByError(c, err)
 }
 
-// AddToWhiteList add specified permission into user permission model's whitelist
+// AddToWhiteList add specified permission into user permission model's whitelist, optionally within a period
 func (api *RbacApi) AddToWhiteList(c iris.Context) {
 	var p struct {
 		System      string   `json:"system"  validate:"required"`
 		UID         string   `json:"uid" validate:"required"`
-		Permissions []string `json:"permissions"validate:"required"`
+		Permissions []string `json:"permissions" validate:"required"`
+		model.Period
+		provenance
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.AddToWhiteList(p.System, p.UID, p.Permissions...)
+	err := api.rbac.AddToWhiteListWithinContext(p.context(c), p.System, p.UID, p.Period, p.Permissions...)
 	api.responseByError(c, err)
 }
 
@@ -546,13 +977,13 @@ func (api *RbacApi) RemoveFromWhiteList(c iris.Context) {
 	var p struct {
 		System     string `json:"system"  validate:"required"`
 		UID        string `json:"uid" validate:"required"`
-		Permission string `json:"permission"validate:"required"`
+		Permission string `json:"permission" validate:"required"`
 	}
 	if validateParams(c, &p) != nil {
 		return
 	}
 
-	err := api.rbac.RemoveFromWhiteList(p.System, p.UID, p.Permission)
+	err := api.rbac.RemoveFromWhiteListContext(c.Request().Context(), p.System, p.UID, p.Permission)
 	api.responseByError(c, err)
 }
 
@@ -566,6 +997,576 @@ func (api *RbacApi) ClearWhiteList(c iris.Context) {
 		return
 	}
 
-	err := api.rbac.ClearWhiteList(p.System, p.UID)
+	err := api.rbac.ClearWhiteListContext(c.Request().Context(), p.System, p.UID)
+	api.responseByError(c, err)
+}
+
+// GetGrants get grants on resources of user
+func (api *RbacApi) GetGrants(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	grants, err := api.rbac.GetGrantsContext(c.Request().Context(), params["system"], params["uid"])
+	api.responseAdditionData(c, err, "grants", grants)
+}
+
+// AddGrants grant permissions on resources to user
+func (api *RbacApi) AddGrants(c iris.Context) {
+	var p struct {
+		System string        `json:"system" validate:"required"`
+		UID    string        `json:"uid" validate:"required"`
+		Grants []model.Grant `json:"grants" validate:"required,dive"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddGrantsContext(c.Request().Context(), p.System, p.UID, p.Grants...)
+	api.responseByError(c, err)
+}
+
+// RemoveGrant remove specified grant from user
+func (api *RbacApi) RemoveGrant(c iris.Context) {
+	var p struct {
+		System string      `json:"system" validate:"required"`
+		UID    string      `json:"uid" validate:"required"`
+		Grant  model.Grant `json:"grant" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveGrantContext(c.Request().Context(), p.System, p.UID, p.Grant)
+	api.responseByError(c, err)
+}
+
+// RegisterGroup register group
+func (api *RbacApi) RegisterGroup(c iris.Context) {
+	var group struct {
+		System string   `json:"system" validate:"required"`
+		Name   string   `json:"name" validate:"required"`
+		Desc   string   `json:"desc"`
+		Roles  []string `json:"roles"`
+	}
+	if validateParams(c, &group) != nil {
+		return
+	}
+
+	err := api.rbac.RegisterGroupContext(c.Request().Context(), group.System, group.Name, group.Desc, group.Roles...)
+	api.responseByError(c, err)
+}
+
+// UnregisterGroup unregister specified group of specified system
+func (api *RbacApi) UnregisterGroup(c iris.Context) {
+	var group struct {
+		System string `json:"system" validate:"required"`
+		Name   string `json:"name" validate:"required"`
+	}
+	if validateParams(c, &group) != nil {
+		return
+	}
+
+	err := api.rbac.UnregisterGroupContext(c.Request().Context(), group.System, group.Name)
+	api.responseByError(c, err)
+}
+
+// GetGroup get specified group of system by name
+func (api *RbacApi) GetGroup(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "group")
+	if err != nil {
+		return
+	}
+
+	group, err := api.rbac.GetGroupContext(c.Request().Context(), params["system"], params["group"])
+	api.responseAdditionData(c, err, "group", group)
+}
+
+// GetAllGroups get all groups of specified system
+func (api *RbacApi) GetAllGroups(c iris.Context) {
+	params, err := checkUrlParams(c, "system")
+	if err != nil {
+		return
+	}
+
+	groups, err := api.rbac.GetAllGroupsContext(c.Request().Context(), params["system"])
+	api.responseAdditionData(c, err, "groups", groups)
+}
+
+// GetDomainsOfUser get all domains in which user holds any entry
+func (api *RbacApi) GetDomainsOfUser(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	domains, err := api.rbac.GetDomainsOfUserContext(c.Request().Context(), params["system"], params["uid"])
+	api.responseAdditionData(c, err, "domains", domains)
+}
+
+// AddRolesInDomain assign roles to user within domain
+func (api *RbacApi) AddRolesInDomain(c iris.Context) {
+	var p struct {
+		System string   `json:"system"  validate:"required"`
+		UID    string   `json:"uid" validate:"required"`
+		Domain string   `json:"domain" validate:"required"`
+		Roles  []string `json:"roles" validate:"required"`
+		provenance
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddRolesInDomainContext(p.context(c), p.System, p.UID, p.Domain, p.Roles...)
+	api.responseByError(c, err)
+}
+
+// RemoveRoleInDomain revoke role assigned to user within domain
+func (api *RbacApi) RemoveRoleInDomain(c iris.Context) {
+	var p struct {
+		System string `json:"system"  validate:"required"`
+		UID    string `json:"uid" validate:"required"`
+		Domain string `json:"domain" validate:"required"`
+		Role   string `json:"role" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveRoleInDomainContext(c.Request().Context(), p.System, p.UID, p.Domain, p.Role)
+	api.responseByError(c, err)
+}
+
+// AddToWhiteListInDomain grant permissions to user within domain
+func (api *RbacApi) AddToWhiteListInDomain(c iris.Context) {
+	var p struct {
+		System      string   `json:"system"  validate:"required"`
+		UID         string   `json:"uid" validate:"required"`
+		Domain      string   `json:"domain" validate:"required"`
+		Permissions []string `json:"permissions" validate:"required"`
+		provenance
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddToWhiteListInDomainContext(p.context(c), p.System, p.UID, p.Domain, p.Permissions...)
+	api.responseByError(c, err)
+}
+
+// RemoveFromWhiteListInDomain remove permission whitelisted within domain
+func (api *RbacApi) RemoveFromWhiteListInDomain(c iris.Context) {
+	var p struct {
+		System     string `json:"system"  validate:"required"`
+		UID        string `json:"uid" validate:"required"`
+		Domain     string `json:"domain" validate:"required"`
+		Permission string `json:"permission" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveFromWhiteListInDomainContext(c.Request().Context(), p.System, p.UID, p.Domain, p.Permission)
+	api.responseByError(c, err)
+}
+
+// AddToBlackListInDomain forbid permissions to user within domain
+func (api *RbacApi) AddToBlackListInDomain(c iris.Context) {
+	var p struct {
+		System      string   `json:"system"  validate:"required"`
+		UID         string   `json:"uid" validate:"required"`
+		Domain      string   `json:"domain" validate:"required"`
+		Permissions []string `json:"permissions" validate:"required"`
+		provenance
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddToBlackListInDomainContext(p.context(c), p.System, p.UID, p.Domain, p.Permissions...)
+	api.responseByError(c, err)
+}
+
+// RemoveFromBlackListInDomain remove permission blacklisted within domain
+func (api *RbacApi) RemoveFromBlackListInDomain(c iris.Context) {
+	var p struct {
+		System     string `json:"system"  validate:"required"`
+		UID        string `json:"uid" validate:"required"`
+		Domain     string `json:"domain" validate:"required"`
+		Permission string `json:"permission" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveFromBlackListInDomainContext(c.Request().Context(), p.System, p.UID, p.Domain, p.Permission)
+	api.responseByError(c, err)
+}
+
+// GetGroupsOfUser get all groups which user belongs to
+func (api *RbacApi) GetGroupsOfUser(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	groups, err := api.rbac.GetGroupsOfUserContext(c.Request().Context(), params["system"], params["uid"])
+	api.responseAdditionData(c, err, "groups", groups)
+}
+
+// Delegate delegate roles of delegator to delegate, optionally within a period
+func (api *RbacApi) Delegate(c iris.Context) {
+	var p model.Delegation
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.DelegateContext(c.Request().Context(), p.System, p.Delegator, p.Delegate, p.Period, p.Transitive, p.Roles...)
+	api.responseByError(c, err)
+}
+
+// Revoke remove delegation from delegator to delegate
+func (api *RbacApi) Revoke(c iris.Context) {
+	var p struct {
+		System    string `json:"system" validate:"required"`
+		Delegator string `json:"delegator" validate:"required"`
+		Delegate  string `json:"delegate" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RevokeContext(c.Request().Context(), p.System, p.Delegator, p.Delegate)
+	api.responseByError(c, err)
+}
+
+// GetDelegations get delegations made by and received by user
+func (api *RbacApi) GetDelegations(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "uid")
+	if err != nil {
+		return
+	}
+
+	ctx := c.Request().Context()
+	from, err := api.rbac.GetDelegationsFromContext(ctx, params["system"], params["uid"])
+	if err != nil {
+		api.responseError(c, err)
+		return
+	}
+	to, err := api.rbac.GetDelegationsToContext(ctx, params["system"], params["uid"])
+	api.responseAdditionData(c, err, "delegations", iris.Map{"from": from, "to": to})
+}
+
+// AddMembersToGroup add users to group
+func (api *RbacApi) AddMembersToGroup(c iris.Context) {
+	var p struct {
+		System string   `json:"system" validate:"required"`
+		Name   string   `json:"name" validate:"required"`
+		UIDs   []string `json:"uids" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddMembersToGroupContext(c.Request().Context(), p.System, p.Name, p.UIDs...)
+	api.responseByError(c, err)
+}
+
+// RemoveMemberFromGroup remove user from group
+func (api *RbacApi) RemoveMemberFromGroup(c iris.Context) {
+	var p struct {
+		System string `json:"system" validate:"required"`
+		Name   string `json:"name" validate:"required"`
+		UID    string `json:"uid" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveMemberFromGroupContext(c.Request().Context(), p.System, p.Name, p.UID)
+	api.responseByError(c, err)
+}
+
+// AddRolesToGroup assign roles to all members of group
+func (api *RbacApi) AddRolesToGroup(c iris.Context) {
+	var p struct {
+		System string   `json:"system" validate:"required"`
+		Name   string   `json:"name" validate:"required"`
+		Roles  []string `json:"roles" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.AddRolesToGroupContext(c.Request().Context(), p.System, p.Name, p.Roles...)
+	api.responseByError(c, err)
+}
+
+// RemoveRoleFromGroup remove role from group
+func (api *RbacApi) RemoveRoleFromGroup(c iris.Context) {
+	var p struct {
+		System string `json:"system" validate:"required"`
+		Name   string `json:"name" validate:"required"`
+		Role   string `json:"role" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveRoleFromGroupContext(c.Request().Context(), p.System, p.Name, p.Role)
+	api.responseByError(c, err)
+}
+
+// AddSoDRule add separation-of-duty rule and report users already violating it
+func (api *RbacApi) AddSoDRule(c iris.Context) {
+	var rule struct {
+		System      string   `json:"system" validate:"required"`
+		Name        string   `json:"name" validate:"required"`
+		Desc        string   `json:"desc"`
+		Roles       []string `json:"roles" validate:"required"`
+		Cardinality int      `json:"cardinality"`
+		Dynamic     bool     `json:"dynamic"`
+	}
+	if validateParams(c, &rule) != nil {
+		return
+	}
+
+	// users may hold all roles of a dynamic rule, nobody violates it
+	if rule.Dynamic {
+		err := api.rbac.AddDynamicSoDRuleContext(c.Request().Context(), rule.System, rule.Name, rule.Desc, rule.Cardinality, rule.Roles...)
+		api.responseAdditionData(c, err, "violations", []rbac.SoDViolation{})
+		return
+	}
+
+	violations, err := api.rbac.AddSoDRuleContext(c.Request().Context(), rule.System, rule.Name, rule.Desc, rule.Cardinality, rule.Roles...)
+	api.responseAdditionData(c, err, "violations", violations)
+}
+
+// RemoveSoDRule remove specified separation-of-duty rule of specified system
+func (api *RbacApi) RemoveSoDRule(c iris.Context) {
+	var rule struct {
+		System string `json:"system" validate:"required"`
+		Name   string `json:"name" validate:"required"`
+	}
+	if validateParams(c, &rule) != nil {
+		return
+	}
+
+	err := api.rbac.RemoveSoDRuleContext(c.Request().Context(), rule.System, rule.Name)
+	api.responseByError(c, err)
+}
+
+// GetSoDRule get specified separation-of-duty rule of system by name
+func (api *RbacApi) GetSoDRule(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "rule")
+	if err != nil {
+		return
+	}
+
+	rule, err := api.rbac.GetSoDRuleContext(c.Request().Context(), params["system"], params["rule"])
+	api.responseAdditionData(c, err, "rule", rule)
+}
+
+// GetAllSoDRules get all separation-of-duty rules of specified system
+func (api *RbacApi) GetAllSoDRules(c iris.Context) {
+	params, err := checkUrlParams(c, "system")
+	if err != nil {
+		return
+	}
+
+	rules, err := api.rbac.GetAllSoDRulesContext(c.Request().Context(), params["system"])
+	api.responseAdditionData(c, err, "rules", rules)
+}
+
+// AuditSoDRule list users currently violating specified separation-of-duty rule
+func (api *RbacApi) AuditSoDRule(c iris.Context) {
+	params, err := checkUrlParams(c, "system", "rule")
+	if err != nil {
+		return
+	}
+
+	violations, err := api.rbac.AuditSoDRuleContext(c.Request().Context(), params["system"], params["rule"])
+	api.responseAdditionData(c, err, "violations", violations)
+}
+
+// ValidateConstraints list existing violations of all constraints of specified system
+func (api *RbacApi) ValidateConstraints(c iris.Context) {
+	params, err := checkUrlParams(c, "system")
+	if err != nil {
+		return
+	}
+
+	report, err := api.rbac.ValidateConstraintsContext(c.Request().Context(), params["system"])
+	api.responseAdditionData(c, err, "report", report)
+}
+
+// CreateSession create session of user with initially active roles, ttl is in seconds
+func (api *RbacApi) CreateSession(c iris.Context) {
+	var p struct {
+		System string   `json:"system" validate:"required"`
+		UID    string   `json:"uid" validate:"required"`
+		TTL    int      `json:"ttl"`
+		Roles  []string `json:"roles"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	session, err := api.rbac.CreateSessionContext(c.Request().Context(), p.System, p.UID, time.Duration(p.TTL)*time.Second, p.Roles...)
+	api.responseAdditionData(c, err, "session", session)
+}
+
+// GetSession get specified session
+func (api *RbacApi) GetSession(c iris.Context) {
+	params, err := checkUrlParams(c, "id")
+	if err != nil {
+		return
+	}
+
+	session, err := api.rbac.GetSessionContext(c.Request().Context(), params["id"])
+	api.responseAdditionData(c, err, "session", session)
+}
+
+// DeleteSession remove specified session
+func (api *RbacApi) DeleteSession(c iris.Context) {
+	var p struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.DeleteSessionContext(c.Request().Context(), p.ID)
+	api.responseByError(c, err)
+}
+
+// ActivateRole activate role within specified session
+func (api *RbacApi) ActivateRole(c iris.Context) {
+	var p struct {
+		ID   string `json:"id" validate:"required"`
+		Role string `json:"role" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.ActivateRoleContext(c.Request().Context(), p.ID, p.Role)
+	api.responseByError(c, err)
+}
+
+// DropRole deactivate role within specified session
+func (api *RbacApi) DropRole(c iris.Context) {
+	var p struct {
+		ID   string `json:"id" validate:"required"`
+		Role string `json:"role" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.DropRoleContext(c.Request().Context(), p.ID, p.Role)
+	api.responseByError(c, err)
+}
+
+// IsPermitInSession check whether user of session has specified permission through its active roles
+func (api *RbacApi) IsPermitInSession(c iris.Context) {
+	params, err := checkUrlParams(c, "id", "permission")
+	if err != nil {
+		return
+	}
+
+	permit, err := api.rbac.IsPermitInSessionContext(c.Request().Context(), params["id"], params["permission"])
+	api.responseAdditionData(c, err, "permit", permit)
+}
+
+// RegisterSystem register system with its owners and metadata
+func (api *RbacApi) RegisterSystem(c iris.Context) {
+	var p struct {
+		Name     string            `json:"name" validate:"required"`
+		Desc     string            `json:"desc"`
+		Owners   []string          `json:"owners"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.RegisterSystemContext(c.Request().Context(), p.Name, p.Desc, p.Metadata, p.Owners...)
+	api.responseByError(c, err)
+}
+
+// UpdateSystem replace description, owners and metadata of registered system
+func (api *RbacApi) UpdateSystem(c iris.Context) {
+	var p struct {
+		Name     string            `json:"name" validate:"required"`
+		Desc     string            `json:"desc"`
+		Owners   []string          `json:"owners"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.UpdateSystemContext(c.Request().Context(), p.Name, p.Desc, p.Metadata, p.Owners...)
+	api.responseByError(c, err)
+}
+
+// SetDefaultRoles replace roles of users of registered system which aren't registered
+func (api *RbacApi) SetDefaultRoles(c iris.Context) {
+	var p struct {
+		Name         string   `json:"name" validate:"required"`
+		Roles        []string `json:"roles"`
+		AutoRegister bool     `json:"auto_register"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.SetDefaultRolesContext(c.Request().Context(), p.Name, p.AutoRegister, p.Roles...)
+	api.responseByError(c, err)
+}
+
+// GetSystem get registered system by name
+func (api *RbacApi) GetSystem(c iris.Context) {
+	params, err := checkUrlParams(c, "name")
+	if err != nil {
+		return
+	}
+
+	system, err := api.rbac.GetSystemContext(c.Request().Context(), params["name"])
+	api.responseAdditionData(c, err, "system", system)
+}
+
+// GetAllSystems get all registered systems
+func (api *RbacApi) GetAllSystems(c iris.Context) {
+	systems, err := api.rbac.GetAllSystemsContext(c.Request().Context())
+	api.responseAdditionData(c, err, "systems", systems)
+}
+
+// DeleteSystem remove system together with all its permissions, roles, users, groups and rules
+func (api *RbacApi) DeleteSystem(c iris.Context) {
+	var p struct {
+		Name string `json:"name" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	affected, err := api.rbac.DeleteSystemContext(c.Request().Context(), p.Name)
+	api.responseAdditionData(c, err, "affected", affected)
+}
+
+// CloneSystem copy registered system together with all its data to target
+func (api *RbacApi) CloneSystem(c iris.Context) {
+	var p struct {
+		Source string `json:"source" validate:"required"`
+		Target string `json:"target" validate:"required"`
+	}
+	if validateParams(c, &p) != nil {
+		return
+	}
+
+	err := api.rbac.CloneSystemContext(c.Request().Context(), p.Source, p.Target)
 	api.responseByError(c, err)
 }
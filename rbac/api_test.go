@@ -1,8 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/kataras/iris/v12"
+	"github.com/nzqpeace/rbac"
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/db/kvstore"
+	"github.com/nzqpeace/rbac/model"
+	"github.com/stretchr/testify/assert"
 )
 
 func BenchmarkAPI(b *testing.B) {
@@ -18,3 +31,72 @@ func BenchmarkAPI(b *testing.B) {
 		}
 	}
 }
+
+// failingStore fail reading users
+type failingStore struct {
+	db.Store
+}
+
+func (s failingStore) Users() db.UserStore {
+	return failingUsers{s.Store.Users()}
+}
+
+type failingUsers struct {
+	db.UserStore
+}
+
+func (failingUsers) GetUserPermModelContext(ctx context.Context, system, uid string) (model.UserPermModel, error) {
+	return model.UserPermModel{}, errors.New("reading user failed")
+}
+
+func TestIsPermitOnFailure(t *testing.T) {
+	r, err := rbac.NewRBAC(&rbac.RBACConfig{Store: failingStore{kvstore.NewMemoryStore()}})
+	assert.Nil(t, err)
+	app := iris.New()
+	app.Get("/authenticate", (&RbacApi{r}).IsPermit)
+	assert.Nil(t, app.Build())
+
+	// failures of checks on resources are reported rather than denying
+	for _, query := range []string{"", "&resource=document/42"} {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authenticate?system=cowshed&uid=uid_admin&permission=read"+query, nil))
+		var resp struct {
+			Code   ErrCode `json:"code"`
+			Permit *bool   `json:"permit"`
+		}
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.NotEqual(t, ErrOK, resp.Code, query)
+		assert.Nil(t, resp.Permit, query)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	r, err := rbac.NewRBAC(&rbac.RBACConfig{Backend: rbac.BackendMemory})
+	assert.Nil(t, err)
+	assert.Nil(t, r.RegisterPermission("cowshed", "read", ""))
+	app := iris.New()
+	app.Post("/role", (&RbacApi{r}).RegisterRole)
+	assert.Nil(t, app.Build())
+
+	post := func(ifMatch string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/role", strings.NewReader(`{"system":"cowshed","name":"reader","permissions":["read"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		app.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// `*` requires the role to exist, weak validators never match
+	assert.Equal(t, http.StatusPreconditionFailed, post("*"))
+	assert.Equal(t, http.StatusOK, post(""))
+	role, err := r.GetRoleOfSystem("cowshed", "reader")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, post(fmt.Sprintf(`W/"%d"`, role.Revision)))
+	assert.Equal(t, http.StatusBadRequest, post(`"-1"`))
+	assert.Equal(t, http.StatusOK, post(fmt.Sprintf(`"%d"`, role.Revision)))
+	assert.Equal(t, http.StatusPreconditionFailed, post(fmt.Sprintf(`"%d"`, role.Revision)))
+	assert.Equal(t, http.StatusOK, post("*"))
+}
@@ -6,8 +6,11 @@ import (
 	"io/ioutil"
 
 	"github.com/imdario/mergo"
+	"github.com/nzqpeace/rbac"
 	"github.com/nzqpeace/rbac/cache"
 	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/db/kvstore"
+	"github.com/nzqpeace/rbac/db/sqlstore"
 )
 
 type Logger struct {
@@ -22,8 +25,27 @@ type HttpServerConfig struct {
 type Config struct {
 	Log   *Logger            `json:"log"`
 	Redis *cache.RedisConfig `json:"redis"`
-	Mongo *db.MgoConf        `json:"mongo"`
-	Http  *HttpServerConfig  `json:"http_server"`
+
+	// SessionRedis keep sessions, it is required along with Redis and its db must differ from that of Redis
+	SessionRedis *cache.RedisConfig `json:"session_redis"`
+
+	// Backend is one of mongo, sql and bolt
+	Backend string              `json:"backend"`
+	Mongo   *db.MgoConf         `json:"mongo"`
+	SQL     *sqlstore.Config    `json:"sql"`
+	Bolt    *kvstore.BoltConfig `json:"bolt"`
+
+	// Strict reject writes referring to unknown permissions or roles
+	Strict bool `json:"strict"`
+
+	// SweepInterval is seconds between removals of expired roles, whitelist and blacklist entries,
+	// sweeping is disabled when it's 0
+	SweepInterval int `json:"sweep_interval"`
+
+	// NegativeTTL is seconds unknown users are remembered, 60 when it's 0, they aren't remembered when it's negative
+	NegativeTTL int `json:"negative_ttl"`
+
+	Http *HttpServerConfig `json:"http_server"`
 }
 
 func DefaultConfig() *Config {
@@ -32,8 +54,17 @@ func DefaultConfig() *Config {
 			Output: "./logs/cowshed.log",
 			Level:  "info",
 		},
-		Redis: cache.DefaultConfig(),
-		Mongo: db.DefaultConf(),
+		Redis:        cache.DefaultConfig(),
+		SessionRedis: &cache.RedisConfig{Address: "localhost:6379", DB: 1, MaxConn: 100, IdleTimeout: 60},
+		Backend:      rbac.BackendMongo,
+		Mongo:        db.DefaultConf(),
+		SQL: &sqlstore.Config{
+			Driver: "sqlite",
+			DSN:    "./rbac.sqlite",
+		},
+		Bolt: &kvstore.BoltConfig{
+			Path: "./rbac.db",
+		},
 		Http: &HttpServerConfig{
 			Address: ":60001",
 		},
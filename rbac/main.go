@@ -7,8 +7,10 @@ import (
 	"path"
 
 	"github.com/kataras/iris/v12"
+	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/go-playground/validator.v9"
+	_ "modernc.org/sqlite"
 )
 
 const DefaultConfigFile = "config.json"
@@ -13,7 +13,10 @@ func registerRoute(app *iris.Application, config *Config) error {
 	}
 
 	// check check whether have specified permission
-	// URL params: system, uid, permission
+	// URL params: system, uid, permission, resource {option}, domain {option}
+	// resource is formatted as type/id, e.g. document/42, the permission must be either unscoped or
+	// granted on it. within domain, roles, whitelist and blacklist of user within domain apply together
+	// with its global ones, resource and domain can't be given together
 	//
 	// Response
 	// {
@@ -23,6 +26,28 @@ func registerRoute(app *iris.Application, config *Config) error {
 	// }
 	app.Get("/authenticate", rbacAPI.IsPermit)
 
+	// check whether have specified permission, attrs are attributes of the request which conditional
+	// permissions of roles are evaluated against, unconditional permissions don't need them
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "permission":permission,
+	//     "attrs":{
+	//         "amount":500,
+	//         "region":"eu",
+	//         "user":{"region":"eu"}
+	//     }
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "permit":true // true or false
+	// }
+	app.Post("/authenticate", rbacAPI.IsPermitWithContext)
+
 	// register permission
 	// Json params:
 	// {
@@ -54,7 +79,7 @@ func registerRoute(app *iris.Application, config *Config) error {
 	app.Delete("/permission", rbacAPI.UnregisterPermission)
 
 	// get all permissions by system
-	// URL params: system
+	// URL params: system, pattern {option}, e.g. article:* to list the subtree below article
 	//
 	// Response
 	// {
@@ -137,6 +162,10 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//         "permissions":[
 	//             "permission1",
 	//             "permission2"
+	//         ],
+	//         "parents":[
+	//             "role1",
+	//             "role2"
 	//         ]
 	//     }
 	// }
@@ -234,7 +263,153 @@ func registerRoute(app *iris.Application, config *Config) error {
 	// }
 	app.Put("/role/permissions/remove", rbacAPI.RemovePermissionFromRole)
 
-	// register user
+	// deny permissions to users holding specified role, whichever other role or whitelist grants them
+	// Json params:
+	// {
+	//     "system":system,
+	//     "role":rolename,
+	//     "permissions":[
+	//         "permission1",
+	//         "permission2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/role/denied/add", rbacAPI.DenyPermissionsToRole)
+
+	// stop denying permission to users holding specified role
+	// Json params:
+	// {
+	//     "system":system,
+	//     "role":rolename,
+	//     "permission":permission
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/role/denied/remove", rbacAPI.RemoveDeniedPermissionFromRole)
+
+	// grant permission to specified role under condition, which replaces the condition granted before.
+	// expr is a Go expression over attributes of request, e.g. `amount < 1000 && region == user.region`
+	// Json params:
+	// {
+	//     "system":system,
+	//     "role":rolename,
+	//     "permission":permission,
+	//     "expr":expr
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 2-invalid expr
+	//     "message":message
+	// }
+	app.Put("/role/conditions/grant", rbacAPI.GrantConditionalPermission)
+
+	// remove conditional permission from specified role
+	// Json params:
+	// {
+	//     "system":system,
+	//     "role":rolename,
+	//     "permission":permission
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/role/conditions/remove", rbacAPI.RemoveConditionalPermission)
+
+	// add parents to specified role, whose permissions are inherited
+	// Json params:
+	// {
+	//     "system":system,
+	//     "role":rolename,
+	//     "parents":[
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 2-inheritance cycle
+	//     "message":message,
+	//     "cycle":["role", "role1", "role"] // only on inheritance cycle
+	// }
+	app.Put("/role/parents/add", rbacAPI.AddParentsToRole)
+
+	// remove parent from specified role
+	// Json params:
+	// {
+	//     "system":system,
+	//     "role":rolename,
+	//     "parent":parent
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/role/parents/remove", rbacAPI.RemoveParentFromRole)
+
+	// replace max members and prerequisites of specified role, users already violating them aren't changed
+	// Json params:
+	// {
+	//     "system":system,
+	//     "role":rolename,
+	//     "max_members":1, // 0 means unlimited
+	//     "prerequisites":[
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/role/constraints", rbacAPI.SetRoleConstraints)
+
+	// get all roles inherited by specified role directly or indirectly
+	// URL params: system, role
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "ancestors":[
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	app.Get("/role/ancestors", rbacAPI.GetAncestorsOfRole)
+
+	// get all roles inheriting specified role directly or indirectly
+	// URL params: system, role
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "descendants":[
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	app.Get("/role/descendants", rbacAPI.GetDescendantsOfRole)
+
+	// register user, granted_by, reason and ticket are recorded as provenance of roles
 	// Json params:
 	// {
 	//     "system":system,
@@ -242,7 +417,10 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//     "roles":[
 	//         "roles1",
 	//         "roles2"
-	//     ]
+	//     ],
+	//     "granted_by":granter, // optional
+	//     "reason":reason,      // optional
+	//     "ticket":ticket       // optional
 	// }
 	//
 	// Response
@@ -274,7 +452,10 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//     "new_roles":[
 	//         "roles1",
 	//         "roles2"
-	//     ]
+	//     ],
+	//     "granted_by":granter, // optional
+	//     "reason":reason,      // optional
+	//     "ticket":ticket       // optional
 	// }
 	//
 	// Response
@@ -305,7 +486,18 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//         "whitelist":[
 	//             "permission1",
 	//             "permission2"
-	//         ]
+	//         ],
+	//         "role_provenance":[
+	//             {
+	//                 "name":"role1",
+	//                 "granted_by":granter,
+	//                 "granted_at":"2020-01-01T00:00:00Z",
+	//                 "reason":reason,
+	//                 "ticket":ticket
+	//             }
+	//         ],
+	//         "whitelist_provenance":[],
+	//         "blacklist_provenance":[]
 	//     }
 	// }
 	app.Get("/user", rbacAPI.GetUser)
@@ -324,7 +516,7 @@ func registerRoute(app *iris.Application, config *Config) error {
 	// }
 	app.Get("/user/roles", rbacAPI.GetAllRolesByUID)
 
-	// update roles of specified user by uid
+	// update roles of specified user by uid, roles already held keep their provenance
 	// Json params:
 	// {
 	//     "system":system,
@@ -332,7 +524,10 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//     "roles":[
 	//         "roles1",
 	//         "roles2"
-	//     ]
+	//     ],
+	//     "granted_by":granter, // optional
+	//     "reason":reason,      // optional
+	//     "ticket":ticket       // optional
 	// }
 	//
 	// Response
@@ -350,7 +545,12 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//     "roles":[
 	//         "roles1",
 	//         "roles2"
-	//     ]
+	//     ],
+	//     "valid_from":"2020-01-01T00:00:00Z", // optional
+	//     "expires_at":"2020-02-01T00:00:00Z", // optional
+	//     "granted_by":granter, // optional
+	//     "reason":reason,      // optional
+	//     "ticket":ticket       // optional
 	// }
 	//
 	// Response
@@ -370,7 +570,7 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//
 	// Response
 	// {
-	//     "code": 0, // 0-success
+	//     "code": 0, // 0-success, 5-constraint violation
 	//     "message":message
 	// }
 	app.Put("/user/roles/remove", rbacAPI.RemoveRoles)
@@ -397,7 +597,12 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//     "permissions":[
 	//         "permission1",
 	//         "permission2"
-	//     ]
+	//     ],
+	//     "valid_from":"2020-01-01T00:00:00Z", // optional
+	//     "expires_at":"2020-02-01T00:00:00Z", // optional
+	//     "granted_by":granter, // optional
+	//     "reason":reason,      // optional
+	//     "ticket":ticket       // optional
 	// }
 	//
 	// Response
@@ -450,7 +655,7 @@ func registerRoute(app *iris.Application, config *Config) error {
 	// }
 	app.Get("/user/whitelist", rbacAPI.GetWhiteList)
 
-	// update whitelist
+	// update whitelist, permissions already whitelisted keep their provenance
 	// Json params:
 	// {
 	//     "system":system,
@@ -458,7 +663,10 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//     "whitelist":[
 	//         "permission1",
 	//         "permission2"
-	//     ]
+	//     ],
+	//     "granted_by":granter, // optional
+	//     "reason":reason,      // optional
+	//     "ticket":ticket       // optional
 	// }
 	//
 	// Response
@@ -476,7 +684,12 @@ func registerRoute(app *iris.Application, config *Config) error {
 	//     "permissions":[
 	//         "permission1",
 	//         "permission2"
-	//     ]
+	//     ],
+	//     "valid_from":"2020-01-01T00:00:00Z", // optional
+	//     "expires_at":"2020-02-01T00:00:00Z", // optional
+	//     "granted_by":granter, // optional
+	//     "reason":reason,      // optional
+	//     "ticket":ticket       // optional
 	// }
 	//
 	// Response
@@ -515,5 +728,771 @@ func registerRoute(app *iris.Application, config *Config) error {
 	// }
 	app.Put("/user/whitelist/clear", rbacAPI.ClearWhiteList)
 
+	// get grants on resources of user
+	// URL params: system, uid
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "grants":[
+	//         {
+	//             "permission":permission,
+	//             "resource":{"type":type, "id":id}
+	//         }
+	//     ]
+	// }
+	app.Get("/user/grants", rbacAPI.GetGrants)
+
+	// grant permissions on resources to user, id of resource may be a pattern like 2019-*
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "grants":[
+	//         {
+	//             "permission":permission,
+	//             "resource":{"type":type, "id":id}
+	//         }
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/user/grants/add", rbacAPI.AddGrants)
+
+	// remove grant from user
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "grant":{
+	//         "permission":permission,
+	//         "resource":{"type":type, "id":id}
+	//     }
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/user/grants/remove", rbacAPI.RemoveGrant)
+
+	// get domains in which user holds any role, whitelisted or blacklisted permission
+	// URL params: system, uid
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "domains":[
+	//         "domain1",
+	//         "domain2"
+	//     ]
+	// }
+	app.Get("/user/domains", rbacAPI.GetDomainsOfUser)
+
+	// assign roles to user within domain only
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "domain":domain,
+	//     "roles":[
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 5-constraint violation
+	//     "message":message
+	// }
+	app.Put("/user/domain/roles/add", rbacAPI.AddRolesInDomain)
+
+	// revoke role assigned to user within domain
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "domain":domain,
+	//     "role":role
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 5-constraint violation
+	//     "message":message
+	// }
+	app.Put("/user/domain/roles/remove", rbacAPI.RemoveRoleInDomain)
+
+	// add permissions into whitelist of user within domain
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "domain":domain,
+	//     "permissions":[
+	//         "permission1",
+	//         "permission2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/user/domain/whitelist/add", rbacAPI.AddToWhiteListInDomain)
+
+	// remove permission from whitelist of user within domain
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "domain":domain,
+	//     "permission":permission
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/user/domain/whitelist/remove", rbacAPI.RemoveFromWhiteListInDomain)
+
+	// add permissions into blacklist of user within domain
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "domain":domain,
+	//     "permissions":[
+	//         "permission1",
+	//         "permission2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/user/domain/blacklist/add", rbacAPI.AddToBlackListInDomain)
+
+	// remove permission from blacklist of user within domain
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "domain":domain,
+	//     "permission":permission
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/user/domain/blacklist/remove", rbacAPI.RemoveFromBlackListInDomain)
+
+	// get groups which user belongs to
+	// URL params: system, uid
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "groups":[
+	//         {
+	//             "system":system,
+	//             "name":name,
+	//             "desc":desc,
+	//             "roles":[
+	//                 "role1",
+	//                 "role2"
+	//             ],
+	//             "members":[
+	//                 "uid1",
+	//                 "uid2"
+	//             ]
+	//         }
+	//     ]
+	// }
+	app.Get("/user/groups", rbacAPI.GetGroupsOfUser)
+
+	// delegate roles of delegator to delegate, e.g. to a deputy during leave, which replaces the delegation
+	// made before. delegator must hold roles, directly or through transitive delegations. delegated roles
+	// count as roles of delegate within valid_from and expires_at as long as delegator holds them, they may
+	// be delegated further only if transitive
+	// Json params:
+	// {
+	//     "system":system,
+	//     "delegator":uid,
+	//     "delegate":uid,
+	//     "roles":[
+	//         "role1",
+	//         "role2"
+	//     ],
+	//     "transitive":false {option},
+	//     "valid_from":"2020-01-01T00:00:00Z" {option},
+	//     "expires_at":"2020-01-15T00:00:00Z" {option}
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 5-roles not held by delegator
+	//     "message":message
+	// }
+	app.Post("/user/delegation", rbacAPI.Delegate)
+
+	// revoke delegation, roles delegate delegated further are revoked too unless it still holds them
+	// Json params:
+	// {
+	//     "system":system,
+	//     "delegator":uid,
+	//     "delegate":uid
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Delete("/user/delegation", rbacAPI.Revoke)
+
+	// get delegations made by and received by user, including those not in effect
+	// URL params: system, uid
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "delegations":{
+	//         "from":[
+	//             {
+	//                 "system":system,
+	//                 "delegator":uid,
+	//                 "delegate":uid,
+	//                 "roles":[
+	//                     "role1"
+	//                 ],
+	//                 "expires_at":"2020-01-15T00:00:00Z",
+	//                 "transitive":false,
+	//                 "revision":1
+	//             }
+	//         ],
+	//         "to":[]
+	//     }
+	// }
+	app.Get("/user/delegations", rbacAPI.GetDelegations)
+
+	// register group without members, replace it if already exist
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name,
+	//     "desc":description {option}
+	//     "roles":[
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Post("/group", rbacAPI.RegisterGroup)
+
+	// unregister group
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Delete("/group", rbacAPI.UnregisterGroup)
+
+	// get specified group by system and group name
+	// URL params: system, group
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "group":{
+	//         "system":system,
+	//         "name":name,
+	//         "desc":desc,
+	//         "roles":[
+	//             "role1",
+	//             "role2"
+	//         ],
+	//         "members":[
+	//             "uid1",
+	//             "uid2"
+	//         ]
+	//     }
+	// }
+	app.Get("/group", rbacAPI.GetGroup)
+
+	// get all groups by system
+	// URL params: system
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "groups":[
+	//         {
+	//             "system":system,
+	//             "name":name,
+	//             "desc":desc,
+	//             "roles":[
+	//                 "role1"
+	//             ],
+	//             "members":[
+	//                 "uid1"
+	//             ]
+	//         }
+	//     ]
+	// }
+	app.Get("/group/all", rbacAPI.GetAllGroups)
+
+	// add users to group, members needn't be registered
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name,
+	//     "uids":[
+	//         "uid1",
+	//         "uid2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/group/members/add", rbacAPI.AddMembersToGroup)
+
+	// remove user from group
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name,
+	//     "uid":uid
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/group/members/remove", rbacAPI.RemoveMemberFromGroup)
+
+	// assign roles to all members of group
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name,
+	//     "roles":[
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/group/roles/add", rbacAPI.AddRolesToGroup)
+
+	// remove role from group
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name,
+	//     "role":role
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Put("/group/roles/remove", rbacAPI.RemoveRoleFromGroup)
+
+	// add separation-of-duty rule, no user may hold cardinality or more of its roles afterwards,
+	// replace it if already exist. users already violating the rule are kept and reported.
+	// a dynamic rule only forbids activating cardinality or more of its roles within one session
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name,
+	//     "desc":description {option}
+	//     "roles":[
+	//         "role1",
+	//         "role2"
+	//     ],
+	//     "cardinality":2 {option} // default 2, i.e. roles are mutually exclusive
+	//     "dynamic":false {option}
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "violations":[
+	//         {
+	//             "rule":name,
+	//             "uid":uid,
+	//             "roles":[
+	//                 "role1",
+	//                 "role2"
+	//             ]
+	//         }
+	//     ]
+	// }
+	app.Post("/sod", rbacAPI.AddSoDRule)
+
+	// remove separation-of-duty rule
+	// Json params:
+	// {
+	//     "system":system,
+	//     "name":name
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Delete("/sod", rbacAPI.RemoveSoDRule)
+
+	// get specified separation-of-duty rule by system and rule name
+	// URL params: system, rule
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "rule":{
+	//         "system":system,
+	//         "name":name,
+	//         "desc":desc,
+	//         "roles":[
+	//             "role1",
+	//             "role2"
+	//         ],
+	//         "cardinality":2,
+	//         "revision":1
+	//     }
+	// }
+	app.Get("/sod", rbacAPI.GetSoDRule)
+
+	// get all separation-of-duty rules by system
+	// URL params: system
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "rules":[
+	//         {
+	//             "system":system,
+	//             "name":name,
+	//             "desc":desc,
+	//             "roles":[
+	//                 "role1",
+	//                 "role2"
+	//             ],
+	//             "cardinality":2,
+	//             "revision":1
+	//         }
+	//     ]
+	// }
+	app.Get("/sod/all", rbacAPI.GetAllSoDRules)
+
+	// list users currently violating separation-of-duty rule, inherited roles count as held
+	// URL params: system, rule
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "violations":[
+	//         {
+	//             "rule":name,
+	//             "uid":uid,
+	//             "roles":[
+	//                 "role1",
+	//                 "role2"
+	//             ]
+	//         }
+	//     ]
+	// }
+	app.Get("/sod/audit", rbacAPI.AuditSoDRule)
+
+	// list existing violations of separation-of-duty rules, max members and prerequisites
+	// URL params: system
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "report":{
+	//         "sod":[
+	//             {
+	//                 "rule":name,
+	//                 "uid":uid,
+	//                 "roles":["role1", "role2"]
+	//             }
+	//         ],
+	//         "max_members":[
+	//             {
+	//                 "role":rolename,
+	//                 "max_members":1,
+	//                 "uids":["uid1", "uid2"]
+	//             }
+	//         ],
+	//         "prerequisites":[
+	//             {
+	//                 "uid":uid,
+	//                 "role":rolename,
+	//                 "missing":["role1"]
+	//             }
+	//         ]
+	//     }
+	// }
+	app.Get("/constraints/validate", rbacAPI.ValidateConstraints)
+
+	// create session of user, roles are activated at once, they must be assigned to user directly,
+	// through groups or by inheritance and may not violate dynamic separation-of-duty rules
+	// Json params:
+	// {
+	//     "system":system,
+	//     "uid":uid,
+	//     "ttl":1800 {option} // seconds, default 1800
+	//     "roles":[ {option}
+	//         "role1",
+	//         "role2"
+	//     ]
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 5-constraint violation
+	//     "message":message,
+	//     "session":{
+	//         "id":id,
+	//         "system":system,
+	//         "uid":uid,
+	//         "roles":[
+	//             "role1",
+	//             "role2"
+	//         ],
+	//         "expires_at":"2020-01-01T00:30:00Z"
+	//     }
+	// }
+	app.Post("/session", rbacAPI.CreateSession)
+
+	// get session by id
+	// URL params: id
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-not found or expired
+	//     "message":message,
+	//     "session":{
+	//         "id":id,
+	//         "system":system,
+	//         "uid":uid,
+	//         "roles":[
+	//             "role1"
+	//         ],
+	//         "expires_at":"2020-01-01T00:30:00Z"
+	//     }
+	// }
+	app.Get("/session", rbacAPI.GetSession)
+
+	// remove session
+	// Json params:
+	// {
+	//     "id":id
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message
+	// }
+	app.Delete("/session", rbacAPI.DeleteSession)
+
+	// activate role within session
+	// Json params:
+	// {
+	//     "id":id,
+	//     "role":rolename
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-session not found, 5-constraint violation
+	//     "message":message
+	// }
+	app.Put("/session/roles/activate", rbacAPI.ActivateRole)
+
+	// deactivate role within session
+	// Json params:
+	// {
+	//     "id":id,
+	//     "role":rolename
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-session not found
+	//     "message":message
+	// }
+	app.Put("/session/roles/drop", rbacAPI.DropRole)
+
+	// check whether user of session has specified permission through roles active within session
+	// URL params: id, permission
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-session not found
+	//     "message":message,
+	//     "permit":true // true or false
+	// }
+	app.Get("/session/authenticate", rbacAPI.IsPermitInSession)
+
+	// register system, registering is optional for using a system but required for cloning it
+	// Json params:
+	// {
+	//     "name":name,
+	//     "desc":description {option},
+	//     "owners":[uid1, uid2, ...] {option},
+	//     "metadata":{"env":"prod", ...} {option}
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 4-already registered
+	//     "message":message
+	// }
+	app.Post("/system", rbacAPI.RegisterSystem)
+
+	// replace description, owners and metadata of registered system
+	// Json params:
+	// {
+	//     "name":name,
+	//     "desc":description {option},
+	//     "owners":[uid1, uid2, ...] {option},
+	//     "metadata":{"env":"prod", ...} {option}
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-not found
+	//     "message":message
+	// }
+	app.Put("/system", rbacAPI.UpdateSystem)
+
+	// replace default roles of registered system, they're held by users which aren't registered, e.g. "anonymous".
+	// if auto_register is true, such users are registered with them when their permissions are checked first
+	// Json params:
+	// {
+	//     "name":name,
+	//     "roles":[role1, role2, ...],
+	//     "auto_register":false {option}
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-not found
+	//     "message":message
+	// }
+	app.Put("/system/default_roles", rbacAPI.SetDefaultRoles)
+
+	// get registered system
+	// URL params: name
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-not found
+	//     "message":message,
+	//     "system":{
+	//         "name":name,
+	//         "desc":description,
+	//         "owners":[uid1, uid2, ...],
+	//         "metadata":{"env":"prod", ...},
+	//         "default_roles":[role1, role2, ...],
+	//         "auto_register":false,
+	//         "created_at":"2020-01-01T00:00:00Z",
+	//         "revision":1
+	//     }
+	// }
+	app.Get("/system", rbacAPI.GetSystem)
+
+	// get all registered systems
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "systems":[system1, system2, ...]
+	// }
+	app.Get("/system/all", rbacAPI.GetAllSystems)
+
+	// remove system together with all its permissions, roles, users, groups and rules, cached permissions
+	// of its users are dropped. systems never registered can be removed too
+	// Json params:
+	// {
+	//     "name":name
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success
+	//     "message":message,
+	//     "affected":{
+	//         "roles":[role1, role2, ...],
+	//         "users":[uid1, uid2, ...],
+	//         "groups":[group1, group2, ...]
+	//     }
+	// }
+	app.Delete("/system", rbacAPI.DeleteSystem)
+
+	// copy registered system together with all its permissions, roles, users, groups and rules,
+	// e.g. for a staging environment. target must be neither registered nor have any data
+	// Json params:
+	// {
+	//     "source":name,
+	//     "target":name
+	// }
+	//
+	// Response
+	// {
+	//     "code": 0, // 0-success, 1-source not found, 4-target already exists
+	//     "message":message
+	// }
+	app.Post("/system/clone", rbacAPI.CloneSystem)
+
 	return nil
 }
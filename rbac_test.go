@@ -1,12 +1,22 @@
 package rbac
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/nzqpeace/rbac/cache"
 	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/db/kvstore"
+	"github.com/nzqpeace/rbac/db/sqlstore"
+	"github.com/nzqpeace/rbac/model"
 	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
 )
 
 const (
@@ -34,7 +44,8 @@ var (
 
 func init() {
 	conf := &RBACConfig{
-		Redis: cache.DefaultConfig(),
+		Redis:        cache.DefaultConfig(),
+		SessionRedis: &cache.RedisConfig{Address: "localhost:6379", DB: 1, MaxConn: 100, IdleTimeout: 60},
 		Mgo: &db.MgoConf{
 			Url: "localhost/test",
 		},
@@ -47,7 +58,7 @@ func init() {
 	}
 }
 
-func fillTestData(t *testing.T) {
+func fillTestData(t *testing.T, rbac *RBAC) {
 	assert.NotNil(t, rbac)
 	// register permissions
 	assert.Nil(t, rbac.RegisterPermission(system, read, "read question/answer/comment"))
@@ -65,14 +76,16 @@ func fillTestData(t *testing.T) {
 	assert.Nil(t, rbac.RegisterUser(system, uid_admin, common, admin))
 }
 
-func clearTestData(t *testing.T) {
+func clearTestData(t *testing.T, rbac *RBAC) {
 	// remove all permissions
-	assert.Nil(t, rbac.UnregisterPermission(system, read))
-	assert.Nil(t, rbac.UnregisterPermission(system, write))
-	assert.Nil(t, rbac.UnregisterPermission(system, manage))
+	for _, p := range []string{read, write, manage} {
+		_, err := rbac.UnregisterPermission(system, p)
+		assert.Nil(t, err)
+	}
 
 	// remove all roles
-	assert.Nil(t, rbac.UnregisterRole(system, guest))
+	_, err := rbac.UnregisterRole(system, guest)
+	assert.Nil(t, err)
 	assert.Nil(t, rbac.UnregisterAllRoles(system))
 
 	// remove all users
@@ -82,7 +95,1174 @@ func clearTestData(t *testing.T) {
 }
 
 func TestRBAC(t *testing.T) {
-	fillTestData(t)
+	testRBAC(t, rbac)
+}
+
+func TestRBACWithMemoryBackend(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	testRBAC(t, r)
+}
+
+func TestRBACWithCanceledContext(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, r.RegisterPermissionContext(ctx, system, "read", ""))
+	assert.Equal(t, context.Canceled, r.RegisterUserContext(ctx, system, "uid", "guest"))
+
+	ps, err := r.GetAllPermissionsBySystem(system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ps))
+}
+
+func TestRBACStrictMode(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// unknown permissions are rejected
+	err = r.RegisterRole(system, "editor", "", read, "wirte", "wirte")
+	assert.Equal(t, &ReferenceError{System: system, Permissions: []string{"wirte"}}, err)
+	_, err = r.GetRoleOfSystem(system, "editor")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	err = r.GrantPermissionsToRole(system, guest, write, "mange")
+	assert.Equal(t, &ReferenceError{System: system, Permissions: []string{"mange"}}, err)
+	assert.Equal(t, "unknown permissions [mange] of system Cowshed", err.Error())
+	assert.NotNil(t, r.AddToWhiteList(system, uid_guest, "mange"))
+	assert.NotNil(t, r.AddToBlackList(system, uid_guest, "mange"))
+
+	// unknown roles are rejected
+	err = r.RegisterUser(system, "uid_new", guest, "admn")
+	assert.Equal(t, &ReferenceError{System: system, Roles: []string{"admn"}}, err)
+	_, err = r.GetUser(system, "uid_new")
+	assert.Equal(t, db.ErrNotFound, err)
+	assert.NotNil(t, r.AddRoles(system, uid_guest, "admn"))
+	assert.NotNil(t, r.UpdateRoles(system, uid_guest, "admn"))
+	assert.NotNil(t, r.UpdateUser(system, uid_guest, "admn"))
+
+	roles, err := r.GetAllRolesByUID(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{guest}, roles)
+
+	// known references are still accepted
+	assert.Nil(t, r.GrantPermissionsToRole(system, guest, write))
+	assert.Nil(t, r.AddRoles(system, uid_guest, common))
+}
+
+func TestRBACCascade(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// warm up cache
+	permit, err := r.IsPermit(system, uid_common, write)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// rename permission
+	affected, err := r.UpdatePermission(system, write, "post")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{admin, common}, Users: []string{}}, affected)
+	permit, err = r.IsPermit(system, uid_common, "post")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = r.IsPermit(system, uid_common, write)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// rename role
+	affected, err = r.UpdateRoleName(system, common, "member")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{}, Users: []string{uid_admin, uid_common}, Groups: []string{}, Delegates: []string{}}, affected)
+	permit, err = r.IsPermit(system, uid_common, "post")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// remove role
+	affected, err = r.UnregisterRole(system, "member")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{}, Users: []string{uid_admin, uid_common}, Groups: []string{}, Delegates: []string{}}, affected)
+	permit, err = r.IsPermit(system, uid_common, read)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// remove permission
+	affected, err = r.UnregisterPermission(system, read)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{admin, guest}, Users: []string{}}, affected)
+	permit, err = r.IsPermit(system, uid_guest, read)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// remove user
+	permit, err = r.IsPermit(system, uid_admin, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	assert.Nil(t, r.UnregisterUser(system, uid_admin))
+	permit, err = r.IsPermit(system, uid_admin, manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+}
+
+func TestRBACIfMatch(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// warm up cache
+	permit, err := r.IsPermit(system, uid_guest, write)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	user, err := r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	revision, err := r.UpdateUserIfMatch(system, uid_guest, user.Revision, common)
+	assert.Nil(t, err)
+	assert.Equal(t, user.Revision+1, revision)
+	permit, err = r.IsPermit(system, uid_guest, write)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// the other writer loses
+	_, err = r.UpdateUserIfMatch(system, uid_guest, user.Revision, admin)
+	assert.Equal(t, db.ErrConflict, err)
+	roles, err := r.GetAllRolesByUID(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{common}, roles)
+
+	role, err := r.GetRoleOfSystem(system, common)
+	assert.Nil(t, err)
+	revision, err = r.UpdateRoleIfMatch(system, common, "", role.Revision, read)
+	assert.Nil(t, err)
+	assert.Equal(t, role.Revision+1, revision)
+	permit, err = r.IsPermit(system, uid_guest, write)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	_, err = r.UpdateRoleIfMatch(system, common, "", role.Revision, read, write)
+	assert.Equal(t, db.ErrConflict, err)
+}
+
+func TestRBACUpdateUser(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// warm up cache
+	permit, err := r.IsPermit(system, uid_admin, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	assert.Nil(t, r.UpdateUser(system, uid_admin, common))
+	permit, err = r.IsPermit(system, uid_admin, manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+}
+
+func TestRBACHierarchy(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+	assert.Nil(t, r.RegisterRole(system, "moderator", "", manage))
+
+	// warm up cache
+	permit, err := r.IsPermit(system, uid_guest, manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// permissions are inherited through all ancestors
+	assert.Nil(t, r.AddParentsToRole(system, guest, "moderator"))
+	assert.Nil(t, r.AddParentsToRole(system, common, guest))
+	permit, err = r.IsPermit(system, uid_guest, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = r.IsPermit(system, uid_common, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	ancestors, err := r.GetAncestorsOfRole(system, common)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{guest, "moderator"}, ancestors)
+	descendants, err := r.GetDescendantsOfRole(system, "moderator")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{common, guest}, descendants)
+	_, err = r.GetAncestorsOfRole(system, "not_exist")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// cycles are rejected
+	err = r.AddParentsToRole(system, "moderator", admin, common)
+	assert.Equal(t, &CycleError{System: system, Path: []string{"moderator", common, guest, "moderator"}}, err)
+	assert.Equal(t, "role inheritance cycle moderator -> common -> guest -> moderator of system Cowshed", err.Error())
+	assert.IsType(t, &CycleError{}, r.AddParentsToRole(system, guest, guest))
+	role, err := r.GetRoleOfSystem(system, "moderator")
+	assert.Nil(t, err)
+	assert.Empty(t, role.Parents)
+
+	// removing parent revokes inherited permissions
+	assert.Nil(t, r.RemoveParentFromRole(system, guest, "moderator"))
+	permit, err = r.IsPermit(system, uid_common, manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// removing role revokes its permissions from descendants
+	affected, err := r.UnregisterRole(system, guest)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Affected{Roles: []string{common}, Users: []string{uid_guest}, Groups: []string{}, Delegates: []string{}}, affected)
+	permit, err = r.IsPermit(system, uid_common, read)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+}
+
+func TestRBACWildcard(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	assert.Nil(t, r.RegisterPermission(system, "article:read", ""))
+	assert.Nil(t, r.RegisterPermission(system, "article:comment:create", ""))
+	assert.Nil(t, r.RegisterPermission(system, "billing.invoice.create", ""))
+
+	// wildcards must match some registered permission in strict mode
+	err = r.RegisterRole(system, "editor", "", "article:*", "blog:*")
+	assert.Equal(t, &ReferenceError{System: system, Permissions: []string{"blog:*"}}, err)
+	assert.Nil(t, r.RegisterRole(system, "editor", "", "article:*"))
+	assert.Nil(t, r.RegisterUser(system, uid_common, "editor"))
+
+	permit, err := r.IsPermit(system, uid_common, "article:comment:create")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = r.IsPermit(system, uid_common, "billing.invoice.create")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// permissions registered later are covered too
+	assert.Nil(t, r.RegisterPermission(system, "article:publish", ""))
+	permit, err = r.IsPermit(system, uid_common, "article:publish")
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	ps, err := r.Cache.PermissionsContext(context.Background(), system, uid_common)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"article:*", "article:read", "article:comment:create", "article:publish"}, ps)
+
+	assert.Nil(t, r.AddToBlackList(system, uid_common, "article:comment:*"))
+	permit, err = r.IsPermit(system, uid_common, "article:comment:create")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// list subtree
+	matched, err := r.GetPermissionsMatching(system, "article:*")
+	assert.Nil(t, err)
+	var names []string
+	for _, p := range matched {
+		names = append(names, p.Name)
+	}
+	assert.ElementsMatch(t, []string{"article:read", "article:comment:create", "article:publish"}, names)
+	matched, err = r.GetPermissionsMatching(system, "billing.invoice.create")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(matched))
+}
+
+func TestRBACIsPermitOn(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	doc := model.Resource{Type: "document", ID: "42"}
+	other := model.Resource{Type: "document", ID: "43"}
+	err = r.AddGrants(system, uid_guest, model.Grant{Permission: "delete", Resource: doc})
+	assert.Equal(t, &ReferenceError{System: system, Permissions: []string{"delete"}}, err)
+	assert.Nil(t, r.AddGrants(system, uid_guest, model.Grant{Permission: write, Resource: doc},
+		model.Grant{Permission: manage, Resource: model.Resource{Type: "document", ID: "4*"}}))
+
+	// unscoped permissions cover every resource
+	permit, err := r.IsPermitOn(system, uid_guest, read, other)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	permit, err = r.IsPermitOn(system, uid_guest, write, doc)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = r.IsPermitOn(system, uid_guest, write, other)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	permit, err = r.IsPermitOn(system, uid_guest, manage, other)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = r.IsPermit(system, uid_guest, write)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// blacklist wins over grants
+	assert.Nil(t, r.AddToBlackList(system, uid_guest, manage))
+	permit, err = r.IsPermitOn(system, uid_guest, manage, doc)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	assert.Nil(t, r.RemoveGrant(system, uid_guest, model.Grant{Permission: write, Resource: doc}))
+	permit, err = r.IsPermitOn(system, uid_guest, write, doc)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	grants, err := r.GetGrants(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(grants))
+
+	permit, err = r.IsPermitOn(system, "uid_not_exist", read, doc)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+}
+
+func TestRBACGroup(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	err = r.RegisterGroup(system, "team", "", common, "owner")
+	assert.Equal(t, &ReferenceError{System: system, Roles: []string{"owner"}}, err)
+	assert.Nil(t, r.RegisterGroup(system, "team", "", common))
+	assert.Nil(t, r.AddMembersToGroup(system, "team", uid_guest, "uid_new"))
+	assert.Equal(t, db.ErrNotFound, r.AddMembersToGroup(system, "not_exist", uid_guest))
+
+	// members get roles of group, unregistered users included
+	for _, uid := range []string{uid_guest, "uid_new"} {
+		permit, err := r.IsPermit(system, uid, write)
+		assert.Nil(t, err)
+		assert.True(t, permit)
+	}
+	groups, err := r.GetGroupsOfUser(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(groups))
+
+	// changes of group are effective at once
+	assert.Nil(t, r.AddRolesToGroup(system, "team", admin))
+	permit, err := r.IsPermit(system, uid_guest, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	assert.Nil(t, r.RemoveRoleFromGroup(system, "team", admin))
+	permit, err = r.IsPermit(system, uid_guest, manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	assert.Nil(t, r.RemoveMemberFromGroup(system, "team", "uid_new"))
+	permit, err = r.IsPermit(system, "uid_new", write)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// removing role revokes it from groups
+	affected, err := r.UnregisterRole(system, common)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"team"}, affected.Groups)
+	permit, err = r.IsPermit(system, uid_guest, write)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// unregistered user leaves its groups
+	assert.Nil(t, r.AddRolesToGroup(system, "team", admin))
+	assert.Nil(t, r.UnregisterUser(system, uid_guest))
+	group, err := r.GetGroup(system, "team")
+	assert.Nil(t, err)
+	assert.Empty(t, group.Members)
+
+	assert.Nil(t, r.UnregisterGroup(system, "team"))
+	groups, err = r.GetAllGroups(system)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(groups))
+}
+
+func TestRBACWindows(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	now := time.Now()
+	later := now.Add(time.Hour)
+	assert.Equal(t, model.ErrInvalidPeriod, r.AddRolesWithin(system, uid_guest, model.Period{ValidFrom: &later, ExpiresAt: &now}, admin))
+	err = r.AddToWhiteListWithin(system, uid_guest, model.Period{ExpiresAt: &later}, "unknown")
+	assert.Equal(t, &ReferenceError{System: system, Permissions: []string{"unknown"}}, err)
+
+	// entries are effective within their windows only
+	boundary := now.Add(300 * time.Millisecond)
+	assert.Nil(t, r.AddRolesWithin(system, uid_guest, model.Period{ExpiresAt: &boundary}, admin))
+	assert.Nil(t, r.AddToWhiteListWithin(system, uid_guest, model.Period{ValidFrom: &later}, write))
+	assert.Nil(t, r.AddToBlackListWithin(system, uid_common, model.Period{ExpiresAt: &boundary}, write))
+	permit, err := r.IsPermit(system, uid_guest, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = r.IsPermit(system, uid_guest, write)
+	assert.Nil(t, err)
+	assert.True(t, permit) // granted by admin
+	permit, err = r.IsPermit(system, uid_common, write)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// windows are shown by GetUser
+	user, err := r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(user.RoleWindows))
+	assert.Equal(t, admin, user.RoleWindows[0].Name)
+	assert.True(t, boundary.Equal(*user.RoleWindows[0].ExpiresAt))
+	assert.Equal(t, 1, len(user.WhiteListWindows))
+	assert.True(t, later.Equal(*user.WhiteListWindows[0].ValidFrom))
+
+	time.Sleep(time.Until(boundary))
+	permit, err = r.IsPermit(system, uid_guest, manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	permit, err = r.IsPermit(system, uid_common, write)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// sweeper removes expired entries
+	refs, err := r.SweepExpired()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []db.UserRef{{System: system, UID: uid_guest}, {System: system, UID: uid_common}}, refs)
+	user, err = r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{guest}, user.Roles)
+	assert.Empty(t, user.RoleWindows)
+	assert.Equal(t, []string{write}, user.WhiteList)
+
+	// adding again makes entries permanent
+	assert.Nil(t, r.AddToWhiteList(system, uid_guest, write))
+	permit, err = r.IsPermit(system, uid_guest, write)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+}
+
+func TestRBACSoD(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	_, err = r.AddSoDRule(system, "payment", "", 1, common, admin)
+	assert.Equal(t, model.ErrInvalidCardinality, err)
+	_, err = r.AddSoDRule(system, "payment", "", 2, common, "unknown")
+	assert.Equal(t, &ReferenceError{System: system, Roles: []string{"unknown"}}, err)
+
+	// users already violating a new rule are reported
+	violations, err := r.AddSoDRule(system, "payment", "", 0, common, admin)
+	assert.Nil(t, err)
+	assert.Equal(t, []SoDViolation{{Rule: "payment", UID: uid_admin, Roles: []string{common, admin}}}, violations)
+	rule, err := r.GetSoDRule(system, "payment")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, rule.Cardinality)
+	rules, err := r.GetAllSoDRules(system)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rules))
+
+	// writes are rejected
+	err = r.RegisterUser(system, "uid_new", common, admin)
+	assert.Equal(t, &SoDError{System: system, UID: "uid_new", Rule: "payment", Roles: []string{common, admin}, Cardinality: 2}, err)
+	assert.Equal(t, "user uid_new would hold roles [common admin], separation-of-duty rule payment of system Cowshed allows at most 1 of them", err.Error())
+	assert.IsType(t, &SoDError{}, r.AddRoles(system, uid_common, admin))
+	assert.IsType(t, &SoDError{}, r.UpdateRoles(system, uid_guest, admin, common))
+	assert.IsType(t, &SoDError{}, r.UpdateUser(system, uid_guest, admin, common))
+	roles, err := r.GetAllRolesByUID(system, uid_common)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{common}, roles)
+	assert.Nil(t, r.AddRoles(system, uid_common, guest))
+
+	// inherited roles count as held
+	assert.Nil(t, r.RegisterRole(system, "senior", "", read))
+	assert.Nil(t, r.AddParentsToRole(system, "senior", common, admin))
+	assert.IsType(t, &SoDError{}, r.RegisterUser(system, "uid_senior", "senior"))
+	assert.Nil(t, r.User.CreateUserPermModelContext(context.Background(), model.NewUserPermModel(system, "uid_senior", "senior")))
+	violations, err = r.AuditSoDRule(system, "payment")
+	assert.Nil(t, err)
+	assert.Equal(t, []SoDViolation{
+		{Rule: "payment", UID: uid_admin, Roles: []string{common, admin}},
+		{Rule: "payment", UID: "uid_senior", Roles: []string{common, admin}},
+	}, violations)
+
+	// roles of groups count as held
+	assert.Nil(t, r.RegisterGroup(system, "approvers", "", admin))
+	assert.IsType(t, &SoDError{}, r.AddMembersToGroup(system, "approvers", uid_common))
+	assert.Nil(t, r.AddMembersToGroup(system, "approvers", uid_guest))
+	assert.IsType(t, &SoDError{}, r.AddRoles(system, uid_guest, common))
+	assert.Nil(t, r.RegisterGroup(system, "requesters", "", guest))
+	assert.Nil(t, r.AddMembersToGroup(system, "requesters", uid_guest))
+	assert.IsType(t, &SoDError{}, r.AddRolesToGroup(system, "requesters", common))
+	group, err := r.GetGroup(system, "requesters")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{guest}, group.Roles)
+	assert.Nil(t, r.Group.AddRolesContext(context.Background(), system, "requesters", common))
+	violations, err = r.AuditSoDRule(system, "payment")
+	assert.Nil(t, err)
+	assert.Equal(t, []SoDViolation{
+		{Rule: "payment", UID: uid_admin, Roles: []string{common, admin}},
+		{Rule: "payment", UID: uid_guest, Roles: []string{common, admin}},
+		{Rule: "payment", UID: "uid_senior", Roles: []string{common, admin}},
+	}, violations)
+
+	// removing rule allows the roles again
+	assert.Nil(t, r.RemoveSoDRule(system, "payment"))
+	assert.Equal(t, db.ErrNotFound, r.RemoveSoDRule(system, "payment"))
+	assert.Nil(t, r.AddRoles(system, uid_common, admin))
+}
+
+func TestRBACRoleConstraints(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	assert.Equal(t, model.ErrInvalidMaxMembers, r.SetRoleConstraints(system, admin, -1))
+	assert.IsType(t, &ReferenceError{}, r.SetRoleConstraints(system, admin, 1, "unknown"))
+	assert.Equal(t, db.ErrNotFound, r.SetRoleConstraints(system, "not_exist", 1))
+
+	// existing violations are reported but tolerated
+	assert.Nil(t, r.SetRoleConstraints(system, admin, 1, guest))
+	report, err := r.ValidateConstraints(system)
+	assert.Nil(t, err)
+	assert.Equal(t, []SoDViolation{}, report.SoD)
+	assert.Equal(t, []MaxMembersViolation{}, report.MaxMembers)
+	assert.Equal(t, []PrerequisiteViolation{{UID: uid_admin, Role: admin, Missing: []string{guest}}}, report.Prerequisites)
+	assert.Nil(t, r.AddRoles(system, uid_admin, guest))
+	report, err = r.ValidateConstraints(system)
+	assert.Nil(t, err)
+	assert.Empty(t, report.Prerequisites)
+
+	// prerequisites must be held before being assigned the role
+	err = r.AddRoles(system, uid_common, admin)
+	assert.Equal(t, &PrerequisiteError{System: system, UID: uid_common, Role: admin, Missing: []string{guest}}, err)
+	assert.Equal(t, "role admin of system Cowshed requires roles [guest], which user uid_common wouldn't hold", err.Error())
+	assert.Nil(t, r.RegisterRole(system, "senior", "", read))
+	assert.Nil(t, r.AddParentsToRole(system, "senior", guest))
+	assert.IsType(t, &PrerequisiteError{}, r.RemoveRoles(system, uid_admin, guest))
+
+	// max members
+	err = r.RegisterUser(system, "uid_new", "senior", admin)
+	assert.Equal(t, &MaxMembersError{System: system, Role: admin, MaxMembers: 1}, err)
+	assert.Equal(t, "role admin of system Cowshed may be assigned to at most 1 users", err.Error())
+	assert.IsType(t, &MaxMembersError{}, r.UpdateRoles(system, uid_guest, guest, admin))
+	assert.Nil(t, r.UpdateRoles(system, uid_admin, admin, "senior"))
+	assert.Nil(t, r.RemoveRoles(system, uid_admin, admin))
+	assert.Nil(t, r.RegisterUser(system, "uid_new", "senior", admin))
+
+	assert.Nil(t, r.SetRoleConstraints(system, "senior", 1))
+	report, err = r.ValidateConstraints(system)
+	assert.Nil(t, err)
+	assert.Equal(t, []MaxMembersViolation{{Role: "senior", MaxMembers: 1, UIDs: []string{uid_admin, "uid_new"}}}, report.MaxMembers)
+	role, err := r.GetRoleOfSystem(system, "senior")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, role.MaxMembers)
+
+	// members of groups count as holders and need prerequisites too
+	assert.Nil(t, r.RegisterGroup(system, "admins", "", admin))
+	assert.IsType(t, &MaxMembersError{}, r.AddMembersToGroup(system, "admins", uid_guest))
+	assert.Nil(t, r.AddMembersToGroup(system, "admins", "uid_new"))
+	assert.Nil(t, r.RegisterGroup(system, "seniors", "", guest))
+	assert.Nil(t, r.AddMembersToGroup(system, "seniors", uid_guest))
+	assert.IsType(t, &MaxMembersError{}, r.AddRolesToGroup(system, "seniors", "senior"))
+	assert.Nil(t, r.RegisterGroup(system, "commons", ""))
+	assert.Nil(t, r.AddMembersToGroup(system, "commons", uid_common))
+	assert.IsType(t, &PrerequisiteError{}, r.AddRolesToGroup(system, "commons", admin))
+}
+
+func TestRBACConditions(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+	assert.Nil(t, r.RegisterPermission(system, "refund", "refund an order"))
+
+	assert.IsType(t, &model.ConditionError{}, r.GrantConditionalPermission(system, common, "refund", "amount <"))
+	assert.IsType(t, &ReferenceError{}, r.GrantConditionalPermission(system, common, "unknown", "true"))
+	assert.Equal(t, db.ErrNotFound, r.GrantConditionalPermission(system, "not_exist", "refund", "true"))
+	assert.Nil(t, r.GrantConditionalPermission(system, common, "refund", `amount < 1000 && region == user.region`))
+
+	attrs := map[string]interface{}{"amount": 500, "region": "eu", "user": map[string]interface{}{"region": "eu"}}
+	permit, err := r.IsPermitWithContext(system, uid_common, "refund", attrs)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	permit, err = r.IsPermit(system, uid_common, "refund")
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	attrs["region"] = "us"
+	permit, err = r.IsPermitWithContext(system, uid_common, "refund", attrs)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// unconditional permissions take the fast path
+	permit, err = r.IsPermitWithContext(system, uid_common, write, nil)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// conditions are inherited and follow renamed permissions
+	assert.Nil(t, r.RegisterRole(system, "cashier", ""))
+	assert.Nil(t, r.AddParentsToRole(system, "cashier", common))
+	assert.Nil(t, r.RegisterUser(system, "uid_cashier", "cashier"))
+	_, err = r.UpdatePermission(system, "refund", "order:refund")
+	assert.Nil(t, err)
+	attrs["region"] = "eu"
+	permit, err = r.IsPermitWithContext(system, "uid_cashier", "order:refund", attrs)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	role, err := r.GetRoleOfSystem(system, common)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Condition{{Permission: "order:refund", Expr: `amount < 1000 && region == user.region`}}, role.Conditions)
+
+	assert.Nil(t, r.RemoveConditionalPermission(system, common, "order:refund"))
+	permit, err = r.IsPermitWithContext(system, "uid_cashier", "order:refund", attrs)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+}
+
+func TestRBACDenied(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	assert.IsType(t, &ReferenceError{}, r.DenyPermissionsToRole(system, guest, "unknown"))
+	assert.Equal(t, db.ErrNotFound, r.DenyPermissionsToRole(system, "not_exist", write))
+	assert.Nil(t, r.RegisterRole(system, "suspended", ""))
+	assert.Nil(t, r.DenyPermissionsToRole(system, "suspended", write, manage))
+
+	permit, err := r.IsPermit(system, uid_admin, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// deny beats allow of other roles and whitelist
+	assert.Nil(t, r.AddRoles(system, uid_admin, "suspended"))
+	assert.Nil(t, r.AddToWhiteList(system, uid_admin, write))
+	for _, p := range []string{write, manage} {
+		permit, err = r.IsPermit(system, uid_admin, p)
+		assert.Nil(t, err)
+		assert.False(t, permit, p)
+	}
+	permit, err = r.IsPermit(system, uid_admin, read)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	role, err := r.GetRoleOfSystem(system, "suspended")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{write, manage}, role.Denied)
+
+	assert.Nil(t, r.RemoveDeniedPermissionFromRole(system, "suspended", manage))
+	permit, err = r.IsPermit(system, uid_admin, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+}
+
+func TestRBACSession(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// dynamic rules don't restrict assignments
+	assert.IsType(t, &ReferenceError{}, r.AddDynamicSoDRule(system, "approval", "", 0, common, "unknown"))
+	assert.Nil(t, r.AddDynamicSoDRule(system, "approval", "", 0, common, admin))
+	violations, err := r.AuditSoDRule(system, "approval")
+	assert.Nil(t, err)
+	assert.Equal(t, []SoDViolation{}, violations)
+	assert.Nil(t, r.AddRoles(system, uid_common, admin))
+	assert.Nil(t, r.RemoveRoles(system, uid_common, admin))
+
+	// roles must be assigned and may not violate dynamic rules
+	_, err = r.CreateSession(system, uid_admin, 0, common, admin)
+	assert.Equal(t, &SoDError{System: system, UID: uid_admin, Rule: "approval", Roles: []string{common, admin}, Cardinality: 2}, err)
+	_, err = r.CreateSession(system, uid_admin, 0, guest)
+	assert.Equal(t, &NotAssignedError{System: system, UID: uid_admin, Roles: []string{guest}}, err)
+	session, err := r.CreateSession(system, uid_admin, time.Hour, common)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{common}, session.Roles)
+	assert.True(t, session.ExpiresAt.After(time.Now().Add(59*time.Minute)))
+
+	// only active roles count
+	for permission, expected := range map[string]bool{read: true, write: true, manage: false} {
+		permit, err := r.IsPermitInSession(session.ID, permission)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, permit, permission)
+	}
+	assert.IsType(t, &SoDError{}, r.ActivateRole(session.ID, admin))
+	assert.IsType(t, &NotAssignedError{}, r.ActivateRole(session.ID, guest))
+	assert.Nil(t, r.DropRole(session.ID, common))
+	assert.Nil(t, r.ActivateRole(session.ID, admin))
+	session, err = r.GetSession(session.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{admin}, session.Roles)
+	permit, err := r.IsPermitInSession(session.ID, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	// inherited roles may be activated, revoked roles no longer count
+	assert.Nil(t, r.RegisterRole(system, "senior", "", read))
+	assert.Nil(t, r.AddParentsToRole(system, "senior", guest))
+	assert.Nil(t, r.AddRoles(system, uid_admin, "senior"))
+	assert.Nil(t, r.ActivateRole(session.ID, guest))
+	assert.Nil(t, r.RemoveRoles(system, uid_admin, admin))
+	permit, err = r.IsPermitInSession(session.ID, manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// renamed and unregistered roles follow into sessions
+	_, err = r.UpdateRoleName(system, guest, "visitor")
+	assert.Nil(t, err)
+	session, err = r.GetSession(session.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{admin, "visitor"}, session.Roles)
+	permit, err = r.IsPermitInSession(session.ID, read)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	_, err = r.UnregisterRole(system, "visitor")
+	assert.Nil(t, err)
+	session, err = r.GetSession(session.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{admin}, session.Roles)
+	permit, err = r.IsPermitInSession(session.ID, read)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// deleted sessions are gone
+	assert.Nil(t, r.DeleteSession(session.ID))
+	_, err = r.GetSession(session.ID)
+	assert.Equal(t, cache.ErrSessionNotFound, err)
+	_, err = r.IsPermitInSession(session.ID, read)
+	assert.Equal(t, cache.ErrSessionNotFound, err)
+	assert.Equal(t, cache.ErrSessionNotFound, r.ActivateRole(session.ID, common))
+}
+
+func TestRBACSessionRedis(t *testing.T) {
+	// sessions need their own redis along with cached permissions
+	_, err := newSessionRedis(&RBACConfig{Redis: cache.DefaultConfig()})
+	assert.NotNil(t, err)
+	c, err := newSessionRedis(&RBACConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+	sessions := &cache.RedisConfig{Address: "localhost:6380"}
+	c, err = newSessionRedis(&RBACConfig{Redis: cache.DefaultConfig(), SessionRedis: sessions})
+	assert.Nil(t, err)
+	assert.Equal(t, sessions, c)
+
+	_, err = NewRBAC(&RBACConfig{Backend: BackendMemory, Redis: cache.DefaultConfig(), SessionRedis: cache.DefaultConfig()})
+	assert.NotNil(t, err)
+}
+
+func TestRBACDomains(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	assert.IsType(t, &ReferenceError{}, r.AddRolesInDomain(system, uid_guest, "org_a", "unknown"))
+	assert.IsType(t, &ReferenceError{}, r.AddToWhiteListInDomain(system, uid_guest, "org_a", "unknown"))
+	assert.Equal(t, db.ErrNotFound, r.AddRolesInDomain(system, "not_exist", "org_a", admin))
+	assert.Nil(t, r.AddRolesInDomain(system, uid_guest, "org_a", admin))
+	assert.Nil(t, r.AddToBlackListInDomain(system, uid_guest, "org_a", manage))
+	assert.Nil(t, r.AddToWhiteListInDomain(system, uid_guest, "org_b", write))
+
+	// entries within a domain add to global ones, those of other domains don't apply
+	for _, c := range []struct {
+		domain     string
+		permission string
+		expected   bool
+	}{
+		{"", read, true},
+		{"", write, false},
+		{"org_a", write, true},
+		{"org_a", manage, false},
+		{"org_b", write, true},
+		{"org_b", manage, false},
+		{"org_c", write, false},
+	} {
+		permit, err := r.IsPermitInDomain(system, uid_guest, c.domain, c.permission)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, permit, "%s %s", c.domain, c.permission)
+	}
+	domains, err := r.GetDomainsOfUser(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"org_a", "org_b"}, domains)
+
+	// constraints apply to roles held within domain
+	_, err = r.AddSoDRule(system, "exclusive", "", 0, guest, common)
+	assert.Nil(t, err)
+	assert.IsType(t, &SoDError{}, r.AddRolesInDomain(system, uid_guest, "org_b", common))
+
+	// holders within domains count towards max members once
+	assert.Nil(t, r.SetRoleConstraints(system, admin, 2))
+	assert.IsType(t, &MaxMembersError{}, r.AddRolesInDomain(system, uid_common, "org_a", admin))
+	assert.Nil(t, r.AddRolesInDomain(system, uid_admin, "org_a", admin))
+	report, err := r.ValidateConstraints(system)
+	assert.Nil(t, err)
+	assert.Empty(t, report.MaxMembers)
+	assert.Nil(t, r.SetRoleConstraints(system, admin, 1))
+	report, err = r.ValidateConstraints(system)
+	assert.Nil(t, err)
+	assert.Equal(t, []MaxMembersViolation{{Role: admin, MaxMembers: 1, UIDs: []string{uid_admin, uid_guest}}}, report.MaxMembers)
+
+	assert.Nil(t, r.RemoveRoleInDomain(system, uid_guest, "org_a", admin))
+	assert.Nil(t, r.RemoveFromWhiteListInDomain(system, uid_guest, "org_b", write))
+	for _, domain := range []string{"org_a", "org_b"} {
+		permit, err := r.IsPermitInDomain(system, uid_guest, domain, write)
+		assert.Nil(t, err)
+		assert.False(t, permit, domain)
+	}
+	domains, err = r.GetDomainsOfUser(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"org_a"}, domains)
+}
+
+func TestRBACSystem(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+	assert.Nil(t, r.AddParentsToRole(system, admin, common))
+	assert.Nil(t, r.RegisterGroup(system, "staff", "", admin))
+	assert.Nil(t, r.AddMembersToGroup(system, "staff", "uid_staff"))
+
+	assert.Equal(t, db.ErrNotFound, r.CloneSystem(system, "staging"))
+	assert.Nil(t, r.RegisterSystem(system, "question and answer", map[string]string{"env": "prod"}, "alice"))
+	assert.Equal(t, db.ErrAlreadyExists, r.RegisterSystem(system, "", nil))
+	assert.Nil(t, r.UpdateSystem(system, "q&a", map[string]string{"env": "prod"}, "alice", "bob"))
+	s, err := r.GetSystem(system)
+	assert.Nil(t, err)
+	assert.Equal(t, "q&a", s.Desc)
+	assert.Equal(t, []string{"alice", "bob"}, s.Owners)
+
+	// clone into staging, target must be unused
+	assert.Nil(t, r.RegisterRole("used", guest, "", read))
+	assert.Equal(t, db.ErrAlreadyExists, r.CloneSystem(system, "used"))
+	assert.Nil(t, r.CloneSystem(system, "staging"))
+	assert.Equal(t, db.ErrAlreadyExists, r.CloneSystem(system, "staging"))
+	systems, err := r.GetAllSystems()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(systems))
+	assert.Equal(t, "staging", systems[1].Name)
+	assert.Equal(t, map[string]string{"env": "prod"}, systems[1].Metadata)
+	for _, uid := range []string{uid_admin, "uid_staff"} {
+		permit, err := r.IsPermit("staging", uid, manage)
+		assert.Nil(t, err)
+		assert.True(t, permit, uid)
+	}
+	ancestors, err := r.GetAncestorsOfRole("staging", admin)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{common}, ancestors)
+
+	// delete system and its cached permissions and sessions, the clone is kept
+	permit, err := r.IsPermit(system, "uid_staff", manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	session, err := r.CreateSession(system, uid_admin, 0, admin)
+	assert.Nil(t, err)
+	kept, err := r.CreateSession("staging", uid_admin, 0, admin)
+	assert.Nil(t, err)
+	affected, err := r.DeleteSystem(system)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{uid_admin, uid_common, uid_guest}, affected.Users)
+	assert.Equal(t, []string{"staff"}, affected.Groups)
+	for _, uid := range []string{uid_admin, "uid_staff"} {
+		permit, err := r.IsPermit(system, uid, manage)
+		assert.Nil(t, err)
+		assert.False(t, permit, uid)
+	}
+	_, err = r.GetSystem(system)
+	assert.Equal(t, db.ErrNotFound, err)
+	permit, err = r.IsPermit("staging", uid_admin, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	_, err = r.GetSession(session.ID)
+	assert.Equal(t, cache.ErrSessionNotFound, err)
+	_, err = r.GetSession(kept.ID)
+	assert.Nil(t, err)
+
+	// failures of removing a partial copy are reported
+	r.Role, r.System = failingRoles{r.Role}, failingSystems{r.System}
+	err = r.CloneSystem("staging", "broken")
+	assert.IsType(t, &RollbackError{}, err)
+	assert.True(t, errors.Is(err, errCreateRole))
+	assert.Equal(t, "creating role failed, rolling back failed: removing system failed", err.Error())
+}
+
+var errCreateRole = errors.New("creating role failed")
+
+// failingRoles fail creating roles
+type failingRoles struct {
+	db.RoleStore
+}
+
+func (failingRoles) CreateRoleContext(ctx context.Context, role *model.Role) error {
+	return errCreateRole
+}
+
+// failingSystems fail removing systems
+type failingSystems struct {
+	db.SystemStore
+}
+
+func (failingSystems) RemoveSystemCascadeContext(ctx context.Context, name string) (db.Affected, error) {
+	return db.Affected{}, errors.New("removing system failed")
+}
+
+func TestRBACDefaultRoles(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory, Strict: true})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// unknown users are remembered until they're registered
+	permit, err := r.IsPermit(system, "visitor", read)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	assert.Nil(t, r.RegisterUser(system, "visitor", guest))
+	permit, err = r.IsPermit(system, "visitor", read)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+
+	assert.Equal(t, db.ErrNotFound, r.SetDefaultRoles(system, false, guest))
+	assert.Nil(t, r.RegisterSystem(system, "", nil))
+	assert.IsType(t, &ReferenceError{}, r.SetDefaultRoles(system, false, "unknown"))
+	assert.Nil(t, r.SetDefaultRoles(system, false, guest))
+	for _, c := range []struct {
+		permission string
+		expected   bool
+	}{
+		{read, true},
+		{write, false},
+	} {
+		permit, err := r.IsPermit(system, "stranger", c.permission)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, permit, c.permission)
+	}
+	_, err = r.GetUser(system, "stranger")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// description changes keep default roles, renamed roles are followed
+	assert.Nil(t, r.UpdateSystem(system, "q&a", nil))
+	_, err = r.UpdateRoleName(system, guest, "anonymous")
+	assert.Nil(t, err)
+	s, err := r.GetSystem(system)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"anonymous"}, s.DefaultRoles)
+
+	assert.Nil(t, r.SetDefaultRoles(system, true, "anonymous"))
+	permit, err = r.IsPermit(system, "newcomer", read)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	u, err := r.GetUser(system, "newcomer")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"anonymous"}, u.Roles)
+
+	// default roles are checked against constraints, so are users registered with them
+	assert.Nil(t, r.SetRoleConstraints(system, admin, 1, common))
+	err = r.SetDefaultRoles(system, true, admin)
+	assert.Equal(t, &PrerequisiteError{System: system, Role: admin, Missing: []string{common}}, err)
+	assert.IsType(t, &MaxMembersError{}, r.SetDefaultRoles(system, false, common, admin))
+	assert.Nil(t, r.SetDefaultRoles(system, true, common, admin))
+	_, err = r.IsPermit(system, "latecomer", manage)
+	assert.Equal(t, &MaxMembersError{System: system, Role: admin, MaxMembers: 1}, err)
+	_, err = r.GetUser(system, "latecomer")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// so are references of default roles in strict mode
+	s, err = r.GetSystem(system)
+	assert.Nil(t, err)
+	s.DefaultRoles = []string{"unknown"}
+	assert.Nil(t, r.System.UpdateSystemContext(context.Background(), &s))
+	_, err = r.IsPermit(system, "latecomer", read)
+	assert.IsType(t, &ReferenceError{}, err)
+	_, err = r.GetUser(system, "latecomer")
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func TestRBACProvenance(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// entries assigned without provenance only record the time
+	u, err := r.GetUser(system, uid_admin)
+	assert.Nil(t, err)
+	p, ok := u.ProvenanceOf(model.ListRoles, admin)
+	assert.True(t, ok)
+	assert.Empty(t, p.GrantedBy)
+	assert.False(t, p.GrantedAt.IsZero())
+
+	ctx := WithProvenance(context.Background(), model.Provenance{GrantedBy: "alice", Reason: "incident", Ticket: "OPS-42"})
+	assert.Nil(t, r.AddRolesContext(ctx, system, uid_guest, admin))
+	assert.Nil(t, r.AddToWhiteListContext(ctx, system, uid_guest, manage))
+	assert.Nil(t, r.AddToBlackListContext(ctx, system, uid_common, write))
+	u, err = r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	p, ok = u.ProvenanceOf(model.ListRoles, admin)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", p.GrantedBy)
+	assert.Equal(t, "incident", p.Reason)
+	assert.Equal(t, "OPS-42", p.Ticket)
+	_, ok = u.ProvenanceOf(model.ListWhiteList, manage)
+	assert.True(t, ok)
+	u, err = r.GetUser(system, uid_common)
+	assert.Nil(t, err)
+	p, ok = u.ProvenanceOf(model.ListBlackList, write)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", p.GrantedBy)
+
+	// replacing roles keeps provenance of those still held
+	ctx = WithProvenance(context.Background(), model.Provenance{GrantedBy: "bob"})
+	assert.Nil(t, r.UpdateRolesContext(ctx, system, uid_guest, admin, common))
+	assert.Nil(t, r.UpdateUserContext(ctx, system, uid_admin, admin))
+	u, err = r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	p, _ = u.ProvenanceOf(model.ListRoles, admin)
+	assert.Equal(t, "alice", p.GrantedBy)
+	p, _ = u.ProvenanceOf(model.ListRoles, common)
+	assert.Equal(t, "bob", p.GrantedBy)
+	assert.Len(t, u.RoleProvenance, 2)
+	u, err = r.GetUser(system, uid_admin)
+	assert.Nil(t, err)
+	assert.Len(t, u.RoleProvenance, 1)
+	p, _ = u.ProvenanceOf(model.ListRoles, admin)
+	assert.Empty(t, p.GrantedBy)
+
+	// removed entries lose their provenance
+	assert.Nil(t, r.RemoveRoles(system, uid_guest, admin))
+	u, err = r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Len(t, u.RoleProvenance, 1)
+	assert.Nil(t, r.AddRoles(system, uid_guest, admin))
+	u, err = r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	p, _ = u.ProvenanceOf(model.ListRoles, admin)
+	assert.Empty(t, p.GrantedBy)
+
+	// entries within single domains record provenance too, entries already held keep theirs
+	ctx = WithProvenance(context.Background(), model.Provenance{GrantedBy: "carol", Ticket: "OPS-7"})
+	assert.Nil(t, r.AddRolesInDomainContext(ctx, system, uid_guest, "org_a", guest))
+	assert.Nil(t, r.AddToWhiteListInDomainContext(ctx, system, uid_guest, "org_a", manage))
+	assert.Nil(t, r.AddToBlackListInDomainContext(ctx, system, uid_guest, "org_b", write))
+	assert.Nil(t, r.AddRolesInDomain(system, uid_guest, "org_a", guest))
+	u, err = r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	p, ok = u.ProvenanceInDomain("org_a", model.ListRoles, guest)
+	assert.True(t, ok)
+	assert.Equal(t, "carol", p.GrantedBy)
+	assert.Equal(t, "OPS-7", p.Ticket)
+	assert.False(t, p.GrantedAt.IsZero())
+	_, ok = u.ProvenanceInDomain("org_a", model.ListWhiteList, manage)
+	assert.True(t, ok)
+	p, ok = u.ProvenanceInDomain("org_b", model.ListBlackList, write)
+	assert.True(t, ok)
+	assert.Equal(t, "carol", p.GrantedBy)
+	_, ok = u.ProvenanceInDomain("org_b", model.ListRoles, guest)
+	assert.False(t, ok)
+
+	// replacing the whitelist keeps provenance of permissions still whitelisted
+	ctx = WithProvenance(context.Background(), model.Provenance{GrantedBy: "dave"})
+	assert.Nil(t, r.UpdateWhiteListContext(ctx, system, uid_guest, manage, read))
+	u, err = r.GetUser(system, uid_guest)
+	assert.Nil(t, err)
+	p, _ = u.ProvenanceOf(model.ListWhiteList, manage)
+	assert.Equal(t, "alice", p.GrantedBy)
+	p, _ = u.ProvenanceOf(model.ListWhiteList, read)
+	assert.Equal(t, "dave", p.GrantedBy)
+}
+
+func TestRBACDelegation(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{Backend: BackendMemory})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+
+	// delegates get roles of delegator, they needn't be registered
+	expires := time.Now().Add(time.Hour)
+	assert.Nil(t, r.Delegate(system, uid_admin, "uid_deputy", model.Period{ExpiresAt: &expires}, false, admin))
+	permit, err := r.IsPermit(system, "uid_deputy", manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	_, err = r.CreateSession(system, "uid_deputy", 0, admin)
+	assert.Nil(t, err)
+
+	// only roles held may be delegated
+	err = r.Delegate(system, uid_admin, "uid_deputy", model.Period{}, false, guest)
+	assert.Equal(t, &NotDelegableError{System: system, UID: uid_admin, Roles: []string{guest}}, err)
+	assert.Equal(t, model.ErrSelfDelegation, r.Delegate(system, uid_admin, uid_admin, model.Period{}, false, admin))
+	_, ok := r.Delegate(system, "uid_deputy", uid_guest, model.Period{}, false, admin).(*NotDelegableError)
+	assert.True(t, ok)
+
+	// transitive delegations may be delegated further
+	assert.Nil(t, r.Delegate(system, uid_admin, "uid_deputy", model.Period{}, true, admin))
+	assert.Nil(t, r.Delegate(system, "uid_deputy", uid_guest, model.Period{}, false, admin))
+	permit, err = r.IsPermit(system, uid_guest, manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	ds, err := r.GetDelegationsFrom(system, uid_admin)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ds))
+	assert.True(t, ds[0].Transitive)
+	assert.Nil(t, ds[0].ExpiresAt)
+	ds, err = r.GetDelegationsTo(system, uid_guest)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ds))
+	assert.Equal(t, "uid_deputy", ds[0].Delegator)
+
+	// delegations are revoked when delegator loses the role
+	assert.Nil(t, r.RemoveRoles(system, uid_admin, admin))
+	for _, uid := range []string{"uid_deputy", uid_guest} {
+		permit, err = r.IsPermit(system, uid, manage)
+		assert.Nil(t, err)
+		assert.False(t, permit, uid)
+		ds, err = r.GetDelegationsTo(system, uid)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(ds), uid)
+	}
+
+	// delegations are in effect within their period only
+	assert.Nil(t, r.AddRoles(system, uid_admin, admin))
+	from := time.Now().Add(time.Hour)
+	assert.Nil(t, r.Delegate(system, uid_admin, "uid_deputy", model.Period{ValidFrom: &from}, false, admin))
+	permit, err = r.IsPermit(system, "uid_deputy", manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+	expires = time.Now().Add(300 * time.Millisecond)
+	assert.Nil(t, r.Delegate(system, uid_admin, "uid_deputy", model.Period{ExpiresAt: &expires}, false, admin))
+	permit, err = r.IsPermit(system, "uid_deputy", manage)
+	assert.Nil(t, err)
+	assert.True(t, permit)
+	time.Sleep(time.Until(expires))
+	permit, err = r.IsPermit(system, "uid_deputy", manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// revoke delegation
+	assert.Nil(t, r.Delegate(system, uid_admin, "uid_deputy", model.Period{}, false, admin))
+	assert.Nil(t, r.Revoke(system, uid_admin, "uid_deputy"))
+	assert.Equal(t, db.ErrNotFound, r.Revoke(system, uid_admin, "uid_deputy"))
+	permit, err = r.IsPermit(system, "uid_deputy", manage)
+	assert.Nil(t, err)
+	assert.False(t, permit)
+
+	// delegated roles are checked against constraints of delegate
+	_, err = r.AddSoDRule(system, "payment", "", 2, guest, admin)
+	assert.Nil(t, err)
+	assert.IsType(t, &SoDError{}, r.Delegate(system, uid_admin, uid_guest, model.Period{}, false, admin))
+	assert.Nil(t, r.SetRoleConstraints(system, common, 0, guest))
+	err = r.Delegate(system, uid_admin, "uid_deputy", model.Period{}, false, common)
+	assert.Equal(t, &PrerequisiteError{System: system, UID: "uid_deputy", Role: common, Missing: []string{guest}}, err)
+	assert.Nil(t, r.SetRoleConstraints(system, admin, 1))
+	assert.IsType(t, &MaxMembersError{}, r.Delegate(system, uid_admin, "uid_deputy", model.Period{}, false, admin))
+	ds, err = r.GetDelegationsFrom(system, uid_admin)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ds))
+}
+
+func TestRBACWithSQLBackend(t *testing.T) {
+	r, err := NewRBAC(&RBACConfig{
+		Backend: BackendSQL,
+		SQL:     &sqlstore.Config{Driver: "sqlite", DSN: ":memory:"},
+	})
+	assert.Nil(t, err)
+	testRBAC(t, r)
+}
+
+func TestRBACWithBoltBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rbac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	r, err := NewRBAC(&RBACConfig{
+		Backend: BackendBolt,
+		Bolt:    &kvstore.BoltConfig{Path: filepath.Join(dir, "rbac.db")},
+	})
+	assert.Nil(t, err)
+	testRBAC(t, r)
+}
+
+func testRBAC(t *testing.T, rbac *RBAC) {
+	fillTestData(t, rbac)
 
 	// IsPermit
 	permit, err := rbac.IsPermit(system, uid_common, manage)
@@ -224,5 +1404,37 @@ func TestRBAC(t *testing.T) {
 	assert.Nil(t, err)
 	assert.False(t, permit)
 
-	clearTestData(t)
+	clearTestData(t, rbac)
+}
+
+// failingBackend fail dropping cached keys
+type failingBackend struct {
+	cache.Backend
+}
+
+func (failingBackend) DelContext(ctx context.Context, keys ...string) (bool, error) {
+	return false, errors.New("dropping keys failed")
+}
+
+func TestRBACCacheFailures(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	r, err := NewRBAC(&RBACConfig{Store: store})
+	assert.Nil(t, err)
+	fillTestData(t, r)
+	assert.Nil(t, r.RegisterSystem(system, "", nil))
+	assert.Nil(t, r.Delegate(system, uid_admin, "uid_deputy", model.Period{}, false, admin))
+	r.Cache = cache.NewPermissionDao(failingBackend{cache.NewMemory()}, store)
+
+	// failures to drop cached permissions are reported, the clone is removed again
+	assert.NotNil(t, r.Revoke(system, uid_admin, "uid_deputy"))
+	ds, err := r.GetDelegationsFrom(system, uid_admin)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ds))
+	assert.NotNil(t, r.CloneSystem(system, "staging"))
+	_, err = r.GetSystem("staging")
+	assert.Equal(t, db.ErrNotFound, err)
+	_, err = r.DeleteSystem(system)
+	assert.NotNil(t, err)
+	_, err = r.GetSystem(system)
+	assert.Equal(t, db.ErrNotFound, err)
 }
@@ -0,0 +1,190 @@
+package rbac
+
+import (
+	"context"
+	"time"
+
+	"github.com/nzqpeace/rbac/cache"
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// DefaultSessionTTL is lifetime of sessions created without one
+const DefaultSessionTTL = 30 * time.Minute
+
+// CreateSession create a session of user which expires after ttl, DefaultSessionTTL if ttl isn't positive.
+// roles are activated at once, they must be assigned to user directly, through groups or by delegation, or be
+// inherited by assigned ones, otherwise *NotAssignedError is returned. *SoDError is returned if they violate a
+// dynamic separation-of-duty rule
+func (r *RBAC) CreateSession(system, uid string, ttl time.Duration, roles ...string) (model.Session, error) {
+	return r.CreateSessionContext(context.Background(), system, uid, ttl, roles...)
+}
+
+// CreateSessionContext is CreateSession with context
+func (r *RBAC) CreateSessionContext(ctx context.Context, system, uid string, ttl time.Duration, roles ...string) (model.Session, error) {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	session := model.NewSession(system, uid, time.Now().Add(ttl))
+	if err := r.checkActivation(ctx, *session, roles); err != nil {
+		return model.Session{}, err
+	}
+
+	session.Roles = append(session.Roles, roles...)
+	if err := r.Session.CreateSessionContext(ctx, session); err != nil {
+		return model.Session{}, err
+	}
+	return *session, nil
+}
+
+// GetSession get specified session, cache.ErrSessionNotFound is returned if it doesn't exist or has expired
+func (r *RBAC) GetSession(id string) (model.Session, error) {
+	return r.GetSessionContext(context.Background(), id)
+}
+
+// GetSessionContext is GetSession with context
+func (r *RBAC) GetSessionContext(ctx context.Context, id string) (model.Session, error) {
+	return r.Session.GetSessionContext(ctx, id)
+}
+
+// DeleteSession remove specified session before it expires
+func (r *RBAC) DeleteSession(id string) error {
+	return r.DeleteSessionContext(context.Background(), id)
+}
+
+// DeleteSessionContext is DeleteSession with context
+func (r *RBAC) DeleteSessionContext(ctx context.Context, id string) error {
+	session, err := r.Session.GetSessionContext(ctx, id)
+	if err == cache.ErrSessionNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err = r.Session.RemoveSessionContext(ctx, id); err != nil {
+		return err
+	}
+	_, err = r.Cache.RemoveSessionContext(ctx, session)
+	return err
+}
+
+// ActivateRole activate role within session, it must be assigned to user of session as CreateSession requires.
+// *SoDError is returned if it would be active together with roles excluded by a dynamic separation-of-duty rule
+func (r *RBAC) ActivateRole(id, role string) error {
+	return r.ActivateRoleContext(context.Background(), id, role)
+}
+
+// ActivateRoleContext is ActivateRole with context
+func (r *RBAC) ActivateRoleContext(ctx context.Context, id, role string) error {
+	session, err := r.Session.GetSessionContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = r.checkActivation(ctx, session, []string{role}); err != nil {
+		return err
+	}
+	if err = r.Session.ActivateRolesContext(ctx, id, role); err != nil {
+		return err
+	}
+	_, err = r.Cache.RemoveSessionContext(ctx, session)
+	return err
+}
+
+// DropRole deactivate role within session, it's ignored if role isn't active
+func (r *RBAC) DropRole(id, role string) error {
+	return r.DropRoleContext(context.Background(), id, role)
+}
+
+// DropRoleContext is DropRole with context
+func (r *RBAC) DropRoleContext(ctx context.Context, id, role string) error {
+	session, err := r.Session.GetSessionContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = r.Session.DropRolesContext(ctx, id, role); err != nil {
+		return err
+	}
+	_, err = r.Cache.RemoveSessionContext(ctx, session)
+	return err
+}
+
+// IsPermitInSession check if user of session has specified permission through roles active within session,
+// whitelist and blacklist of user still apply. active roles which are no longer assigned to user don't
+// count, and roles assigned to user but not activated are ignored, groups' ones included. permissions of
+// session are cached until it expires, its active roles change or cached permissions of user are dropped
+func (r *RBAC) IsPermitInSession(id, permission string) (bool, error) {
+	return r.IsPermitInSessionContext(context.Background(), id, permission)
+}
+
+// IsPermitInSessionContext is IsPermitInSession with context
+func (r *RBAC) IsPermitInSessionContext(ctx context.Context, id, permission string) (bool, error) {
+	session, err := r.Session.GetSessionContext(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return r.Cache.IsPermitInSessionContext(ctx, session, permission)
+}
+
+// authorized return roles user may activate, see authorizedRoles
+func (r *RBAC) authorized(ctx context.Context, system, uid string) ([]string, error) {
+	roles, _, err := r.authorizedRoles(ctx, system, uid)
+	return roles, err
+}
+
+// authorizedRoles return roles user may activate, i.e. roles currently assigned to it, its groups or delegated to it
+// and all roles they inherit, together with the hierarchy of system
+func (r *RBAC) authorizedRoles(ctx context.Context, system, uid string) ([]string, hierarchy, error) {
+	u, err := r.User.GetUserPermModelContext(ctx, system, uid)
+	if err == db.ErrNotFound {
+		u, err = *model.NewUserPermModel(system, uid), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, err := r.Group.GetGroupsOfUserContext(ctx, system, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	delegated, err := r.Cache.DelegatedRolesContext(ctx, system, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, err := r.Role.GetAllRolesContext(ctx, system)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	assigned := append(u.EffectiveAt(time.Now()).Roles, delegated...)
+	for _, g := range groups {
+		assigned = append(assigned, g.Roles...)
+	}
+	h := newHierarchy(rs)
+	return h.expand(assigned), h, nil
+}
+
+// checkActivation return *NotAssignedError if any of roles may not be activated by user of session, or
+// *SoDError if roles active within session together with roles would violate a dynamic separation-of-duty
+// rule. roles inherited from active ones count as active
+func (r *RBAC) checkActivation(ctx context.Context, session model.Session, roles []string) error {
+	authorized, h, err := r.authorizedRoles(ctx, session.System, session.UID)
+	if err != nil {
+		return err
+	}
+	if m := missing(roles, authorized); len(m) > 0 {
+		return &NotAssignedError{System: session.System, UID: session.UID, Roles: m}
+	}
+
+	rules, err := r.Constraint.GetAllSoDRulesContext(ctx, session.System)
+	if err != nil {
+		return err
+	}
+	active := h.expand(append(append([]string{}, session.Roles...), roles...))
+	for _, rule := range rules {
+		if !rule.Dynamic {
+			continue
+		}
+		if v := rule.Violated(active); v != nil {
+			return &SoDError{System: session.System, UID: session.UID, Rule: rule.Name, Roles: v, Cardinality: rule.Cardinality}
+		}
+	}
+	return nil
+}
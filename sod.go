@@ -0,0 +1,149 @@
+package rbac
+
+import (
+	"context"
+	"sort"
+
+	"github.com/nzqpeace/rbac/model"
+)
+
+// SoDViolation is a user holding roles which are mutually exclusive by a separation-of-duty rule
+type SoDViolation struct {
+	Rule  string   `json:"rule"`
+	UID   string   `json:"uid"`
+	Roles []string `json:"roles"` // roles of rule held by user, inherited ones included
+}
+
+// AddSoDRule register a separation-of-duty rule, no user may hold cardinality or more of roles afterwards.
+// a zero cardinality means 2, i.e. roles are mutually exclusive. the rule is replaced if already exist.
+// users already violating the rule aren't changed, they are returned instead
+func (r *RBAC) AddSoDRule(system, name, desc string, cardinality int, roles ...string) ([]SoDViolation, error) {
+	return r.AddSoDRuleContext(context.Background(), system, name, desc, cardinality, roles...)
+}
+
+// AddSoDRuleContext is AddSoDRule with context
+func (r *RBAC) AddSoDRuleContext(ctx context.Context, system, name, desc string, cardinality int, roles ...string) ([]SoDViolation, error) {
+	if cardinality == 0 {
+		cardinality = 2
+	}
+	rule := model.NewSoDRule(system, name, desc, cardinality, roles...)
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return nil, err
+	}
+
+	if err := r.Constraint.CreateSoDRuleContext(ctx, rule); err != nil {
+		return nil, err
+	}
+	return r.AuditSoDRuleContext(ctx, system, name)
+}
+
+// AddDynamicSoDRule register a dynamic separation-of-duty rule, users may hold all of roles, but no session
+// may have cardinality or more of them active at once. a zero cardinality means 2. the rule is replaced if
+// already exist, it applies to roles activated afterwards
+func (r *RBAC) AddDynamicSoDRule(system, name, desc string, cardinality int, roles ...string) error {
+	return r.AddDynamicSoDRuleContext(context.Background(), system, name, desc, cardinality, roles...)
+}
+
+// AddDynamicSoDRuleContext is AddDynamicSoDRule with context
+func (r *RBAC) AddDynamicSoDRuleContext(ctx context.Context, system, name, desc string, cardinality int, roles ...string) error {
+	if cardinality == 0 {
+		cardinality = 2
+	}
+	rule := model.NewSoDRule(system, name, desc, cardinality, roles...)
+	rule.Dynamic = true
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	return r.Constraint.CreateSoDRuleContext(ctx, rule)
+}
+
+// RemoveSoDRule remove specified separation-of-duty rule
+func (r *RBAC) RemoveSoDRule(system, name string) error {
+	return r.RemoveSoDRuleContext(context.Background(), system, name)
+}
+
+// RemoveSoDRuleContext is RemoveSoDRule with context
+func (r *RBAC) RemoveSoDRuleContext(ctx context.Context, system, name string) error {
+	return r.Constraint.RemoveSoDRuleContext(ctx, system, name)
+}
+
+// GetSoDRule get specified separation-of-duty rule
+func (r *RBAC) GetSoDRule(system, name string) (model.SoDRule, error) {
+	return r.GetSoDRuleContext(context.Background(), system, name)
+}
+
+// GetSoDRuleContext is GetSoDRule with context
+func (r *RBAC) GetSoDRuleContext(ctx context.Context, system, name string) (model.SoDRule, error) {
+	return r.Constraint.GetSoDRuleContext(ctx, system, name)
+}
+
+// GetAllSoDRules get all separation-of-duty rules of specified system
+func (r *RBAC) GetAllSoDRules(system string) ([]model.SoDRule, error) {
+	return r.GetAllSoDRulesContext(context.Background(), system)
+}
+
+// GetAllSoDRulesContext is GetAllSoDRules with context
+func (r *RBAC) GetAllSoDRulesContext(ctx context.Context, system string) ([]model.SoDRule, error) {
+	return r.Constraint.GetAllSoDRulesContext(ctx, system)
+}
+
+// AuditSoDRule list users currently violating specified separation-of-duty rule, ordered by uid.
+// roles inherited by users, roles of their groups and roles delegated to them count as held.
+// users may hold all roles of a dynamic rule, so nobody violates it
+func (r *RBAC) AuditSoDRule(system, name string) ([]SoDViolation, error) {
+	return r.AuditSoDRuleContext(context.Background(), system, name)
+}
+
+// AuditSoDRuleContext is AuditSoDRule with context
+func (r *RBAC) AuditSoDRuleContext(ctx context.Context, system, name string) ([]SoDViolation, error) {
+	rule, err := r.Constraint.GetSoDRuleContext(ctx, system, name)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Dynamic {
+		return []SoDViolation{}, nil
+	}
+	rs, err := r.Role.GetAllRolesContext(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+
+	// users may hold roles of rule by inheriting them from any descendant
+	h := newHierarchy(rs)
+	candidates := []string{}
+	for _, role := range rule.Roles {
+		candidates = append(candidates, role)
+		candidates = append(candidates, h.descendants(role)...)
+	}
+	users, err := r.User.GetUsersWithRolesContext(ctx, system, candidates...)
+	if err != nil {
+		return nil, err
+	}
+	held, err := r.allIndirectRoles(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		held[u.UID] = append(held[u.UID], u.Roles...)
+	}
+
+	uids := []string{}
+	for uid := range held {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	violations := []SoDViolation{}
+	for _, uid := range uids {
+		if v := rule.Violated(h.expand(held[uid])); v != nil {
+			violations = append(violations, SoDViolation{Rule: name, UID: uid, Roles: v})
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,310 @@
+package rbac
+
+import (
+	"context"
+
+	"github.com/nzqpeace/rbac/db"
+	"github.com/nzqpeace/rbac/model"
+)
+
+// RegisterSystem register system with its owners and metadata, registering is optional for using a system
+// but required for cloning it
+func (r *RBAC) RegisterSystem(name, desc string, metadata map[string]string, owners ...string) error {
+	return r.RegisterSystemContext(context.Background(), name, desc, metadata, owners...)
+}
+
+// RegisterSystemContext is RegisterSystem with context, db.ErrAlreadyExists is returned if it's registered already
+func (r *RBAC) RegisterSystemContext(ctx context.Context, name, desc string, metadata map[string]string, owners ...string) error {
+	s := model.NewSystem(name, desc, owners...)
+	for k, v := range metadata {
+		s.Metadata[k] = v
+	}
+	return r.System.CreateSystemContext(ctx, s)
+}
+
+// UpdateSystem replace description, owners and metadata of registered system
+func (r *RBAC) UpdateSystem(name, desc string, metadata map[string]string, owners ...string) error {
+	return r.UpdateSystemContext(context.Background(), name, desc, metadata, owners...)
+}
+
+// UpdateSystemContext is UpdateSystem with context
+func (r *RBAC) UpdateSystemContext(ctx context.Context, name, desc string, metadata map[string]string, owners ...string) error {
+	s, err := r.System.GetSystemContext(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	u := model.NewSystem(name, desc, owners...)
+	for k, v := range metadata {
+		u.Metadata[k] = v
+	}
+	s.Desc, s.Owners, s.Metadata = u.Desc, u.Owners, u.Metadata
+	return r.System.UpdateSystemContext(ctx, &s)
+}
+
+// SetDefaultRoles replace roles held by users of registered system which aren't registered, e.g. "anonymous".
+// if autoRegister is true, such users are registered with them when their permissions are checked first
+func (r *RBAC) SetDefaultRoles(system string, autoRegister bool, roles ...string) error {
+	return r.SetDefaultRolesContext(context.Background(), system, autoRegister, roles...)
+}
+
+// SetDefaultRolesContext is SetDefaultRoles with context. *SoDError or *PrerequisiteError with an empty uid is
+// returned if roles violate a constraint by themselves, *MaxMembersError if any of them has max members and users
+// aren't registered automatically. users registered automatically are checked like RegisterUser, a check of their
+// permissions fails with the error of a violated constraint
+func (r *RBAC) SetDefaultRolesContext(ctx context.Context, system string, autoRegister bool, roles ...string) error {
+	if err := r.checkRoles(ctx, system, roles); err != nil {
+		return err
+	}
+	rs, err := r.checkHeld(ctx, system, "", nil, roles, roles)
+	if err != nil {
+		return err
+	}
+	for _, role := range rs {
+		// any number of users which aren't registered hold default roles
+		if !autoRegister && role.MaxMembers > 0 && contains(roles, role.Name) {
+			return &MaxMembersError{System: system, Role: role.Name, MaxMembers: role.MaxMembers}
+		}
+	}
+	s, err := r.System.GetSystemContext(ctx, system)
+	if err != nil {
+		return err
+	}
+
+	if roles == nil {
+		roles = []string{}
+	}
+	s.DefaultRoles, s.AutoRegister = roles, autoRegister
+	if err = r.System.UpdateSystemContext(ctx, &s); err != nil {
+		return err
+	}
+	// users which aren't registered are unknown, all of them may be cached
+	return r.Cache.ClearAllKeysContext(ctx)
+}
+
+// registerDefault register user with default roles of its system when its permissions are checked first unless
+// it's registered meanwhile, db.ErrAlreadyExists is returned then. *ReferenceError is returned in strict mode if
+// any of roles isn't registered, *SoDError, *PrerequisiteError or *MaxMembersError if roles violate a constraint
+func (r *RBAC) registerDefault(ctx context.Context, u *model.UserPermModel) error {
+	if err := r.checkRoles(ctx, u.System, u.Roles); err != nil {
+		return err
+	}
+	if err := r.checkConstraints(ctx, u.System, u.UID, nil, u.Roles); err != nil {
+		return err
+	}
+	return r.User.InsertUserPermModelContext(ctx, u)
+}
+
+// GetSystem get registered system
+func (r *RBAC) GetSystem(name string) (model.System, error) {
+	return r.GetSystemContext(context.Background(), name)
+}
+
+// GetSystemContext is GetSystem with context
+func (r *RBAC) GetSystemContext(ctx context.Context, name string) (model.System, error) {
+	return r.System.GetSystemContext(ctx, name)
+}
+
+// GetAllSystems list all registered systems
+func (r *RBAC) GetAllSystems() ([]model.System, error) {
+	return r.GetAllSystemsContext(context.Background())
+}
+
+// GetAllSystemsContext is GetAllSystems with context
+func (r *RBAC) GetAllSystemsContext(ctx context.Context) ([]model.System, error) {
+	return r.System.GetAllSystemsContext(ctx)
+}
+
+// DeleteSystem remove system together with all its permissions, roles, users, groups, rules and delegations, and drop
+// cached permissions and sessions of its users. it works for systems never registered too
+func (r *RBAC) DeleteSystem(name string) (db.Affected, error) {
+	return r.DeleteSystemContext(context.Background(), name)
+}
+
+// DeleteSystemContext is DeleteSystem with context
+func (r *RBAC) DeleteSystemContext(ctx context.Context, name string) (db.Affected, error) {
+	// members of groups and users holding default roles may have cached permissions without being registered
+	groups, err := r.Group.GetAllGroupsContext(ctx, name)
+	if err != nil {
+		return db.Affected{}, err
+	}
+	ds, err := r.Delegation.GetAllDelegationsContext(ctx, name)
+	if err != nil {
+		return db.Affected{}, err
+	}
+	s, err := r.System.GetSystemContext(ctx, name)
+	if err != nil && err != db.ErrNotFound {
+		return db.Affected{}, err
+	}
+
+	affected, err := r.System.RemoveSystemCascadeContext(ctx, name)
+	if err != nil {
+		return affected, err
+	}
+	if err = r.Session.RemoveSessionsOfSystemContext(ctx, name); err != nil {
+		return affected, err
+	}
+	if len(s.DefaultRoles) > 0 {
+		return affected, r.Cache.ClearAllKeysContext(ctx)
+	}
+	// cached permissions of all users are dropped even if dropping some fails, the first failure is returned
+	uids := append([]string{}, affected.Users...)
+	for _, g := range groups {
+		uids = append(uids, g.Members...)
+	}
+	for _, d := range ds {
+		uids = append(uids, d.Delegate)
+	}
+	for _, uid := range uids {
+		if _, e := r.Cache.RemoveUserContext(ctx, name, uid); e != nil && err == nil {
+			err = e
+		}
+	}
+	return affected, err
+}
+
+// CloneSystem copy registered system source together with all its permissions, roles, users, groups, rules and
+// delegations to target, e.g. for a staging environment
+func (r *RBAC) CloneSystem(source, target string) error {
+	return r.CloneSystemContext(context.Background(), source, target)
+}
+
+// CloneSystemContext is CloneSystem with context, db.ErrNotFound is returned if source isn't registered and
+// db.ErrAlreadyExists if target is registered or has any data. whatever was copied is removed again on failure,
+// *RollbackError wraps the error if removing fails too
+func (r *RBAC) CloneSystemContext(ctx context.Context, source, target string) error {
+	s, err := r.System.GetSystemContext(ctx, source)
+	if err != nil {
+		return err
+	}
+	if used, err := r.systemInUse(ctx, target); err != nil {
+		return err
+	} else if used {
+		return db.ErrAlreadyExists
+	}
+
+	clone := model.NewSystem(target, s.Desc, s.Owners...)
+	clone.Metadata, clone.DefaultRoles, clone.AutoRegister = s.Metadata, s.DefaultRoles, s.AutoRegister
+	if err = r.System.CreateSystemContext(ctx, clone); err != nil {
+		return err
+	}
+	if err = r.copySystem(ctx, source, target); err != nil {
+		if _, rerr := r.System.RemoveSystemCascadeContext(ctx, target); rerr != nil {
+			return &RollbackError{Err: err, RollbackErr: rerr}
+		}
+		return err
+	}
+	// users of target remembered as unknown get default roles now
+	if len(s.DefaultRoles) > 0 {
+		return r.Cache.ClearAllKeysContext(ctx)
+	}
+	return nil
+}
+
+// systemInUse report whether system is registered or has any permissions, roles, users, groups or delegations
+func (r *RBAC) systemInUse(ctx context.Context, system string) (bool, error) {
+	if _, err := r.System.GetSystemContext(ctx, system); err != db.ErrNotFound {
+		return err == nil, err
+	}
+
+	ps, err := r.Permission.GetAllPermissionsContext(ctx, system)
+	if err != nil || len(ps) > 0 {
+		return len(ps) > 0, err
+	}
+	roles, err := r.Role.GetAllRolesContext(ctx, system)
+	if err != nil || len(roles) > 0 {
+		return len(roles) > 0, err
+	}
+	users, err := r.User.GetAllUsersContext(ctx, system)
+	if err != nil || len(users) > 0 {
+		return len(users) > 0, err
+	}
+	groups, err := r.Group.GetAllGroupsContext(ctx, system)
+	if err != nil || len(groups) > 0 {
+		return len(groups) > 0, err
+	}
+	ds, err := r.Delegation.GetAllDelegationsContext(ctx, system)
+	return len(ds) > 0, err
+}
+
+// copySystem copy permissions, roles, users, groups, rules and delegations of source to target
+func (r *RBAC) copySystem(ctx context.Context, source, target string) error {
+	ps, err := r.Permission.GetAllPermissionsContext(ctx, source)
+	if err != nil {
+		return err
+	}
+	for _, p := range ps {
+		p.System = target
+		if err = r.Permission.CreatePermissionContext(ctx, &p); err != nil {
+			return err
+		}
+	}
+
+	roles, err := r.Role.GetAllRolesContext(ctx, source)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		role.System, role.Revision = target, 0
+		if err = r.Role.CreateRoleContext(ctx, &role); err != nil {
+			return err
+		}
+	}
+
+	users, err := r.User.GetAllUsersContext(ctx, source)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		u.System, u.Revision = target, 0
+		if err = r.User.CreateUserPermModelContext(ctx, &u); err != nil {
+			return err
+		}
+		// permissions of a previous system with the same name may be cached
+		if _, err = r.Cache.RemoveUserContext(ctx, target, u.UID); err != nil {
+			return err
+		}
+	}
+
+	groups, err := r.Group.GetAllGroupsContext(ctx, source)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		g.System, g.Revision = target, 0
+		if err = r.Group.CreateGroupContext(ctx, &g); err != nil {
+			return err
+		}
+		for _, uid := range g.Members {
+			if _, err = r.Cache.RemoveUserContext(ctx, target, uid); err != nil {
+				return err
+			}
+		}
+	}
+
+	rules, err := r.Constraint.GetAllSoDRulesContext(ctx, source)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		rule.System, rule.Revision = target, 0
+		if err = r.Constraint.CreateSoDRuleContext(ctx, &rule); err != nil {
+			return err
+		}
+	}
+
+	ds, err := r.Delegation.GetAllDelegationsContext(ctx, source)
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		d.System, d.Revision = target, 0
+		if err = r.Delegation.CreateDelegationContext(ctx, &d); err != nil {
+			return err
+		}
+		if _, err = r.Cache.RemoveUserContext(ctx, target, d.Delegate); err != nil {
+			return err
+		}
+	}
+	return nil
+}